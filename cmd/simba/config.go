@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configError is a problem in a configuration file, it points at the offending line
+type configError struct {
+	path string
+	line int
+	msg  string
+}
+
+// Error returns the problem prefixed with the file and line
+func (e *configError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.path, e.line, e.msg)
+}
+
+// configSetting is a server setting read from a configuration file, named after the flag it sets
+type configSetting struct {
+	flag  string
+	value string
+	line  int
+}
+
+// configShare is a share defined in a configuration file
+type configShare struct {
+	name string
+	spec shareSpec
+	line int
+}
+
+// config holds the settings and shares read from a configuration file
+type config struct {
+	settings []configSetting
+	shares   []configShare
+
+	// warnings lists the parameters that were ignored
+	warnings []*configError
+}
+
+// loadConfig reads the configuration file at path. Files named *.yaml or *.yml are read as YAML,
+// anything else as an smb.conf-style INI file.
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the file according to its format
+	var cfg *config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		cfg, err = parseYAMLConfig(data)
+	default:
+		cfg, err = parseINIConfig(data)
+	}
+	var ce *configError
+	if errors.As(err, &ce) {
+		ce.path = path
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Report the ignored parameters
+	for _, w := range cfg.warnings {
+		w.path = path
+		log.Print(w)
+	}
+	return cfg, nil
+}
+
+// apply sets the flags from the settings of the configuration and adds its shares.
+// Flags and shares given on the command line take precedence over the file.
+func (cfg *config) apply(path string, shares shareFlags) error {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	// Set the flags
+	for _, s := range cfg.settings {
+		if explicit[s.flag] {
+			continue
+		}
+		value, err := checkSetting(s.flag, s.value)
+		if err == nil {
+			err = flag.Set(s.flag, value)
+		}
+		if err != nil {
+			return &configError{path: path, line: s.line, msg: fmt.Sprintf("invalid value %q for %s: %v", s.value, s.flag, err)}
+		}
+	}
+
+	// Add the shares
+	for _, sh := range cfg.shares {
+		if _, ok := shares[sh.name]; ok {
+			continue
+		}
+		if sh.spec.path == "" {
+			return &configError{path: path, line: sh.line, msg: fmt.Sprintf("share %s has no path", sh.name)}
+		}
+		if _, mem, err := sh.spec.memory(); mem {
+			if err != nil {
+				return &configError{path: path, line: sh.line, msg: fmt.Sprintf("share %s: %v", sh.name, err)}
+			}
+		} else if fi, err := os.Stat(sh.spec.path); err != nil || !fi.IsDir() {
+			return &configError{path: path, line: sh.line, msg: fmt.Sprintf("share %s: %s is not a directory", sh.name, sh.spec.path)}
+		}
+		shares[sh.name] = sh.spec
+	}
+	return nil
+}
+
+// checkSetting validates the value of a setting beyond what its flag checks and returns
+// the value to set the flag to. Boolean settings accept yes, no, on and off as well.
+func checkSetting(name, value string) (string, error) {
+	if f := flag.Lookup(name); f != nil {
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			v, ok := parseConfigBool(value)
+			if !ok {
+				return "", errors.New("expected a boolean")
+			}
+			return strconv.FormatBool(v), nil
+		}
+	}
+
+	switch name {
+	case "listen":
+		if _, _, err := net.SplitHostPort(value); err != nil {
+			return "", err
+		}
+	case "workers", "max-message-size", "max-read-size", "max-write-size", "max-transact-size":
+		if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+			return "", errors.New("expected a positive number")
+		}
+	}
+	return value, nil
+}
+
+// parseConfigBool parses a boolean given as true, false, yes, no, on, off, 1 or 0
+func parseConfigBool(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, true
+	case "false", "no", "off", "0":
+		return false, true
+	default:
+		return false, false
+	}
+}
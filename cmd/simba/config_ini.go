@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// iniGlobalSettings maps the smb.conf parameters of [global] taken over as they are to the flags they set.
+// Parameter names are compared without case, spaces and underscores, like Samba does.
+var iniGlobalSettings = map[string]string{
+	"netbiosname":         "netbios-name",
+	"workgroup":           "workgroup",
+	"smb2maxread":         "max-read-size",
+	"smb2maxwrite":        "max-write-size",
+	"smb2maxtrans":        "max-transact-size",
+	"guestaccount":        "guest-account",
+	"dedicatedkeytabfile": "keytab",
+	"logfile":             "log-file",
+}
+
+// iniIgnoredSections are the special Samba sections simba has no equivalent for
+var iniIgnoredSections = map[string]bool{
+	"homes":    true,
+	"printers": true,
+	"print$":   true,
+}
+
+// parseINIConfig parses an smb.conf-style configuration. [global] holds the server settings,
+// every other section defines a share. As in Samba, shares are read-only unless made writable.
+// Parameters simba does not support are ignored with a warning.
+func parseINIConfig(data []byte) (*config, error) {
+	cfg := &config{}
+	var share *configShare
+	section := ""
+	skip := false
+	seen := make(map[string]bool)
+	shareNames := make(map[string]bool)
+
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		num := i + 1
+		line := strings.TrimSpace(lines[i])
+
+		// A trailing backslash continues the line
+		for strings.HasSuffix(line, `\`) && i+1 < len(lines) {
+			i++
+			line = strings.TrimSpace(line[:len(line)-1]) + " " + strings.TrimSpace(lines[i])
+		}
+
+		// Skip blank lines and comments
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		// Start a section
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, &configError{line: num, msg: "unterminated section header"}
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" {
+				return nil, &configError{line: num, msg: "empty section name"}
+			}
+			if share != nil {
+				cfg.shares = append(cfg.shares, *share)
+				share = nil
+			}
+			section = strings.ToLower(name)
+			seen = make(map[string]bool)
+			skip = iniIgnoredSections[section]
+			switch {
+			case skip:
+				cfg.warnings = append(cfg.warnings, &configError{line: num, msg: fmt.Sprintf("ignoring unsupported section [%s]", name)})
+			case section != "global":
+				if shareNames[section] {
+					return nil, &configError{line: num, msg: fmt.Sprintf("duplicate share [%s]", name)}
+				}
+				shareNames[section] = true
+				share = &configShare{name: name, line: num, spec: shareSpec{readOnly: true}}
+			}
+			continue
+		}
+
+		// Parse the parameter
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, &configError{line: num, msg: "expected parameter = value"}
+		}
+		param := iniParameter(key)
+		value = strings.TrimSpace(value)
+		if section == "" {
+			return nil, &configError{line: num, msg: "parameter outside of a section"}
+		}
+		if skip {
+			continue
+		}
+		if seen[param] {
+			return nil, &configError{line: num, msg: fmt.Sprintf("duplicate parameter %q", strings.TrimSpace(key))}
+		}
+		seen[param] = true
+
+		var err error
+		if share == nil {
+			err = cfg.iniGlobal(param, strings.TrimSpace(key), value, num)
+		} else {
+			err = cfg.iniShare(share, param, strings.TrimSpace(key), value, num)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if share != nil {
+		cfg.shares = append(cfg.shares, *share)
+	}
+	return cfg, nil
+}
+
+// iniParameter normalizes a parameter name, Samba ignores case, spaces and underscores
+func iniParameter(key string) string {
+	return strings.NewReplacer(" ", "", "\t", "", "_", "").Replace(strings.ToLower(key))
+}
+
+// iniGlobal adds a parameter of the [global] section
+func (cfg *config) iniGlobal(param, key, value string, line int) error {
+	setting := configSetting{value: value, line: line}
+	invalid := &configError{line: line, msg: fmt.Sprintf("invalid value %q for %s", value, key)}
+
+	if name, ok := iniGlobalSettings[param]; ok {
+		setting.flag = name
+		cfg.settings = append(cfg.settings, setting)
+		return nil
+	}
+
+	switch param {
+	case "smbports":
+		// The server listens on the first port
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			return invalid
+		}
+		if _, err := strconv.ParseUint(fields[0], 10, 16); err != nil {
+			return invalid
+		}
+		setting.flag, setting.value = "listen", ":"+fields[0]
+	case "deadtime":
+		// Samba counts minutes, zero disables the timeout
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes < 0 {
+			return invalid
+		}
+		setting.flag, setting.value = "idle-timeout", strconv.Itoa(minutes)+"m"
+	case "serversigning":
+		switch strings.ToLower(value) {
+		case "mandatory", "required":
+			setting.value = "true"
+		case "auto", "default", "if_required", "disabled", "off", "no":
+			setting.value = "false"
+		default:
+			return invalid
+		}
+		setting.flag = "signing-required"
+	case "smbencrypt", "serversmbencrypt":
+		required, ok := iniEncrypt(value)
+		if !ok {
+			return invalid
+		}
+		setting.flag, setting.value = "encrypt", strconv.FormatBool(required)
+	case "maptoguest":
+		setting.flag, setting.value = "map-to-guest", strings.ReplaceAll(strings.ToLower(value), " ", "-")
+	case "restrictanonymous":
+		// Anonymous logons are allowed unless restricted
+		level, err := strconv.Atoi(value)
+		if err != nil || level < 0 || level > 2 {
+			return invalid
+		}
+		setting.flag, setting.value = "null-sessions", strconv.FormatBool(level == 0)
+	case "passdbbackend":
+		// Only the simba user file is supported, given as file:path
+		backend, path, _ := strings.Cut(value, ":")
+		if backend != "file" || path == "" {
+			return &configError{line: line, msg: fmt.Sprintf("unsupported passdb backend %q, expected file:path", value)}
+		}
+		setting.flag, setting.value = "users", path
+	default:
+		cfg.warnings = append(cfg.warnings, &configError{line: line, msg: fmt.Sprintf("ignoring unsupported parameter %q", key)})
+		return nil
+	}
+	cfg.settings = append(cfg.settings, setting)
+	return nil
+}
+
+// iniShare adds a parameter of a share section
+func (cfg *config) iniShare(share *configShare, param, key, value string, line int) error {
+	invalid := &configError{line: line, msg: fmt.Sprintf("invalid value %q for %s", value, key)}
+
+	switch param {
+	case "path", "directory":
+		share.spec.path = value
+	case "readonly":
+		readOnly, ok := parseConfigBool(value)
+		if !ok {
+			return invalid
+		}
+		share.spec.readOnly = readOnly
+	case "writable", "writeable", "writeok":
+		writable, ok := parseConfigBool(value)
+		if !ok {
+			return invalid
+		}
+		share.spec.readOnly = !writable
+	case "guestok", "public":
+		// Guests may write where the share is writable
+		guest, ok := parseConfigBool(value)
+		if !ok {
+			return invalid
+		}
+		share.spec.guest, share.spec.guestWrite = guest, guest
+	case "smbencrypt", "serversmbencrypt":
+		required, ok := iniEncrypt(value)
+		if !ok {
+			return invalid
+		}
+		share.spec.encrypt = required
+	case "validusers":
+		// Groups are written @group, +group or &group
+		share.spec.validUsers = nil
+		for _, name := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			if name[0] == '+' || name[0] == '&' {
+				name = "@" + strings.TrimLeft(name, "@+&")
+			}
+			share.spec.validUsers = append(share.spec.validUsers, name)
+		}
+	case "comment":
+	default:
+		cfg.warnings = append(cfg.warnings, &configError{line: line, msg: fmt.Sprintf("ignoring unsupported parameter %q of share [%s]", key, share.name)})
+	}
+	return nil
+}
+
+// iniEncrypt parses an smb encrypt value, only required and its synonyms make encryption mandatory
+func iniEncrypt(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "required", "mandatory", "force":
+		return true, true
+	case "off", "disabled", "no", "false", "auto", "default", "desired", "if_required", "enabled", "yes", "true":
+		return false, true
+	default:
+		return false, false
+	}
+}
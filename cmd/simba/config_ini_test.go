@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseINIConfig(t *testing.T) {
+	conf := `# smb.conf taken over from Samba
+[global]
+   netbios name = FILESERVER
+   workgroup = EXAMPLE
+   smb ports = 4445 139
+   deadtime = 15
+   server signing = mandatory
+   server smb encrypt = desired
+   map to guest = Bad User
+   restrict anonymous = 2
+   passdb backend = file:/etc/simba/users
+   load printers = no
+
+[homes]
+   browseable = no
+
+[Public]
+   path = /srv/public
+   guest ok = yes
+   comment = everyone
+
+; a writable share split over two lines
+[team]
+   path = /srv/team
+   writable = yes
+   valid users = alice, @staff \
+                 +admins
+   smb encrypt = required
+   veto files = /*.tmp/
+`
+	cfg, err := parseINIConfig([]byte(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := []configSetting{
+		{flag: "netbios-name", value: "FILESERVER", line: 3},
+		{flag: "workgroup", value: "EXAMPLE", line: 4},
+		{flag: "listen", value: ":4445", line: 5},
+		{flag: "idle-timeout", value: "15m", line: 6},
+		{flag: "signing-required", value: "true", line: 7},
+		{flag: "encrypt", value: "false", line: 8},
+		{flag: "map-to-guest", value: "bad-user", line: 9},
+		{flag: "null-sessions", value: "false", line: 10},
+		{flag: "users", value: "/etc/simba/users", line: 11},
+	}
+	if !reflect.DeepEqual(cfg.settings, settings) {
+		t.Errorf("settings = %+v, want %+v", cfg.settings, settings)
+	}
+
+	shares := []configShare{
+		{name: "Public", line: 17, spec: shareSpec{path: "/srv/public", readOnly: true, guest: true, guestWrite: true}},
+		{name: "team", line: 23, spec: shareSpec{path: "/srv/team", encrypt: true, validUsers: []string{"alice", "@staff", "@admins"}}},
+	}
+	if !reflect.DeepEqual(cfg.shares, shares) {
+		t.Errorf("shares = %+v, want %+v", cfg.shares, shares)
+	}
+
+	var warnings []string
+	for _, w := range cfg.warnings {
+		warnings = append(warnings, w.Error())
+	}
+	want := []string{
+		`:12: ignoring unsupported parameter "load printers"`,
+		`:14: ignoring unsupported section [homes]`,
+		`:29: ignoring unsupported parameter "veto files" of share [team]`,
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings = %q, want %q", warnings, want)
+	}
+}
+
+func TestParseINIConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ini  string
+		line int
+		msg  string
+	}{
+		{name: "parameter outside of a section", ini: "# top\nworkgroup = EXAMPLE\n", line: 2, msg: "outside of a section"},
+		{name: "unterminated section", ini: "[global\n", line: 1, msg: "unterminated section header"},
+		{name: "empty section", ini: "[global]\n[ ]\n", line: 2, msg: "empty section name"},
+		{name: "missing equals", ini: "[global]\nworkgroup EXAMPLE\n", line: 2, msg: "expected parameter = value"},
+		{name: "duplicate parameter", ini: "[global]\nworkgroup = A\nWork_Group = B\n", line: 3, msg: `duplicate parameter "Work_Group"`},
+		{name: "duplicate share", ini: "[data]\npath = /a\n[Data]\npath = /b\n", line: 3, msg: "duplicate share [Data]"},
+		{name: "invalid port", ini: "[global]\nsmb ports = http\n", line: 2, msg: `invalid value "http"`},
+		{name: "invalid deadtime", ini: "[global]\ndeadtime = -1\n", line: 2, msg: `invalid value "-1"`},
+		{name: "invalid signing", ini: "[global]\nserver signing = sometimes\n", line: 2, msg: `invalid value "sometimes"`},
+		{name: "invalid restrict anonymous", ini: "[global]\nrestrict anonymous = 3\n", line: 2, msg: `invalid value "3"`},
+		{name: "unsupported passdb backend", ini: "[global]\npassdb backend = tdbsam\n", line: 2, msg: "unsupported passdb backend"},
+		{name: "invalid boolean", ini: "[data]\npath = /a\nread only = perhaps\n", line: 3, msg: `invalid value "perhaps"`},
+		{name: "invalid encryption", ini: "[data]\nsmb encrypt = always\n", line: 2, msg: `invalid value "always"`},
+		{name: "continued line", ini: "[global]\nworkgroup = A \\\n  B\ndeadtime = x\n", line: 4, msg: `invalid value "x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseINIConfig([]byte(tt.ini))
+			var ce *configError
+			if !errors.As(err, &ce) {
+				t.Fatalf("error = %v, want a configuration error", err)
+			}
+			if ce.line != tt.line || !strings.Contains(ce.msg, tt.msg) {
+				t.Errorf("error at line %d: %s, want line %d: %s", ce.line, ce.msg, tt.line, tt.msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// yamlKind is the kind of a YAML node
+type yamlKind int
+
+const (
+	// yamlScalar is a single value, an empty value stands for null
+	yamlScalar yamlKind = iota
+
+	// yamlSequence is a list of nodes
+	yamlSequence
+
+	// yamlMapping maps keys to nodes
+	yamlMapping
+)
+
+// yamlNode is a node of a YAML document. line is the line of the key or sequence item holding it.
+type yamlNode struct {
+	kind  yamlKind
+	line  int
+	value string
+	items []*yamlNode
+
+	// keys lists the keys of a mapping in document order
+	keys   []string
+	fields map[string]*yamlNode
+}
+
+// yamlLine is a line of a YAML document without its indentation and comment
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// yamlSettings maps the settings of every section of a YAML configuration to the flags they set
+var yamlSettings = map[string]map[string]string{
+	"global": {
+		"listen":             "listen",
+		"netbios-name":       "netbios-name",
+		"workgroup":          "workgroup",
+		"max-message-size":   "max-message-size",
+		"max-read-size":      "max-read-size",
+		"max-write-size":     "max-write-size",
+		"max-transact-size":  "max-transact-size",
+		"idle-timeout":       "idle-timeout",
+		"workers":            "workers",
+		"shutdown-timeout":   "shutdown-timeout",
+		"signing-required":   "signing-required",
+		"encrypt":            "encrypt",
+		"compress":           "compress",
+		"compress-threshold": "compress-threshold",
+	},
+	"auth": {
+		"users":         "users",
+		"users-file":    "users",
+		"keytab":        "keytab",
+		"guest-account": "guest-account",
+		"map-to-guest":  "map-to-guest",
+		"null-sessions": "null-sessions",
+	},
+	"logging": {
+		"file": "log-file",
+	},
+}
+
+// parseYAMLConfig parses a YAML configuration. The global, auth and logging sections hold settings,
+// the shares section maps share names to their options:
+//
+//	global:
+//	  netbios_name: FILESERVER
+//	  workgroup: EXAMPLE
+//	auth:
+//	  backend: file
+//	  users_file: /etc/simba/users
+//	shares:
+//	  public:
+//	    path: /srv/public
+//	    read_only: true
+//	    guest: read-only
+//	    valid_users: [alice, "@staff"]
+//	  scratch:
+//	    path: mem:512M
+func parseYAMLConfig(data []byte) (*config, error) {
+	root, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	if root.kind != yamlMapping {
+		return nil, &configError{line: root.line, msg: "expected a mapping of sections"}
+	}
+
+	cfg := &config{}
+	for _, section := range root.keys {
+		node := root.fields[section]
+		if node.kind == yamlScalar && node.value == "" {
+			continue
+		}
+		if node.kind != yamlMapping {
+			return nil, &configError{line: node.line, msg: fmt.Sprintf("section %s must be a mapping", section)}
+		}
+
+		switch section {
+		case "global", "auth", "logging":
+			for _, key := range node.keys {
+				value := node.fields[key]
+				name := yamlKey(key)
+				if value.kind != yamlScalar {
+					return nil, &configError{line: value.line, msg: fmt.Sprintf("%s.%s must be a single value", section, key)}
+				}
+
+				// Users are looked up in the user file, there is no other backend
+				if section == "auth" && name == "backend" {
+					if value.value != "file" {
+						return nil, &configError{line: value.line, msg: fmt.Sprintf("unsupported auth backend %q, expected file", value.value)}
+					}
+					continue
+				}
+
+				flagName, ok := yamlSettings[section][name]
+				if !ok {
+					return nil, &configError{line: value.line, msg: fmt.Sprintf("unknown setting %s.%s", section, key)}
+				}
+				cfg.settings = append(cfg.settings, configSetting{flag: flagName, value: value.value, line: value.line})
+			}
+		case "shares":
+			for _, name := range node.keys {
+				share, err := yamlShare(name, node.fields[name])
+				if err != nil {
+					return nil, err
+				}
+				cfg.shares = append(cfg.shares, share)
+			}
+		default:
+			return nil, &configError{line: node.line, msg: fmt.Sprintf("unknown section %s", section)}
+		}
+	}
+	return cfg, nil
+}
+
+// yamlShare reads the options of a share. guest is no, read-only or read-write, a boolean admits
+// guests read-only. valid_users is a list or a comma separated string of users and @groups.
+func yamlShare(name string, node *yamlNode) (configShare, error) {
+	share := configShare{name: name, line: node.line}
+	if node.kind != yamlMapping {
+		return share, &configError{line: node.line, msg: fmt.Sprintf("share %s must be a mapping", name)}
+	}
+
+	for _, key := range node.keys {
+		value := node.fields[key]
+		option := yamlKey(key)
+
+		// Only the valid users may be a list
+		if option == "valid-users" {
+			users, err := yamlStrings(value)
+			if err != nil {
+				return share, err
+			}
+			share.spec.validUsers = users
+			continue
+		}
+		if value.kind != yamlScalar {
+			return share, &configError{line: value.line, msg: fmt.Sprintf("%s of share %s must be a single value", key, name)}
+		}
+
+		var ok bool
+		switch option {
+		case "path":
+			share.spec.path, ok = value.value, value.value != ""
+		case "read-only":
+			share.spec.readOnly, ok = parseConfigBool(value.value)
+		case "encrypt":
+			share.spec.encrypt, ok = parseConfigBool(value.value)
+		case "guest":
+			ok = true
+			switch strings.ToLower(value.value) {
+			case "read-only":
+				share.spec.guest = true
+			case "read-write":
+				share.spec.guest, share.spec.guestWrite = true, true
+			default:
+				share.spec.guest, ok = parseConfigBool(value.value)
+			}
+		case "comment":
+			ok = true
+		default:
+			return share, &configError{line: value.line, msg: fmt.Sprintf("unknown option %s of share %s", key, name)}
+		}
+		if !ok {
+			return share, &configError{line: value.line, msg: fmt.Sprintf("invalid value %q for %s of share %s", value.value, key, name)}
+		}
+	}
+	return share, nil
+}
+
+// yamlKey normalizes a setting name, underscores and dashes are interchangeable
+func yamlKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// yamlStrings reads a list of strings given as a sequence of scalars or a comma separated scalar
+func yamlStrings(node *yamlNode) ([]string, error) {
+	var values []string
+	switch node.kind {
+	case yamlScalar:
+		for _, v := range strings.Split(node.value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	case yamlSequence:
+		for _, item := range node.items {
+			if item.kind != yamlScalar {
+				return nil, &configError{line: item.line, msg: "expected a list of values"}
+			}
+			values = append(values, item.value)
+		}
+	default:
+		return nil, &configError{line: node.line, msg: "expected a list of values"}
+	}
+	return values, nil
+}
+
+// parseYAML parses the subset of YAML used by configuration files: block mappings and sequences,
+// flow sequences of scalars and plain or quoted scalars. Flow mappings, multi-line scalars,
+// anchors, tags and multiple documents are not supported.
+func parseYAML(data []byte) (*yamlNode, error) {
+	// Split the document into lines, dropping comments and blank lines
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		text := strings.TrimLeft(raw, " \t")
+		if strings.Contains(raw[:len(raw)-len(text)], "\t") {
+			return nil, &configError{line: i + 1, msg: "tabs cannot be used for indentation"}
+		}
+		text = strings.TrimSpace(stripYAMLComment(text))
+		if text == "" || text == "---" {
+			continue
+		}
+		if text == "..." {
+			break
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(raw) - len(strings.TrimLeft(raw, " ")), text: text})
+	}
+	if len(lines) == 0 {
+		return &yamlNode{kind: yamlMapping, line: 1, fields: make(map[string]*yamlNode)}, nil
+	}
+
+	// Parse the top level block, it must span the whole document
+	p := &yamlParser{lines: lines}
+	root, err := p.parseBlock(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(lines) {
+		return nil, &configError{line: lines[p.pos].num, msg: "unexpected indentation"}
+	}
+	return root, nil
+}
+
+// yamlParser parses the blocks of a YAML document
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseBlock parses the mapping or sequence starting at the current line
+func (p *yamlParser) parseBlock(indent int) (*yamlNode, error) {
+	if isYAMLSequenceItem(p.lines[p.pos].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+// parseNested parses the block nested under a line, a null scalar if there is none
+func (p *yamlParser) parseNested(parent yamlLine) (*yamlNode, error) {
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > parent.indent {
+		return p.parseBlock(p.lines[p.pos].indent)
+	}
+	return &yamlNode{kind: yamlScalar, line: parent.num}, nil
+}
+
+// parseMapping parses the key: value lines at an indentation
+func (p *yamlParser) parseMapping(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlMapping, line: p.lines[p.pos].num, fields: make(map[string]*yamlNode)}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, &configError{line: l.num, msg: "unexpected indentation"}
+		}
+		key, value, err := splitYAMLKey(l)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := node.fields[key]; ok {
+			return nil, &configError{line: l.num, msg: fmt.Sprintf("duplicate key %s", key)}
+		}
+		p.pos++
+
+		// The value follows the key, or the block nested under it. A sequence may be at the indentation of its key.
+		var child *yamlNode
+		switch {
+		case value != "":
+			child, err = parseYAMLValue(value, l.num)
+		case p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLSequenceItem(p.lines[p.pos].text):
+			child, err = p.parseSequence(indent)
+		default:
+			child, err = p.parseNested(l)
+		}
+		if err != nil {
+			return nil, err
+		}
+		child.line = l.num
+		node.keys = append(node.keys, key)
+		node.fields[key] = child
+	}
+	return node, nil
+}
+
+// parseSequence parses the - item lines at an indentation
+func (p *yamlParser) parseSequence(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlSequence, line: p.lines[p.pos].num}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent || !isYAMLSequenceItem(l.text) {
+			return nil, &configError{line: l.num, msg: "expected a sequence item"}
+		}
+		p.pos++
+
+		// The item follows the dash, or is the block nested under it
+		var item *yamlNode
+		var err error
+		if rest := strings.TrimSpace(l.text[1:]); rest != "" {
+			if _, _, err := splitYAMLKey(yamlLine{num: l.num, text: rest}); err == nil {
+				return nil, &configError{line: l.num, msg: "mappings in sequences are not supported"}
+			}
+			item, err = parseYAMLValue(rest, l.num)
+		} else {
+			item, err = p.parseNested(l)
+		}
+		if err != nil {
+			return nil, err
+		}
+		item.line = l.num
+		node.items = append(node.items, item)
+	}
+	return node, nil
+}
+
+// isYAMLSequenceItem reports whether a line starts a sequence item
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits a key: value line, the value is empty if a block follows
+func splitYAMLKey(l yamlLine) (string, string, error) {
+	text := l.text
+
+	// A quoted key ends with its closing quote
+	if text[0] == '"' || text[0] == '\'' {
+		end := yamlQuoteEnd(text)
+		if end < 0 || end+1 >= len(text) || text[end+1] != ':' {
+			return "", "", &configError{line: l.num, msg: "expected key: value"}
+		}
+		key, err := parseYAMLScalar(text[:end+1], l.num)
+		if err != nil {
+			return "", "", err
+		}
+		return key.value, strings.TrimSpace(text[end+2:]), nil
+	}
+
+	// A plain key ends with a colon followed by a space or the end of the line
+	if i := strings.Index(text, ": "); i > 0 {
+		return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+2:]), nil
+	}
+	if strings.HasSuffix(text, ":") && len(text) > 1 {
+		return strings.TrimSpace(text[:len(text)-1]), "", nil
+	}
+	return "", "", &configError{line: l.num, msg: "expected key: value"}
+}
+
+// parseYAMLValue parses the value following a key or a dash, a scalar or a flow sequence
+func parseYAMLValue(text string, line int) (*yamlNode, error) {
+	switch text[0] {
+	case '[':
+		if !strings.HasSuffix(text, "]") {
+			return nil, &configError{line: line, msg: "unterminated flow sequence"}
+		}
+		node := &yamlNode{kind: yamlSequence, line: line}
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		if inner == "" {
+			return node, nil
+		}
+		for _, part := range splitYAMLFlow(inner) {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				return nil, &configError{line: line, msg: "empty item in flow sequence"}
+			}
+			item, err := parseYAMLScalar(part, line)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+		}
+		return node, nil
+	case '{':
+		return nil, &configError{line: line, msg: "flow mappings are not supported"}
+	case '|', '>':
+		return nil, &configError{line: line, msg: "multi-line scalars are not supported"}
+	case '&', '*', '!':
+		return nil, &configError{line: line, msg: "anchors, aliases and tags are not supported"}
+	}
+	return parseYAMLScalar(text, line)
+}
+
+// parseYAMLScalar parses a plain, single-quoted or double-quoted scalar. ~ and null are empty.
+func parseYAMLScalar(text string, line int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlScalar, line: line}
+	switch text[0] {
+	case '\'':
+		if yamlQuoteEnd(text) != len(text)-1 {
+			return nil, &configError{line: line, msg: "malformed single-quoted string"}
+		}
+		node.value = strings.ReplaceAll(text[1:len(text)-1], "''", "'")
+	case '"':
+		if yamlQuoteEnd(text) != len(text)-1 {
+			return nil, &configError{line: line, msg: "malformed double-quoted string"}
+		}
+		value, ok := unquoteYAML(text[1 : len(text)-1])
+		if !ok {
+			return nil, &configError{line: line, msg: "invalid escape in double-quoted string"}
+		}
+		node.value = value
+	default:
+		if text != "~" && text != "null" {
+			node.value = text
+		}
+	}
+	return node, nil
+}
+
+// yamlEscapes maps the characters following a backslash in a double-quoted scalar to what they stand for
+var yamlEscapes = map[byte]string{
+	'0':  "\x00",
+	'a':  "\a",
+	'b':  "\b",
+	't':  "\t",
+	'\t': "\t",
+	'n':  "\n",
+	'v':  "\v",
+	'f':  "\f",
+	'r':  "\r",
+	'e':  "\x1b",
+	' ':  " ",
+	'"':  "\"",
+	'/':  "/",
+	'\\': "\\",
+	'N':  "\u0085",
+	'_':  "\u00a0",
+	'L':  "\u2028",
+	'P':  "\u2029",
+}
+
+// yamlCodePointEscapes maps the escapes of code points to the number of hex digits following them
+var yamlCodePointEscapes = map[byte]int{'x': 2, 'u': 4, 'U': 8}
+
+// unquoteYAML decodes the escapes of the inside of a double-quoted scalar following the YAML rules,
+// which differ from the ones of Go. It reports false for an unknown or truncated escape.
+func unquoteYAML(text string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' {
+			b.WriteByte(text[i])
+			continue
+		}
+		i++
+		if i == len(text) {
+			return "", false
+		}
+
+		// Decode a character escape
+		if s, ok := yamlEscapes[text[i]]; ok {
+			b.WriteString(s)
+			continue
+		}
+
+		// Decode a code point given in hex
+		n, ok := yamlCodePointEscapes[text[i]]
+		if !ok || i+n >= len(text) {
+			return "", false
+		}
+		r, err := strconv.ParseUint(text[i+1:i+1+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return "", false
+		}
+		b.WriteRune(rune(r))
+		i += n
+	}
+	return b.String(), true
+}
+
+// yamlQuoteEnd returns the index of the quote closing the string text starts with, or -1
+func yamlQuoteEnd(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case quote == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitYAMLFlow splits the items of a flow sequence at the commas outside of quotes
+func splitYAMLFlow(text string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"', '\'':
+			if end := yamlQuoteEnd(text[i:]); end > 0 {
+				i += end
+			}
+		case ',':
+			parts = append(parts, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, text[start:])
+}
+
+// stripYAMLComment removes a comment from a line, a # starts a comment at the start
+// of the line or after a space when it is not quoted
+func stripYAMLComment(text string) string {
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"', '\'':
+			// Quotes only start a string at the start of a value
+			if i == 0 || text[i-1] == ' ' || text[i-1] == '[' || text[i-1] == ',' {
+				if end := yamlQuoteEnd(text[i:]); end > 0 {
+					i += end
+				}
+			}
+		case '#':
+			if i == 0 || text[i-1] == ' ' || text[i-1] == '\t' {
+				return text[:i]
+			}
+		}
+	}
+	return text
+}
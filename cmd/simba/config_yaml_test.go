@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAMLConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		settings []configSetting
+		shares   []configShare
+	}{
+		{
+			name: "empty document",
+			yaml: "# nothing yet\n",
+		},
+		{
+			name: "settings",
+			yaml: `---
+global:
+  netbios_name: FILESERVER   # the name clients see
+  workgroup: "EXAMPLE"
+  max-read-size: 1048576
+auth:
+  backend: file
+  users_file: '/etc/simba/users'
+logging:
+  file: ~
+`,
+			settings: []configSetting{
+				{flag: "netbios-name", value: "FILESERVER", line: 3},
+				{flag: "workgroup", value: "EXAMPLE", line: 4},
+				{flag: "max-read-size", value: "1048576", line: 5},
+				{flag: "users", value: "/etc/simba/users", line: 8},
+				{flag: "log-file", value: "", line: 10},
+			},
+		},
+		{
+			name: "shares",
+			yaml: `shares:
+  public:
+    path: /srv/public
+    read_only: yes
+    guest: read-only
+    valid_users: [alice, "@staff", 'bob']
+  scratch:
+    path: mem:512M
+    guest: read-write
+    encrypt: true
+    valid_users:
+    - carol
+    - "@admins"
+  team:
+    path: "/srv/team #1"
+    valid_users: alice, bob
+    comment: it's the team share
+`,
+			shares: []configShare{
+				{name: "public", line: 2, spec: shareSpec{path: "/srv/public", readOnly: true, guest: true, validUsers: []string{"alice", "@staff", "bob"}}},
+				{name: "scratch", line: 7, spec: shareSpec{path: "mem:512M", guest: true, guestWrite: true, encrypt: true, validUsers: []string{"carol", "@admins"}}},
+				{name: "team", line: 14, spec: shareSpec{path: "/srv/team #1", validUsers: []string{"alice", "bob"}}},
+			},
+		},
+		{
+			name:     "section without settings",
+			yaml:     "global:\nshares:\n",
+			settings: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseYAMLConfig([]byte(tt.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg.settings, tt.settings) {
+				t.Errorf("settings = %+v, want %+v", cfg.settings, tt.settings)
+			}
+			if !reflect.DeepEqual(cfg.shares, tt.shares) {
+				t.Errorf("shares = %+v, want %+v", cfg.shares, tt.shares)
+			}
+		})
+	}
+}
+
+func TestParseYAMLConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		line int
+		msg  string
+	}{
+		{name: "tab indentation", yaml: "global:\n\tworkgroup: EXAMPLE\n", line: 2, msg: "tabs"},
+		{name: "top level list", yaml: "- global\n", line: 1, msg: "expected a mapping of sections"},
+		{name: "section as a value", yaml: "\nglobal: yes\n", line: 2, msg: "section global must be a mapping"},
+		{name: "unknown section", yaml: "global:\n  workgroup: EXAMPLE\nextras:\n  a: b\n", line: 3, msg: "unknown section extras"},
+		{name: "unknown setting", yaml: "global:\n  workgroup: EXAMPLE\n  color: blue\n", line: 3, msg: "unknown setting global.color"},
+		{name: "setting as a list", yaml: "global:\n  workgroup: [a, b]\n", line: 2, msg: "must be a single value"},
+		{name: "duplicate key", yaml: "global:\n  workgroup: A\n  workgroup: B\n", line: 3, msg: "duplicate key workgroup"},
+		{name: "bad indentation", yaml: "global:\n    workgroup: A\n  listen: :445\n", line: 3, msg: "unexpected indentation"},
+		{name: "missing colon", yaml: "global:\n  workgroup\n", line: 2, msg: "expected key: value"},
+		{name: "auth backend", yaml: "auth:\n  backend: ldap\n", line: 2, msg: "unsupported auth backend"},
+		{name: "share as a value", yaml: "shares:\n  public: /srv\n", line: 2, msg: "share public must be a mapping"},
+		{name: "unknown share option", yaml: "shares:\n  public:\n    path: /srv\n    browseable: no\n", line: 4, msg: "unknown option browseable"},
+		{name: "invalid boolean", yaml: "shares:\n  public:\n    read_only: maybe\n", line: 3, msg: `invalid value "maybe"`},
+		{name: "flow mapping", yaml: "global: {workgroup: A}\n", line: 1, msg: "flow mappings"},
+		{name: "block scalar", yaml: "shares:\n  public:\n    comment: |\n", line: 3, msg: "multi-line"},
+		{name: "anchor", yaml: "global: &defaults\n", line: 1, msg: "anchors"},
+		{name: "mapping in a sequence", yaml: "shares:\n  public:\n    valid_users:\n      - name: alice\n", line: 4, msg: "mappings in sequences"},
+		{name: "unterminated flow sequence", yaml: "shares:\n  public:\n    valid_users: [alice\n", line: 3, msg: "unterminated flow sequence"},
+		{name: "unterminated string", yaml: "global:\n  workgroup: \"EXAMPLE\n", line: 2, msg: "malformed double-quoted string"},
+		{name: "Go escape", yaml: "global:\n  workgroup: \"\\101\"\n", line: 2, msg: "invalid escape"},
+		{name: "Go quote escape", yaml: "global:\n  workgroup: \"it\\'s\"\n", line: 2, msg: "invalid escape"},
+		{name: "short hex escape", yaml: "global:\n  workgroup: \"\\u00\"\n", line: 2, msg: "invalid escape"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAMLConfig([]byte(tt.yaml))
+			var ce *configError
+			if !errors.As(err, &ce) {
+				t.Fatalf("error = %v, want a configuration error", err)
+			}
+			if ce.line != tt.line || !strings.Contains(ce.msg, tt.msg) {
+				t.Errorf("error at line %d: %s, want line %d: %s", ce.line, ce.msg, tt.line, tt.msg)
+			}
+		})
+	}
+}
+
+func TestUnquoteYAML(t *testing.T) {
+	tests := []struct {
+		quoted string
+		want   string
+		ok     bool
+	}{
+		{quoted: `plain`, want: "plain", ok: true},
+		{quoted: `a\/b`, want: "a/b", ok: true},
+		{quoted: `\e[0m`, want: "\x1b[0m", ok: true},
+		{quoted: `tab\tand\ space`, want: "tab\tand space", ok: true},
+		{quoted: `\"quoted\" \\ back`, want: `"quoted" \ back`, ok: true},
+		{quoted: `\0\a\b\n\v\f\r`, want: "\x00\a\b\n\v\f\r", ok: true},
+		{quoted: `\N\_\L\P`, want: "\u0085\u00a0\u2028\u2029", ok: true},
+		{quoted: `caf\xe9 \u00e9 \U0001F600`, want: "café é \U0001F600", ok: true},
+		{quoted: `\'`},
+		{quoted: `\101`},
+		{quoted: `\q`},
+		{quoted: `trailing\`},
+		{quoted: `\x4`},
+		{quoted: `\xZZ`},
+		{quoted: `\UFFFFFFFF`},
+		{quoted: `\uD800`},
+	}
+	for _, tt := range tests {
+		got, ok := unquoteYAML(tt.quoted)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("unquoteYAML(%q) = %q, %v, want %q, %v", tt.quoted, got, ok, tt.want, tt.ok)
+		}
+	}
+}
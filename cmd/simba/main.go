@@ -1,77 +1,194 @@
 package main
 
 import (
-	"net"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/yuriyvolkov/simba/pkg/krb5"
 	"github.com/yuriyvolkov/simba/pkg/smb"
 )
 
-// shareMap maps share names to directories on the local filesystem
-var shareMap = map[string]string{
-	"share1": "/path/to/share1",
-	"share2": "/path/to/share2",
-	// ...
-}
+var (
+	// configPath is the configuration file, flags given on the command line override it
+	configPath = flag.String("config", "", "configuration file, YAML if named *.yaml or *.yml and smb.conf-style otherwise")
+
+	// listenAddr is the TCP address the server listens on
+	listenAddr = flag.String("listen", ":445", "address to listen on")
+
+	// netbiosName and workgroup are the NetBIOS names of the server and its domain
+	netbiosName = flag.String("netbios-name", "", "NetBIOS name of the server, the host name if empty")
+	workgroup   = flag.String("workgroup", "", "NetBIOS domain or workgroup of the server, WORKGROUP if empty")
+
+	// maxMessageSize limits the size of a single SMB message accepted from a client
+	maxMessageSize = flag.Int("max-message-size", smb.DefaultMaxMessageSize, "maximum size of an SMB message in bytes")
+
+	// maxReadSize, maxWriteSize and maxTransactSize are the largest read, write and transact announced to clients
+	maxReadSize     = flag.Int("max-read-size", smb.DefaultMaxIOSize, "largest read in bytes")
+	maxWriteSize    = flag.Int("max-write-size", smb.DefaultMaxIOSize, "largest write in bytes")
+	maxTransactSize = flag.Int("max-transact-size", smb.DefaultMaxIOSize, "largest transact in bytes")
+
+	// idleTimeout closes connections that have not sent a message for this long
+	idleTimeout = flag.Duration("idle-timeout", smb.DefaultConnectionLimits.IdleTimeout, "close connections idle for this long")
+
+	// workers limits the number of requests of a connection processed concurrently
+	workers = flag.Int("workers", smb.DefaultConnectionLimits.Workers, "requests processed concurrently per connection")
+
+	// shutdownTimeout limits how long the server waits for requests in progress when stopped
+	shutdownTimeout = flag.Duration("shutdown-timeout", 30*time.Second, "time to wait for requests in progress on shutdown")
+
+	// keytabPath is the keytab holding the service keys for Kerberos authentication
+	keytabPath = flag.String("keytab", "", "keytab file enabling Kerberos authentication")
+
+	// usersFile is the user file holding the accounts allowed to log in
+	usersFile = flag.String("users", defaultUsersFile, "user file managed with simba user")
+
+	// guestAccount enables guest logons as this account
+	guestAccount = flag.String("guest-account", "", "account guests are logged in as, guests are refused if empty")
+
+	// nullSessions allows anonymous logons
+	nullSessions = flag.Bool("null-sessions", false, "allow anonymous logons")
+
+	// signingRequired makes authenticated sessions sign their messages
+	signingRequired = flag.Bool("signing-required", true, "require authenticated sessions to sign their messages")
+
+	// encrypt makes authenticated sessions encrypt their messages
+	encrypt = flag.Bool("encrypt", false, "require sessions to encrypt their messages, refusing clients older than SMB 3")
+
+	// compress offers SMB 3.1.1 compression, messages below compressThreshold are sent uncompressed
+	compress          = flag.Bool("compress", false, "offer SMB 3.1.1 compression of reads and writes")
+	compressThreshold = flag.Int("compress-threshold", smb.DefaultCompressionThreshold, "size in bytes below which responses are not compressed")
+
+	// logFile receives the log instead of standard error
+	logFile = flag.String("log-file", "", "file the log is appended to, standard error if empty")
+
+	// mapToGuest selects the failed logons turned into guest logons
+	mapToGuest mapToGuestFlag
+
+	// shares maps share names to directories on the local filesystem or to RAM disks
+	shares = shareFlags{}
+)
 
 func main() {
-	// Listen for incoming connections on port 445
-	ln, err := net.Listen("tcp", ":445")
-	if err != nil {
-		// Handle error
+	// Manage the user file with simba user
+	if len(os.Args) > 1 && os.Args[1] == "user" {
+		if err := runUserCommand(os.Args[2:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				os.Exit(2)
+			}
+			log.Fatal(err)
+		}
+		return
 	}
 
-	for {
-		// Accept incoming connections
-		conn, err := ln.Accept()
+	flag.Var(shares, "share", "share a directory as name=path or a RAM disk as name=mem:SIZE, append ,guest or ,guest-rw to admit guests, ,encrypt to require encryption and ,read-only to refuse writes, may be repeated")
+	flag.Var(&mapToGuest, "map-to-guest", "failed logons mapped to the guest account: never, bad-user or bad-password")
+	flag.Parse()
+
+	// Read the configuration file, the command line takes precedence
+	if *configPath != "" {
+		cfg, err := loadConfig(*configPath)
 		if err != nil {
-			// Handle error
+			log.Fatal(err)
+		}
+		if err := cfg.apply(*configPath, shares); err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		// Handle the connection in a new goroutine
-		go handleConnection(conn)
+	// Send the log to the log file
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		log.SetOutput(f)
 	}
-}
 
-// handleConnection handles an incoming SMB connection
-func handleConnection(conn net.Conn) {
-	// Close the connection when this function returns
-	defer conn.Close()
+	// Apply the limits from the command line
+	limits := smb.DefaultConnectionLimits
+	limits.MaxMessageSize = *maxMessageSize
+	limits.IdleTimeout = *idleTimeout
+	limits.Workers = *workers
+	limits.MaxReadSize = *maxReadSize
+	limits.MaxWriteSize = *maxWriteSize
+	limits.MaxTransactSize = *maxTransactSize
 
-	// Receive the incoming SMB packet
-	data := make([]byte, 4096)
-	n, err := conn.Read(data)
+	// Load the accounts
+	users, err := smb.OpenFileUserStore(*usersFile)
 	if err != nil {
-		// Handle error
+		log.Fatal(err)
 	}
 
-	// Parse the SMB packet
-	packet, err := smb.PacketParse(data[:n])
-	if err != nil {
-		// Handle error
+	// Create the server
+	opts := []smb.Option{
+		smb.WithLimits(limits),
+		smb.WithAuthenticator(users),
+		smb.WithGuestAccount(*guestAccount),
+		smb.WithMapToGuest(smb.MapToGuest(mapToGuest)),
+		smb.WithNullSessions(*nullSessions),
+		smb.WithSigningRequired(*signingRequired),
+		smb.WithEncryptionRequired(*encrypt),
+	}
+	if *netbiosName != "" {
+		opts = append(opts, smb.WithComputerName(*netbiosName))
+	}
+	if *workgroup != "" {
+		opts = append(opts, smb.WithDomain(*workgroup))
+	}
+	if *compress {
+		policy := smb.DefaultNegotiatePolicy
+		policy.CompressionAlgorithms = []smb.CompressionAlgorithm{
+			smb.CompressionAlgorithmLZ77,
+			smb.CompressionAlgorithmLZ77Huffman,
+			smb.CompressionAlgorithmLZNT1,
+			smb.CompressionAlgorithmPatternV1,
+		}
+		policy.ChainedCompression = true
+		policy.CompressionThreshold = *compressThreshold
+		opts = append(opts, smb.WithNegotiatePolicy(policy))
+	}
+	for name, spec := range shares {
+		opt, err := spec.option(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, opt)
+	}
+	if *keytabPath != "" {
+		kt, err := krb5.LoadKeytab(*keytabPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, smb.WithKeytab(kt))
 	}
+	server := smb.NewServer(opts...)
 
-	// Handle the SMB packet according to its command
-	switch packet.Header.Command {
-	case smb.CommandNegotiate:
-		handleNegotiateCommand(conn, packet)
-	case smb.CommandSessionSetup:
-		handleSessionSetupCommand(conn, packet)
-	case smb.CommandTreeConnect:
-		handleTreeConnectCommand(conn, packet)
-	case smb.CommandCreate:
-		handleCreateCommand(conn, packet)
-	case smb.CommandClose:
-		handleCloseCommand(conn, packet)
-	case smb.CommandWrite:
-		handleWriteCommand(conn, packet)
-	case smb.CommandRead:
-		handleReadCommand(conn, packet)
-	case smb.CommandTreeDisconnect:
-		handleTreeDisconnectCommand(conn, packet)
-	case smb.CommandLogoff:
-		handleLogoffCommand(conn, packet)
-	default:
-		// Send error response for unknown command
-		sendErrorResponse(conn, packet.Header, smb.StatusNotImplemented)
+	// Shut down gracefully on SIGINT and SIGTERM
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	// Serve until shut down
+	if err := server.ListenAndServe(*listenAddr); !errors.Is(err, smb.ErrServerClosed) {
+		log.Fatal(err)
 	}
+
+	// Wait for the requests in progress
+	<-stopped
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yuriyvolkov/simba/pkg/smb"
+	"github.com/yuriyvolkov/simba/pkg/vfs"
+)
+
+// shareSpec is a share given on the command line
+type shareSpec struct {
+	path string
+
+	// guest lets guests connect, read-only unless guestWrite is set
+	guest      bool
+	guestWrite bool
+
+	// encrypt refuses unencrypted access
+	encrypt bool
+
+	// readOnly restricts everybody to reading
+	readOnly bool
+
+	// validUsers lists the users and @groups allowed to connect, everybody if empty
+	validUsers []string
+}
+
+// memory reports whether the share is a RAM disk given as mem or mem:SIZE and returns its capacity,
+// zero for the default capacity of a RAM disk
+func (s shareSpec) memory() (int64, bool, error) {
+	if s.path != "mem" && !strings.HasPrefix(s.path, "mem:") {
+		return 0, false, nil
+	}
+	size, err := parseSize(strings.TrimPrefix(strings.TrimPrefix(s.path, "mem"), ":"))
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid RAM disk %q: %v", s.path, err)
+	}
+	return size, true, nil
+}
+
+// option returns the server option exporting the share, on the local filesystem or in memory
+func (s shareSpec) option(name string) (smb.Option, error) {
+	size, mem, err := s.memory()
+	switch {
+	case err != nil:
+		return nil, err
+	case mem:
+		return smb.WithShareFS(name, vfs.NewMemFS(size), s.options()...), nil
+	default:
+		return smb.WithShare(name, s.path, s.options()...), nil
+	}
+}
+
+// parseSize parses a byte count with an optional K, M, G or T suffix, empty means zero
+func parseSize(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	shift := 0
+	switch strings.ToUpper(value[len(value)-1:]) {
+	case "K":
+		shift = 10
+	case "M":
+		shift = 20
+	case "G":
+		shift = 30
+	case "T":
+		shift = 40
+	}
+	if shift > 0 {
+		value = value[:len(value)-1]
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)>>shift {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n << shift, nil
+}
+
+// options returns the share options of the share
+func (s shareSpec) options() []smb.ShareOption {
+	var opts []smb.ShareOption
+	if s.guest {
+		opts = append(opts, smb.GuestAccess(!s.guestWrite))
+	}
+	if s.encrypt {
+		opts = append(opts, smb.RequireEncryption())
+	}
+	if s.readOnly {
+		opts = append(opts, smb.ReadOnly())
+	}
+	if len(s.validUsers) > 0 {
+		opts = append(opts, smb.ValidUsers(s.validUsers...))
+	}
+	return opts
+}
+
+// shareFlags collects the shares given with repeated -share name=path[,guest|,guest-rw][,encrypt][,read-only] flags.
+// A path of mem or mem:SIZE shares a RAM disk.
+type shareFlags map[string]shareSpec
+
+// String returns the shares in the flag syntax
+func (f shareFlags) String() string {
+	var shares []string
+	for name, spec := range f {
+		share := name + "=" + spec.path
+		switch {
+		case spec.guestWrite:
+			share += ",guest-rw"
+		case spec.guest:
+			share += ",guest"
+		}
+		if spec.encrypt {
+			share += ",encrypt"
+		}
+		if spec.readOnly {
+			share += ",read-only"
+		}
+		shares = append(shares, share)
+	}
+	return strings.Join(shares, " ")
+}
+
+// Set adds a share given as name=path, optionally followed by ,guest for read-only
+// guest access or ,guest-rw for guests that may write, by ,encrypt to require encryption
+// and by ,read-only to refuse writes
+func (f shareFlags) Set(value string) error {
+	name, rest, ok := strings.Cut(value, "=")
+	if !ok || name == "" || rest == "" {
+		return fmt.Errorf("invalid share %q, expected name=path", value)
+	}
+
+	// Parse the options following the path, a trailing part that is no option belongs to the path
+	spec := shareSpec{path: rest}
+	for {
+		i := strings.LastIndex(spec.path, ",")
+		if i < 0 {
+			break
+		}
+		switch spec.path[i+1:] {
+		case "guest":
+			spec.guest = true
+		case "guest-rw":
+			spec.guest, spec.guestWrite = true, true
+		case "encrypt":
+			spec.encrypt = true
+		case "read-only":
+			spec.readOnly = true
+		default:
+			i = -1
+		}
+		if i < 0 {
+			break
+		}
+		spec.path = spec.path[:i]
+	}
+	if spec.path == "" {
+		return fmt.Errorf("invalid share %q, expected name=path", value)
+	}
+	if _, _, err := spec.memory(); err != nil {
+		return err
+	}
+
+	f[name] = spec
+	return nil
+}
+
+// mapToGuestFlag is the -map-to-guest flag, named after the values of the Samba option
+type mapToGuestFlag smb.MapToGuest
+
+// String returns the setting in the flag syntax
+func (m *mapToGuestFlag) String() string {
+	switch smb.MapToGuest(*m) {
+	case smb.MapToGuestBadUser:
+		return "bad-user"
+	case smb.MapToGuestBadPassword:
+		return "bad-password"
+	default:
+		return "never"
+	}
+}
+
+// Set parses never, bad-user or bad-password
+func (m *mapToGuestFlag) Set(value string) error {
+	switch strings.ToLower(value) {
+	case "never":
+		*m = mapToGuestFlag(smb.MapToGuestNever)
+	case "bad-user":
+		*m = mapToGuestFlag(smb.MapToGuestBadUser)
+	case "bad-password":
+		*m = mapToGuestFlag(smb.MapToGuestBadPassword)
+	default:
+		return fmt.Errorf("invalid map to guest setting %q, expected never, bad-user or bad-password", value)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/yuriyvolkov/simba/pkg/smb"
+)
+
+// defaultUsersFile is the user file of the server and of the user subcommand
+const defaultUsersFile = "/etc/simba/users"
+
+// userUsage describes the user subcommand
+const userUsage = `usage: simba user <command> [flags] <name>
+
+commands:
+  add     add a user, the password is read from standard input
+  del     delete a user
+  passwd  change the password of a user, it is read from standard input
+
+flags:
+`
+
+// runUserCommand manages the accounts of the user file, args follow "simba user"
+func runUserCommand(args []string) error {
+	fs := flag.NewFlagSet("user", flag.ContinueOnError)
+	file := fs.String("users", defaultUsersFile, "user file to change")
+	groups := fs.String("groups", "", "comma separated groups of a new user")
+	disabled := fs.Bool("disabled", false, "add the user with a disabled account")
+	mustChange := fs.Bool("must-change", false, "require the user to change the password at the next logon")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), userUsage)
+		fs.PrintDefaults()
+	}
+
+	// Parse the command and its flags
+	if len(args) == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	command := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	name := fs.Arg(0)
+
+	// Open the user file
+	store, err := smb.OpenFileUserStore(*file)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "add":
+		user := smb.User{Name: name}
+		for _, g := range strings.Split(*groups, ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				user.Groups = append(user.Groups, g)
+			}
+		}
+		if *disabled {
+			user.Flags |= smb.AccountDisabled
+		}
+		if *mustChange {
+			user.Flags |= smb.AccountPasswordMustChange
+		}
+		password, err := readPassword(os.Stdin)
+		if err != nil {
+			return err
+		}
+		user.SetPassword(password)
+		return store.AddUser(user)
+	case "del":
+		return store.DeleteUser(name)
+	case "passwd":
+		current, err := store.LookupUser("", name)
+		if err != nil {
+			return err
+		}
+		password, err := readPassword(os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		// Setting a new password clears the request to change it
+		user := *current
+		user.SetPassword(password)
+		user.Flags &^= smb.AccountPasswordMustChange
+		if *mustChange {
+			user.Flags |= smb.AccountPasswordMustChange
+		}
+		return store.UpdateUser(user)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown user command %q", command)
+	}
+}
+
+// readPassword reads a password from the first line of r, prompting for it twice when r is a terminal
+func readPassword(r *os.File) (string, error) {
+	reader := bufio.NewReader(r)
+	info, err := r.Stat()
+	if err != nil {
+		return "", err
+	}
+	interactive := info.Mode()&os.ModeCharDevice != 0
+
+	// Read the password
+	if interactive {
+		fmt.Fprint(os.Stderr, "New password: ")
+	}
+	password, err := readLine(reader)
+	if err != nil {
+		return "", err
+	}
+
+	// Have it confirmed on a terminal
+	if interactive {
+		fmt.Fprint(os.Stderr, "Retype new password: ")
+		confirm, err := readLine(reader)
+		if err != nil {
+			return "", err
+		}
+		if confirm != password {
+			return "", errors.New("passwords do not match")
+		}
+	}
+
+	return password, nil
+}
+
+// readLine reads a line without its line ending
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return "", errors.New("no password given")
+		}
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/yuriyvolkov/simba/pkg/ntlm"
+	"github.com/yuriyvolkov/simba/pkg/smb"
+)
+
+// withStdin runs f with standard input reading input
+func withStdin(t *testing.T, input string, f func() error) error {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(path, []byte(input), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	stdin := os.Stdin
+	os.Stdin = file
+	defer func() { os.Stdin = stdin }()
+	return f()
+}
+
+func TestUserCommand(t *testing.T) {
+	users := filepath.Join(t.TempDir(), "users")
+	run := func(input string, args ...string) error {
+		return withStdin(t, input, func() error {
+			return runUserCommand(append(args[:1:1], append([]string{"-users", users}, args[1:]...)...))
+		})
+	}
+	lookup := func(name string) *smb.User {
+		store, err := smb.OpenFileUserStore(users)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := store.LookupUser("", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	// Add a user with groups and flags
+	if err := run("secret\n", "add", "-groups", "staff, admins", "-must-change", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	want := &smb.User{
+		Name:   "alice",
+		NTHash: ntlm.NTHash("secret"),
+		Groups: []string{"staff", "admins"},
+		Flags:  smb.AccountPasswordMustChange,
+	}
+	if u := lookup("alice"); !reflect.DeepEqual(u, want) {
+		t.Errorf("added %+v, want %+v", u, want)
+	}
+	if err := run("secret\n", "add", "alice"); !errors.Is(err, smb.ErrUserExists) {
+		t.Errorf("adding an existing user error = %v, want %v", err, smb.ErrUserExists)
+	}
+	if err := run("secret\n", "add", "-groups", "staff ,:x", "bob"); err == nil {
+		t.Error("invalid group accepted")
+	}
+
+	// Changing the password clears the request to change it
+	if err := run("changed\n", "passwd", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	want.NTHash = ntlm.NTHash("changed")
+	want.Flags = 0
+	if u := lookup("alice"); !reflect.DeepEqual(u, want) {
+		t.Errorf("changed %+v, want %+v", u, want)
+	}
+	if err := run("", "passwd", "alice"); err == nil {
+		t.Error("empty input accepted as a password")
+	}
+
+	// Delete the user
+	if err := run("", "del", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("", "del", "alice"); !errors.Is(err, smb.ErrNoSuchUser) {
+		t.Errorf("deleting a missing user error = %v, want %v", err, smb.ErrNoSuchUser)
+	}
+	if err := run("", "rename", "alice"); err == nil {
+		t.Error("unknown command accepted")
+	}
+}
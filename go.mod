@@ -1,3 +1,3 @@
 module github.com/yuriyvolkov/simba
 
-go 1.17
+go 1.19
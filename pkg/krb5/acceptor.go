@@ -0,0 +1,380 @@
+package krb5
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rc4"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSkew is the largest clock difference accepted between the client and the server
+const DefaultMaxSkew = 5 * time.Minute
+
+// oidMSKerberos5 is the object identifier older Windows versions use for Kerberos V5
+var oidMSKerberos5 = asn1.ObjectIdentifier{1, 2, 840, 48018, 1, 2, 2}
+
+// Token identifiers of GSS-API Kerberos tokens (RFC 4121, section 4.1)
+var (
+	tokenIDAPReq = []byte{0x01, 0x00}
+	tokenIDAPRep = []byte{0x02, 0x00}
+	tokenIDMIC   = []byte{0x04, 0x04}
+)
+
+// rc4MICHeader is the header of RFC 4757 MIC tokens: the token identifier, the HMAC-MD5 signing
+// algorithm and the filler
+var rc4MICHeader = []byte{0x01, 0x01, 0x11, 0x00, 0xff, 0xff, 0xff, 0xff}
+
+// Sizes of the parts of an RFC 4757 MIC token, the header is followed by the encrypted sequence
+// number and the checksum
+const (
+	rc4MICHeaderSize   = 8
+	rc4MICSeqSize      = 8
+	rc4MICChecksumSize = 8
+)
+
+// Flags of RFC 4121 per-message tokens
+const (
+	micFlagSentByAcceptor = 0x01
+	micFlagAcceptorSubkey = 0x04
+)
+
+// micHeaderSize is the size of the header of an RFC 4121 MIC token
+const micHeaderSize = 16
+
+// Acceptor validates the AP-REQ messages of clients against the keys of a keytab.
+// An Acceptor is safe for concurrent use, it remembers recent authenticators to detect replays.
+type Acceptor struct {
+	keytab *Keytab
+
+	// MaxSkew is the largest clock difference accepted, DefaultMaxSkew by default
+	MaxSkew time.Duration
+
+	// Now returns the current time, it can be replaced to validate recorded tickets
+	Now func() time.Time
+
+	// replays holds the authenticators seen within the skew window and when they expire
+	mu      sync.Mutex
+	replays map[string]time.Time
+}
+
+// NewAcceptor creates an acceptor using the service keys of the keytab
+func NewAcceptor(kt *Keytab) *Acceptor {
+	return &Acceptor{
+		keytab:  kt,
+		MaxSkew: DefaultMaxSkew,
+		Now:     time.Now,
+		replays: make(map[string]time.Time),
+	}
+}
+
+// Context is an established Kerberos security context
+type Context struct {
+	// Client is the principal name of the client and Realm its realm
+	Client string
+	Realm  string
+
+	// SessionKey is the subkey of the client if it sent one, the session key of the ticket otherwise
+	SessionKey EncryptionKey
+
+	// EndTime is the end of the validity of the ticket
+	EndTime time.Time
+
+	// acceptorSeq is the initial sequence number of the server
+	acceptorSeq uint64
+}
+
+// Accept validates a GSS-API Kerberos token or a bare AP-REQ. It returns the security context
+// and, when the client asked for mutual authentication, the AP-REP token to send back.
+func (a *Acceptor) Accept(token []byte) (*Context, []byte, error) {
+	// Strip the GSS-API framing
+	data, framed, err := unframe(token, tokenIDAPReq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Parse the AP-REQ
+	var req apReq
+	if err := unmarshalApplication(data, tagAPReq, &req); err != nil {
+		return nil, nil, err
+	}
+	if req.PVNO != 5 || req.MsgType != msgTypeAPReq {
+		return nil, nil, ErrInvalidMessage
+	}
+
+	// Parse the ticket
+	var tkt ticket
+	if err := unmarshalApplication(req.Ticket.Bytes, tagTicket, &tkt); err != nil {
+		return nil, nil, err
+	}
+	realm, err := kerberosString(tkt.Realm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Decrypt the ticket with the key of the service
+	key, ok := a.keytab.key(tkt.SName.String(), realm, uint32(tkt.EncPart.KVNO), EType(tkt.EncPart.EType))
+	if !ok {
+		return nil, nil, ErrNoKey
+	}
+	plaintext, err := decrypt(key, keyUsageTicket, tkt.EncPart.Cipher)
+	if err != nil {
+		return nil, nil, err
+	}
+	var encPart encTicketPart
+	if err := unmarshalApplication(plaintext, tagEncTicketPart, &encPart); err != nil {
+		return nil, nil, err
+	}
+	sessionKey := EncryptionKey{Type: EType(encPart.Key.KeyType), Value: encPart.Key.KeyValue}
+
+	// Decrypt the authenticator with the session key of the ticket
+	plaintext, err = decrypt(sessionKey, keyUsageAPReqAuthenticator, req.Authenticator.Cipher)
+	if err != nil {
+		return nil, nil, err
+	}
+	var auth authenticator
+	if err := unmarshalApplication(plaintext, tagAuthenticator, &auth); err != nil {
+		return nil, nil, err
+	}
+
+	// The authenticator must come from the client the ticket was issued to
+	crealm, err := kerberosString(encPart.CRealm)
+	if err != nil {
+		return nil, nil, err
+	}
+	authRealm, err := kerberosString(auth.CRealm)
+	if err != nil {
+		return nil, nil, err
+	}
+	if crealm != authRealm || encPart.CName.String() != auth.CName.String() {
+		return nil, nil, ErrClientMismatch
+	}
+
+	// Check the validity of the ticket and the time of the authenticator
+	now := a.Now()
+	start := encPart.AuthTime
+	if !encPart.StartTime.IsZero() {
+		start = encPart.StartTime
+	}
+	if now.Before(start.Add(-a.MaxSkew)) || now.After(encPart.EndTime.Add(a.MaxSkew)) {
+		return nil, nil, ErrTicketExpired
+	}
+	if skew := now.Sub(auth.CTime); skew > a.MaxSkew || skew < -a.MaxSkew {
+		return nil, nil, ErrClockSkew
+	}
+
+	// Refuse authenticators that were already used
+	if !a.remember(auth, crealm, now) {
+		return nil, nil, ErrReplay
+	}
+
+	// Create the security context
+	ctx := &Context{
+		Client:     auth.CName.String(),
+		Realm:      crealm,
+		SessionKey: sessionKey,
+		EndTime:    encPart.EndTime,
+	}
+	if len(auth.SubKey.KeyValue) > 0 {
+		ctx.SessionKey = EncryptionKey{Type: EType(auth.SubKey.KeyType), Value: auth.SubKey.KeyValue}
+	}
+
+	// Answer with an AP-REP if the client wants to authenticate the server
+	if !hasBit(req.APOptions, apOptionMutualRequired) {
+		return ctx, nil, nil
+	}
+	reply, err := a.reply(ctx, sessionKey, auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	if framed {
+		reply, err = frame(reply, tokenIDAPRep)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return ctx, reply, nil
+}
+
+// reply builds the AP-REP proving the server could decrypt the authenticator
+func (a *Acceptor) reply(ctx *Context, sessionKey EncryptionKey, auth authenticator) ([]byte, error) {
+	// Pick the sequence number of the server
+	var seq [4]byte
+	if _, err := rand.Read(seq[:]); err != nil {
+		return nil, err
+	}
+	ctx.acceptorSeq = uint64(binary.BigEndian.Uint32(seq[:]) & 0x3fffffff)
+
+	// Encrypt the time of the authenticator with the session key of the ticket
+	data, err := marshalApplication(tagEncAPRepPart, encAPRepPart{
+		CTime:     auth.CTime,
+		Cusec:     auth.Cusec,
+		SeqNumber: int64(ctx.acceptorSeq),
+	})
+	if err != nil {
+		return nil, err
+	}
+	cipher, err := encrypt(sessionKey, keyUsageAPRepEncPart, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Marshal the AP-REP
+	return marshalApplication(tagAPRep, apRep{
+		PVNO:    5,
+		MsgType: msgTypeAPRep,
+		EncPart: encryptedData{EType: int32(sessionKey.Type), Cipher: cipher},
+	})
+}
+
+// remember records an authenticator, it returns false if it was already seen within the skew window
+func (a *Acceptor) remember(auth authenticator, realm string, now time.Time) bool {
+	key := fmt.Sprintf("%s@%s/%d/%d", auth.CName, realm, auth.CTime.Unix(), auth.Cusec)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Forget the authenticators that expired
+	for k, expiry := range a.replays {
+		if now.After(expiry) {
+			delete(a.replays, k)
+		}
+	}
+
+	if _, ok := a.replays[key]; ok {
+		return false
+	}
+	a.replays[key] = auth.CTime.Add(a.MaxSkew)
+	return true
+}
+
+// VerifyMIC verifies a MIC token computed by the client over msg, an RFC 4121 token for AES keys
+// and an RFC 4757 token for RC4 keys
+func (c *Context) VerifyMIC(msg []byte, mic []byte) error {
+	if c.SessionKey.Type == ETypeRC4HMAC {
+		return c.verifyRC4MIC(msg, mic)
+	}
+	if len(mic) < micHeaderSize || !bytes.Equal(mic[:2], tokenIDMIC) || mic[2]&micFlagSentByAcceptor != 0 {
+		return ErrInvalidMessage
+	}
+	expected, err := c.checksum(keyUsageInitiatorSign, msg, mic[:micHeaderSize])
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, mic[micHeaderSize:]) {
+		return ErrIntegrity
+	}
+	return nil
+}
+
+// verifyRC4MIC verifies an RFC 4757 MIC token computed by the client over msg. The token may
+// carry the GSS-API framing of RFC 1964 tokens.
+func (c *Context) verifyRC4MIC(msg []byte, mic []byte) error {
+	// Strip the framing, the token identifier is part of the header
+	token, framed, err := unframe(mic, rc4MICHeader[:2])
+	if err != nil {
+		return err
+	}
+	if framed {
+		token = append(append([]byte{}, rc4MICHeader[:2]...), token...)
+	}
+	if len(token) != rc4MICHeaderSize+rc4MICSeqSize+rc4MICChecksumSize || !bytes.Equal(token[:rc4MICHeaderSize], rc4MICHeader) {
+		return ErrInvalidMessage
+	}
+
+	// Check the checksum over the header and the message
+	data := append(append([]byte{}, token[:rc4MICHeaderSize]...), msg...)
+	sum := checksumRC4(c.SessionKey.Value, rc4UsageSign, data)[:rc4MICChecksumSize]
+	if !hmac.Equal(sum, token[rc4MICHeaderSize+rc4MICSeqSize:]) {
+		return ErrIntegrity
+	}
+
+	// Decrypt the sequence number, its direction bytes are zero for tokens of the client
+	stream, err := rc4.NewCipher(hmacMD5(hmacMD5(c.SessionKey.Value, make([]byte, 4)), sum))
+	if err != nil {
+		return err
+	}
+	seq := make([]byte, rc4MICSeqSize)
+	stream.XORKeyStream(seq, token[rc4MICHeaderSize:rc4MICHeaderSize+rc4MICSeqSize])
+	if !bytes.Equal(seq[4:], []byte{0, 0, 0, 0}) {
+		return ErrInvalidMessage
+	}
+	return nil
+}
+
+// MIC computes an RFC 4121 MIC token of the server over msg
+func (c *Context) MIC(msg []byte) ([]byte, error) {
+	// Build the token header
+	header := make([]byte, micHeaderSize)
+	copy(header, tokenIDMIC)
+	header[2] = micFlagSentByAcceptor
+	copy(header[3:8], []byte{0xff, 0xff, 0xff, 0xff, 0xff})
+	binary.BigEndian.PutUint64(header[8:], c.acceptorSeq)
+
+	// Append the checksum
+	sum, err := c.checksum(keyUsageAcceptorSign, msg, header)
+	if err != nil {
+		return nil, err
+	}
+	return append(header, sum...), nil
+}
+
+// checksum computes the checksum of a MIC token over the message followed by the token header
+func (c *Context) checksum(usage uint32, msg []byte, header []byte) ([]byte, error) {
+	if header[2]&micFlagAcceptorSubkey != 0 {
+		return nil, ErrInvalidMessage
+	}
+	switch c.SessionKey.Type {
+	case ETypeAES128CTSHMACSHA196, ETypeAES256CTSHMACSHA196:
+		data := append(append([]byte{}, msg...), header...)
+		return checksumAES(c.SessionKey.Value, usage, data)
+	default:
+		return nil, ErrUnsupportedEType
+	}
+}
+
+// unframe strips the GSS-API framing of a token (RFC 2743, section 3.1) and checks its token identifier.
+// Bare Kerberos messages are returned unchanged, framed reports whether the token was framed.
+func unframe(token []byte, tokenID []byte) ([]byte, bool, error) {
+	// Bare messages start with their own application tag
+	if len(token) == 0 || token[0] != 0x60 {
+		return token, false, nil
+	}
+	content, _, err := unwrap(token, asn1.ClassApplication, 0)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Check the mechanism and the token identifier
+	var oid asn1.ObjectIdentifier
+	rest, err := asn1.Unmarshal(content, &oid)
+	if err != nil {
+		return nil, false, ErrInvalidMessage
+	}
+	if !oid.Equal(OIDKerberos5) && !oid.Equal(oidMSKerberos5) {
+		return nil, false, ErrInvalidMessage
+	}
+	if len(rest) < 2 || !bytes.Equal(rest[:2], tokenID) {
+		return nil, false, ErrInvalidMessage
+	}
+	return rest[2:], true, nil
+}
+
+// frame wraps a Kerberos message into a GSS-API token
+func frame(msg []byte, tokenID []byte) ([]byte, error) {
+	oid, err := asn1.Marshal(OIDKerberos5)
+	if err != nil {
+		return nil, err
+	}
+	content := append(oid, tokenID...)
+	return wrap(asn1.ClassApplication, 0, append(content, msg...))
+}
+
+// hasBit reports whether a bit of a Kerberos flags bit string is set, bit 0 being the most significant
+func hasBit(flags asn1.BitString, bit int) bool {
+	return bit < flags.BitLength && flags.At(bit) == 1
+}
@@ -0,0 +1,211 @@
+package krb5
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// The tickets in testdata were issued at 2026-01-01 00:00 UTC for ten hours to alice@EXAMPLE.COM for
+// cifs/fs.example.com, their authenticators are dated a minute later
+var (
+	testAuthTime = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	testCTime    = testAuthTime.Add(time.Minute)
+)
+
+// testMechTypes is the mechTypes list of the Kerberos mechanism the RC4 MIC in testdata was computed over
+const testMechTypes = "300b06092a864886f712010202"
+
+// testAcceptor returns an acceptor using the keytab of testdata, its clock set to now
+func testAcceptor(t *testing.T, now time.Time) *Acceptor {
+	t.Helper()
+
+	kt, err := LoadKeytab("testdata/service.keytab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAcceptor(kt)
+	a.Now = func() time.Time { return now }
+	return a
+}
+
+// readTestData returns the content of a file of testdata
+func readTestData(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestAccept(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		etype   EType
+		framed  bool
+		mutual  bool
+		wantKey string
+	}{
+		{
+			name:    "aes256 bare with mutual authentication",
+			file:    "ap-req-aes256.bin",
+			etype:   ETypeAES256CTSHMACSHA196,
+			mutual:  true,
+			wantKey: "202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f",
+		},
+		{
+			name:    "rc4 framed",
+			file:    "ap-req-rc4.bin",
+			etype:   ETypeRC4HMAC,
+			framed:  true,
+			wantKey: "404142434445464748494a4b4c4d4e4f",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAcceptor(t, testCTime.Add(30*time.Second))
+			ctx, reply, err := a.Accept(readTestData(t, tt.file))
+			if err != nil {
+				t.Fatalf("Accept() error = %v", err)
+			}
+			if ctx.Client != "alice" || ctx.Realm != "EXAMPLE.COM" {
+				t.Errorf("Accept() client = %s@%s, want alice@EXAMPLE.COM", ctx.Client, ctx.Realm)
+			}
+			if ctx.SessionKey.Type != tt.etype || hex.EncodeToString(ctx.SessionKey.Value) != tt.wantKey {
+				t.Errorf("Accept() session key = %d %x, want %d %s", ctx.SessionKey.Type, ctx.SessionKey.Value, tt.etype, tt.wantKey)
+			}
+			if !ctx.EndTime.Equal(testAuthTime.Add(10 * time.Hour)) {
+				t.Errorf("Accept() end time = %v", ctx.EndTime)
+			}
+			if (reply != nil) != tt.mutual {
+				t.Errorf("Accept() reply = %x, want one: %v", reply, tt.mutual)
+			}
+			if tt.mutual {
+				if _, _, err := unframe(reply, tokenIDAPRep); err != nil {
+					t.Errorf("Accept() reply is not an AP-REP: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestAcceptRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		now     time.Time
+		twice   bool
+		maxSkew time.Duration
+		want    error
+	}{
+		{
+			name: "authenticator too old",
+			file: "ap-req-aes256.bin",
+			now:  testCTime.Add(DefaultMaxSkew + time.Second),
+			want: ErrClockSkew,
+		},
+		{
+			name: "authenticator from the future",
+			file: "ap-req-rc4.bin",
+			now:  testCTime.Add(-DefaultMaxSkew - time.Second),
+			want: ErrClockSkew,
+		},
+		{
+			name: "ticket expired",
+			file: "ap-req-rc4.bin",
+			now:  testAuthTime.Add(11 * time.Hour),
+			want: ErrTicketExpired,
+		},
+		{
+			name:  "replayed authenticator",
+			file:  "ap-req-aes256.bin",
+			now:   testCTime,
+			twice: true,
+			want:  ErrReplay,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAcceptor(t, tt.now)
+			token := readTestData(t, tt.file)
+			if tt.twice {
+				if _, _, err := a.Accept(token); err != nil {
+					t.Fatalf("first Accept() error = %v", err)
+				}
+			}
+			if _, _, err := a.Accept(token); !errors.Is(err, tt.want) {
+				t.Errorf("Accept() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcceptUnknownService(t *testing.T) {
+	a := NewAcceptor(&Keytab{})
+	a.Now = func() time.Time { return testCTime }
+	if _, _, err := a.Accept(readTestData(t, "ap-req-aes256.bin")); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Accept() error = %v, want %v", err, ErrNoKey)
+	}
+}
+
+func TestVerifyMICRC4(t *testing.T) {
+	a := testAcceptor(t, testCTime)
+	ctx, _, err := a.Accept(readTestData(t, "ap-req-rc4.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, _ := hex.DecodeString(testMechTypes)
+	mic := readTestData(t, "mic-rc4.bin")
+
+	// The MIC of the client verifies over the message it was computed over, not over another
+	if err := ctx.VerifyMIC(msg, mic); err != nil {
+		t.Errorf("VerifyMIC() error = %v", err)
+	}
+	if err := ctx.VerifyMIC(append(msg, 0), mic); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("VerifyMIC() of another message error = %v, want %v", err, ErrIntegrity)
+	}
+
+	// A corrupted checksum or token fails
+	corrupted := append([]byte{}, mic...)
+	corrupted[len(corrupted)-1] ^= 1
+	if err := ctx.VerifyMIC(msg, corrupted); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("VerifyMIC() of a corrupted checksum error = %v, want %v", err, ErrIntegrity)
+	}
+	if err := ctx.VerifyMIC(msg, mic[:len(mic)-1]); err == nil {
+		t.Error("VerifyMIC() of a truncated token succeeded")
+	}
+}
+
+func TestMICAES(t *testing.T) {
+	a := testAcceptor(t, testCTime)
+	ctx, _, err := a.Accept(readTestData(t, "ap-req-aes256.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, _ := hex.DecodeString(testMechTypes)
+
+	// A token of the server is refused as a token of the client
+	mic, err := ctx.MIC(msg)
+	if err != nil {
+		t.Fatalf("MIC() error = %v", err)
+	}
+	if err := ctx.VerifyMIC(msg, mic); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("VerifyMIC() of a server token error = %v, want %v", err, ErrInvalidMessage)
+	}
+
+	// A token signed with the usage of the client verifies
+	header := append([]byte{}, mic[:micHeaderSize]...)
+	header[2] = 0
+	sum, err := ctx.checksum(keyUsageInitiatorSign, msg, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.VerifyMIC(msg, append(header, sum...)); err != nil {
+		t.Errorf("VerifyMIC() error = %v", err)
+	}
+}
@@ -0,0 +1,366 @@
+package krb5
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha1"
+	"encoding/binary"
+)
+
+// EType represents a Kerberos encryption type
+type EType int32
+
+const (
+	// ETypeAES128CTSHMACSHA196 is AES-128 in CTS mode with HMAC-SHA1-96 (RFC 3962)
+	ETypeAES128CTSHMACSHA196 EType = 17
+
+	// ETypeAES256CTSHMACSHA196 is AES-256 in CTS mode with HMAC-SHA1-96 (RFC 3962)
+	ETypeAES256CTSHMACSHA196 EType = 18
+
+	// ETypeRC4HMAC is RC4 with HMAC-MD5 (RFC 4757)
+	ETypeRC4HMAC EType = 23
+)
+
+const (
+	// aesConfounderSize is the size of the random prefix of AES encrypted data
+	aesConfounderSize = aes.BlockSize
+
+	// aesHMACSize is the size of the truncated HMAC-SHA1 of AES encrypted data
+	aesHMACSize = 12
+
+	// rc4ConfounderSize is the size of the random prefix of RC4 encrypted data
+	rc4ConfounderSize = 8
+
+	// rc4ChecksumSize is the size of the HMAC-MD5 of RC4 encrypted data
+	rc4ChecksumSize = md5.Size
+)
+
+// Key derivation constants appended to the key usage (RFC 3961, section 5.3)
+const (
+	deriveChecksum   = 0x99
+	deriveEncryption = 0xAA
+	deriveIntegrity  = 0x55
+)
+
+// EncryptionKey represents a Kerberos key of a given encryption type
+type EncryptionKey struct {
+	Type  EType
+	Value []byte
+}
+
+// encrypt encrypts plaintext with the key for the given key usage
+func encrypt(key EncryptionKey, usage uint32, plaintext []byte) ([]byte, error) {
+	switch key.Type {
+	case ETypeAES128CTSHMACSHA196, ETypeAES256CTSHMACSHA196:
+		// Prefix a random confounder
+		data := make([]byte, aesConfounderSize, aesConfounderSize+len(plaintext))
+		if _, err := rand.Read(data); err != nil {
+			return nil, err
+		}
+		data = append(data, plaintext...)
+
+		// Encrypt the data and append its HMAC
+		ke, err := deriveKey(key.Value, usage, deriveEncryption)
+		if err != nil {
+			return nil, err
+		}
+		ki, err := deriveKey(key.Value, usage, deriveIntegrity)
+		if err != nil {
+			return nil, err
+		}
+		ciphertext, err := encryptCTS(ke, data)
+		if err != nil {
+			return nil, err
+		}
+		return append(ciphertext, hmacSHA1(ki, data)[:aesHMACSize]...), nil
+	case ETypeRC4HMAC:
+		// Prefix a random confounder
+		data := make([]byte, rc4ConfounderSize, rc4ConfounderSize+len(plaintext))
+		if _, err := rand.Read(data); err != nil {
+			return nil, err
+		}
+		data = append(data, plaintext...)
+
+		// The checksum of the data keys the RC4 stream and prefixes the ciphertext
+		k1 := hmacMD5(key.Value, rc4Usage(usage))
+		checksum := hmacMD5(k1, data)
+		stream, err := rc4.NewCipher(hmacMD5(k1, checksum))
+		if err != nil {
+			return nil, err
+		}
+		stream.XORKeyStream(data, data)
+		return append(checksum, data...), nil
+	default:
+		return nil, ErrUnsupportedEType
+	}
+}
+
+// decrypt decrypts and verifies ciphertext with the key for the given key usage
+func decrypt(key EncryptionKey, usage uint32, ciphertext []byte) ([]byte, error) {
+	switch key.Type {
+	case ETypeAES128CTSHMACSHA196, ETypeAES256CTSHMACSHA196:
+		if len(ciphertext) < aesConfounderSize+aesHMACSize {
+			return nil, ErrInvalidMessage
+		}
+
+		// Decrypt the data
+		ke, err := deriveKey(key.Value, usage, deriveEncryption)
+		if err != nil {
+			return nil, err
+		}
+		ki, err := deriveKey(key.Value, usage, deriveIntegrity)
+		if err != nil {
+			return nil, err
+		}
+		mac := ciphertext[len(ciphertext)-aesHMACSize:]
+		data, err := decryptCTS(ke, ciphertext[:len(ciphertext)-aesHMACSize])
+		if err != nil {
+			return nil, err
+		}
+
+		// Verify its HMAC and strip the confounder
+		if !hmac.Equal(hmacSHA1(ki, data)[:aesHMACSize], mac) {
+			return nil, ErrIntegrity
+		}
+		return data[aesConfounderSize:], nil
+	case ETypeRC4HMAC:
+		if len(ciphertext) < rc4ChecksumSize+rc4ConfounderSize {
+			return nil, ErrInvalidMessage
+		}
+
+		// Decrypt the data with the stream keyed by the checksum
+		k1 := hmacMD5(key.Value, rc4Usage(usage))
+		checksum := ciphertext[:rc4ChecksumSize]
+		stream, err := rc4.NewCipher(hmacMD5(k1, checksum))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, len(ciphertext)-rc4ChecksumSize)
+		stream.XORKeyStream(data, ciphertext[rc4ChecksumSize:])
+
+		// Verify the checksum and strip the confounder
+		if !hmac.Equal(hmacMD5(k1, data), checksum) {
+			return nil, ErrIntegrity
+		}
+		return data[rc4ConfounderSize:], nil
+	default:
+		return nil, ErrUnsupportedEType
+	}
+}
+
+// checksumAES computes the HMAC-SHA1-96 checksum of data for the given key usage (RFC 3962)
+func checksumAES(key []byte, usage uint32, data []byte) ([]byte, error) {
+	kc, err := deriveKey(key, usage, deriveChecksum)
+	if err != nil {
+		return nil, err
+	}
+	return hmacSHA1(kc, data)[:aesHMACSize], nil
+}
+
+// checksumRC4 computes the HMAC-MD5 checksum of data for the given message type (RFC 4757, section 4)
+func checksumRC4(key []byte, usage uint32, data []byte) []byte {
+	ksign := hmacMD5(key, []byte("signaturekey\x00"))
+	sum := md5.Sum(append(rc4Usage(usage), data...))
+	return hmacMD5(ksign, sum[:])
+}
+
+// rc4Usage returns the message type used by RC4-HMAC in place of the key usage (RFC 4757, section 3)
+func rc4Usage(usage uint32) []byte {
+	switch usage {
+	case 3:
+		usage = 8
+	case 9:
+		usage = 8
+	case 23:
+		usage = 13
+	}
+	return binary.LittleEndian.AppendUint32(nil, usage)
+}
+
+// deriveKey derives a key for the usage and purpose from an AES base key (RFC 3961, section 5.1)
+func deriveKey(key []byte, usage uint32, purpose byte) ([]byte, error) {
+	constant := binary.BigEndian.AppendUint32(nil, usage)
+	constant = append(constant, purpose)
+	return deriveRandom(key, constant)
+}
+
+// deriveRandom implements DR, encrypting the n-folded constant repeatedly until the key length is reached
+func deriveRandom(key []byte, constant []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(key)+aes.BlockSize)
+	in := nfold(constant, aes.BlockSize)
+	for len(out) < len(key) {
+		next := make([]byte, aes.BlockSize)
+		block.Encrypt(next, in)
+		out = append(out, next...)
+		in = next
+	}
+	return out[:len(key)], nil
+}
+
+// nfold stretches or folds the input to n bytes (RFC 3961, section 5.1)
+func nfold(in []byte, n int) []byte {
+	// The result is the sum of lcm(n, len(in)) bytes made of the input rotated by 13 more bits each time
+	l := lcm(n, len(in))
+	buf := make([]byte, 0, l)
+	for i := 0; len(buf) < l; i++ {
+		buf = append(buf, rotateRight(in, 13*i)...)
+	}
+
+	// Add the n-byte chunks with one's complement addition
+	out := make([]byte, n)
+	for i := 0; i < l; i += n {
+		carry := 0
+		for j := n - 1; j >= 0; j-- {
+			sum := int(out[j]) + int(buf[i+j]) + carry
+			out[j] = byte(sum)
+			carry = sum >> 8
+		}
+
+		// Add the carry back in at the end
+		for carry > 0 {
+			for j := n - 1; j >= 0 && carry > 0; j-- {
+				sum := int(out[j]) + carry
+				out[j] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return out
+}
+
+// rotateRight rotates a byte string to the right by the given number of bits
+func rotateRight(in []byte, bits int) []byte {
+	n := len(in) * 8
+	bits %= n
+	out := make([]byte, len(in))
+	for i := 0; i < n; i++ {
+		src := (i - bits + n) % n
+		if in[src/8]&(0x80>>(src%8)) != 0 {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
+
+// lcm returns the least common multiple of a and b
+func lcm(a, b int) int {
+	x, y := a, b
+	for y != 0 {
+		x, y = y, x%y
+	}
+	return a / x * b
+}
+
+// encryptCTS encrypts data with AES in CBC mode with ciphertext stealing and a zero IV,
+// the last two blocks are always swapped (RFC 3962, section 5)
+func encryptCTS(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aes.BlockSize {
+		return nil, ErrInvalidMessage
+	}
+
+	// A single block is plain CBC
+	iv := make([]byte, aes.BlockSize)
+	if len(data) == aes.BlockSize {
+		out := make([]byte, aes.BlockSize)
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+		return out, nil
+	}
+
+	// Pad the data to full blocks and encrypt it
+	tail := len(data) % aes.BlockSize
+	if tail == 0 {
+		tail = aes.BlockSize
+	}
+	padded := make([]byte, len(data)+aes.BlockSize-tail)
+	copy(padded, data)
+	out := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+
+	// Swap the last two blocks and truncate the final one
+	n := len(out)
+	last := append([]byte{}, out[n-aes.BlockSize:]...)
+	secondLast := out[n-2*aes.BlockSize : n-aes.BlockSize]
+	result := append(out[:n-2*aes.BlockSize:n-2*aes.BlockSize], last...)
+	return append(result, secondLast[:tail]...), nil
+}
+
+// decryptCTS reverses encryptCTS
+func decryptCTS(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aes.BlockSize {
+		return nil, ErrInvalidMessage
+	}
+
+	// A single block is plain CBC
+	iv := make([]byte, aes.BlockSize)
+	if len(data) == aes.BlockSize {
+		out := make([]byte, aes.BlockSize)
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+		return out, nil
+	}
+
+	// Split off the last two blocks, the final one may be partial
+	tail := len(data) % aes.BlockSize
+	if tail == 0 {
+		tail = aes.BlockSize
+	}
+	head := len(data) - aes.BlockSize - tail
+	prev := iv
+	if head > 0 {
+		prev = data[head-aes.BlockSize : head]
+	}
+	cn1 := data[head : head+aes.BlockSize]
+	cn := data[head+aes.BlockSize:]
+
+	// Decrypt the swapped block, its tail restores the stolen ciphertext
+	d := make([]byte, aes.BlockSize)
+	block.Decrypt(d, cn1)
+	full := append(append([]byte{}, cn...), d[tail:]...)
+	lastPlain := make([]byte, tail)
+	for i := range lastPlain {
+		lastPlain[i] = d[i] ^ cn[i]
+	}
+
+	// Decrypt the remaining blocks in CBC order
+	out := make([]byte, head, len(data))
+	if head > 0 {
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data[:head])
+	}
+	secondLast := make([]byte, aes.BlockSize)
+	block.Decrypt(secondLast, full)
+	for i := range secondLast {
+		secondLast[i] ^= prev[i]
+	}
+	out = append(out, secondLast...)
+	return append(out, lastPlain...), nil
+}
+
+// hmacSHA1 computes the HMAC-SHA1 of data
+func hmacSHA1(key []byte, data []byte) []byte {
+	h := hmac.New(sha1.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// hmacMD5 computes the HMAC-MD5 of data
+func hmacMD5(key []byte, data []byte) []byte {
+	h := hmac.New(md5.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
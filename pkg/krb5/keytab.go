@@ -0,0 +1,242 @@
+package krb5
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// keytabVersion is the file format version of MIT keytab files supported here
+const keytabVersion = 0x0502
+
+// ErrInvalidKeytab is returned for a keytab that is not a version 0x502 keytab
+var ErrInvalidKeytab = errors.New("krb5: invalid keytab")
+
+// KeytabEntry is a key of a service principal
+type KeytabEntry struct {
+	// Principal is the name of the principal, its components joined with slashes such as cifs/host.example.com
+	Principal string
+	Realm     string
+	NameType  int32
+	Timestamp time.Time
+	KVNO      uint32
+	Key       EncryptionKey
+}
+
+// Keytab holds the service keys used to decrypt tickets
+type Keytab struct {
+	Entries []KeytabEntry
+}
+
+// LoadKeytab reads a keytab file
+func LoadKeytab(path string) (*Keytab, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return KeytabParse(data)
+}
+
+// KeytabParse parses a keytab in the MIT file format
+func KeytabParse(data []byte) (*Keytab, error) {
+	// Create a new bytes reader
+	r := bytes.NewReader(data)
+
+	// Read the file format version
+	var version uint16
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil || version != keytabVersion {
+		return nil, ErrInvalidKeytab
+	}
+
+	keytab := &Keytab{}
+	for r.Len() > 0 {
+		// Read the entry size, a negative size marks a deleted entry
+		var size int32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, ErrInvalidKeytab
+		}
+
+		// Entries and holes must fit in what is left of the file
+		length := int64(size)
+		if length < 0 {
+			length = -length
+		}
+		if length > int64(r.Len()) {
+			return nil, ErrInvalidKeytab
+		}
+		if size < 0 {
+			if _, err := r.Seek(length, io.SeekCurrent); err != nil {
+				return nil, ErrInvalidKeytab
+			}
+			continue
+		}
+
+		// Read the entry
+		record := make([]byte, size)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return nil, ErrInvalidKeytab
+		}
+		entry, err := keytabEntryParse(record)
+		if err != nil {
+			return nil, err
+		}
+		keytab.Entries = append(keytab.Entries, *entry)
+	}
+
+	return keytab, nil
+}
+
+// keytabEntryParse parses a single keytab entry
+func keytabEntryParse(data []byte) (*KeytabEntry, error) {
+	// Create a new bytes reader
+	r := bytes.NewReader(data)
+
+	// Read the number of name components
+	var count uint16
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, ErrInvalidKeytab
+	}
+
+	// Read the realm and the name components
+	realm, err := readCountedString(r)
+	if err != nil {
+		return nil, err
+	}
+	components := make([]string, count)
+	for i := range components {
+		if components[i], err = readCountedString(r); err != nil {
+			return nil, err
+		}
+	}
+
+	// Read the name type and the timestamp
+	var nameType int32
+	if err := binary.Read(r, binary.BigEndian, &nameType); err != nil {
+		return nil, ErrInvalidKeytab
+	}
+	var timestamp uint32
+	if err := binary.Read(r, binary.BigEndian, &timestamp); err != nil {
+		return nil, ErrInvalidKeytab
+	}
+
+	// Read the 8-bit key version number
+	var kvno8 uint8
+	if err := binary.Read(r, binary.BigEndian, &kvno8); err != nil {
+		return nil, ErrInvalidKeytab
+	}
+
+	// Read the key
+	var keyType uint16
+	if err := binary.Read(r, binary.BigEndian, &keyType); err != nil {
+		return nil, ErrInvalidKeytab
+	}
+	key, err := readCountedString(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the 32-bit key version number, which newer files append
+	kvno := uint32(kvno8)
+	if r.Len() >= 4 {
+		var kvno32 uint32
+		if err := binary.Read(r, binary.BigEndian, &kvno32); err != nil {
+			return nil, ErrInvalidKeytab
+		}
+		if kvno32 != 0 {
+			kvno = kvno32
+		}
+	}
+
+	// Create the entry
+	entry := &KeytabEntry{
+		Principal: strings.Join(components, "/"),
+		Realm:     realm,
+		NameType:  nameType,
+		Timestamp: time.Unix(int64(timestamp), 0),
+		KVNO:      kvno,
+		Key:       EncryptionKey{Type: EType(keyType), Value: []byte(key)},
+	}
+
+	return entry, nil
+}
+
+// Marshal serializes a keytab in the MIT file format
+func (k *Keytab) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
+
+	// Write the file format version
+	if err := binary.Write(buf, binary.BigEndian, uint16(keytabVersion)); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range k.Entries {
+		// Serialize the entry
+		record := new(bytes.Buffer)
+		components := strings.Split(entry.Principal, "/")
+		binary.Write(record, binary.BigEndian, uint16(len(components)))
+		writeCountedString(record, entry.Realm)
+		for _, c := range components {
+			writeCountedString(record, c)
+		}
+		binary.Write(record, binary.BigEndian, entry.NameType)
+		binary.Write(record, binary.BigEndian, uint32(entry.Timestamp.Unix()))
+		binary.Write(record, binary.BigEndian, uint8(entry.KVNO))
+		binary.Write(record, binary.BigEndian, uint16(entry.Key.Type))
+		writeCountedString(record, string(entry.Key.Value))
+		binary.Write(record, binary.BigEndian, entry.KVNO)
+
+		// Write the entry size and the entry
+		if err := binary.Write(buf, binary.BigEndian, int32(record.Len())); err != nil {
+			return nil, err
+		}
+		buf.Write(record.Bytes())
+	}
+
+	return buf.Bytes(), nil
+}
+
+// key returns the key of a service principal for the encryption type. A zero kvno selects
+// the newest key, principal names are compared case-insensitively as host names may differ in case.
+func (k *Keytab) key(principal string, realm string, kvno uint32, etype EType) (EncryptionKey, bool) {
+	var found *KeytabEntry
+	for i := range k.Entries {
+		entry := &k.Entries[i]
+		if !strings.EqualFold(entry.Principal, principal) || entry.Realm != realm || entry.Key.Type != etype {
+			continue
+		}
+		if kvno != 0 && entry.KVNO != kvno {
+			continue
+		}
+		if found == nil || entry.KVNO > found.KVNO {
+			found = entry
+		}
+	}
+	if found == nil {
+		return EncryptionKey{}, false
+	}
+	return found.Key, true
+}
+
+// readCountedString reads a string prefixed with its 16-bit length
+func readCountedString(r *bytes.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", ErrInvalidKeytab
+	}
+	s := make([]byte, length)
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", ErrInvalidKeytab
+	}
+	return string(s), nil
+}
+
+// writeCountedString writes a string prefixed with its 16-bit length
+func writeCountedString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
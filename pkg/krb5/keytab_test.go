@@ -0,0 +1,61 @@
+package krb5
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestKeytabParse(t *testing.T) {
+	data := readTestData(t, "service.keytab")
+	kt, err := KeytabParse(data)
+	if err != nil {
+		t.Fatalf("KeytabParse() error = %v", err)
+	}
+	if len(kt.Entries) != 2 {
+		t.Fatalf("KeytabParse() entries = %d, want 2", len(kt.Entries))
+	}
+	for _, etype := range []EType{ETypeAES256CTSHMACSHA196, ETypeRC4HMAC} {
+		if _, ok := kt.key("CIFS/FS.example.com", "EXAMPLE.COM", 3, etype); !ok {
+			t.Errorf("key() found no key of type %d", etype)
+		}
+	}
+
+	// The keytab serializes back to the same file
+	out, err := kt.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("Marshal() = %x, want %x", out, data)
+	}
+}
+
+func TestKeytabParseInvalid(t *testing.T) {
+	// entry returns a keytab of a single entry of the given size followed by the given data
+	entry := func(size int32, data []byte) []byte {
+		buf := []byte{0x05, 0x02}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(size))
+		return append(buf, data...)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "wrong version", data: []byte{0x05, 0x01}},
+		{name: "truncated size", data: []byte{0x05, 0x02, 0x00}},
+		{name: "size beyond the file", data: entry(0x7fffffff, []byte{0x00, 0x01})},
+		{name: "truncated entry", data: entry(16, make([]byte, 8))},
+		{name: "deleted entry beyond the file", data: entry(-0x7fffffff, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := KeytabParse(tt.data); !errors.Is(err, ErrInvalidKeytab) {
+				t.Errorf("KeytabParse() error = %v, want %v", err, ErrInvalidKeytab)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Package krb5 implements a Kerberos V5 acceptor (RFC 4120, RFC 4121) that validates
+// AP-REQ messages against the service keys of a keytab, without contacting a KDC.
+package krb5
+
+import (
+	"encoding/asn1"
+	"errors"
+	"strings"
+)
+
+// OIDKerberos5 identifies Kerberos V5 in GSS-API tokens
+var OIDKerberos5 = asn1.ObjectIdentifier{1, 2, 840, 113554, 1, 2, 2}
+
+// Message types
+const (
+	msgTypeAPReq = 14
+	msgTypeAPRep = 15
+)
+
+// Application tags of the Kerberos messages and their encrypted parts
+const (
+	tagTicket        = 1
+	tagAuthenticator = 2
+	tagEncTicketPart = 3
+	tagAPReq         = 14
+	tagAPRep         = 15
+	tagEncAPRepPart  = 27
+)
+
+// Key usage numbers (RFC 4120, section 7.5.1 and RFC 4121, section 2)
+const (
+	keyUsageTicket             = 2
+	keyUsageAPReqAuthenticator = 11
+	keyUsageAPRepEncPart       = 12
+	keyUsageAcceptorSign       = 23
+	keyUsageInitiatorSign      = 25
+)
+
+// rc4UsageSign is the message type of the checksum of RC4-HMAC MIC tokens (RFC 4757, section 7.3)
+const rc4UsageSign = 15
+
+// apOptionMutualRequired is the AP option bit asking the acceptor to answer with an AP-REP
+const apOptionMutualRequired = 2
+
+var (
+	// ErrInvalidMessage is returned for a malformed Kerberos message
+	ErrInvalidMessage = errors.New("krb5: invalid message")
+
+	// ErrNoKey is returned when the keytab holds no key for the service a ticket was issued to
+	ErrNoKey = errors.New("krb5: no key for service principal")
+
+	// ErrIntegrity is returned when decrypted data fails its integrity check
+	ErrIntegrity = errors.New("krb5: integrity check failed")
+
+	// ErrUnsupportedEType is returned for an encryption type that is not implemented
+	ErrUnsupportedEType = errors.New("krb5: unsupported encryption type")
+
+	// ErrTicketExpired is returned for a ticket that is not valid at the current time
+	ErrTicketExpired = errors.New("krb5: ticket not yet valid or expired")
+
+	// ErrClockSkew is returned when the authenticator time is too far from the current time
+	ErrClockSkew = errors.New("krb5: clock skew too great")
+
+	// ErrReplay is returned for an authenticator that was already seen
+	ErrReplay = errors.New("krb5: request is a replay")
+
+	// ErrClientMismatch is returned when the authenticator and the ticket name different clients
+	ErrClientMismatch = errors.New("krb5: authenticator does not match ticket")
+)
+
+// principalName is the ASN.1 structure of a PrincipalName
+type principalName struct {
+	NameType   int32           `asn1:"explicit,tag:0"`
+	NameString []asn1.RawValue `asn1:"explicit,tag:1"`
+}
+
+// String returns the components of the name joined with slashes
+func (n principalName) String() string {
+	components := make([]string, len(n.NameString))
+	for i, s := range n.NameString {
+		components[i] = string(s.Bytes)
+	}
+	return strings.Join(components, "/")
+}
+
+// encryptedData is the ASN.1 structure of EncryptedData
+type encryptedData struct {
+	EType  int32  `asn1:"explicit,tag:0"`
+	KVNO   int64  `asn1:"explicit,optional,tag:1"`
+	Cipher []byte `asn1:"explicit,tag:2"`
+}
+
+// encryptionKey is the ASN.1 structure of EncryptionKey
+type encryptionKey struct {
+	KeyType  int32  `asn1:"explicit,tag:0"`
+	KeyValue []byte `asn1:"explicit,tag:1"`
+}
+
+// kerberosString decodes a GeneralString wrapped in an explicit tag, encoding/asn1 cannot decode it directly
+func kerberosString(v asn1.RawValue) (string, error) {
+	var s asn1.RawValue
+	if _, err := asn1.Unmarshal(v.Bytes, &s); err != nil {
+		return "", ErrInvalidMessage
+	}
+	return string(s.Bytes), nil
+}
+
+// wrap encodes content as a constructed value with the given class and tag
+func wrap(class int, tag int, content []byte) ([]byte, error) {
+	return asn1.Marshal(asn1.RawValue{Class: class, Tag: tag, IsCompound: true, Bytes: content})
+}
+
+// unwrap returns the content of a constructed value with the given class and tag, and the data following it
+func unwrap(data []byte, class int, tag int) ([]byte, []byte, error) {
+	var v asn1.RawValue
+	rest, err := asn1.Unmarshal(data, &v)
+	if err != nil || v.Class != class || v.Tag != tag || !v.IsCompound {
+		return nil, nil, ErrInvalidMessage
+	}
+	return v.Bytes, rest, nil
+}
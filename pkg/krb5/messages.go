@@ -0,0 +1,99 @@
+package krb5
+
+import (
+	"encoding/asn1"
+	"time"
+)
+
+// apReq is the ASN.1 structure of KRB_AP_REQ
+type apReq struct {
+	PVNO          int32          `asn1:"explicit,tag:0"`
+	MsgType       int32          `asn1:"explicit,tag:1"`
+	APOptions     asn1.BitString `asn1:"explicit,tag:2"`
+	Ticket        asn1.RawValue  `asn1:"explicit,tag:3"`
+	Authenticator encryptedData  `asn1:"explicit,tag:4"`
+}
+
+// ticket is the ASN.1 structure of a Ticket
+type ticket struct {
+	TktVNO  int32         `asn1:"explicit,tag:0"`
+	Realm   asn1.RawValue `asn1:"explicit,tag:1"`
+	SName   principalName `asn1:"explicit,tag:2"`
+	EncPart encryptedData `asn1:"explicit,tag:3"`
+}
+
+// transitedEncoding is the ASN.1 structure of TransitedEncoding
+type transitedEncoding struct {
+	TRType   int32  `asn1:"explicit,tag:0"`
+	Contents []byte `asn1:"explicit,tag:1"`
+}
+
+// encTicketPart is the ASN.1 structure of EncTicketPart, the part of a ticket encrypted with the service key
+type encTicketPart struct {
+	Flags             asn1.BitString    `asn1:"explicit,tag:0"`
+	Key               encryptionKey     `asn1:"explicit,tag:1"`
+	CRealm            asn1.RawValue     `asn1:"explicit,tag:2"`
+	CName             principalName     `asn1:"explicit,tag:3"`
+	Transited         transitedEncoding `asn1:"explicit,tag:4"`
+	AuthTime          time.Time         `asn1:"generalized,explicit,tag:5"`
+	StartTime         time.Time         `asn1:"generalized,explicit,optional,tag:6"`
+	EndTime           time.Time         `asn1:"generalized,explicit,tag:7"`
+	RenewTill         time.Time         `asn1:"generalized,explicit,optional,tag:8"`
+	CAddr             asn1.RawValue     `asn1:"explicit,optional,tag:9"`
+	AuthorizationData asn1.RawValue     `asn1:"explicit,optional,tag:10"`
+}
+
+// checksum is the ASN.1 structure of a Checksum
+type checksum struct {
+	CksumType int32  `asn1:"explicit,tag:0"`
+	Checksum  []byte `asn1:"explicit,tag:1"`
+}
+
+// authenticator is the ASN.1 structure of an Authenticator, encrypted with the session key of the ticket
+type authenticator struct {
+	AuthenticatorVNO  int32         `asn1:"explicit,tag:0"`
+	CRealm            asn1.RawValue `asn1:"explicit,tag:1"`
+	CName             principalName `asn1:"explicit,tag:2"`
+	Cksum             checksum      `asn1:"explicit,optional,tag:3"`
+	Cusec             int32         `asn1:"explicit,tag:4"`
+	CTime             time.Time     `asn1:"generalized,explicit,tag:5"`
+	SubKey            encryptionKey `asn1:"explicit,optional,tag:6"`
+	SeqNumber         int64         `asn1:"explicit,optional,tag:7"`
+	AuthorizationData asn1.RawValue `asn1:"explicit,optional,tag:8"`
+}
+
+// apRep is the ASN.1 structure of KRB_AP_REP
+type apRep struct {
+	PVNO    int32         `asn1:"explicit,tag:0"`
+	MsgType int32         `asn1:"explicit,tag:1"`
+	EncPart encryptedData `asn1:"explicit,tag:2"`
+}
+
+// encAPRepPart is the ASN.1 structure of EncAPRepPart
+type encAPRepPart struct {
+	CTime     time.Time     `asn1:"generalized,explicit,tag:0"`
+	Cusec     int32         `asn1:"explicit,tag:1"`
+	SubKey    encryptionKey `asn1:"explicit,optional,tag:2"`
+	SeqNumber int64         `asn1:"explicit,optional,tag:3"`
+}
+
+// unmarshalApplication parses a value wrapped in an application tag
+func unmarshalApplication(data []byte, tag int, v interface{}) error {
+	content, _, err := unwrap(data, asn1.ClassApplication, tag)
+	if err != nil {
+		return err
+	}
+	if _, err := asn1.Unmarshal(content, v); err != nil {
+		return ErrInvalidMessage
+	}
+	return nil
+}
+
+// marshalApplication serializes a value wrapped in an application tag
+func marshalApplication(tag int, v interface{}) ([]byte, error) {
+	content, err := asn1.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(asn1.ClassApplication, tag, content)
+}
@@ -0,0 +1,80 @@
+package ntlm
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	// authenticateMICOffset is the offset of the MIC in an AUTHENTICATE_MESSAGE carrying a version
+	authenticateMICOffset = 72
+
+	// authenticateMICSize is the size of the MIC
+	authenticateMICSize = 16
+)
+
+// AuthenticateMessage represents an NTLM AUTHENTICATE_MESSAGE
+type AuthenticateMessage struct {
+	LmChallengeResponse       []byte
+	NtChallengeResponse       []byte
+	Domain                    string
+	User                      string
+	Workstation               string
+	EncryptedRandomSessionKey []byte
+	Flags                     NegotiateFlag
+}
+
+// AuthenticateMessageParse parses an NTLM AUTHENTICATE_MESSAGE
+func AuthenticateMessageParse(data []byte) (*AuthenticateMessage, error) {
+	if TypeOf(data) != MessageTypeAuthenticate {
+		return nil, ErrInvalidMessage
+	}
+
+	// Create a new bytes reader after the signature and the message type
+	r := bytes.NewReader(data[12:])
+
+	// Read the payload fields, in the order they appear in the message
+	var lm, nt, domain, user, workstation, sessionKey field
+	for _, f := range []*field{&lm, &nt, &domain, &user, &workstation, &sessionKey} {
+		if err := binary.Read(r, binary.LittleEndian, f); err != nil {
+			return nil, ErrInvalidMessage
+		}
+	}
+
+	// Read the negotiate flags
+	var flags NegotiateFlag
+	if err := binary.Read(r, binary.LittleEndian, &flags); err != nil {
+		return nil, ErrInvalidMessage
+	}
+
+	// Read the payload
+	message := &AuthenticateMessage{Flags: flags}
+	var err error
+	if message.LmChallengeResponse, err = readField(data, lm); err != nil {
+		return nil, err
+	}
+	if message.NtChallengeResponse, err = readField(data, nt); err != nil {
+		return nil, err
+	}
+	if message.EncryptedRandomSessionKey, err = readField(data, sessionKey); err != nil {
+		return nil, err
+	}
+
+	// Read the strings, in Unicode unless the client negotiated OEM strings
+	for _, s := range []struct {
+		f   field
+		dst *string
+	}{{domain, &message.Domain}, {user, &message.User}, {workstation, &message.Workstation}} {
+		b, err := readField(data, s.f)
+		if err != nil {
+			return nil, err
+		}
+		if flags&NegotiateUnicode != 0 {
+			*s.dst = decodeUTF16LE(b)
+		} else {
+			*s.dst = string(b)
+		}
+	}
+
+	return message, nil
+}
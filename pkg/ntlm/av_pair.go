@@ -0,0 +1,120 @@
+package ntlm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// AvID identifies an attribute of the target information in NTLM messages
+type AvID uint16
+
+const (
+	// AvEOL ends the attribute list
+	AvEOL AvID = 0x0000
+
+	// AvNbComputerName is the NetBIOS name of the server
+	AvNbComputerName AvID = 0x0001
+
+	// AvNbDomainName is the NetBIOS name of the domain
+	AvNbDomainName AvID = 0x0002
+
+	// AvDNSComputerName is the DNS name of the server
+	AvDNSComputerName AvID = 0x0003
+
+	// AvDNSDomainName is the DNS name of the domain
+	AvDNSDomainName AvID = 0x0004
+
+	// AvDNSTreeName is the DNS name of the forest
+	AvDNSTreeName AvID = 0x0005
+
+	// AvFlags holds the MsvAvFlags of the client
+	AvFlags AvID = 0x0006
+
+	// AvTimestamp is the FILETIME the challenge was created at
+	AvTimestamp AvID = 0x0007
+
+	// AvSingleHost holds the Single_Host_Data structure
+	AvSingleHost AvID = 0x0008
+
+	// AvTargetName is the SPN of the target server
+	AvTargetName AvID = 0x0009
+
+	// AvChannelBindings is the MD5 hash of the channel bindings
+	AvChannelBindings AvID = 0x000A
+)
+
+// avFlagMICPresent is set in AvFlags when the authenticate message carries a MIC
+const avFlagMICPresent = 0x00000002
+
+// AvPair is a single attribute of the target information
+type AvPair struct {
+	ID    AvID
+	Value []byte
+}
+
+// AvPairs is an ordered list of attributes, the terminating AvEOL is not included
+type AvPairs []AvPair
+
+// Get returns the value of the first attribute with the given ID
+func (p AvPairs) Get(id AvID) ([]byte, bool) {
+	for _, pair := range p {
+		if pair.ID == id {
+			return pair.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Marshal serializes the attribute list followed by AvEOL
+func (p AvPairs) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
+
+	for _, pair := range append(p, AvPair{ID: AvEOL}) {
+		// Write the attribute ID
+		if err := binary.Write(buf, binary.LittleEndian, pair.ID); err != nil {
+			return nil, err
+		}
+
+		// Write the value length and the value
+		if err := binary.Write(buf, binary.LittleEndian, uint16(len(pair.Value))); err != nil {
+			return nil, err
+		}
+		buf.Write(pair.Value)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// AvPairsParse parses an attribute list up to AvEOL
+func AvPairsParse(data []byte) (AvPairs, error) {
+	// Create a new bytes reader
+	r := bytes.NewReader(data)
+
+	var pairs AvPairs
+	for {
+		// Read the attribute ID
+		var id AvID
+		if err := binary.Read(r, binary.LittleEndian, &id); err != nil {
+			return nil, ErrInvalidMessage
+		}
+
+		// Read the value length
+		var length uint16
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return nil, ErrInvalidMessage
+		}
+		if id == AvEOL {
+			return pairs, nil
+		}
+
+		// Read the value
+		value := make([]byte, length)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, ErrInvalidMessage
+		}
+
+		pairs = append(pairs, AvPair{ID: id, Value: value})
+	}
+}
@@ -0,0 +1,92 @@
+package ntlm
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// challengeHeaderSize is the size of the fixed part of a CHALLENGE_MESSAGE, version included
+const challengeHeaderSize = 56
+
+// Version represents the version field of NTLM messages
+type Version struct {
+	ProductMajorVersion uint8
+	ProductMinorVersion uint8
+	ProductBuild        uint16
+	Reserved            [3]byte
+	NTLMRevision        uint8
+}
+
+// DefaultVersion is the version announced by the server
+var DefaultVersion = Version{
+	ProductMajorVersion: 10,
+	ProductMinorVersion: 0,
+	ProductBuild:        20348,
+	NTLMRevision:        15,
+}
+
+// ChallengeMessage represents an NTLM CHALLENGE_MESSAGE
+type ChallengeMessage struct {
+	TargetName      string
+	Flags           NegotiateFlag
+	ServerChallenge [8]byte
+	TargetInfo      AvPairs
+	Version         Version
+}
+
+// Marshal serializes an NTLM CHALLENGE_MESSAGE into a byte slice
+func (m *ChallengeMessage) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
+
+	// Serialize the payload, the target name followed by the target info
+	targetName := encodeUTF16LE(m.TargetName)
+	targetInfo, err := m.TargetInfo.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	// Write the signature and the message type
+	if err := binary.Write(buf, binary.LittleEndian, Signature); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, MessageTypeChallenge); err != nil {
+		return nil, err
+	}
+
+	// Write the target name field
+	targetNameField := field{Len: uint16(len(targetName)), MaxLen: uint16(len(targetName)), Offset: challengeHeaderSize}
+	if err := binary.Write(buf, binary.LittleEndian, targetNameField); err != nil {
+		return nil, err
+	}
+
+	// Write the negotiate flags
+	if err := binary.Write(buf, binary.LittleEndian, m.Flags); err != nil {
+		return nil, err
+	}
+
+	// Write the server challenge and the reserved field
+	if err := binary.Write(buf, binary.LittleEndian, m.ServerChallenge); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint64(0)); err != nil {
+		return nil, err
+	}
+
+	// Write the target info field
+	targetInfoField := field{Len: uint16(len(targetInfo)), MaxLen: uint16(len(targetInfo)), Offset: challengeHeaderSize + uint32(len(targetName))}
+	if err := binary.Write(buf, binary.LittleEndian, targetInfoField); err != nil {
+		return nil, err
+	}
+
+	// Write the version
+	if err := binary.Write(buf, binary.LittleEndian, m.Version); err != nil {
+		return nil, err
+	}
+
+	// Write the payload
+	buf.Write(targetName)
+	buf.Write(targetInfo)
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,60 @@
+package ntlm
+
+// NegotiateFlag represents the negotiate flags of NTLM messages
+type NegotiateFlag uint32
+
+const (
+	// NegotiateUnicode requests Unicode strings in the payload
+	NegotiateUnicode NegotiateFlag = 0x00000001
+
+	// NegotiateOEM requests OEM strings in the payload
+	NegotiateOEM NegotiateFlag = 0x00000002
+
+	// RequestTarget requests the target name in the challenge
+	RequestTarget NegotiateFlag = 0x00000004
+
+	// NegotiateSign requests message signing
+	NegotiateSign NegotiateFlag = 0x00000010
+
+	// NegotiateSeal requests message sealing
+	NegotiateSeal NegotiateFlag = 0x00000020
+
+	// NegotiateLMKey requests LM session key computation
+	NegotiateLMKey NegotiateFlag = 0x00000080
+
+	// NegotiateNTLM requests NTLM authentication
+	NegotiateNTLM NegotiateFlag = 0x00000200
+
+	// NegotiateAnonymous marks an anonymous authenticate message
+	NegotiateAnonymous NegotiateFlag = 0x00000800
+
+	// NegotiateAlwaysSign requests a signature even without NegotiateSign
+	NegotiateAlwaysSign NegotiateFlag = 0x00008000
+
+	// TargetTypeDomain marks the target name as a domain name
+	TargetTypeDomain NegotiateFlag = 0x00010000
+
+	// TargetTypeServer marks the target name as a server name
+	TargetTypeServer NegotiateFlag = 0x00020000
+
+	// NegotiateExtendedSessionSecurity requests NTLMv2 session security
+	NegotiateExtendedSessionSecurity NegotiateFlag = 0x00080000
+
+	// NegotiateIdentify requests an identify level token
+	NegotiateIdentify NegotiateFlag = 0x00100000
+
+	// NegotiateTargetInfo marks the presence of target information in the challenge
+	NegotiateTargetInfo NegotiateFlag = 0x00800000
+
+	// NegotiateVersion marks the presence of the version field
+	NegotiateVersion NegotiateFlag = 0x02000000
+
+	// Negotiate128 requests 128-bit session key negotiation
+	Negotiate128 NegotiateFlag = 0x20000000
+
+	// NegotiateKeyExch requests an explicit key exchange
+	NegotiateKeyExch NegotiateFlag = 0x40000000
+
+	// Negotiate56 requests 56-bit encryption
+	Negotiate56 NegotiateFlag = 0x80000000
+)
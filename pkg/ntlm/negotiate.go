@@ -0,0 +1,57 @@
+package ntlm
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// NegotiateMessage represents an NTLM NEGOTIATE_MESSAGE
+type NegotiateMessage struct {
+	Flags       NegotiateFlag
+	Domain      string
+	Workstation string
+}
+
+// NegotiateMessageParse parses an NTLM NEGOTIATE_MESSAGE
+func NegotiateMessageParse(data []byte) (*NegotiateMessage, error) {
+	if TypeOf(data) != MessageTypeNegotiate {
+		return nil, ErrInvalidMessage
+	}
+
+	// Create a new bytes reader after the signature and the message type
+	r := bytes.NewReader(data[12:])
+
+	// Read the negotiate flags
+	var flags NegotiateFlag
+	if err := binary.Read(r, binary.LittleEndian, &flags); err != nil {
+		return nil, ErrInvalidMessage
+	}
+
+	// Read the domain and workstation fields
+	var domainField, workstationField field
+	if err := binary.Read(r, binary.LittleEndian, &domainField); err != nil {
+		return nil, ErrInvalidMessage
+	}
+	if err := binary.Read(r, binary.LittleEndian, &workstationField); err != nil {
+		return nil, ErrInvalidMessage
+	}
+
+	// Read the OEM domain and workstation names, they are only present when the flags say so
+	message := &NegotiateMessage{Flags: flags}
+	if domainField.Len > 0 {
+		domain, err := readField(data, domainField)
+		if err != nil {
+			return nil, err
+		}
+		message.Domain = string(domain)
+	}
+	if workstationField.Len > 0 {
+		workstation, err := readField(data, workstationField)
+		if err != nil {
+			return nil, err
+		}
+		message.Workstation = string(workstation)
+	}
+
+	return message, nil
+}
@@ -0,0 +1,90 @@
+// Package ntlm implements the server side of the NTLM authentication protocol (MS-NLMP)
+// with NTLMv2 responses, as used by SMB clients inside SPNEGO.
+package ntlm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"unicode/utf16"
+)
+
+// Signature starts every NTLM message
+var Signature = [8]byte{'N', 'T', 'L', 'M', 'S', 'S', 'P', 0}
+
+// MessageType represents the type of an NTLM message
+type MessageType uint32
+
+const (
+	// MessageTypeNegotiate is the NEGOTIATE_MESSAGE sent first by the client
+	MessageTypeNegotiate MessageType = 1
+
+	// MessageTypeChallenge is the CHALLENGE_MESSAGE sent by the server
+	MessageTypeChallenge MessageType = 2
+
+	// MessageTypeAuthenticate is the AUTHENTICATE_MESSAGE carrying the client response
+	MessageTypeAuthenticate MessageType = 3
+)
+
+var (
+	// ErrInvalidMessage is returned for a truncated or malformed NTLM message
+	ErrInvalidMessage = errors.New("ntlm: invalid message")
+
+	// ErrUnexpectedMessage is returned when a message arrives out of order
+	ErrUnexpectedMessage = errors.New("ntlm: unexpected message")
+
+	// ErrLogonFailure is returned when the client response does not match the password of the user
+	ErrLogonFailure = errors.New("ntlm: logon failure")
+
+	// ErrUnknownUser is returned when the user of the client response is unknown
+	ErrUnknownUser = errors.New("ntlm: unknown user")
+
+	// ErrNTLMv1 is returned for clients answering with NTLMv1 or LM responses, which are not accepted
+	ErrNTLMv1 = errors.New("ntlm: NTLMv1 responses are not supported")
+
+	// ErrInvalidMIC is returned when the message integrity code of a message does not match
+	ErrInvalidMIC = errors.New("ntlm: invalid message integrity code")
+)
+
+// TypeOf returns the type of an NTLM message, or zero if data is not an NTLM message
+func TypeOf(data []byte) MessageType {
+	if len(data) < 12 || !bytes.Equal(data[:8], Signature[:]) {
+		return 0
+	}
+	return MessageType(binary.LittleEndian.Uint32(data[8:]))
+}
+
+// field describes a variable length payload field by its length and offset from the start of the message
+type field struct {
+	Len    uint16
+	MaxLen uint16
+	Offset uint32
+}
+
+// readField reads the payload a field points to from the message
+func readField(msg []byte, f field) ([]byte, error) {
+	end := uint64(f.Offset) + uint64(f.Len)
+	if end > uint64(len(msg)) {
+		return nil, ErrInvalidMessage
+	}
+	return msg[f.Offset:end], nil
+}
+
+// encodeUTF16LE encodes a string as UTF-16 in little-endian byte order
+func encodeUTF16LE(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, len(u)*2)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+	return b
+}
+
+// decodeUTF16LE decodes a UTF-16 little-endian byte slice into a string
+func decodeUTF16LE(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,309 @@
+package ntlm
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+// filetimeEpochOffset is the number of 100-nanosecond intervals between 1601-01-01 and 1970-01-01
+const filetimeEpochOffset = 116444736000000000
+
+// ntProofStrSize is the size of the NTProofStr at the start of an NTLMv2 response
+const ntProofStrSize = 16
+
+// ntlmv2BlobAvPairsOffset is the offset of the AV pairs in the NTLMv2 client challenge blob
+const ntlmv2BlobAvPairsOffset = 28
+
+// Magic constants of the signing and sealing key derivation
+const (
+	clientSigningMagic = "session key to client-to-server signing key magic constant\x00"
+	serverSigningMagic = "session key to server-to-client signing key magic constant\x00"
+	clientSealingMagic = "session key to client-to-server sealing key magic constant\x00"
+	serverSealingMagic = "session key to server-to-client sealing key magic constant\x00"
+)
+
+// Config configures the server side of NTLM authentication
+type Config struct {
+	// Domain is the NetBIOS domain name announced to clients
+	Domain string
+
+	// Computer is the NetBIOS name of the server
+	Computer string
+
+	// DNSDomain and DNSComputer are the DNS names of the domain and the server, they are optional
+	DNSDomain   string
+	DNSComputer string
+
+	// NTHash returns the NT hash of the password of a user, it must return an error for unknown users
+	NTHash func(domain string, user string) ([16]byte, error)
+}
+
+// ServerContext authenticates a single client. It is fed the NEGOTIATE_MESSAGE with Challenge
+// and the AUTHENTICATE_MESSAGE with Authenticate, and holds the client identity afterwards.
+type ServerContext struct {
+	config *Config
+
+	// negotiate and challenge are kept to verify the MIC of the authenticate message
+	negotiate       []byte
+	challenge       []byte
+	serverChallenge [8]byte
+	flags           NegotiateFlag
+
+	// Domain, User and Workstation identify the authenticated client
+	Domain      string
+	User        string
+	Workstation string
+
+	// Anonymous is set when the client logged in without credentials
+	Anonymous bool
+
+	// SessionKey is the exported session key, nil for anonymous clients
+	SessionKey []byte
+
+	// The signing keys and sealing handles of both directions, used for MICs over other messages
+	clientSigningKey []byte
+	serverSigningKey []byte
+	clientSealing    *rc4.Cipher
+	serverSealing    *rc4.Cipher
+	clientSequence   uint32
+	serverSequence   uint32
+}
+
+// NewServerContext creates a context for authenticating a client
+func NewServerContext(config *Config) *ServerContext {
+	return &ServerContext{config: config}
+}
+
+// Challenge answers a NEGOTIATE_MESSAGE with a CHALLENGE_MESSAGE
+func (s *ServerContext) Challenge(negotiate []byte) ([]byte, error) {
+	if s.challenge != nil {
+		return nil, ErrUnexpectedMessage
+	}
+
+	// Parse the negotiate message
+	request, err := NegotiateMessageParse(negotiate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Answer the options the client asked for and the server supports
+	s.flags = NegotiateUnicode | RequestTarget | NegotiateNTLM | TargetTypeServer | NegotiateTargetInfo | NegotiateVersion
+	s.flags |= request.Flags & (NegotiateSign | NegotiateSeal | NegotiateAlwaysSign |
+		NegotiateExtendedSessionSecurity | NegotiateIdentify | Negotiate128 | Negotiate56 | NegotiateKeyExch)
+
+	// Create the server challenge
+	if _, err := rand.Read(s.serverChallenge[:]); err != nil {
+		return nil, err
+	}
+
+	// Describe the server, the timestamp makes clients protect the exchange with a MIC
+	targetInfo := AvPairs{
+		{ID: AvNbDomainName, Value: encodeUTF16LE(s.config.Domain)},
+		{ID: AvNbComputerName, Value: encodeUTF16LE(s.config.Computer)},
+	}
+	if s.config.DNSDomain != "" {
+		targetInfo = append(targetInfo, AvPair{ID: AvDNSDomainName, Value: encodeUTF16LE(s.config.DNSDomain)})
+	}
+	if s.config.DNSComputer != "" {
+		targetInfo = append(targetInfo, AvPair{ID: AvDNSComputerName, Value: encodeUTF16LE(s.config.DNSComputer)})
+	}
+	timestamp := binary.LittleEndian.AppendUint64(nil, uint64(time.Now().UnixNano()/100+filetimeEpochOffset))
+	targetInfo = append(targetInfo, AvPair{ID: AvTimestamp, Value: timestamp})
+
+	// Marshal the challenge message
+	challenge := &ChallengeMessage{
+		TargetName:      s.config.Computer,
+		Flags:           s.flags,
+		ServerChallenge: s.serverChallenge,
+		TargetInfo:      targetInfo,
+		Version:         DefaultVersion,
+	}
+	data, err := challenge.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	s.negotiate = negotiate
+	s.challenge = data
+	return data, nil
+}
+
+// Authenticate verifies the NTLMv2 response of an AUTHENTICATE_MESSAGE.
+// It returns ErrUnknownUser if the user is unknown and ErrLogonFailure if the response does not match.
+func (s *ServerContext) Authenticate(authenticate []byte) error {
+	if s.challenge == nil || s.User != "" || s.Anonymous {
+		return ErrUnexpectedMessage
+	}
+
+	// Parse the authenticate message
+	request, err := AuthenticateMessageParse(authenticate)
+	if err != nil {
+		return err
+	}
+	s.Domain = request.Domain
+	s.User = request.User
+	s.Workstation = request.Workstation
+
+	// An empty user with empty responses is an anonymous logon
+	if request.User == "" && len(request.NtChallengeResponse) == 0 &&
+		(len(request.LmChallengeResponse) == 0 || bytes.Equal(request.LmChallengeResponse, []byte{0})) {
+		s.Anonymous = true
+		return nil
+	}
+
+	// Only NTLMv2 responses are accepted, NTLMv1 responses are exactly 24 bytes long
+	if len(request.NtChallengeResponse) <= ntProofStrSize+ntlmv2BlobAvPairsOffset {
+		return ErrNTLMv1
+	}
+
+	// Look up the NT hash of the user
+	if s.config.NTHash == nil {
+		return ErrUnknownUser
+	}
+	hash, err := s.config.NTHash(request.Domain, request.User)
+	if err != nil {
+		return ErrUnknownUser
+	}
+
+	// Verify the NTProofStr, clients compute it with the domain they sent or with an empty one
+	ntProofStr := request.NtChallengeResponse[:ntProofStrSize]
+	blob := request.NtChallengeResponse[ntProofStrSize:]
+	var responseKey []byte
+	for _, domain := range []string{request.Domain, ""} {
+		key := ntowfv2(hash, request.User, domain)
+		if hmac.Equal(hmacMD5(key, s.serverChallenge[:], blob), ntProofStr) {
+			responseKey = key
+			break
+		}
+	}
+	if responseKey == nil {
+		return ErrLogonFailure
+	}
+
+	// Derive the session key, the client may have replaced it with a random key
+	keyExchangeKey := hmacMD5(responseKey, ntProofStr)
+	sessionKey := keyExchangeKey
+	if s.flags&NegotiateKeyExch != 0 && len(request.EncryptedRandomSessionKey) == 16 {
+		cipher, err := rc4.NewCipher(keyExchangeKey)
+		if err != nil {
+			return err
+		}
+		sessionKey = make([]byte, 16)
+		cipher.XORKeyStream(sessionKey, request.EncryptedRandomSessionKey)
+	}
+
+	// Verify the MIC over the three messages when the client announces it
+	pairs, err := AvPairsParse(blob[ntlmv2BlobAvPairsOffset:])
+	if err != nil {
+		return err
+	}
+	if flags, ok := pairs.Get(AvFlags); ok && len(flags) == 4 && binary.LittleEndian.Uint32(flags)&avFlagMICPresent != 0 {
+		if len(authenticate) < authenticateMICOffset+authenticateMICSize {
+			return ErrInvalidMIC
+		}
+		mic := append([]byte{}, authenticate[authenticateMICOffset:authenticateMICOffset+authenticateMICSize]...)
+		zeroed := append([]byte{}, authenticate...)
+		copy(zeroed[authenticateMICOffset:], make([]byte, authenticateMICSize))
+		if !hmac.Equal(hmacMD5(sessionKey, s.negotiate, s.challenge, zeroed), mic) {
+			return ErrInvalidMIC
+		}
+	}
+
+	s.SessionKey = sessionKey
+	return s.initSecurity()
+}
+
+// initSecurity derives the signing keys and sealing handles from the session key
+func (s *ServerContext) initSecurity() error {
+	// Sealing keys are shortened unless 128-bit keys were negotiated
+	sealKey := s.SessionKey
+	if s.flags&Negotiate128 == 0 {
+		if s.flags&Negotiate56 != 0 {
+			sealKey = sealKey[:7]
+		} else {
+			sealKey = sealKey[:5]
+		}
+	}
+
+	s.clientSigningKey = md5Sum(s.SessionKey, []byte(clientSigningMagic))
+	s.serverSigningKey = md5Sum(s.SessionKey, []byte(serverSigningMagic))
+
+	var err error
+	if s.clientSealing, err = rc4.NewCipher(md5Sum(sealKey, []byte(clientSealingMagic))); err != nil {
+		return err
+	}
+	if s.serverSealing, err = rc4.NewCipher(md5Sum(sealKey, []byte(serverSealingMagic))); err != nil {
+		return err
+	}
+	return nil
+}
+
+// VerifyMIC verifies a signature the client computed over msg, such as the SPNEGO mechListMIC
+func (s *ServerContext) VerifyMIC(msg []byte, mic []byte) error {
+	if s.clientSealing == nil {
+		return ErrUnexpectedMessage
+	}
+
+	expected := s.mac(s.clientSigningKey, s.clientSealing, s.clientSequence, msg)
+	s.clientSequence++
+	if !hmac.Equal(expected, mic) {
+		return ErrInvalidMIC
+	}
+	return nil
+}
+
+// MIC signs msg for the client, such as the SPNEGO mechListMIC
+func (s *ServerContext) MIC(msg []byte) ([]byte, error) {
+	if s.serverSealing == nil {
+		return nil, ErrUnexpectedMessage
+	}
+
+	mic := s.mac(s.serverSigningKey, s.serverSealing, s.serverSequence, msg)
+	s.serverSequence++
+	return mic, nil
+}
+
+// mac computes an NTLMSSP_MESSAGE_SIGNATURE with extended session security
+func (s *ServerContext) mac(signingKey []byte, sealing *rc4.Cipher, sequence uint32, msg []byte) []byte {
+	seq := binary.LittleEndian.AppendUint32(nil, sequence)
+
+	// The checksum is the start of the HMAC, encrypted if a key was exchanged
+	checksum := hmacMD5(signingKey, seq, msg)[:8]
+	if s.flags&NegotiateKeyExch != 0 {
+		sealing.XORKeyStream(checksum, checksum)
+	}
+
+	// Version, checksum and sequence number
+	signature := binary.LittleEndian.AppendUint32(nil, 1)
+	signature = append(signature, checksum...)
+	return append(signature, seq...)
+}
+
+// ntowfv2 computes the NTLMv2 response key of a user
+func ntowfv2(hash [16]byte, user string, domain string) []byte {
+	return hmacMD5(hash[:], encodeUTF16LE(strings.ToUpper(user)+domain))
+}
+
+// hmacMD5 computes the HMAC-MD5 of the concatenated data
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	h := hmac.New(md5.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// md5Sum computes the MD5 digest of the concatenated data
+func md5Sum(data ...[]byte) []byte {
+	h := md5.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,80 @@
+package smb
+
+// AccessMask represents the access rights requested on or granted to a file, directory or share
+type AccessMask uint32
+
+const (
+	// FileReadData allows reading the data of a file or listing a directory
+	FileReadData AccessMask = 0x00000001
+
+	// FileWriteData allows writing the data of a file or adding a file to a directory
+	FileWriteData AccessMask = 0x00000002
+
+	// FileAppendData allows appending to a file or adding a subdirectory to a directory
+	FileAppendData AccessMask = 0x00000004
+
+	// FileReadEA allows reading the extended attributes
+	FileReadEA AccessMask = 0x00000008
+
+	// FileWriteEA allows writing the extended attributes
+	FileWriteEA AccessMask = 0x00000010
+
+	// FileExecute allows executing a file or traversing a directory
+	FileExecute AccessMask = 0x00000020
+
+	// FileDeleteChild allows deleting the entries of a directory
+	FileDeleteChild AccessMask = 0x00000040
+
+	// FileReadAttributes allows reading the attributes
+	FileReadAttributes AccessMask = 0x00000080
+
+	// FileWriteAttributes allows writing the attributes
+	FileWriteAttributes AccessMask = 0x00000100
+
+	// Delete allows deleting the file or directory
+	Delete AccessMask = 0x00010000
+
+	// ReadControl allows reading the security descriptor
+	ReadControl AccessMask = 0x00020000
+
+	// WriteDAC allows changing the discretionary access control list
+	WriteDAC AccessMask = 0x00040000
+
+	// WriteOwner allows changing the owner
+	WriteOwner AccessMask = 0x00080000
+
+	// Synchronize allows waiting on the handle
+	Synchronize AccessMask = 0x00100000
+
+	// AccessSystemSecurity allows reading and changing the system access control list
+	AccessSystemSecurity AccessMask = 0x01000000
+
+	// MaximumAllowed asks for the most access the user can be granted
+	MaximumAllowed AccessMask = 0x02000000
+
+	// GenericAll asks for all access rights
+	GenericAll AccessMask = 0x10000000
+
+	// GenericExecute asks for the rights needed to execute
+	GenericExecute AccessMask = 0x20000000
+
+	// GenericWrite asks for the rights needed to write
+	GenericWrite AccessMask = 0x40000000
+
+	// GenericRead asks for the rights needed to read
+	GenericRead AccessMask = 0x80000000
+)
+
+const (
+	// FileGenericRead is the set of rights GenericRead maps to
+	FileGenericRead = FileReadData | FileReadEA | FileReadAttributes | ReadControl | Synchronize
+
+	// FileGenericWrite is the set of rights GenericWrite maps to
+	FileGenericWrite = FileWriteData | FileAppendData | FileWriteEA | FileWriteAttributes | ReadControl | Synchronize
+
+	// FileGenericExecute is the set of rights GenericExecute maps to
+	FileGenericExecute = FileExecute | FileReadAttributes | ReadControl | Synchronize
+
+	// FileAllAccess is the set of rights GenericAll maps to
+	FileAllAccess AccessMask = 0x001F01FF
+)
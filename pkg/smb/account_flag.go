@@ -0,0 +1,15 @@
+package smb
+
+// AccountFlag represents the state of a user account
+type AccountFlag uint32
+
+const (
+	// AccountDisabled indicates that the account may not log in
+	AccountDisabled AccountFlag = 0x0001
+
+	// AccountExpired indicates that the account has expired
+	AccountExpired AccountFlag = 0x0002
+
+	// AccountPasswordMustChange indicates that the password must be changed before the next logon
+	AccountPasswordMustChange AccountFlag = 0x0004
+)
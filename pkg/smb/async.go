@@ -0,0 +1,169 @@
+package smb
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// asyncOperation is a request that was answered with an interim STATUS_PENDING
+// response and completes later with a final response carrying the same AsyncID.
+// The handler watches ctx, which is canceled by an SMB2 CANCEL or when the
+// connection is closed, and must call complete exactly once.
+type asyncOperation struct {
+	conn *Connection
+
+	// header is the request header, with the async flag and the AsyncID set
+	header Header
+
+	// signer signs the final response if the interim response was signed,
+	// encrypted encrypts it if the request was encrypted
+	signer    *signer
+	encrypted *session
+
+	// ctx is canceled when the client cancels the operation or the connection is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// interimSent is closed once the interim response has been written to the connection,
+	// the final response must not overtake it
+	interimSent chan struct{}
+
+	once sync.Once
+}
+
+// goAsync turns the request in packet into an async operation and records the
+// interim response to it. The final response is sent by calling complete on the result.
+func (c *Connection) goAsync(packet *Packet) (*asyncOperation, error) {
+	// Allocate the async ID and register the operation
+	ctx, cancel := context.WithCancel(context.Background())
+	op := &asyncOperation{
+		conn:        c,
+		ctx:         ctx,
+		cancel:      cancel,
+		interimSent: make(chan struct{}),
+	}
+
+	c.asyncMu.Lock()
+	c.nextAsyncID++
+	packet.Header.Flags |= FlagAsyncCommand
+	packet.Header.AsyncID = c.nextAsyncID
+	op.header = packet.Header
+	c.asyncOps[op.header.AsyncID] = op
+	c.asyncMu.Unlock()
+
+	// Marshal the interim response, it grants the credits of the request
+	data, err := (&ErrorResponse{}).Marshal()
+	if err != nil {
+		c.removeAsync(op)
+		return nil, err
+	}
+	buf, err := c.marshalResponse(packet, StatusPending, data)
+	if err != nil {
+		c.removeAsync(op)
+		return nil, err
+	}
+
+	// Record the interim response, it is sent with the other responses of the message
+	packet.respond(StatusPending, buf)
+	packet.async = op
+	op.signer = packet.signer
+	op.encrypted = packet.encrypted
+	return op, nil
+}
+
+// complete sends the final response to an async operation.
+// A nil data sends an error response with the given status.
+func (op *asyncOperation) complete(status Status, data []byte) error {
+	err := net.ErrClosed
+	op.once.Do(func() {
+		c := op.conn
+		c.removeAsync(op)
+
+		// Wait for the interim response to be sent
+		select {
+		case <-op.interimSent:
+		case <-c.done:
+			return
+		}
+
+		// Marshal the final response, the credits were granted by the interim response
+		if data == nil {
+			if data, err = (&ErrorResponse{}).Marshal(); err != nil {
+				return
+			}
+		}
+		header := responseHeader(&op.header, status, 0)
+		var buf []byte
+		if buf, err = header.Marshal(); err != nil {
+			return
+		}
+		buf = append(buf, data...)
+		if op.signer != nil {
+			op.signer.sign(buf)
+		}
+		if op.encrypted != nil {
+			if buf, err = c.encryptMessage(op.encrypted, buf); err != nil {
+				return
+			}
+		}
+
+		// Send the response
+		err = c.writeMessage(buf)
+	})
+	return err
+}
+
+// removeAsync removes an operation from the async table of the connection
+func (c *Connection) removeAsync(op *asyncOperation) {
+	c.asyncMu.Lock()
+	defer c.asyncMu.Unlock()
+
+	delete(c.asyncOps, op.header.AsyncID)
+	op.cancel()
+}
+
+// cancelAsync cancels the async operation a CANCEL request refers to, by AsyncID if the
+// request has an async header and by the MessageID of the original request otherwise
+func (c *Connection) cancelAsync(header *Header) {
+	c.asyncMu.Lock()
+	defer c.asyncMu.Unlock()
+
+	// Find the operation by its async ID
+	if header.IsAsync() {
+		if op, ok := c.asyncOps[header.AsyncID]; ok && op.header.SessionID == header.SessionID {
+			op.cancel()
+		}
+		return
+	}
+
+	// Find the operation by the message ID of the request
+	for _, op := range c.asyncOps {
+		if op.header.MessageID == header.MessageID && op.header.SessionID == header.SessionID {
+			op.cancel()
+			return
+		}
+	}
+}
+
+// cancelSessionAsync cancels the async operations of a session
+func (c *Connection) cancelSessionAsync(sessionID uint64) {
+	c.asyncMu.Lock()
+	defer c.asyncMu.Unlock()
+
+	for _, op := range c.asyncOps {
+		if op.header.SessionID == sessionID {
+			op.cancel()
+		}
+	}
+}
+
+// cancelAllAsync cancels every async operation of the connection
+func (c *Connection) cancelAllAsync() {
+	c.asyncMu.Lock()
+	defer c.asyncMu.Unlock()
+
+	for _, op := range c.asyncOps {
+		op.cancel()
+	}
+}
@@ -0,0 +1,151 @@
+package smb
+
+import (
+	"testing"
+
+	"github.com/yuriyvolkov/simba/pkg/vfs"
+)
+
+// slowFS is storage whose files only return data once release is closed
+type slowFS struct {
+	vfs.FS
+	release chan struct{}
+}
+
+// slowFile is a file of a slowFS
+type slowFile struct {
+	vfs.File
+	release chan struct{}
+}
+
+// Open opens a file of the storage, reads from it wait for the release
+func (f *slowFS) Open(name string, opts vfs.OpenOptions) (vfs.File, vfs.Action, error) {
+	file, action, err := f.FS.Open(name, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &slowFile{File: file, release: f.release}, action, nil
+}
+
+// ReadAt waits for the release and reads from the file
+func (f *slowFile) ReadAt(p []byte, off int64) (int, error) {
+	<-f.release
+	return f.File.ReadAt(p, off)
+}
+
+// message sends a request through the message handling of the connection, as if it was read from the network
+func (tt *testTree) message(header Header, request Marshaller) error {
+	tt.t.Helper()
+
+	header.ProtocolID = ProtocolIDSMB2
+	header.StructureSize = HeaderSize
+	header.CreditRequestResponse = 1
+	header.SessionID = tt.session.id
+	if !header.IsAsync() {
+		header.TreeID = tt.tree.id
+	}
+	msg, err := (&Packet{Header: header, Data: request}).Marshal()
+	if err != nil {
+		tt.t.Fatal(err)
+	}
+	return tt.conn.handleMessage(msg)
+}
+
+// receive reads the next response written to the network and returns its header and body
+func (tt *testTree) receive() (*Header, []byte) {
+	tt.t.Helper()
+
+	msg, err := ReadMessage(tt.client, 1<<20)
+	if err != nil {
+		tt.t.Fatal(err)
+	}
+	header, err := HeaderParse(msg)
+	if err != nil {
+		tt.t.Fatal(err)
+	}
+	return header, msg[HeaderSize:]
+}
+
+func TestAsyncRead(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel func(tree *testTree, interim *Header) error
+		want   Status
+	}{
+		{
+			name: "completed",
+			want: StatusSuccess,
+		},
+		{
+			name: "canceled by async ID",
+			cancel: func(tree *testTree, interim *Header) error {
+				return tree.message(Header{Command: CommandCancel, Flags: FlagAsyncCommand, AsyncID: interim.AsyncID}, &CancelRequest{})
+			},
+			want: StatusCancelled,
+		},
+		{
+			name: "canceled by message ID",
+			cancel: func(tree *testTree, interim *Header) error {
+				return tree.message(Header{Command: CommandCancel, MessageID: interim.MessageID}, &CancelRequest{})
+			},
+			want: StatusCancelled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := &slowFS{FS: vfs.NewMemFS(0), release: make(chan struct{})}
+			tree := newTestTree(t, fsys)
+			go tree.conn.writeLoop()
+			t.Cleanup(func() { tree.conn.Close() })
+
+			id := tree.mustCreate("file.txt", FileReadData|FileWriteData, shareAll, CreateDispositionCreate, 0)
+			if status, _ := tree.write(id, 0, []byte("data")); status != StatusSuccess {
+				t.Fatalf("write status = %#x", uint32(status))
+			}
+
+			// The read waits for the storage, it is answered with an interim response
+			errs := make(chan error, 1)
+			go func() {
+				errs <- tree.message(Header{Command: CommandRead, MessageID: 0}, &ReadRequest{FileID: id, Length: 16})
+			}()
+			interim, _ := tree.receive()
+			if err := <-errs; err != nil {
+				t.Fatal(err)
+			}
+			if interim.Status != StatusPending || !interim.IsAsync() || interim.AsyncID == 0 {
+				t.Fatalf("interim response status %#x, flags %#x, async ID %d", uint32(interim.Status), interim.Flags, interim.AsyncID)
+			}
+
+			// Cancel the read or let the storage answer
+			if tt.cancel != nil {
+				if err := tt.cancel(tree, interim); err != nil {
+					t.Fatal(err)
+				}
+				defer close(fsys.release)
+			} else {
+				close(fsys.release)
+			}
+
+			// The final response follows with the same async ID
+			final, body := tree.receive()
+			if final.Status != tt.want {
+				t.Fatalf("final response status = %#x, want %#x", uint32(final.Status), uint32(tt.want))
+			}
+			if !final.IsAsync() || final.AsyncID != interim.AsyncID || final.MessageID != interim.MessageID {
+				t.Errorf("final response async ID %d message ID %d, want %d and %d",
+					final.AsyncID, final.MessageID, interim.AsyncID, interim.MessageID)
+			}
+			if final.Status == StatusSuccess {
+				if data := string(body[16:20]); data != "data" {
+					t.Errorf("read %q, want %q", data, "data")
+				}
+			}
+
+			tree.conn.asyncMu.Lock()
+			defer tree.conn.asyncMu.Unlock()
+			if n := len(tree.conn.asyncOps); n != 0 {
+				t.Errorf("connection holds %d async operations once completed", n)
+			}
+		})
+	}
+}
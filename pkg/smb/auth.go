@@ -0,0 +1,76 @@
+package smb
+
+import (
+	"errors"
+
+	"github.com/yuriyvolkov/simba/pkg/ntlm"
+)
+
+var (
+	// ErrNoSuchUser is returned by an Authenticator for a user it does not know
+	ErrNoSuchUser = errors.New("smb: no such user")
+
+	// ErrUserExists is returned by a UserStore when adding a user that already exists
+	ErrUserExists = errors.New("smb: user already exists")
+
+	// ErrInvalidUserName is returned by a UserStore for an empty user name or one it cannot store
+	ErrInvalidUserName = errors.New("smb: invalid user name")
+)
+
+// User represents a user account
+type User struct {
+	// Name is the name the user logs in with, it is matched case-insensitively
+	Name string
+
+	// NTHash is the MD4 hash of the UTF-16 password of the user
+	NTHash [16]byte
+
+	// Groups lists the groups the user belongs to
+	Groups []string
+
+	// Flags holds the state of the account
+	Flags AccountFlag
+}
+
+// SetPassword sets the NT hash of the user from a password
+func (u *User) SetPassword(password string) {
+	u.NTHash = ntlm.NTHash(password)
+}
+
+// logonStatus returns the status refusing a logon because of the state of the account, or StatusSuccess
+func (u *User) logonStatus() Status {
+	switch {
+	case u.Flags&AccountDisabled != 0:
+		return StatusAccountDisabled
+	case u.Flags&AccountExpired != 0:
+		return StatusAccountExpired
+	case u.Flags&AccountPasswordMustChange != 0:
+		return StatusPasswordMustChange
+	default:
+		return StatusSuccess
+	}
+}
+
+// Authenticator looks up the accounts of users logging in with session setup
+type Authenticator interface {
+	// LookupUser returns the account of the user in the domain given by the client, or ErrNoSuchUser.
+	// The returned user must not be modified.
+	LookupUser(domain string, name string) (*User, error)
+}
+
+// UserStore is an Authenticator whose accounts can be managed
+type UserStore interface {
+	Authenticator
+
+	// Users returns all accounts sorted by name
+	Users() ([]User, error)
+
+	// AddUser adds an account, or returns ErrUserExists
+	AddUser(user User) error
+
+	// UpdateUser replaces an existing account, or returns ErrNoSuchUser
+	UpdateUser(user User) error
+
+	// DeleteUser removes an account, or returns ErrNoSuchUser
+	DeleteUser(name string) error
+}
@@ -0,0 +1,333 @@
+package smb
+
+import (
+	"encoding/asn1"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/yuriyvolkov/simba/pkg/krb5"
+	"github.com/yuriyvolkov/simba/pkg/ntlm"
+	"github.com/yuriyvolkov/simba/pkg/spnego"
+)
+
+// ErrNoCommonMechanism is returned when the client offers no authentication mechanism the server supports
+var ErrNoCommonMechanism = errors.New("smb: no common authentication mechanism")
+
+// authIdentity describes an authenticated client. Guest and anonymous clients have no session key.
+// The session key is the full key of the mechanism, the session uses its first 16 bytes.
+// Kerberos logons expire with their ticket, the others have no expiry time.
+type authIdentity struct {
+	domain     string
+	user       string
+	anonymous  bool
+	guest      bool
+	sessionKey []byte
+	expiresAt  time.Time
+}
+
+// mechanism authenticates a client with one of the mechanisms negotiated by SPNEGO
+type mechanism interface {
+	// step consumes a token of the client and returns the token to send back,
+	// done is set once the client is authenticated
+	step(token []byte) (out []byte, done bool, err error)
+
+	// identity returns the authenticated client
+	identity() authIdentity
+
+	// verifyMIC verifies the mechListMIC of the client over msg
+	verifyMIC(msg []byte, mic []byte) error
+
+	// mic computes the mechListMIC of the server over msg
+	mic(msg []byte) ([]byte, error)
+}
+
+// mechanisms returns the OIDs of the authentication mechanisms of the server in order of preference
+func (s *Server) mechanisms() []asn1.ObjectIdentifier {
+	if s.acceptor != nil {
+		return []asn1.ObjectIdentifier{spnego.OIDMSKerberos5, spnego.OIDKerberos5, spnego.OIDNTLMSSP}
+	}
+	return []asn1.ObjectIdentifier{spnego.OIDNTLMSSP}
+}
+
+// newMechanism creates the server side of an authentication mechanism, or returns nil if it is not supported
+func (s *Server) newMechanism(oid asn1.ObjectIdentifier) mechanism {
+	switch {
+	case oid.Equal(spnego.OIDNTLMSSP):
+		return newNTLMMechanism(s)
+	case oid.Equal(spnego.OIDKerberos5), oid.Equal(spnego.OIDMSKerberos5):
+		if s.acceptor == nil {
+			return nil
+		}
+		return &kerberosMechanism{acceptor: s.acceptor}
+	default:
+		return nil
+	}
+}
+
+// lookupUser returns the account of a user from the authenticator of the server
+func (s *Server) lookupUser(domain string, name string) (*User, error) {
+	if s.authenticator == nil {
+		return nil, ErrNoSuchUser
+	}
+	return s.authenticator.LookupUser(domain, name)
+}
+
+// mapsToGuest reports whether the NTLM logon of the user, which failed with err if not nil, is a guest logon.
+// Logging in with the name of the guest account always gives a guest, failures follow the map to guest setting.
+func (s *Server) mapsToGuest(user string, err error) bool {
+	if s.guestAccount == "" {
+		return false
+	}
+	unknown := errors.Is(err, ntlm.ErrUnknownUser)
+	badPassword := errors.Is(err, ntlm.ErrLogonFailure)
+	switch {
+	case strings.EqualFold(user, s.guestAccount):
+		return err == nil || unknown || badPassword
+	case s.mapToGuest == MapToGuestBadUser:
+		return unknown
+	case s.mapToGuest == MapToGuestBadPassword:
+		return unknown || badPassword
+	default:
+		return false
+	}
+}
+
+// securityBlob returns the SPNEGO token sent in the negotiate response, it lists the mechanisms of the server
+func (s *Server) securityBlob() ([]byte, error) {
+	return (&spnego.NegTokenInit{MechTypes: s.mechanisms()}).Marshal()
+}
+
+// authExchange is the SPNEGO negotiation authenticating a session over one or more session setup legs.
+// Clients that skip SPNEGO and send raw NTLM messages are accepted as well.
+type authExchange struct {
+	server *Server
+
+	// raw is set for clients sending NTLM messages without SPNEGO
+	raw bool
+
+	// mechTypes is the DER encoded mechanism list of the client, the mechListMIC covers it
+	mechTypes []byte
+
+	// mech is the selected mechanism, nil before the first leg
+	mech    mechanism
+	mechOID asn1.ObjectIdentifier
+}
+
+// newAuthExchange starts an authentication exchange
+func newAuthExchange(s *Server) *authExchange {
+	return &authExchange{server: s}
+}
+
+// step consumes the security buffer of a session setup request and returns the one of the response,
+// done is set once the client is authenticated
+func (a *authExchange) step(token []byte) ([]byte, bool, error) {
+	// Raw NTLM messages are passed straight to the NTLM mechanism
+	if a.raw || a.mech == nil && ntlm.TypeOf(token) != 0 {
+		if a.mech == nil {
+			a.raw = true
+			a.mech = newNTLMMechanism(a.server)
+		}
+		return a.mech.step(token)
+	}
+
+	// The first leg selects the mechanism
+	if a.mech == nil {
+		return a.init(token)
+	}
+
+	// Pass the token of the following legs to the mechanism
+	resp, err := spnego.NegTokenRespParse(token)
+	if err != nil {
+		return nil, false, err
+	}
+	out, done, err := a.mech.step(resp.ResponseToken)
+	if err != nil {
+		return nil, false, err
+	}
+	return a.respond(out, done, resp.MechListMIC, false)
+}
+
+// init handles the NegTokenInit of the client
+func (a *authExchange) init(token []byte) ([]byte, bool, error) {
+	// Parse the token
+	if !spnego.IsNegTokenInit(token) {
+		return nil, false, spnego.ErrInvalidToken
+	}
+	init, err := spnego.NegTokenInitParse(token)
+	if err != nil {
+		return nil, false, err
+	}
+	a.mechTypes = init.RawMechTypes
+
+	// Select the first mechanism of the client the server supports
+	for _, oid := range init.MechTypes {
+		if a.mech = a.server.newMechanism(oid); a.mech != nil {
+			a.mechOID = oid
+			break
+		}
+	}
+	if a.mech == nil {
+		return nil, false, ErrNoCommonMechanism
+	}
+
+	// The optimistic token is only meant for the preferred mechanism of the client
+	if init.MechToken == nil || !init.MechTypes[0].Equal(a.mechOID) {
+		return a.respond(nil, false, nil, true)
+	}
+	out, done, err := a.mech.step(init.MechToken)
+	if err != nil {
+		return nil, false, err
+	}
+	return a.respond(out, done, init.MechListMIC, true)
+}
+
+// respond wraps the token of the mechanism into a NegTokenResp. Once the client is authenticated,
+// its mechListMIC is verified and answered with the one of the server.
+func (a *authExchange) respond(out []byte, done bool, clientMIC []byte, first bool) ([]byte, bool, error) {
+	resp := &spnego.NegTokenResp{
+		NegState:      spnego.NegStateAcceptIncomplete,
+		ResponseToken: out,
+	}
+
+	// Tell the client which mechanism was selected
+	if first {
+		resp.SupportedMech = a.mechOID
+	}
+
+	// Protect the mechanism list against downgrades
+	if done {
+		resp.NegState = spnego.NegStateAcceptCompleted
+		if identity := a.mech.identity(); clientMIC != nil && !identity.anonymous && !identity.guest {
+			if err := a.mech.verifyMIC(a.mechTypes, clientMIC); err != nil {
+				return nil, false, err
+			}
+			mic, err := a.mech.mic(a.mechTypes)
+			if err != nil {
+				return nil, false, err
+			}
+			resp.MechListMIC = mic
+		}
+	}
+
+	// Marshal the token
+	data, err := resp.Marshal()
+	if err != nil {
+		return nil, false, err
+	}
+	return data, done, nil
+}
+
+// identity returns the authenticated client
+func (a *authExchange) identity() authIdentity {
+	return a.mech.identity()
+}
+
+// ntlmMechanism authenticates clients with NTLMv2
+type ntlmMechanism struct {
+	server *Server
+	ctx    *ntlm.ServerContext
+
+	// guest is set when the client was logged in as guest
+	guest bool
+}
+
+// newNTLMMechanism creates the NTLM mechanism, looking up users with the authenticator of the server
+func newNTLMMechanism(s *Server) *ntlmMechanism {
+	config := &ntlm.Config{
+		Domain:   s.domain,
+		Computer: s.computerName,
+		NTHash: func(domain string, name string) ([16]byte, error) {
+			user, err := s.lookupUser(domain, name)
+			if err != nil {
+				return [16]byte{}, err
+			}
+			return user.NTHash, nil
+		},
+	}
+	return &ntlmMechanism{server: s, ctx: ntlm.NewServerContext(config)}
+}
+
+// step answers the NEGOTIATE message with a CHALLENGE and verifies the AUTHENTICATE message
+func (m *ntlmMechanism) step(token []byte) ([]byte, bool, error) {
+	switch ntlm.TypeOf(token) {
+	case ntlm.MessageTypeNegotiate:
+		out, err := m.ctx.Challenge(token)
+		return out, false, err
+	case ntlm.MessageTypeAuthenticate:
+		err := m.ctx.Authenticate(token)
+		if m.server.mapsToGuest(m.ctx.User, err) {
+			m.guest = true
+			return nil, true, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, true, nil
+	default:
+		return nil, false, ntlm.ErrUnexpectedMessage
+	}
+}
+
+// identity returns the authenticated client
+func (m *ntlmMechanism) identity() authIdentity {
+	if m.guest {
+		return authIdentity{domain: m.server.domain, user: m.server.guestAccount, guest: true}
+	}
+	return authIdentity{
+		domain:     m.ctx.Domain,
+		user:       m.ctx.User,
+		anonymous:  m.ctx.Anonymous,
+		sessionKey: m.ctx.SessionKey,
+	}
+}
+
+// verifyMIC verifies the mechListMIC of the client
+func (m *ntlmMechanism) verifyMIC(msg []byte, mic []byte) error {
+	return m.ctx.VerifyMIC(msg, mic)
+}
+
+// mic computes the mechListMIC of the server
+func (m *ntlmMechanism) mic(msg []byte) ([]byte, error) {
+	return m.ctx.MIC(msg)
+}
+
+// kerberosMechanism authenticates clients with a Kerberos ticket for the service principal of the server
+type kerberosMechanism struct {
+	acceptor *krb5.Acceptor
+	ctx      *krb5.Context
+}
+
+// step validates the AP-REQ of the client, a single leg authenticates it
+func (m *kerberosMechanism) step(token []byte) ([]byte, bool, error) {
+	ctx, reply, err := m.acceptor.Accept(token)
+	if err != nil {
+		return nil, false, err
+	}
+	m.ctx = ctx
+	return reply, true, nil
+}
+
+// identity returns the authenticated client, the session key is the full Kerberos session key
+func (m *kerberosMechanism) identity() authIdentity {
+	sessionKey := append([]byte{}, m.ctx.SessionKey.Value...)
+	return authIdentity{
+		domain:     m.ctx.Realm,
+		user:       m.ctx.Client,
+		sessionKey: sessionKey,
+		expiresAt:  m.ctx.EndTime,
+	}
+}
+
+// verifyMIC verifies the mechListMIC of the client
+func (m *kerberosMechanism) verifyMIC(msg []byte, mic []byte) error {
+	return m.ctx.VerifyMIC(msg, mic)
+}
+
+// mic computes the mechListMIC of the server, none is sent for RC4 contexts
+func (m *kerberosMechanism) mic(msg []byte) ([]byte, error) {
+	if m.ctx.SessionKey.Type == krb5.ETypeRC4HMAC {
+		return nil, nil
+	}
+	return m.ctx.MIC(msg)
+}
@@ -1,21 +1,30 @@
 package smb
 
-// Capability represents the capabilities of an SMB packet
+// Capability represents the global capabilities of an SMB2 client or server
 type Capability uint32
 
 const (
-	// CapabilityNTStatus indicates support for NT error codes
-	CapabilityNTStatus Capability = 0x00000001
+	// CapabilityDFS indicates support for the Distributed File System
+	CapabilityDFS Capability = 0x00000001
 
-	// CapabilityRPCRemoteAPIs indicates support for remote RPC
-	CapabilityRPCRemoteAPIs Capability = 0x00000002
+	// CapabilityLeasing indicates support for leasing
+	CapabilityLeasing Capability = 0x00000002
 
-	// CapabilityUnicode indicates support for Unicode strings
-	CapabilityUnicode Capability = 0x00000004
+	// CapabilityLargeMTU indicates support for multi-credit operations
+	CapabilityLargeMTU Capability = 0x00000004
 
-	// CapabilityLargeFiles indicates support for large files
-	CapabilityLargeFiles Capability = 0x00000008
+	// CapabilityMultiChannel indicates support for multiple channels per session
+	CapabilityMultiChannel Capability = 0x00000008
 
-	// CapabilityExtendedSecurity indicates support for extended security
-	CapabilityExtendedSecurity Capability = 0x80000000
+	// CapabilityPersistentHandles indicates support for persistent handles
+	CapabilityPersistentHandles Capability = 0x00000010
+
+	// CapabilityDirectoryLeasing indicates support for directory leasing
+	CapabilityDirectoryLeasing Capability = 0x00000020
+
+	// CapabilityEncryption indicates support for encryption in SMB 3.0 and 3.0.2
+	CapabilityEncryption Capability = 0x00000040
+
+	// CapabilityNotifications indicates support for server to client notifications
+	CapabilityNotifications Capability = 0x00000080
 )
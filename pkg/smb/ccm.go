@@ -0,0 +1,128 @@
+package smb
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// errCCMOpen is returned when a CCM ciphertext fails authentication
+var errCCMOpen = errors.New("smb: message authentication failed")
+
+// ccm implements AES in Counter with CBC-MAC mode (NIST SP 800-38C, RFC 3610) as a cipher.AEAD,
+// the standard library only provides GCM
+type ccm struct {
+	block     cipher.Block
+	nonceSize int
+	tagSize   int
+}
+
+// newCCM returns the CCM mode of a 128-bit block cipher with the given nonce and tag sizes.
+// SMB 3 uses 11-byte nonces and 16-byte tags.
+func newCCM(block cipher.Block, nonceSize int, tagSize int) cipher.AEAD {
+	return &ccm{block: block, nonceSize: nonceSize, tagSize: tagSize}
+}
+
+// NonceSize returns the size of the nonce
+func (c *ccm) NonceSize() int {
+	return c.nonceSize
+}
+
+// Overhead returns the size of the tag appended to the ciphertext
+func (c *ccm) Overhead() int {
+	return c.tagSize
+}
+
+// Seal encrypts and authenticates plaintext, authenticates additionalData and appends the result to dst
+func (c *ccm) Seal(dst []byte, nonce []byte, plaintext []byte, additionalData []byte) []byte {
+	tag := c.mac(nonce, plaintext, additionalData)
+
+	// Encrypt the message with the counter blocks starting at 1 and the tag with counter block 0
+	out := make([]byte, len(plaintext)+c.tagSize)
+	c.ctr(out, plaintext, nonce, 1)
+	c.ctr(out[len(plaintext):], tag, nonce, 0)
+	return append(dst, out...)
+}
+
+// Open decrypts and authenticates ciphertext, authenticates additionalData and appends the plaintext to dst
+func (c *ccm) Open(dst []byte, nonce []byte, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < c.tagSize {
+		return nil, errCCMOpen
+	}
+
+	// Decrypt the message and the tag
+	n := len(ciphertext) - c.tagSize
+	plaintext := make([]byte, n)
+	c.ctr(plaintext, ciphertext[:n], nonce, 1)
+	tag := make([]byte, c.tagSize)
+	c.ctr(tag, ciphertext[n:], nonce, 0)
+
+	// Verify the tag
+	if subtle.ConstantTimeCompare(tag, c.mac(nonce, plaintext, additionalData)) != 1 {
+		return nil, errCCMOpen
+	}
+	return append(dst, plaintext...), nil
+}
+
+// mac computes the CBC-MAC of the formatted nonce, additional data and plaintext
+func (c *ccm) mac(nonce []byte, plaintext []byte, additionalData []byte) []byte {
+	// The first block holds the flags, the nonce and the length of the plaintext
+	l := 15 - c.nonceSize
+	b0 := make([]byte, 16)
+	b0[0] = byte((c.tagSize-2)/2<<3 | (l - 1))
+	if len(additionalData) > 0 {
+		b0[0] |= 0x40
+	}
+	copy(b0[1:], nonce)
+	length := make([]byte, 8)
+	binary.BigEndian.PutUint64(length, uint64(len(plaintext)))
+	copy(b0[1+c.nonceSize:], length[8-l:])
+
+	// The additional data is prefixed with its length, SMB never sends more than 65279 bytes of it
+	data := b0
+	if len(additionalData) > 0 {
+		data = append(data, byte(len(additionalData)>>8), byte(len(additionalData)))
+		data = append(data, additionalData...)
+		data = append(data, make([]byte, padding16(len(data)))...)
+	}
+	data = append(data, plaintext...)
+	data = append(data, make([]byte, padding16(len(data)))...)
+
+	// Chain the blocks
+	mac := make([]byte, 16)
+	for i := 0; i < len(data); i += 16 {
+		xorBytes(mac, mac, data[i:i+16])
+		c.block.Encrypt(mac, mac)
+	}
+	return mac[:c.tagSize]
+}
+
+// ctr encrypts src into dst with the counter blocks starting at the given counter
+func (c *ccm) ctr(dst []byte, src []byte, nonce []byte, counter uint64) {
+	l := 15 - c.nonceSize
+	a := make([]byte, 16)
+	a[0] = byte(l - 1)
+	copy(a[1:], nonce)
+
+	keystream := make([]byte, 16)
+	for i := 0; i < len(src); i += 16 {
+		// Set the counter in the last bytes of the block
+		ctr := make([]byte, 8)
+		binary.BigEndian.PutUint64(ctr, counter)
+		copy(a[1+c.nonceSize:], ctr[8-l:])
+		counter++
+
+		c.block.Encrypt(keystream, a)
+		end := i + 16
+		if end > len(src) {
+			end = len(src)
+		}
+		xorBytes(dst[i:end], src[i:end], keystream)
+	}
+}
+
+// padding16 returns the number of bytes needed to pad n to a multiple of 16
+func padding16(n int) int {
+	return (16 - n%16) % 16
+}
@@ -0,0 +1,21 @@
+package smb
+
+// Cipher identifies an SMB3 encryption algorithm
+type Cipher uint16
+
+const (
+	// CipherNone indicates that no common cipher was found
+	CipherNone Cipher = 0x0000
+
+	// CipherAES128CCM indicates AES-128-CCM
+	CipherAES128CCM Cipher = 0x0001
+
+	// CipherAES128GCM indicates AES-128-GCM
+	CipherAES128GCM Cipher = 0x0002
+
+	// CipherAES256CCM indicates AES-256-CCM
+	CipherAES256CCM Cipher = 0x0003
+
+	// CipherAES256GCM indicates AES-256-GCM
+	CipherAES256GCM Cipher = 0x0004
+)
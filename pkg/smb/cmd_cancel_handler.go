@@ -0,0 +1,12 @@
+package smb
+
+// handleCancelCommand handles an SMB2 CANCEL request.
+// CANCEL has no response of its own, the canceled operation completes with STATUS_CANCELLED.
+// A malformed CANCEL is ignored.
+func handleCancelCommand(conn *Connection, packet *Packet) error {
+	if _, ok := packet.Data.(*CancelRequest); !ok {
+		return nil
+	}
+	conn.cancelAsync(&packet.Header)
+	return nil
+}
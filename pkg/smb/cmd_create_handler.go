@@ -0,0 +1,241 @@
+package smb
+
+import (
+	"errors"
+
+	"github.com/yuriyvolkov/simba/pkg/vfs"
+)
+
+// reservedAccessMask holds the access bits a create request must not set
+const reservedAccessMask AccessMask = 0x0CE0FE00
+
+// unsupportedCreateOptions are the create options refused with STATUS_NOT_SUPPORTED
+const unsupportedCreateOptions = CreateOptionOpenByFileID | CreateOptionReserveOpfilter
+
+// handleCreateCommand handles an SMB2 create request, it opens or creates a file of the share
+// and registers the open on the tree connect
+func handleCreateCommand(conn *Connection, packet *Packet) error {
+	request, ok := packet.Data.(*CreateRequest)
+	if !ok {
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	}
+	s := conn.lookupSession(packet.Header.SessionID)
+	if s == nil {
+		return sendErrorResponse(conn, packet, StatusUserSessionDeleted)
+	}
+	tree := s.lookupTree(packet.Header.TreeID)
+	if tree == nil {
+		return sendErrorResponse(conn, packet, StatusNetworkNameDeleted)
+	}
+
+	// Pipe shares serve no named pipes
+	fsys := tree.share.FS
+	if fsys == nil {
+		return sendErrorResponse(conn, packet, StatusObjectNameNotFound)
+	}
+
+	// Check the parameters of the request
+	options := request.CreateOptions
+	disposition := request.CreateDisposition
+	switch {
+	case request.ImpersonationLevel > ImpersonationLevelDelegate:
+		return sendErrorResponse(conn, packet, StatusBadImpersonationLevel)
+	case !disposition.valid():
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	case options&CreateOptionDirectoryFile != 0 && options&CreateOptionNonDirectoryFile != 0:
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	case options&CreateOptionDirectoryFile != 0 && disposition.modifies() && disposition != CreateDispositionCreate:
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	case options&unsupportedCreateOptions != 0:
+		return sendErrorResponse(conn, packet, StatusNotSupported)
+	case request.DesiredAccess&reservedAccessMask != 0:
+		return sendErrorResponse(conn, packet, StatusAccessDenied)
+	}
+
+	// Map the generic rights and grant the access asked for if the share allows it
+	access := mapGenericAccess(request.DesiredAccess)
+	if access&MaximumAllowed != 0 {
+		access = access&^MaximumAllowed | tree.maximalAccess
+	}
+	if access&^tree.maximalAccess != 0 {
+		return sendErrorResponse(conn, packet, StatusAccessDenied)
+	}
+	if options&CreateOptionDeleteOnClose != 0 && access&Delete == 0 {
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	}
+
+	// Find the file and the stream
+	name, stream, status := sharePath(request.Name)
+	if status != StatusSuccess {
+		return sendErrorResponse(conn, packet, status)
+	}
+
+	// Files are only created or truncated where the session may write, a read-only
+	// open-if opens an existing file
+	readOnly := tree.maximalAccess&FileWriteData == 0
+	if readOnly && disposition.modifies() {
+		return sendErrorResponse(conn, packet, StatusAccessDenied)
+	}
+	opts := vfs.OpenOptions{
+		Disposition:  disposition.vfs(),
+		Directory:    options&CreateOptionDirectoryFile != 0,
+		NonDirectory: options&CreateOptionNonDirectoryFile != 0,
+		Write:        access&(FileWriteData|FileAppendData) != 0,
+		WriteThrough: options&CreateOptionWriteThrough != 0,
+	}
+	if readOnly && disposition == CreateDispositionOpenIf {
+		opts.Disposition = vfs.DispositionOpen
+	}
+
+	// Read-only files and the root of the share cannot be deleted, directories only once empty.
+	// The file is checked before the open, which may supersede or overwrite it.
+	if options&CreateOptionDeleteOnClose != 0 {
+		if status := checkDeleteOnClose(fsys, name, stream); status != StatusSuccess {
+			return sendErrorResponse(conn, packet, status)
+		}
+	}
+
+	// Open the file under the share modes of its other opens
+	o := &open{
+		name:          name,
+		stream:        stream,
+		access:        access,
+		shareAccess:   request.ShareAccess,
+		options:       options,
+		deleteOnClose: options&CreateOptionDeleteOnClose != 0,
+	}
+	action, info, status := conn.server.files.open(o, fsys, opts)
+	if status != StatusSuccess {
+		if readOnly && status == StatusObjectNameNotFound && disposition == CreateDispositionOpenIf {
+			status = StatusAccessDenied
+		}
+		return sendErrorResponse(conn, packet, status)
+	}
+	o.isDir = info.IsDir() && stream == ""
+
+	// Set the attributes of a new or replaced file
+	if action != vfs.ActionOpened && request.FileAttributes&^(vfs.AttrNormal|vfs.AttrDirectory) != 0 {
+		if af, ok := o.file.(vfs.AttributeFile); ok {
+			err := af.SetAttributes(request.FileAttributes)
+			if err == nil {
+				info, err = o.file.Stat()
+			}
+			if err != nil {
+				o.close()
+				return sendErrorResponse(conn, packet, vfsStatus(err))
+			}
+		}
+	}
+
+	// Register the open on the tree connect, related requests use its file ID
+	tree.addOpen(o, &conn.server.persistentIDs)
+	packet.setFileID(o.id)
+
+	// Marshal the response
+	response := &CreateResponse{
+		OplockLevel:    OplockLevelNone,
+		CreateAction:   createActionOf(action),
+		CreationTime:   info.CreationTime,
+		LastAccessTime: info.AccessTime,
+		LastWriteTime:  info.ModTime,
+		ChangeTime:     info.ChangeTime,
+		FileAttributes: info.Attributes,
+		FileID:         o.id,
+	}
+	if !o.isDir {
+		response.AllocationSize = allocationSize(info.Size)
+		response.EndOfFile = uint64(info.Size)
+	}
+	data, err := response.Marshal()
+	if err != nil {
+		return err
+	}
+
+	// Send the response
+	return sendResponse(conn, packet, data)
+}
+
+// checkDeleteOnClose checks that an existing file may be opened with delete on close. A missing
+// file passes, the open reports the errors of the others.
+func checkDeleteOnClose(fsys vfs.FS, name, stream string) Status {
+	if name == "." {
+		return StatusCannotDelete
+	}
+	info, err := fsys.Stat(name)
+	if err != nil {
+		return StatusSuccess
+	}
+	if info.Attributes&vfs.AttrReadOnly != 0 {
+		return StatusCannotDelete
+	}
+
+	// A directory is only deleted once empty
+	if !info.IsDir() || stream != "" {
+		return StatusSuccess
+	}
+	dir, _, err := fsys.Open(name, vfs.OpenOptions{Disposition: vfs.DispositionOpen, Directory: true})
+	if err != nil {
+		return StatusSuccess
+	}
+	defer dir.Close()
+	if entries, err := dir.Readdir(); err != nil || len(entries) > 0 {
+		return StatusDirectoryNotEmpty
+	}
+	return StatusSuccess
+}
+
+// handleCloseCommand handles an SMB2 close request, it closes an open and returns the
+// final attributes of the file if asked
+func handleCloseCommand(conn *Connection, packet *Packet) error {
+	request, ok := packet.Data.(*CloseRequest)
+	if !ok {
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	}
+	s := conn.lookupSession(packet.Header.SessionID)
+	if s == nil {
+		return sendErrorResponse(conn, packet, StatusUserSessionDeleted)
+	}
+	tree := s.lookupTree(packet.Header.TreeID)
+	if tree == nil {
+		return sendErrorResponse(conn, packet, StatusNetworkNameDeleted)
+	}
+
+	// Find the open, a related close uses the file of the previous request
+	id := packet.resolveFileID(request.FileID)
+	o := tree.removeOpen(id)
+	if o == nil {
+		return sendErrorResponse(conn, packet, StatusFileClosed)
+	}
+	packet.setFileID(id)
+
+	// Query the attributes before the file goes away
+	response := &CloseResponse{}
+	if request.Flags&CloseFlagPostQueryAttrib != 0 {
+		if info, err := o.file.Stat(); err == nil {
+			response.Flags = CloseFlagPostQueryAttrib
+			response.CreationTime = info.CreationTime
+			response.LastAccessTime = info.AccessTime
+			response.LastWriteTime = info.ModTime
+			response.ChangeTime = info.ChangeTime
+			response.FileAttributes = info.Attributes
+			if !o.isDir {
+				response.AllocationSize = allocationSize(info.Size)
+				response.EndOfFile = uint64(info.Size)
+			}
+		}
+	}
+
+	// Close the file, a pending delete that fails leaves the file in place
+	if err := o.close(); err != nil && !errors.Is(err, vfs.ErrNotEmpty) {
+		conn.server.logger.Printf("%s: closing %s: %v", conn.RemoteAddr(), o.name, err)
+	}
+
+	// Marshal the response
+	data, err := response.Marshal()
+	if err != nil {
+		return err
+	}
+
+	// Send the response
+	return sendResponse(conn, packet, data)
+}
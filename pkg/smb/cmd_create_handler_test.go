@@ -0,0 +1,201 @@
+package smb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yuriyvolkov/simba/pkg/vfs"
+)
+
+func TestCreateDispositions(t *testing.T) {
+	tests := []struct {
+		name        string
+		disposition CreateDisposition
+		exists      bool
+		want        Status
+		action      CreateAction
+		size        int
+	}{
+		{name: "supersede existing", disposition: CreateDispositionSupersede, exists: true, action: CreateActionSuperseded},
+		{name: "supersede missing", disposition: CreateDispositionSupersede, action: CreateActionCreated},
+		{name: "open existing", disposition: CreateDispositionOpen, exists: true, action: CreateActionOpened, size: 4},
+		{name: "open missing", disposition: CreateDispositionOpen, want: StatusObjectNameNotFound},
+		{name: "create existing", disposition: CreateDispositionCreate, exists: true, want: StatusObjectNameCollision},
+		{name: "create missing", disposition: CreateDispositionCreate, action: CreateActionCreated},
+		{name: "open if existing", disposition: CreateDispositionOpenIf, exists: true, action: CreateActionOpened, size: 4},
+		{name: "open if missing", disposition: CreateDispositionOpenIf, action: CreateActionCreated},
+		{name: "overwrite existing", disposition: CreateDispositionOverwrite, exists: true, action: CreateActionOverwritten},
+		{name: "overwrite missing", disposition: CreateDispositionOverwrite, want: StatusObjectNameNotFound},
+		{name: "overwrite if existing", disposition: CreateDispositionOverwriteIf, exists: true, action: CreateActionOverwritten},
+		{name: "overwrite if missing", disposition: CreateDispositionOverwriteIf, action: CreateActionCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newTestTree(t, vfs.NewMemFS(0))
+
+			// Create the existing file
+			if tt.exists {
+				id := tree.mustCreate("file.txt", FileWriteData, shareAll, CreateDispositionCreate, 0)
+				if status, _ := tree.write(id, 0, []byte("data")); status != StatusSuccess {
+					t.Fatalf("write status = %#x", uint32(status))
+				}
+				tree.close(id)
+			}
+
+			// Open the file with the disposition and read it back
+			status, id, action := tree.create("file.txt", FileReadData|FileWriteData|Delete, shareAll, tt.disposition, 0)
+			if status != tt.want {
+				t.Fatalf("create status = %#x, want %#x", uint32(status), uint32(tt.want))
+			}
+			if status != StatusSuccess {
+				return
+			}
+			defer tree.close(id)
+			if action != tt.action {
+				t.Errorf("create action = %d, want %d", action, tt.action)
+			}
+			status, data := tree.read(id, 0, 16)
+			if tt.size == 0 && status != StatusEndOfFile || tt.size != 0 && len(data) != tt.size {
+				t.Errorf("read status = %#x, %d bytes, want %d bytes", uint32(status), len(data), tt.size)
+			}
+		})
+	}
+}
+
+func TestCreateErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		access      AccessMask
+		disposition CreateDisposition
+		options     CreateOptions
+		want        Status
+	}{
+		{name: "missing directory", path: `missing\file.txt`, access: FileReadData, disposition: CreateDispositionOpen, want: StatusPathNotFound},
+		{name: "directory as a file", path: `dir`, access: FileReadData, disposition: CreateDispositionOpen, options: CreateOptionNonDirectoryFile, want: StatusFileIsADirectory},
+		{name: "file as a directory", path: `dir\file.txt`, access: FileReadData, disposition: CreateDispositionOpen, options: CreateOptionDirectoryFile, want: StatusNotADirectory},
+		{name: "invalid name", path: `a*b`, access: FileReadData, disposition: CreateDispositionCreate, want: StatusObjectNameInvalid},
+		{name: "absolute name", path: `\file.txt`, access: FileReadData, disposition: CreateDispositionCreate, want: StatusInvalidParameter},
+		{name: "delete on close without delete access", path: `new.txt`, access: FileReadData, disposition: CreateDispositionCreate, options: CreateOptionDeleteOnClose, want: StatusInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newTestTree(t, vfs.NewMemFS(0))
+			tree.close(tree.mustCreate(`dir`, FileReadData, shareAll, CreateDispositionCreate, CreateOptionDirectoryFile))
+			tree.close(tree.mustCreate(`dir\file.txt`, FileWriteData, shareAll, CreateDispositionCreate, 0))
+
+			if status, _, _ := tree.create(tt.path, tt.access, shareAll, tt.disposition, tt.options); status != tt.want {
+				t.Errorf("create status = %#x, want %#x", uint32(status), uint32(tt.want))
+			}
+		})
+	}
+}
+
+func TestCreateDeleteOnClose(t *testing.T) {
+	fsys := vfs.NewMemFS(0)
+	tree := newTestTree(t, fsys)
+	tree.close(tree.mustCreate("file.txt", FileWriteData, shareAll, CreateDispositionCreate, 0))
+
+	// The file stays while another open is left, and cannot be opened again meanwhile
+	other := tree.mustCreate("file.txt", FileReadData, shareAll, CreateDispositionOpen, 0)
+	id := tree.mustCreate("file.txt", FileReadData|Delete, shareAll, CreateDispositionOpen, CreateOptionDeleteOnClose)
+	tree.close(id)
+	if _, err := fsys.Stat("file.txt"); err != nil {
+		t.Fatalf("file deleted while open: %v", err)
+	}
+	if status, _, _ := tree.create("file.txt", FileReadData, shareAll, CreateDispositionOpen, 0); status != StatusDeletePending {
+		t.Errorf("open status = %#x, want %#x", uint32(status), uint32(StatusDeletePending))
+	}
+
+	// Closing the last open deletes the file, its name can be used again
+	tree.close(other)
+	if _, err := fsys.Stat("file.txt"); err == nil {
+		t.Error("file kept once its last open was closed")
+	}
+	if status, _, action := tree.create("file.txt", FileReadData, shareAll, CreateDispositionOpenIf, 0); status != StatusSuccess || action != CreateActionCreated {
+		t.Errorf("create status = %#x, action %d", uint32(status), action)
+	}
+}
+
+func TestCreateDeleteOnCloseRefused(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "readonly.txt"), []byte("data"), 0444); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "full", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		disposition CreateDisposition
+		options     CreateOptions
+		want        Status
+	}{
+		{name: "read-only file", path: "readonly.txt", disposition: CreateDispositionOpen, want: StatusCannotDelete},
+		{name: "read-only file superseded", path: "readonly.txt", disposition: CreateDispositionSupersede, want: StatusCannotDelete},
+		{name: "read-only file overwritten", path: "readonly.txt", disposition: CreateDispositionOverwrite, want: StatusCannotDelete},
+		{name: "read-only file overwritten if present", path: "readonly.txt", disposition: CreateDispositionOverwriteIf, want: StatusCannotDelete},
+		{name: "root of the share", path: "", disposition: CreateDispositionOpen, options: CreateOptionDirectoryFile, want: StatusCannotDelete},
+		{name: "directory not empty", path: "full", disposition: CreateDispositionOpen, options: CreateOptionDirectoryFile, want: StatusDirectoryNotEmpty},
+		{name: "directory not empty opened if present", path: "full", disposition: CreateDispositionOpenIf, want: StatusDirectoryNotEmpty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newTestTree(t, vfs.NewOSFS(dir))
+			status, _, _ := tree.create(tt.path, FileReadData|FileWriteData|Delete, shareAll, tt.disposition, tt.options|CreateOptionDeleteOnClose)
+			if status != tt.want {
+				t.Errorf("create status = %#x, want %#x", uint32(status), uint32(tt.want))
+			}
+
+			// The refused open left the file and the directory as they were
+			if data, err := os.ReadFile(filepath.Join(dir, "readonly.txt")); err != nil || string(data) != "data" {
+				t.Errorf("read-only file holds %q, %v, want %q", data, err, "data")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "full", "sub")); err != nil {
+				t.Error(err)
+			}
+			if n := len(tree.conn.server.files.files); n != 0 {
+				t.Errorf("file table holds %d files once refused", n)
+			}
+		})
+	}
+}
+
+// racingFS lets another open register a file as soon as it is created, before the open creating it moves to its file ID
+type racingFS struct {
+	vfs.FS
+	files *fileTable
+}
+
+// Open opens a file, then registers another open sharing nothing on a created file
+func (f *racingFS) Open(name string, opts vfs.OpenOptions) (vfs.File, vfs.Action, error) {
+	file, action, err := f.FS.Open(name, opts)
+	if err != nil || action != vfs.ActionCreated {
+		return file, action, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	f.files.register(&open{name: name, access: FileReadData}, fileKey{fs: f, id: info.FileID}, FileReadData)
+	return file, action, nil
+}
+
+func TestCreateRemovesFileLostToAnotherOpen(t *testing.T) {
+	mem := vfs.NewMemFS(0)
+	fsys := &racingFS{FS: mem}
+	tree := newTestTree(t, fsys)
+	fsys.files = tree.conn.server.files
+
+	// The other open does not share reading, the create fails and takes the file it created away
+	if status, _, _ := tree.create("file.txt", FileReadData|FileWriteData, shareAll, CreateDispositionCreate, 0); status != StatusSharingViolation {
+		t.Errorf("create status = %#x, want %#x", uint32(status), uint32(StatusSharingViolation))
+	}
+	if _, err := mem.Stat("file.txt"); err == nil {
+		t.Error("file kept once the create failed")
+	}
+}
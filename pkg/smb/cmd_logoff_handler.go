@@ -0,0 +1,29 @@
+package smb
+
+// handleLogoffCommand handles an SMB2 LOGOFF request. The session is removed as soon as the
+// response is recorded, before it is sent. The response is still signed with the keys of the
+// session, its signer is taken when the response is marshaled.
+func handleLogoffCommand(conn *Connection, packet *Packet) error {
+	if _, ok := packet.Data.(*LogoffRequest); !ok {
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	}
+
+	// Find the session
+	s := conn.lookupSession(packet.Header.SessionID)
+	if s == nil {
+		return sendErrorResponse(conn, packet, StatusUserSessionDeleted)
+	}
+
+	// Marshal the response
+	data, err := (&LogoffResponse{}).Marshal()
+	if err != nil {
+		return err
+	}
+
+	// Record the response, then tear down the session with its tree connects and pending operations
+	if err := sendResponse(conn, packet, data); err != nil {
+		return err
+	}
+	conn.removeSession(s)
+	return nil
+}
@@ -1,100 +1,259 @@
 package smb
 
 import (
-	"net"
+	"errors"
 	"time"
 )
 
+// smb202MaxBufferSize is the largest transact, read or write SMB 2.0.2 clients can use
+const smb202MaxBufferSize = 64 * 1024
+
+// preauthIntegritySaltSize is the size of the salt sent in the preauth integrity context
+const preauthIntegritySaltSize = 32
+
+// ErrAlreadyNegotiated is returned when a client sends a second negotiate request on a connection
+var ErrAlreadyNegotiated = errors.New("smb: connection already negotiated")
+
 // handleNegotiateCommand handles an SMB negotiate request
-func handleNegotiateCommand(conn net.Conn, packet *Packet) error {
-	data, err := packet.Data.Marshal()
-	if err != nil {
-		return err
+func handleNegotiateCommand(conn *Connection, packet *Packet) error {
+	// A connection is negotiated only once, the SMB2 wildcard dialect allows one more request
+	if conn.dialect != DialectUnknown && conn.dialect != DialectSMB2Wildcard {
+		return ErrAlreadyNegotiated
 	}
 
-	// Parse the request data
-	request, err := NegotiateRequestParse(data)
-	if err != nil {
-		return err
+	// Older clients open the connection with an SMB1 negotiate request
+	request, ok := packet.Data.(*NegotiateRequest)
+	if !ok {
+		if smb1Request, ok := packet.Data.(*SMB1NegotiateRequest); ok {
+			return handleSMB1NegotiateCommand(conn, packet, smb1Request)
+		}
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
 	}
 
-	// Check if the request contains any supported dialects
+	// Select the highest dialect supported by both sides
 	var dialect Dialect = DialectUnknown
 	for _, d := range request.Dialects {
-		if isDialectSupported(d) {
+		if isDialectSupported(d) && d > dialect {
 			dialect = d
-			break
 		}
 	}
 
 	// If no supported dialects were found, return an error
 	if dialect == DialectUnknown {
-		return sendErrorResponse(conn, StatusNotSupported)
+		return sendErrorResponse(conn, packet, StatusNotSupported)
 	}
 
 	// Create the response
-	response := &NegotiateResponse{
-		Dialect: dialect,
-		SecurityMode: SecurityModeUserLevel | SecurityModeEncryptPasswords |
-			SecurityModeSignaturesEnabled | SecurityModeSignaturesRequired,
-		MaxBufferSize: 64 * 1024,
-		MaxMpxCount:   2,
-		Capabilities: CapabilityUnicode | CapabilityNTStatus |
-			CapabilityLargeFiles | CapabilityInfoLevelPassthru,
-		SystemTime:          time.Now(),
-		ServerTimeZone:      -60,
-		Challenge:           randomBytes(8),
-		DomainName:          "EXAMPLE",
-		ServerName:          "FILESERVER",
-		EncryptionKeyLength: 8,
+	response, err := newNegotiateResponse(conn.server, dialect)
+	if err != nil {
+		return err
 	}
 
+	// Select the algorithms for SMB 3.1.1 from the negotiate contexts
+	if dialect == DialectSMB311 {
+		contexts, status := negotiateContexts(conn, request.NegotiateContexts, conn.negotiatePolicy)
+		if status != StatusSuccess {
+			return sendErrorResponse(conn, packet, status)
+		}
+		response.NegotiateContexts = contexts
+	} else if dialect >= DialectSMB300 {
+		conn.signingAlgorithmID = SigningAlgorithmAESCMAC
+
+		// SMB 3.0 and 3.0.2 encrypt with AES-128-CCM if the client announces encryption
+		if request.Capabilities&CapabilityEncryption != 0 {
+			conn.cipherID = CipherAES128CCM
+			response.Capabilities |= CapabilityEncryption
+		}
+	} else {
+		conn.signingAlgorithmID = SigningAlgorithmHMACSHA256
+	}
+
+	// Remember the negotiated state
+	conn.dialect = dialect
+	conn.clientGUID = request.ClientGUID
+	conn.clientCapabilities = request.Capabilities
+	conn.clientSecurityMode = request.SecurityMode
+
 	// Marshal the response
-	data, err = response.Marshal()
+	data, err := response.Marshal()
+	if err != nil {
+		return err
+	}
+	buf, err := conn.marshalResponse(packet, StatusSuccess, data)
 	if err != nil {
 		return err
 	}
 
+	// SMB 3.1.1 starts the preauth integrity hash with the negotiate request and response
+	if dialect == DialectSMB311 {
+		conn.preauth = NewPreauthIntegrity()
+		conn.preauth.Update(packet.raw)
+		conn.preauth.Update(buf)
+	}
+
 	// Send the response
-	return sendResponse(conn, packet, data)
+	packet.respond(StatusSuccess, buf)
+	return nil
 }
 
-func sendResponse(conn net.Conn, packet *Packet, data []byte) error {
-	// Set the data field of the packet's header
-	packet.Header.Data = data
+// negotiateContexts selects the SMB 3.1.1 algorithms from the negotiate contexts
+// of the client, stores them on the connection and returns the response contexts
+func negotiateContexts(conn *Connection, request *NegotiateContexts, policy *NegotiatePolicy) (*NegotiateContexts, Status) {
+	// The preauth integrity context is mandatory and SHA-512 is the only hash algorithm
+	if request == nil || request.PreauthIntegrity == nil {
+		return nil, StatusInvalidParameter
+	}
+	hasSHA512 := false
+	for _, a := range request.PreauthIntegrity.HashAlgorithms {
+		if a == HashAlgorithmSHA512 {
+			hasSHA512 = true
+		}
+	}
+	if !hasSHA512 {
+		return nil, StatusSMBNoPreauthIntegrityHashOverlap
+	}
 
-	// Marshal the packet
-	buf, err := packet.Marshal()
-	if err != nil {
-		return err
+	// Answer with our own salt
+	response := &NegotiateContexts{
+		PreauthIntegrity: &PreauthIntegrityCapabilities{
+			HashAlgorithms: []HashAlgorithm{HashAlgorithmSHA512},
+			Salt:           randomBytes(preauthIntegritySaltSize),
+		},
 	}
 
-	// Send the packet
-	_, err = conn.Write(buf)
-	return err
+	// Select the cipher, CipherNone tells the client that there is no common cipher
+	if request.Encryption != nil {
+		conn.cipherID = policy.selectCipher(request.Encryption.Ciphers)
+		response.Encryption = &EncryptionCapabilities{Ciphers: []Cipher{conn.cipherID}}
+	}
+
+	// Select the compression algorithms
+	if request.Compression != nil {
+		response.Compression = policy.selectCompression(request.Compression)
+		if response.Compression.CompressionAlgorithms[0] != CompressionAlgorithmNone {
+			conn.compressionAlgorithms = response.Compression.CompressionAlgorithms
+			conn.compressionChained = response.Compression.Flags&CompressionCapabilitiesFlagChained != 0
+		}
+	}
+
+	// Select the signing algorithm, AES-CMAC is used if the client sends no signing context
+	conn.signingAlgorithmID = SigningAlgorithmAESCMAC
+	if request.Signing != nil {
+		conn.signingAlgorithmID = policy.selectSigningAlgorithm(request.Signing.SigningAlgorithms)
+		response.Signing = &SigningCapabilities{SigningAlgorithms: []SigningAlgorithm{conn.signingAlgorithmID}}
+	}
+
+	// RDMA transforms and transport level security are not supported, so these
+	// contexts are left unanswered, as is the informational netname context
+
+	return response, StatusSuccess
 }
 
-// sendErrorResponse sends an error response to the client
-func sendErrorResponse(conn net.Conn, status Status) error {
-	// Create the response packet
-	response := &Packet{
-		Header: Header{
-			ProtocolID: [4]byte{'N', 'B', 'L', 'S'},
-			Command:    CommandNegotiate,
-			Status:     status,
-		},
+// handleSMB1NegotiateCommand answers an SMB1 negotiate request with an SMB2
+// negotiate response if the client lists an SMB2 dialect, and refuses it otherwise
+func handleSMB1NegotiateCommand(conn *Connection, packet *Packet, request *SMB1NegotiateRequest) error {
+	// Upgrading is only possible as the first request on the connection
+	if conn.dialect != DialectUnknown {
+		return ErrAlreadyNegotiated
 	}
 
-	// Marshal the packet
+	// Pick the SMB2 dialect to upgrade to
+	dialect := request.upgradeDialect()
+	if dialect == DialectUnknown {
+		return ErrSMB1NotSupported
+	}
+	conn.dialect = dialect
+	conn.signingAlgorithmID = SigningAlgorithmHMACSHA256
+
+	// Create the response
+	response, err := newNegotiateResponse(conn.server, dialect)
+	if err != nil {
+		return err
+	}
+
+	// Marshal the response
 	data, err := response.Marshal()
 	if err != nil {
 		return err
 	}
 
 	// Send the response
-	if _, err := conn.Write(data); err != nil {
+	return sendResponse(conn, packet, data)
+}
+
+// newNegotiateResponse creates a negotiate response for the selected dialect
+func newNegotiateResponse(server *Server, dialect Dialect) (*NegotiateResponse, error) {
+	// Multi-credit requests are supported from SMB 2.1 on
+	var capabilities Capability
+	if dialect != DialectSMB202 {
+		capabilities |= CapabilityLargeMTU
+	}
+
+	// Announce the size limits of the dialect
+	maxTransact, maxRead, maxWrite := server.limits.ioSizes(dialect)
+
+	// List the authentication mechanisms
+	securityBlob, err := server.securityBlob()
+	if err != nil {
+		return nil, err
+	}
+
+	return &NegotiateResponse{
+		SecurityMode:    server.securityMode(),
+		Dialect:         dialect,
+		ServerGUID:      server.guid,
+		Capabilities:    capabilities,
+		MaxTransactSize: uint32(maxTransact),
+		MaxReadSize:     uint32(maxRead),
+		MaxWriteSize:    uint32(maxWrite),
+		SystemTime:      time.Now(),
+		ServerStartTime: server.startTime,
+		SecurityBuffer:  securityBlob,
+	}, nil
+}
+
+// sendResponse sends a successful response to the request in packet
+func sendResponse(conn *Connection, packet *Packet, data []byte) error {
+	// Marshal the response
+	buf, err := conn.marshalResponse(packet, StatusSuccess, data)
+	if err != nil {
+		return err
+	}
+
+	// Send the packet
+	packet.respond(StatusSuccess, buf)
+	return nil
+}
+
+// sendErrorResponse sends an error response to the request in packet
+func sendErrorResponse(conn *Connection, packet *Packet, status Status) error {
+	// Marshal the error response
+	data, err := (&ErrorResponse{}).Marshal()
+	if err != nil {
+		return err
+	}
+	buf, err := conn.marshalResponse(packet, status, data)
+	if err != nil {
 		return err
 	}
 
+	// Send the response
+	packet.respond(status, buf)
 	return nil
 }
+
+// marshalResponse serializes a response with the given status and body to the request
+// in packet, granting the client new credits in the header. The response is signed when it is sent.
+func (c *Connection) marshalResponse(packet *Packet, status Status, data []byte) ([]byte, error) {
+	// Create the response header from the request header
+	header := responseHeader(&packet.Header, status, c.grantCredits(&packet.Header))
+
+	// Marshal the header
+	buf, err := header.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	packet.signer = c.responseSigner(packet, status)
+
+	return append(buf, data...), nil
+}
@@ -0,0 +1,109 @@
+package smb
+
+import (
+	"io"
+	"math"
+	"time"
+)
+
+// asyncReadDelay is how long a read waits for the storage before it goes async
+const asyncReadDelay = 50 * time.Millisecond
+
+// readResult is the outcome of reading the storage
+type readResult struct {
+	n   int
+	err error
+}
+
+// handleReadCommand handles an SMB2 read request. The server keeps no cache of its own,
+// so unbuffered reads need no special handling. A read the storage does not answer within
+// asyncReadDelay is answered with an interim response and completes asynchronously.
+func handleReadCommand(conn *Connection, packet *Packet) error {
+	request, ok := packet.Data.(*ReadRequest)
+	if !ok {
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	}
+	o, id, status := conn.lookupOpen(packet, request.FileID)
+	if status != StatusSuccess {
+		return sendErrorResponse(conn, packet, status)
+	}
+	packet.setFileID(id)
+
+	// Check the request against the limits of the connection and the access of the open
+	_, maxRead, _ := conn.limits.ioSizes(conn.dialect)
+	switch {
+	case request.Length > uint32(maxRead) || request.Channel != 0 || request.Offset > math.MaxInt64:
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	case o.access&(FileReadData|FileExecute) == 0:
+		return sendErrorResponse(conn, packet, StatusAccessDenied)
+	case o.isDir:
+		return sendErrorResponse(conn, packet, StatusInvalidDevice)
+	}
+
+	// Read the data in the background, the storage may be slow
+	data := make([]byte, request.Length)
+	results := make(chan readResult, 1)
+	go func() {
+		n, err := o.file.ReadAt(data, int64(request.Offset))
+		results <- readResult{n: n, err: err}
+	}()
+
+	// Answer a quick read right away
+	timer := time.NewTimer(asyncReadDelay)
+	defer timer.Stop()
+	select {
+	case result := <-results:
+		status, response, err := readResponse(request, data, result)
+		if err != nil {
+			return err
+		}
+		if status != StatusSuccess {
+			return sendErrorResponse(conn, packet, status)
+		}
+
+		// Compress the response if the client asked for it
+		if request.Flags&ReadFlagRequestCompressed != 0 {
+			packet.compress = true
+		}
+		return sendResponse(conn, packet, response)
+	case <-timer.C:
+	}
+
+	// Go async and complete the read once the storage answers or the client cancels it
+	op, err := conn.goAsync(packet)
+	if err != nil {
+		return err
+	}
+	go func() {
+		select {
+		case result := <-results:
+			status, response, err := readResponse(request, data, result)
+			if err != nil {
+				status, response = StatusUnsuccessful, nil
+			}
+			op.complete(status, response)
+		case <-op.ctx.Done():
+			op.complete(StatusCancelled, nil)
+		}
+	}()
+	return nil
+}
+
+// readResponse returns the status of a read and its marshaled response, which is nil for an error status.
+// A read returning less than the minimum count fails at the end of the file.
+func readResponse(request *ReadRequest, data []byte, result readResult) (Status, []byte, error) {
+	// Check the outcome of the read
+	if result.err != nil && result.err != io.EOF {
+		return vfsStatus(result.err), nil, nil
+	}
+	if result.n == 0 && request.Length > 0 || uint32(result.n) < request.MinimumCount {
+		return StatusEndOfFile, nil, nil
+	}
+
+	// Marshal the response
+	response, err := (&ReadResponse{Data: data[:result.n]}).Marshal()
+	if err != nil {
+		return 0, nil, err
+	}
+	return StatusSuccess, response, nil
+}
@@ -0,0 +1,63 @@
+package smb
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/yuriyvolkov/simba/pkg/vfs"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name         string
+		offset       uint64
+		length       uint32
+		minimumCount uint32
+		want         Status
+		data         string
+	}{
+		{name: "whole file", offset: 0, length: 16, data: "0123456789"},
+		{name: "within the file", offset: 2, length: 3, data: "234"},
+		{name: "across the end", offset: 8, length: 4, data: "89"},
+		{name: "at the end", offset: 10, length: 4, want: StatusEndOfFile},
+		{name: "past the end", offset: 100, length: 4, want: StatusEndOfFile},
+		{name: "minimum count not met", offset: 8, length: 4, minimumCount: 3, want: StatusEndOfFile},
+		{name: "offset out of range", offset: 1 << 63, length: 4, want: StatusInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newTestTree(t, vfs.NewMemFS(0))
+			id := tree.mustCreate("file.txt", FileReadData|FileWriteData, shareAll, CreateDispositionCreate, 0)
+			defer tree.close(id)
+			if status, _ := tree.write(id, 0, []byte("0123456789")); status != StatusSuccess {
+				t.Fatalf("write status = %#x", uint32(status))
+			}
+
+			status, body := tree.request(CommandRead, &ReadRequest{
+				FileID:       id,
+				Offset:       tt.offset,
+				Length:       tt.length,
+				MinimumCount: tt.minimumCount,
+			})
+			if status != tt.want {
+				t.Fatalf("read status = %#x, want %#x", uint32(status), uint32(tt.want))
+			}
+			if status != StatusSuccess {
+				return
+			}
+			n := binary.LittleEndian.Uint32(body[4:8])
+			if data := string(body[16 : 16+n]); data != tt.data {
+				t.Errorf("read %q, want %q", data, tt.data)
+			}
+		})
+	}
+}
+
+func TestReadAccessDenied(t *testing.T) {
+	tree := newTestTree(t, vfs.NewMemFS(0))
+	id := tree.mustCreate("file.txt", FileWriteData, shareAll, CreateDispositionCreate, 0)
+	defer tree.close(id)
+	if status, _ := tree.read(id, 0, 4); status != StatusAccessDenied {
+		t.Errorf("read status = %#x, want %#x", uint32(status), uint32(StatusAccessDenied))
+	}
+}
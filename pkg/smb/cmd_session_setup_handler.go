@@ -0,0 +1,177 @@
+package smb
+
+import (
+	"errors"
+	"strings"
+)
+
+// handleSessionSetupCommand handles an SMB2 session setup request. Authentication takes
+// one or more legs, every leg but the last is answered with STATUS_MORE_PROCESSING_REQUIRED.
+func handleSessionSetupCommand(conn *Connection, packet *Packet) error {
+	request, ok := packet.Data.(*SessionSetupRequest)
+	if !ok {
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	}
+
+	// Multichannel is not supported, sessions cannot be bound to another connection
+	if request.Flags&SessionSetupFlagBinding != 0 {
+		return sendErrorResponse(conn, packet, StatusRequestNotAccepted)
+	}
+
+	// Find the session, the first leg creates it
+	var s *session
+	if packet.Header.SessionID == 0 {
+		s = conn.newSession()
+		packet.Header.SessionID = s.id
+		packet.setSessionID(s.id)
+	} else if s = conn.lookupSession(packet.Header.SessionID); s == nil {
+		return sendErrorResponse(conn, packet, StatusUserSessionDeleted)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Start a new exchange, on an established session it reauthenticates the client
+	if s.auth == nil {
+		s.auth = newAuthExchange(conn.server)
+	}
+
+	// SMB 3.1.1 hashes every session setup request into the preauth integrity hash of the session
+	preauth := conn.sessionPreauth(s.id)
+	if preauth != nil {
+		preauth.Update(packet.raw)
+	}
+
+	// Run the authentication leg
+	securityBuffer, done, err := s.auth.step(request.SecurityBuffer)
+	if err != nil {
+		return failSessionSetup(conn, packet, s, StatusLogonFailure)
+	}
+
+	// Ask the client for the next leg
+	if !done {
+		data, err := (&SessionSetupResponse{SecurityBuffer: securityBuffer}).Marshal()
+		if err != nil {
+			return err
+		}
+		buf, err := conn.marshalResponse(packet, StatusMoreProcessingRequired, data)
+		if err != nil {
+			return err
+		}
+
+		// The response is hashed as well, only the final response is left out
+		if preauth != nil {
+			preauth.Update(buf)
+		}
+
+		packet.respond(StatusMoreProcessingRequired, buf)
+		return nil
+	}
+
+	// Anonymous logons are refused unless null sessions are allowed
+	identity := s.auth.identity()
+	var flags SessionFlag
+	var groups []string
+	switch {
+	case identity.anonymous:
+		if !conn.server.nullSessions {
+			return failSessionSetup(conn, packet, s, StatusLogonFailure)
+		}
+		flags = SessionFlagIsNull
+	default:
+		if identity.guest {
+			flags = SessionFlagIsGuest
+		}
+
+		// Refuse accounts that may not log in. Kerberos clients and the guest account may be unknown
+		// to the authenticator, they are logged in without groups.
+		user, err := conn.server.lookupUser(identity.domain, identity.user)
+		switch {
+		case err == nil:
+			if status := user.logonStatus(); status != StatusSuccess {
+				return failSessionSetup(conn, packet, s, status)
+			}
+			groups = user.Groups
+		case !errors.Is(err, ErrNoSuchUser):
+			return failSessionSetup(conn, packet, s, StatusLogonFailure)
+		}
+	}
+
+	// Reauthentication renews the logon of the session, it cannot switch to another user
+	if domain, user, _, _ := s.identity(); s.state != sessionInProgress &&
+		(!strings.EqualFold(domain, identity.domain) || !strings.EqualFold(user, identity.user)) {
+		return failSessionSetup(conn, packet, s, StatusAccessDenied)
+	}
+
+	// Set up the keys of a new session. Guest and anonymous sessions have none, so they can neither
+	// sign nor encrypt. The AES-256 ciphers derive their keys from the full session key.
+	preauth = conn.endSessionPreauth(s.id)
+	var sessionKey, preauthValue []byte
+	var sg *signer
+	var sc *sessionCipher
+	if s.state == sessionInProgress && len(identity.sessionKey) > 0 {
+		sessionKey = make([]byte, 16)
+		copy(sessionKey, identity.sessionKey)
+		if preauth != nil {
+			preauthValue = preauth.Value()
+		}
+		if sg, err = newSigner(conn.signingAlgorithmID, signingKey(conn.dialect, sessionKey, preauthValue)); err != nil {
+			return err
+		}
+		if conn.dialect >= DialectSMB300 && conn.cipherID != CipherNone {
+			key := sessionKey
+			if conn.cipherID == CipherAES256CCM || conn.cipherID == CipherAES256GCM {
+				key = identity.sessionKey
+			}
+			if sc, err = newSessionCipher(conn.cipherID, conn.dialect, key, preauthValue); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Sessions that cannot encrypt are refused when the server requires encryption
+	if s.state == sessionInProgress && conn.server.encryptData && sc == nil {
+		return failSessionSetup(conn, packet, s, StatusAccessDenied)
+	}
+
+	// The client is authenticated. Reauthentication keeps the keys of the session and
+	// only moves its expiry time.
+	s.auth = nil
+	s.setIdentity(identity.domain, identity.user, groups, flags)
+	if s.state == sessionInProgress {
+		s.sessionKey = sessionKey
+		s.preauthValue = preauthValue
+		if sg != nil {
+			required := conn.server.signingRequired ||
+				conn.clientSecurityMode&SecurityModeSignaturesRequired != 0 ||
+				SecurityMode(request.SecurityMode)&SecurityModeSignaturesRequired != 0
+			s.setSigning(sg, required)
+		}
+		if sc != nil {
+			s.setEncryption(sc, conn.server.encryptData)
+		}
+	}
+	s.establish(identity.expiresAt)
+	if _, required := s.encryption(); required {
+		flags |= SessionFlagEncryptData
+	}
+
+	// Marshal the response
+	data, err := (&SessionSetupResponse{SessionFlags: flags, SecurityBuffer: securityBuffer}).Marshal()
+	if err != nil {
+		return err
+	}
+
+	// Send the response
+	return sendResponse(conn, packet, data)
+}
+
+// failSessionSetup answers a failed authentication leg with the status, usually STATUS_LOGON_FAILURE.
+// A session in setup is removed, an established session keeps its previous authentication.
+func failSessionSetup(conn *Connection, packet *Packet, s *session, status Status) error {
+	s.auth = nil
+	conn.endSessionPreauth(s.id)
+	if s.state == sessionInProgress {
+		conn.removeSession(s)
+	}
+	return sendErrorResponse(conn, packet, status)
+}
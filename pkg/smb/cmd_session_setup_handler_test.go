@@ -0,0 +1,152 @@
+package smb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/yuriyvolkov/simba/pkg/ntlm"
+)
+
+// anonymousNegotiate returns an NTLM NEGOTIATE_MESSAGE without domain and workstation
+func anonymousNegotiate() []byte {
+	msg := append([]byte{}, ntlm.Signature[:]...)
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(ntlm.MessageTypeNegotiate))
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(ntlm.NegotiateUnicode|ntlm.NegotiateNTLM))
+	return append(msg, make([]byte, 16)...)
+}
+
+// anonymousAuthenticate returns an NTLM AUTHENTICATE_MESSAGE with an empty user and empty responses
+func anonymousAuthenticate() []byte {
+	const size = 64
+	msg := append([]byte{}, ntlm.Signature[:]...)
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(ntlm.MessageTypeAuthenticate))
+	for i := 0; i < 6; i++ {
+		msg = binary.LittleEndian.AppendUint16(msg, 0)
+		msg = binary.LittleEndian.AppendUint16(msg, 0)
+		msg = binary.LittleEndian.AppendUint32(msg, size)
+	}
+	return binary.LittleEndian.AppendUint32(msg, uint32(ntlm.NegotiateUnicode|ntlm.NegotiateNTLM))
+}
+
+// anonymousLogon runs the two legs of an anonymous NTLM logon on a session, a zero session ID creates one.
+// It returns the status of the last leg and the session ID, it does not fail the test so that it can run
+// on any goroutine.
+func anonymousLogon(conn *Connection, sessionID uint64) (Status, uint64, error) {
+	// Send the negotiate message, the first leg of a new session allocates its ID
+	status, _, err := handleTestRequest(conn, sessionID, 0, CommandSessionSetup, &SessionSetupRequest{SecurityBuffer: anonymousNegotiate()})
+	if err != nil || status != StatusMoreProcessingRequired {
+		return status, sessionID, err
+	}
+	if sessionID == 0 {
+		conn.server.sessions.mu.Lock()
+		for id, s := range conn.server.sessions.sessions {
+			if s.conn == conn {
+				sessionID = id
+			}
+		}
+		conn.server.sessions.mu.Unlock()
+	}
+
+	// Send the authenticate message
+	status, _, err = handleTestRequest(conn, sessionID, 0, CommandSessionSetup, &SessionSetupRequest{SecurityBuffer: anonymousAuthenticate()})
+	return status, sessionID, err
+}
+
+func TestSessionSetupAnonymous(t *testing.T) {
+	tests := []struct {
+		name         string
+		nullSessions bool
+		want         Status
+	}{
+		{name: "null sessions allowed", nullSessions: true, want: StatusSuccess},
+		{name: "null sessions refused", nullSessions: false, want: StatusLogonFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newTestConn(t, WithNullSessions(tt.nullSessions))
+			status, id, err := anonymousLogon(conn, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != tt.want {
+				t.Fatalf("logon status = %#x, want %#x", uint32(status), uint32(tt.want))
+			}
+			if status != StatusSuccess {
+				return
+			}
+			s := conn.lookupSession(id)
+			if s == nil {
+				t.Fatal("session was not kept")
+			}
+			if !s.isGuest() {
+				t.Error("anonymous session is not a guest session")
+			}
+		})
+	}
+}
+
+// TestSessionSetupReauthenticate reauthenticates a session while the shares check its identity,
+// run it with -race to check the identity is published safely
+func TestSessionSetupReauthenticate(t *testing.T) {
+	conn := newTestConn(t,
+		WithNullSessions(true),
+		WithShareFS("public", nil, GuestAccess(false)),
+		WithShareFS("staff", nil, GuestAccess(false), ValidUsers("@staff")),
+	)
+	status, id, err := anonymousLogon(conn, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != StatusSuccess {
+		t.Fatalf("logon status = %#x", uint32(status))
+	}
+	s := conn.lookupSession(id)
+	public := conn.server.shares.lookup("public")
+	staff := conn.server.shares.lookup("staff")
+
+	// Reauthenticate the session over and over, failures are reported to the test goroutine
+	const rounds = 50
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer close(done)
+		for i := 0; i < rounds; i++ {
+			status, _, err := anonymousLogon(conn, id)
+			if err == nil && status != StatusSuccess {
+				err = fmt.Errorf("reauthentication status = %#x", uint32(status))
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	// Check the session against the shares meanwhile, it is admitted to the public share only
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		if !public.admits(s) || staff.admits(s) || public.readOnlyFor(s) {
+			t.Error("anonymous session admitted to the wrong shares")
+			<-done
+			break
+		}
+	}
+	select {
+	case err := <-errs:
+		t.Fatal(err)
+	default:
+	}
+
+	// Tree connects see the same identity once reauthentication has completed
+	if status, _ := testRequest(t, conn, id, 0, CommandTreeConnect, &TreeConnectRequest{Path: `\\server\public`}); status != StatusSuccess {
+		t.Errorf("tree connect to the public share status = %#x", uint32(status))
+	}
+	if status, _ := testRequest(t, conn, id, 0, CommandTreeConnect, &TreeConnectRequest{Path: `\\server\staff`}); status != StatusAccessDenied {
+		t.Errorf("tree connect to the staff share status = %#x, want %#x", uint32(status), uint32(StatusAccessDenied))
+	}
+}
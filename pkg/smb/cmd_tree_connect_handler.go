@@ -0,0 +1,79 @@
+package smb
+
+// handleTreeConnectCommand handles an SMB2 tree connect request, it connects the session to a share
+func handleTreeConnectCommand(conn *Connection, packet *Packet) error {
+	request, ok := packet.Data.(*TreeConnectRequest)
+	if !ok {
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	}
+	s := conn.lookupSession(packet.Header.SessionID)
+	if s == nil {
+		return sendErrorResponse(conn, packet, StatusUserSessionDeleted)
+	}
+
+	// Find the share
+	name, ok := shareName(request.Path)
+	if !ok {
+		return sendErrorResponse(conn, packet, StatusBadNetworkName)
+	}
+	share := conn.server.shares.lookup(name)
+	if share == nil {
+		return sendErrorResponse(conn, packet, StatusBadNetworkName)
+	}
+
+	// Guests only connect to shares open to them
+	if !share.admits(s) {
+		return sendErrorResponse(conn, packet, StatusAccessDenied)
+	}
+
+	// Shares that require encryption refuse sessions that cannot encrypt
+	if sc, _ := s.encryption(); share.EncryptData && sc == nil {
+		return sendErrorResponse(conn, packet, StatusAccessDenied)
+	}
+
+	// Connect the tree, the response header carries its ID
+	tree := s.addTree(share)
+	packet.Header.TreeID = tree.id
+	packet.setTreeID(tree.id)
+
+	// Marshal the response
+	data, err := (&TreeConnectResponse{
+		ShareType:     share.Type,
+		ShareFlags:    share.flags(),
+		Capabilities:  share.capabilities(),
+		MaximalAccess: tree.maximalAccess,
+	}).Marshal()
+	if err != nil {
+		return err
+	}
+
+	// Send the response
+	return sendResponse(conn, packet, data)
+}
+
+// handleTreeDisconnectCommand handles an SMB2 tree disconnect request
+func handleTreeDisconnectCommand(conn *Connection, packet *Packet) error {
+	if _, ok := packet.Data.(*TreeDisconnectRequest); !ok {
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	}
+	s := conn.lookupSession(packet.Header.SessionID)
+	if s == nil {
+		return sendErrorResponse(conn, packet, StatusUserSessionDeleted)
+	}
+
+	// Disconnect the tree and close the files opened on it
+	tree := s.removeTree(packet.Header.TreeID)
+	if tree == nil {
+		return sendErrorResponse(conn, packet, StatusNetworkNameDeleted)
+	}
+	tree.closeOpens()
+
+	// Marshal the response
+	data, err := (&TreeDisconnectResponse{}).Marshal()
+	if err != nil {
+		return err
+	}
+
+	// Send the response
+	return sendResponse(conn, packet, data)
+}
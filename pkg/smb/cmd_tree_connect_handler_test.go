@@ -0,0 +1,106 @@
+package smb
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/yuriyvolkov/simba/pkg/vfs"
+)
+
+func TestTreeConnect(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		guest         bool
+		want          Status
+		shareType     ShareType
+		shareFlags    ShareFlag
+		maximalAccess AccessMask
+	}{
+		{
+			name: "disk share", path: `\\server\files`,
+			shareType: ShareTypeDisk, shareFlags: ShareFlagManualCaching, maximalAccess: FileAllAccess,
+		},
+		{
+			name: "share name in another case", path: `\\SERVER\FILES`,
+			shareType: ShareTypeDisk, shareFlags: ShareFlagManualCaching, maximalAccess: FileAllAccess,
+		},
+		{
+			name: "read-only share", path: `\\server\archive`,
+			shareType: ShareTypeDisk, shareFlags: ShareFlagManualCaching, maximalAccess: FileGenericRead | FileGenericExecute,
+		},
+		{
+			name: "guest on a share read-only for guests", path: `\\server\public`, guest: true,
+			shareType: ShareTypeDisk, shareFlags: ShareFlagManualCaching, maximalAccess: FileGenericRead | FileGenericExecute,
+		},
+		{
+			name: "user on a share read-only for guests", path: `\\server\public`,
+			shareType: ShareTypeDisk, shareFlags: ShareFlagManualCaching, maximalAccess: FileAllAccess,
+		},
+		{
+			name: "pipe share", path: `\\server\IPC$`,
+			shareType: ShareTypePipe, shareFlags: ShareFlagManualCaching, maximalAccess: FileAllAccess,
+		},
+		{name: "guest on a share closed to guests", path: `\\server\files`, guest: true, want: StatusAccessDenied},
+		{name: "encrypted share without encryption", path: `\\server\secret`, want: StatusAccessDenied},
+		{name: "unknown share", path: `\\server\missing`, want: StatusBadNetworkName},
+		{name: "no share name", path: `\\server`, want: StatusBadNetworkName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newTestConn(t,
+				WithShareFS("files", vfs.NewMemFS(0)),
+				WithShareFS("archive", vfs.NewMemFS(0), ReadOnly()),
+				WithShareFS("public", vfs.NewMemFS(0), GuestAccess(true)),
+				WithShareFS("secret", vfs.NewMemFS(0), RequireEncryption()),
+			)
+			s := conn.newSession()
+			if tt.guest {
+				s.setIdentity("DOMAIN", "guest", nil, SessionFlagIsGuest)
+			} else {
+				s.setIdentity("DOMAIN", "user", nil, 0)
+			}
+			s.establish(time.Time{})
+
+			// Connect to the share
+			status, body := testRequest(t, conn, s.id, 0, CommandTreeConnect, &TreeConnectRequest{Path: tt.path})
+			if status != tt.want {
+				t.Fatalf("tree connect status = %#x, want %#x", uint32(status), uint32(tt.want))
+			}
+			if status != StatusSuccess {
+				return
+			}
+
+			// Check the fields of the response
+			if size := binary.LittleEndian.Uint16(body[0:2]); size != treeConnectResponseStructureSize {
+				t.Errorf("structure size = %d", size)
+			}
+			if shareType := ShareType(body[2]); shareType != tt.shareType {
+				t.Errorf("share type = %#x, want %#x", shareType, tt.shareType)
+			}
+			if flags := ShareFlag(binary.LittleEndian.Uint32(body[4:8])); flags != tt.shareFlags {
+				t.Errorf("share flags = %#x, want %#x", flags, tt.shareFlags)
+			}
+			if capabilities := ShareCapability(binary.LittleEndian.Uint32(body[8:12])); capabilities != 0 {
+				t.Errorf("capabilities = %#x, want none", capabilities)
+			}
+			if access := AccessMask(binary.LittleEndian.Uint32(body[12:16])); access != tt.maximalAccess {
+				t.Errorf("maximal access = %#x, want %#x", access, tt.maximalAccess)
+			}
+			if len(s.trees) != 1 {
+				t.Fatalf("session holds %d tree connects, want 1", len(s.trees))
+			}
+
+			// Disconnect the tree, its ID is no longer valid afterwards
+			for id := range s.trees {
+				if status, _ := testRequest(t, conn, s.id, id, CommandTreeDisconnect, &TreeDisconnectRequest{}); status != StatusSuccess {
+					t.Errorf("tree disconnect status = %#x", uint32(status))
+				}
+				if status, _ := testRequest(t, conn, s.id, id, CommandTreeDisconnect, &TreeDisconnectRequest{}); status != StatusNetworkNameDeleted {
+					t.Errorf("second tree disconnect status = %#x, want %#x", uint32(status), uint32(StatusNetworkNameDeleted))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package smb
+
+import "math"
+
+// appendOffset is the write offset that appends to the end of the file
+const appendOffset = math.MaxUint64
+
+// handleWriteCommand handles an SMB2 write request. Write-through writes are committed to stable
+// storage before the response is sent, the server keeps no cache so unbuffered writes need nothing more.
+func handleWriteCommand(conn *Connection, packet *Packet) error {
+	request, ok := packet.Data.(*WriteRequest)
+	if !ok {
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	}
+	o, id, status := conn.lookupOpen(packet, request.FileID)
+	if status != StatusSuccess {
+		return sendErrorResponse(conn, packet, status)
+	}
+	packet.setFileID(id)
+
+	// Check the request against the limits of the connection and the access of the open
+	_, _, maxWrite := conn.limits.ioSizes(conn.dialect)
+	switch {
+	case len(request.Data) > maxWrite || request.Channel != 0:
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	case o.access&(FileWriteData|FileAppendData) == 0:
+		return sendErrorResponse(conn, packet, StatusAccessDenied)
+	case o.isDir:
+		return sendErrorResponse(conn, packet, StatusInvalidDevice)
+	}
+
+	// Opens that may only append write at the end of the file whatever the offset, as Windows does
+	appending := request.Offset == appendOffset || o.access&FileWriteData == 0
+	if !appending && request.Offset > math.MaxInt64-uint64(len(request.Data)) {
+		return sendErrorResponse(conn, packet, StatusInvalidParameter)
+	}
+
+	// Write the data, appends go through the file so that concurrent ones do not overwrite each other
+	var n int
+	var err error
+	if appending {
+		n, err = o.appendData(request.Data)
+	} else {
+		n, err = o.file.WriteAt(request.Data, int64(request.Offset))
+	}
+	if err != nil {
+		return sendErrorResponse(conn, packet, vfsStatus(err))
+	}
+
+	// Commit the data before answering a write-through write, SMB 2.0.2 has no such flag
+	if request.Flags&WriteFlagWriteThrough != 0 && conn.dialect != DialectSMB202 {
+		if err := o.file.Sync(); err != nil {
+			return sendErrorResponse(conn, packet, vfsStatus(err))
+		}
+	}
+
+	// Marshal the response
+	response, err := (&WriteResponse{Count: uint32(n)}).Marshal()
+	if err != nil {
+		return err
+	}
+
+	// Send the response
+	return sendResponse(conn, packet, response)
+}
@@ -0,0 +1,116 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/yuriyvolkov/simba/pkg/vfs"
+)
+
+func TestWriteAppend(t *testing.T) {
+	tests := []struct {
+		name   string
+		access AccessMask
+		offset uint64
+		want   Status
+		data   string
+	}{
+		{name: "append", access: FileAppendData, offset: appendOffset, data: "0123456789abc"},
+		{name: "append with write access", access: FileWriteData, offset: appendOffset, data: "0123456789abc"},
+		{name: "write at an offset", access: FileWriteData, offset: 2, data: "01abc56789"},
+		{name: "append only at an offset", access: FileAppendData, offset: 2, data: "0123456789abc"},
+		{name: "append only at an offset out of range", access: FileAppendData, offset: appendOffset - 1, data: "0123456789abc"},
+		{name: "offset out of range", access: FileWriteData, offset: appendOffset - 1, want: StatusInvalidParameter, data: "0123456789"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newTestTree(t, vfs.NewMemFS(0))
+			id := tree.mustCreate("file.txt", FileWriteData, shareAll, CreateDispositionCreate, 0)
+			if status, _ := tree.write(id, 0, []byte("0123456789")); status != StatusSuccess {
+				t.Fatalf("write status = %#x", uint32(status))
+			}
+			tree.close(id)
+
+			// Write through an open with the access
+			id = tree.mustCreate("file.txt", tt.access, shareAll, CreateDispositionOpen, 0)
+			status, n := tree.write(id, tt.offset, []byte("abc"))
+			tree.close(id)
+			if status != tt.want {
+				t.Fatalf("write status = %#x, want %#x", uint32(status), uint32(tt.want))
+			}
+			if status == StatusSuccess && n != 3 {
+				t.Errorf("write count = %d, want 3", n)
+			}
+
+			// Read the file back
+			id = tree.mustCreate("file.txt", FileReadData, shareAll, CreateDispositionOpen, 0)
+			defer tree.close(id)
+			if _, data := tree.read(id, 0, 32); string(data) != tt.data {
+				t.Errorf("file holds %q, want %q", data, tt.data)
+			}
+		})
+	}
+}
+
+// TestWriteAppendConcurrent appends to a file through two opens at once, run it with -race.
+// The goroutines call handleTestRequest, the helpers of testTree may stop the test.
+func TestWriteAppendConcurrent(t *testing.T) {
+	tree := newTestTree(t, vfs.NewMemFS(0))
+	ids := []FileID{
+		tree.mustCreate("log.txt", FileAppendData, shareAll, CreateDispositionCreate, 0),
+		tree.mustCreate("log.txt", FileAppendData, shareAll, CreateDispositionOpen, 0),
+	}
+
+	// Append a line per round through each open
+	const rounds = 200
+	line := []byte("0123456789\n")
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id FileID) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				status, body, err := handleTestRequest(tree.conn, tree.session.id, tree.tree.id, CommandWrite, &WriteRequest{FileID: id, Offset: appendOffset, Data: line})
+				if err == nil && status == StatusSuccess && binary.LittleEndian.Uint32(body[4:8]) != uint32(len(line)) {
+					err = fmt.Errorf("count %d", binary.LittleEndian.Uint32(body[4:8]))
+				}
+				if err != nil || status != StatusSuccess {
+					t.Errorf("append status = %#x, %v", uint32(status), err)
+					return
+				}
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	// No append overwrote another
+	reader := tree.mustCreate("log.txt", FileReadData, shareAll, CreateDispositionOpen, 0)
+	status, data := tree.read(reader, 0, 2*rounds*uint32(len(line)))
+	if status != StatusSuccess {
+		t.Fatalf("read status = %#x", uint32(status))
+	}
+	if want := bytes.Repeat(line, 2*rounds); !bytes.Equal(data, want) {
+		t.Errorf("file holds %d bytes, want %d", len(data), len(want))
+	}
+	for _, id := range append(ids, reader) {
+		tree.close(id)
+	}
+}
+
+func TestWriteFarPastEnd(t *testing.T) {
+	fsys := vfs.NewMemFS(0)
+	tree := newTestTree(t, fsys)
+	id := tree.mustCreate("sparse.bin", FileReadData|FileWriteData, shareAll, CreateDispositionCreate, 0)
+	defer tree.close(id)
+
+	// A RAM disk without a capacity refuses to fill a terabyte with zeros
+	if status, _ := tree.write(id, 1<<40, []byte("x")); status != StatusDiskFull {
+		t.Errorf("write status = %#x, want %#x", uint32(status), uint32(StatusDiskFull))
+	}
+	if _, free := fsys.Usage(); free != vfs.DefaultMemCapacity {
+		t.Errorf("free space = %d, want %d", free, vfs.DefaultMemCapacity)
+	}
+}
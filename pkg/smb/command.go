@@ -1,33 +1,63 @@
 package smb
 
-// Command represents an SMB command
+// Command represents an SMB2 command
 type Command uint16
 
 const (
 	// CommandNegotiate indicates a negotiate command
-	CommandNegotiate Command = 0x72
+	CommandNegotiate Command = 0x0000
 
 	// CommandSessionSetup indicates a session setup command
-	CommandSessionSetup Command = 0x73
+	CommandSessionSetup Command = 0x0001
+
+	// CommandLogoff indicates a logoff command
+	CommandLogoff Command = 0x0002
 
 	// CommandTreeConnect indicates a tree connect command
-	CommandTreeConnect Command = 0x75
+	CommandTreeConnect Command = 0x0003
+
+	// CommandTreeDisconnect indicates a tree disconnect command
+	CommandTreeDisconnect Command = 0x0004
 
 	// CommandCreate indicates a create command
-	CommandCreate Command = 0x6D
+	CommandCreate Command = 0x0005
 
 	// CommandClose indicates a close command
-	CommandClose Command = 0x6E
+	CommandClose Command = 0x0006
 
-	// CommandWrite indicates a write command
-	CommandWrite Command = 0x2B
+	// CommandFlush indicates a flush command
+	CommandFlush Command = 0x0007
 
 	// CommandRead indicates a read command
-	CommandRead Command = 0x2E
+	CommandRead Command = 0x0008
 
-	// CommandTreeDisconnect indicates a tree disconnect command
-	CommandTreeDisconnect Command = 0x71
+	// CommandWrite indicates a write command
+	CommandWrite Command = 0x0009
 
-	// CommandLogoff indicates a logoff command
-	CommandLogoff Command = 0x74
+	// CommandLock indicates a byte-range lock command
+	CommandLock Command = 0x000A
+
+	// CommandIoctl indicates an ioctl or fsctl command
+	CommandIoctl Command = 0x000B
+
+	// CommandCancel indicates a cancel command
+	CommandCancel Command = 0x000C
+
+	// CommandEcho indicates an echo command
+	CommandEcho Command = 0x000D
+
+	// CommandQueryDirectory indicates a query directory command
+	CommandQueryDirectory Command = 0x000E
+
+	// CommandChangeNotify indicates a change notify command
+	CommandChangeNotify Command = 0x000F
+
+	// CommandQueryInfo indicates a query info command
+	CommandQueryInfo Command = 0x0010
+
+	// CommandSetInfo indicates a set info command
+	CommandSetInfo Command = 0x0011
+
+	// CommandOplockBreak indicates an oplock or lease break command
+	CommandOplockBreak Command = 0x0012
 )
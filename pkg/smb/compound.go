@@ -0,0 +1,143 @@
+package smb
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// headerNextCommandOffset is the offset of the NextCommand field in the SMB2 header
+const headerNextCommandOffset = 20
+
+// ErrInvalidCompound is returned when the NextCommand chain of a message is malformed
+var ErrInvalidCompound = errors.New("smb: invalid compounded message")
+
+// FileID identifies an open file
+type FileID struct {
+	Persistent uint64
+	Volatile   uint64
+}
+
+// relatedFileID is used by related requests in a compound to refer to the file
+// opened or used by the previous request
+var relatedFileID = FileID{Persistent: 0xFFFFFFFFFFFFFFFF, Volatile: 0xFFFFFFFFFFFFFFFF}
+
+// compoundState carries values from one request of a compounded message to the next
+type compoundState struct {
+	sessionID uint64
+	treeID    uint32
+	fileID    FileID
+	status    Status
+}
+
+// isRelated reports whether the request is a related operation of a compound
+func (p *Packet) isRelated() bool {
+	return p.Header.Flags&FlagRelatedOperations != 0
+}
+
+// resolveFileID returns the file ID a request refers to, replacing the
+// related file ID by the one of the previous request in the compound
+func (p *Packet) resolveFileID(id FileID) FileID {
+	if p.compound != nil && p.isRelated() && id == relatedFileID {
+		return p.compound.fileID
+	}
+	return id
+}
+
+// setFileID records the file ID opened or used by a request for the related requests following it
+func (p *Packet) setFileID(id FileID) {
+	if p.compound != nil {
+		p.compound.fileID = id
+	}
+}
+
+// setSessionID records the session created by a request for the related requests following it
+func (p *Packet) setSessionID(id uint64) {
+	if p.compound != nil {
+		p.compound.sessionID = id
+	}
+}
+
+// setTreeID records the tree connected by a request for the related requests following it
+func (p *Packet) setTreeID(id uint32) {
+	if p.compound != nil {
+		p.compound.treeID = id
+	}
+}
+
+// compoundParse splits a message into the packets of its compounded requests.
+// A request whose data cannot be parsed is returned with nil Data, so its handler
+// can answer it with an error instead of failing the whole message.
+func compoundParse(data []byte) ([]*Packet, error) {
+	// SMB1 messages cannot be compounded
+	if isSMB1(data) {
+		packet, err := PacketParse(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*Packet{packet}, nil
+	}
+
+	state := &compoundState{}
+
+	var packets []*Packet
+	for {
+		// Parse the header
+		header, err := HeaderParse(data)
+		if err != nil {
+			return nil, err
+		}
+
+		// Find the end of the request, the next one starts at an 8-byte boundary
+		end := len(data)
+		if header.NextCommand != 0 {
+			if header.NextCommand%8 != 0 || header.NextCommand < HeaderSize || int(header.NextCommand) > len(data) {
+				return nil, ErrInvalidCompound
+			}
+			end = int(header.NextCommand)
+		}
+
+		// Parse the packet data
+		parsedData, err := ParseData(header.Command, data[HeaderSize:end])
+		if err != nil {
+			parsedData = nil
+		}
+
+		packets = append(packets, &Packet{
+			Header:   *header,
+			Data:     parsedData,
+			raw:      data[:end],
+			compound: state,
+		})
+
+		if header.NextCommand == 0 {
+			return packets, nil
+		}
+		data = data[end:]
+	}
+}
+
+// compoundResponses chains the responses to the requests of a compounded message into a single message,
+// requests without a response are skipped. Every response but the last is padded to an 8-byte boundary
+// and points to the next one. Responses are signed once chained, the signature covers the padding.
+func compoundResponses(packets []*Packet) []byte {
+	var responses []*Packet
+	for _, packet := range packets {
+		if packet.response != nil {
+			responses = append(responses, packet)
+		}
+	}
+
+	var msg []byte
+	for i, packet := range responses {
+		r := packet.response
+		if i < len(responses)-1 {
+			r = append(r, make([]byte, padding8(len(r)))...)
+			binary.LittleEndian.PutUint32(r[headerNextCommandOffset:], uint32(len(r)))
+		}
+		if packet.signer != nil {
+			packet.signer.sign(r)
+		}
+		msg = append(msg, r...)
+	}
+	return msg
+}
@@ -0,0 +1,286 @@
+package smb
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/yuriyvolkov/simba/pkg/xca"
+)
+
+// DefaultCompressionThreshold is the size below which messages are sent uncompressed
+const DefaultCompressionThreshold = 4096
+
+// patternMinRun is the shortest run of a byte at either end of a message sent as a Pattern_V1 payload
+const patternMinRun = 32
+
+// ErrDecompressionFailed is returned for a compressed message that cannot be decompressed
+var ErrDecompressionFailed = errors.New("smb: message decompression failed")
+
+// isCompressionSupported reports whether the server implements a compression algorithm
+func isCompressionSupported(a CompressionAlgorithm) bool {
+	switch a {
+	case CompressionAlgorithmLZNT1, CompressionAlgorithmLZ77, CompressionAlgorithmLZ77Huffman, CompressionAlgorithmPatternV1:
+		return true
+	default:
+		return false
+	}
+}
+
+// compressPayload compresses data with one of the LZ algorithms
+func compressPayload(a CompressionAlgorithm, data []byte) []byte {
+	switch a {
+	case CompressionAlgorithmLZNT1:
+		return xca.CompressLZNT1(data)
+	case CompressionAlgorithmLZ77:
+		return xca.CompressLZ77(data)
+	case CompressionAlgorithmLZ77Huffman:
+		return xca.CompressLZ77Huffman(data)
+	default:
+		return nil
+	}
+}
+
+// decompressPayload decompresses data compressed with one of the LZ algorithms to size bytes
+func decompressPayload(a CompressionAlgorithm, data []byte, size int) ([]byte, error) {
+	switch a {
+	case CompressionAlgorithmLZNT1:
+		return xca.DecompressLZNT1(data, size)
+	case CompressionAlgorithmLZ77:
+		return xca.DecompressLZ77(data, size)
+	case CompressionAlgorithmLZ77Huffman:
+		return xca.DecompressLZ77Huffman(data, size)
+	default:
+		return nil, ErrDecompressionFailed
+	}
+}
+
+// compressionNegotiated reports whether the client may use a compression algorithm on the connection
+func (c *Connection) compressionNegotiated(a CompressionAlgorithm) bool {
+	for _, negotiated := range c.compressionAlgorithms {
+		if a == negotiated {
+			return true
+		}
+	}
+	return false
+}
+
+// decompressMessage decompresses a message received with a compression transform header.
+// Only the negotiated algorithms are accepted and the message may not grow beyond the largest message allowed.
+func (c *Connection) decompressMessage(data []byte) ([]byte, error) {
+	if len(c.compressionAlgorithms) == 0 || len(data) < CompressionTransformHeaderSize {
+		return nil, ErrDecompressionFailed
+	}
+
+	// The flags of an unchained header share their place with those of the first payload header of a chained one
+	if binary.LittleEndian.Uint16(data[10:])&CompressionFlagChained != 0 {
+		return c.decompressChained(data)
+	}
+
+	// Parse the header
+	header, err := CompressionTransformHeaderParse(data)
+	if err != nil {
+		return nil, err
+	}
+	if !c.compressionNegotiated(header.CompressionAlgorithm) || header.CompressionAlgorithm == CompressionAlgorithmPatternV1 {
+		return nil, ErrDecompressionFailed
+	}
+	size := int64(header.Offset) + int64(header.OriginalCompressedSegmentSize)
+	if int64(header.Offset) > int64(len(data)-CompressionTransformHeaderSize) || size > int64(c.limits.MaxMessageSize) {
+		return nil, ErrDecompressionFailed
+	}
+
+	// The data before the offset is not compressed
+	segment := data[CompressionTransformHeaderSize+int(header.Offset):]
+	decompressed, err := decompressPayload(header.CompressionAlgorithm, segment, int(header.OriginalCompressedSegmentSize))
+	if err != nil {
+		return nil, ErrDecompressionFailed
+	}
+	msg := make([]byte, 0, size)
+	msg = append(msg, data[CompressionTransformHeaderSize:CompressionTransformHeaderSize+int(header.Offset)]...)
+	return append(msg, decompressed...), nil
+}
+
+// decompressChained decompresses a message with a chained compression transform header
+func (c *Connection) decompressChained(data []byte) ([]byte, error) {
+	size := int64(binary.LittleEndian.Uint32(data[4:]))
+	if size > int64(c.limits.MaxMessageSize) {
+		return nil, ErrDecompressionFailed
+	}
+
+	// Decompress the payloads in order
+	msg := make([]byte, 0, size)
+	rest := data[compressionChainedHeaderSize:]
+	for len(rest) > 0 {
+		header, payload, err := CompressionPayloadHeaderParse(rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = rest[compressionPayloadHeaderSize+int(header.Length):]
+		remaining := size - int64(len(msg))
+
+		switch {
+		case header.CompressionAlgorithm == CompressionAlgorithmNone:
+			if int64(len(payload)) > remaining {
+				return nil, ErrDecompressionFailed
+			}
+			msg = append(msg, payload...)
+		case !c.compressionNegotiated(header.CompressionAlgorithm):
+			return nil, ErrDecompressionFailed
+		case header.CompressionAlgorithm == CompressionAlgorithmPatternV1:
+			pattern, err := PatternPayloadV1Parse(payload)
+			if err != nil {
+				return nil, err
+			}
+			if int64(pattern.Repetitions) > remaining {
+				return nil, ErrDecompressionFailed
+			}
+			for i := uint32(0); i < pattern.Repetitions; i++ {
+				msg = append(msg, pattern.Pattern)
+			}
+		default:
+			if int64(header.OriginalPayloadSize) > remaining {
+				return nil, ErrDecompressionFailed
+			}
+			decompressed, err := decompressPayload(header.CompressionAlgorithm, payload, int(header.OriginalPayloadSize))
+			if err != nil {
+				return nil, ErrDecompressionFailed
+			}
+			msg = append(msg, decompressed...)
+		}
+	}
+
+	if int64(len(msg)) != size {
+		return nil, ErrDecompressionFailed
+	}
+	return msg, nil
+}
+
+// compressMessage compresses a message with the algorithms negotiated on the connection.
+// Messages below the compression threshold and messages that do not shrink are returned unchanged.
+func (c *Connection) compressMessage(msg []byte) ([]byte, error) {
+	if len(c.compressionAlgorithms) == 0 || len(msg) < c.negotiatePolicy.CompressionThreshold {
+		return msg, nil
+	}
+
+	var compressed []byte
+	var err error
+	if c.compressionChained {
+		compressed, err = c.compressChained(msg)
+	} else {
+		compressed, err = compressUnchained(c.compressionAlgorithms[0], msg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if compressed == nil || len(compressed) >= len(msg) {
+		return msg, nil
+	}
+	return compressed, nil
+}
+
+// compressUnchained compresses a whole message with a single algorithm
+func compressUnchained(a CompressionAlgorithm, msg []byte) ([]byte, error) {
+	payload := compressPayload(a, msg)
+	if payload == nil {
+		return nil, nil
+	}
+
+	// Marshal the header
+	header := &CompressionTransformHeader{
+		OriginalCompressedSegmentSize: uint32(len(msg)),
+		CompressionAlgorithm:          a,
+		Flags:                         CompressionFlagNone,
+	}
+	buf, err := header.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, payload...), nil
+}
+
+// compressChained compresses a message into a chain of payloads. Runs of a byte at either end of the
+// message are sent as Pattern_V1 payloads if it was negotiated, the rest is compressed with the preferred
+// LZ algorithm, or sent as is if it does not shrink.
+func (c *Connection) compressChained(msg []byte) ([]byte, error) {
+	// Find the preferred LZ algorithm
+	lz := CompressionAlgorithmNone
+	pattern := false
+	for _, a := range c.compressionAlgorithms {
+		if a == CompressionAlgorithmPatternV1 {
+			pattern = true
+		} else if lz == CompressionAlgorithmNone {
+			lz = a
+		}
+	}
+
+	// Measure the runs at both ends
+	front, back := 0, 0
+	if pattern {
+		for front < len(msg) && msg[front] == msg[0] {
+			front++
+		}
+		if front < patternMinRun {
+			front = 0
+		}
+		for back < len(msg)-front && msg[len(msg)-1-back] == msg[len(msg)-1] {
+			back++
+		}
+		if back < patternMinRun {
+			back = 0
+		}
+	}
+
+	// Write the header, the payload headers follow
+	buf := make([]byte, compressionChainedHeaderSize)
+	copy(buf, ProtocolIDCompressed[:])
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(msg)))
+	appendPayload := func(header *CompressionPayloadHeader, payload []byte) error {
+		if len(buf) == compressionChainedHeaderSize {
+			header.Flags = CompressionFlagChained
+		}
+		header.Length = uint32(len(payload))
+		if header.hasOriginalPayloadSize() {
+			header.Length += 4
+		}
+		data, err := header.Marshal()
+		if err != nil {
+			return err
+		}
+		buf = append(buf, data...)
+		buf = append(buf, payload...)
+		return nil
+	}
+	appendPattern := func(b byte, n int) error {
+		data, err := (&PatternPayloadV1{Pattern: b, Repetitions: uint32(n)}).Marshal()
+		if err != nil {
+			return err
+		}
+		return appendPayload(&CompressionPayloadHeader{CompressionAlgorithm: CompressionAlgorithmPatternV1}, data)
+	}
+
+	// Add the payloads
+	if front > 0 {
+		if err := appendPattern(msg[0], front); err != nil {
+			return nil, err
+		}
+	}
+	if middle := msg[front : len(msg)-back]; len(middle) > 0 {
+		header := &CompressionPayloadHeader{CompressionAlgorithm: CompressionAlgorithmNone}
+		payload := middle
+		if lz != CompressionAlgorithmNone {
+			if compressed := compressPayload(lz, middle); len(compressed)+4 < len(middle) {
+				header = &CompressionPayloadHeader{CompressionAlgorithm: lz, OriginalPayloadSize: uint32(len(middle))}
+				payload = compressed
+			}
+		}
+		if err := appendPayload(header, payload); err != nil {
+			return nil, err
+		}
+	}
+	if back > 0 {
+		if err := appendPattern(msg[len(msg)-1], back); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
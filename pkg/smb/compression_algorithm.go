@@ -0,0 +1,24 @@
+package smb
+
+// CompressionAlgorithm identifies an SMB3 compression algorithm
+type CompressionAlgorithm uint16
+
+const (
+	// CompressionAlgorithmNone indicates no compression
+	CompressionAlgorithmNone CompressionAlgorithm = 0x0000
+
+	// CompressionAlgorithmLZNT1 indicates LZNT1
+	CompressionAlgorithmLZNT1 CompressionAlgorithm = 0x0001
+
+	// CompressionAlgorithmLZ77 indicates Plain LZ77
+	CompressionAlgorithmLZ77 CompressionAlgorithm = 0x0002
+
+	// CompressionAlgorithmLZ77Huffman indicates LZ77+Huffman
+	CompressionAlgorithmLZ77Huffman CompressionAlgorithm = 0x0003
+
+	// CompressionAlgorithmPatternV1 indicates Pattern_V1, which is only used in chained compression
+	CompressionAlgorithmPatternV1 CompressionAlgorithm = 0x0004
+
+	// CompressionAlgorithmLZ4 indicates LZ4
+	CompressionAlgorithmLZ4 CompressionAlgorithm = 0x0005
+)
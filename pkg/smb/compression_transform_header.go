@@ -0,0 +1,253 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// CompressionTransformHeaderSize is the size of an unchained SMB2 COMPRESSION_TRANSFORM_HEADER in bytes
+const CompressionTransformHeaderSize = 16
+
+// compressionChainedHeaderSize is the size of the part of a chained header preceding the first payload header
+const compressionChainedHeaderSize = 8
+
+// compressionPayloadHeaderSize is the size of a chained payload header without the original payload size
+const compressionPayloadHeaderSize = 8
+
+// ProtocolIDCompressed is the protocol identifier of compressed SMB3 messages
+var ProtocolIDCompressed = [4]byte{0xFC, 'S', 'M', 'B'}
+
+const (
+	// CompressionFlagNone marks an unchained compression transform header
+	CompressionFlagNone uint16 = 0x0000
+
+	// CompressionFlagChained marks the first payload header of a chained compression transform header
+	CompressionFlagChained uint16 = 0x0001
+)
+
+// ErrInvalidCompressionHeader is returned for a truncated or malformed compression transform header
+var ErrInvalidCompressionHeader = errors.New("smb: invalid compression transform header")
+
+// CompressionTransformHeader represents an unchained SMB2 COMPRESSION_TRANSFORM_HEADER. Offset bytes of
+// the message follow the header uncompressed, then the compressed segment of OriginalCompressedSegmentSize bytes.
+type CompressionTransformHeader struct {
+	OriginalCompressedSegmentSize uint32
+	CompressionAlgorithm          CompressionAlgorithm
+	Flags                         uint16
+	Offset                        uint32
+}
+
+// Marshal serializes an unchained compression transform header into a byte slice
+func (h *CompressionTransformHeader) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := bytes.NewBuffer(make([]byte, 0, CompressionTransformHeaderSize))
+
+	// Write the protocol ID
+	if err := binary.Write(buf, binary.LittleEndian, ProtocolIDCompressed); err != nil {
+		return nil, err
+	}
+
+	// Write the size of the segment before compression
+	if err := binary.Write(buf, binary.LittleEndian, h.OriginalCompressedSegmentSize); err != nil {
+		return nil, err
+	}
+
+	// Write the compression algorithm
+	if err := binary.Write(buf, binary.LittleEndian, h.CompressionAlgorithm); err != nil {
+		return nil, err
+	}
+
+	// Write the flags
+	if err := binary.Write(buf, binary.LittleEndian, h.Flags); err != nil {
+		return nil, err
+	}
+
+	// Write the offset of the compressed segment
+	if err := binary.Write(buf, binary.LittleEndian, h.Offset); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// CompressionTransformHeaderParse parses an unchained compression transform header from a byte slice
+func CompressionTransformHeaderParse(data []byte) (*CompressionTransformHeader, error) {
+	// Make sure the whole header is present
+	if len(data) < CompressionTransformHeaderSize {
+		return nil, ErrInvalidCompressionHeader
+	}
+
+	// Create a new bytes reader
+	r := bytes.NewReader(data[:CompressionTransformHeaderSize])
+
+	// Read the protocol ID
+	var protocolID [4]byte
+	if err := binary.Read(r, binary.LittleEndian, &protocolID); err != nil {
+		return nil, err
+	}
+	if protocolID != ProtocolIDCompressed {
+		return nil, ErrInvalidProtocolID
+	}
+
+	header := &CompressionTransformHeader{}
+
+	// Read the size of the segment before compression
+	if err := binary.Read(r, binary.LittleEndian, &header.OriginalCompressedSegmentSize); err != nil {
+		return nil, err
+	}
+
+	// Read the compression algorithm
+	if err := binary.Read(r, binary.LittleEndian, &header.CompressionAlgorithm); err != nil {
+		return nil, err
+	}
+
+	// Read the flags
+	if err := binary.Read(r, binary.LittleEndian, &header.Flags); err != nil {
+		return nil, err
+	}
+
+	// Read the offset of the compressed segment
+	if err := binary.Read(r, binary.LittleEndian, &header.Offset); err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// CompressionPayloadHeader represents an SMB2_COMPRESSION_CHAINED_PAYLOAD_HEADER. The payloads of a chained
+// message follow each other, each decompressing to the next part of the message. OriginalPayloadSize is only
+// present for the LZ algorithms, it is counted in Length.
+type CompressionPayloadHeader struct {
+	CompressionAlgorithm CompressionAlgorithm
+	Flags                uint16
+	Length               uint32
+	OriginalPayloadSize  uint32
+}
+
+// hasOriginalPayloadSize reports whether the payload header holds the size of the payload before compression
+func (h *CompressionPayloadHeader) hasOriginalPayloadSize() bool {
+	switch h.CompressionAlgorithm {
+	case CompressionAlgorithmLZNT1, CompressionAlgorithmLZ77, CompressionAlgorithmLZ77Huffman, CompressionAlgorithmLZ4:
+		return true
+	default:
+		return false
+	}
+}
+
+// Marshal serializes a chained payload header into a byte slice
+func (h *CompressionPayloadHeader) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
+
+	// Write the compression algorithm
+	if err := binary.Write(buf, binary.LittleEndian, h.CompressionAlgorithm); err != nil {
+		return nil, err
+	}
+
+	// Write the flags
+	if err := binary.Write(buf, binary.LittleEndian, h.Flags); err != nil {
+		return nil, err
+	}
+
+	// Write the length of the payload
+	if err := binary.Write(buf, binary.LittleEndian, h.Length); err != nil {
+		return nil, err
+	}
+
+	// Write the size of the payload before compression
+	if h.hasOriginalPayloadSize() {
+		if err := binary.Write(buf, binary.LittleEndian, h.OriginalPayloadSize); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// CompressionPayloadHeaderParse parses a chained payload header from a byte slice and returns
+// the payload following it
+func CompressionPayloadHeaderParse(data []byte) (*CompressionPayloadHeader, []byte, error) {
+	// Create a new bytes reader
+	r := bytes.NewReader(data)
+
+	header := &CompressionPayloadHeader{}
+
+	// Read the compression algorithm
+	if err := binary.Read(r, binary.LittleEndian, &header.CompressionAlgorithm); err != nil {
+		return nil, nil, ErrInvalidCompressionHeader
+	}
+
+	// Read the flags
+	if err := binary.Read(r, binary.LittleEndian, &header.Flags); err != nil {
+		return nil, nil, ErrInvalidCompressionHeader
+	}
+
+	// Read the length of the payload
+	if err := binary.Read(r, binary.LittleEndian, &header.Length); err != nil {
+		return nil, nil, ErrInvalidCompressionHeader
+	}
+	if int64(header.Length) > int64(r.Len()) {
+		return nil, nil, ErrInvalidCompressionHeader
+	}
+	payload := data[len(data)-r.Len():][:header.Length]
+
+	// Read the size of the payload before compression, it starts the payload
+	if header.hasOriginalPayloadSize() {
+		if len(payload) < 4 {
+			return nil, nil, ErrInvalidCompressionHeader
+		}
+		header.OriginalPayloadSize = binary.LittleEndian.Uint32(payload)
+		payload = payload[4:]
+	}
+
+	return header, payload, nil
+}
+
+// PatternPayloadV1 represents an SMB2_COMPRESSION_PATTERN_PAYLOAD_V1, a byte repeated Repetitions times
+type PatternPayloadV1 struct {
+	Pattern     byte
+	Repetitions uint32
+}
+
+// patternPayloadV1Size is the size of a Pattern_V1 payload in bytes
+const patternPayloadV1Size = 8
+
+// Marshal serializes a Pattern_V1 payload into a byte slice
+func (p *PatternPayloadV1) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := bytes.NewBuffer(make([]byte, 0, patternPayloadV1Size))
+
+	// Write the pattern
+	if err := binary.Write(buf, binary.LittleEndian, p.Pattern); err != nil {
+		return nil, err
+	}
+
+	// Write the reserved fields
+	if err := binary.Write(buf, binary.LittleEndian, [3]byte{}); err != nil {
+		return nil, err
+	}
+
+	// Write the number of repetitions
+	if err := binary.Write(buf, binary.LittleEndian, p.Repetitions); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// PatternPayloadV1Parse parses a Pattern_V1 payload from a byte slice
+func PatternPayloadV1Parse(data []byte) (*PatternPayloadV1, error) {
+	if len(data) != patternPayloadV1Size {
+		return nil, ErrInvalidCompressionHeader
+	}
+	return &PatternPayloadV1{
+		Pattern:     data[0],
+		Repetitions: binary.LittleEndian.Uint32(data[4:]),
+	}, nil
+}
+
+// isCompressed reports whether a message starts with a compression transform header
+func isCompressed(data []byte) bool {
+	return len(data) >= len(ProtocolIDCompressed) && bytes.Equal(data[:len(ProtocolIDCompressed)], ProtocolIDCompressed[:])
+}
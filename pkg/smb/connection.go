@@ -0,0 +1,177 @@
+package smb
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Connection holds the state of a single client connection.
+// It embeds the underlying network connection, so it can be used wherever a net.Conn is expected.
+type Connection struct {
+	net.Conn
+
+	// server is the server that accepted the connection
+	server *Server
+
+	// negotiatePolicy and creditPolicy configure the negotiation and the granting of credits
+	negotiatePolicy *NegotiatePolicy
+	creditPolicy    *CreditPolicy
+
+	// credits holds the message IDs the client may use
+	credits *creditWindow
+
+	// inFlight counts the requests currently being processed, it is accessed atomically
+	inFlight int32
+
+	// dialect is the negotiated dialect, DialectUnknown before negotiation
+	dialect Dialect
+
+	// clientGUID, clientCapabilities and clientSecurityMode are taken from the negotiate request
+	clientGUID         [16]byte
+	clientCapabilities Capability
+	clientSecurityMode SecurityMode
+
+	// cipherID is the cipher selected for encryption, CipherNone if the connection cannot encrypt
+	cipherID Cipher
+
+	// signingAlgorithmID is the algorithm used to sign messages
+	signingAlgorithmID SigningAlgorithm
+
+	// compressionAlgorithms are the compression algorithms selected for SMB 3.1.1,
+	// compressionChained reports whether chained compression was negotiated
+	compressionAlgorithms []CompressionAlgorithm
+	compressionChained    bool
+
+	// preauth is the connection preauth integrity hash over the negotiate exchange,
+	// it is only tracked for the SMB 3.1.1 dialect
+	preauth *PreauthIntegrity
+
+	// preauthSessions holds the preauth integrity hashes of sessions in session setup, keyed by session ID
+	preauthMu       sync.Mutex
+	preauthSessions map[uint64]*PreauthIntegrity
+
+	// asyncOps holds the operations that went async, keyed by async ID
+	asyncMu     sync.Mutex
+	asyncOps    map[uint64]*asyncOperation
+	nextAsyncID uint64
+
+	// limits bounds the resources used by the connection
+	limits *ConnectionLimits
+
+	// writes queues the messages for the writer goroutine, a nil message stops it
+	writes     chan []byte
+	writerDone chan struct{}
+
+	// draining is set once the connection stops reading requests, it is accessed atomically
+	draining int32
+
+	// done is closed when the connection is closed
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// err is the error that ended the connection
+	err     error
+	errOnce sync.Once
+}
+
+// newConnection creates the state for a connection accepted by the server
+func newConnection(s *Server, conn net.Conn) *Connection {
+	return &Connection{
+		Conn:            conn,
+		server:          s,
+		limits:          &s.limits,
+		writes:          make(chan []byte, s.limits.Workers),
+		writerDone:      make(chan struct{}),
+		negotiatePolicy: &s.negotiatePolicy,
+		creditPolicy:    &s.creditPolicy,
+		credits:         newCreditWindow(),
+		preauthSessions: make(map[uint64]*PreauthIntegrity),
+		asyncOps:        make(map[uint64]*asyncOperation),
+		done:            make(chan struct{}),
+	}
+}
+
+// Close cancels the async operations of the connection, tears down its sessions
+// and closes the underlying network connection
+func (c *Connection) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.cancelAllAsync()
+		c.closeSessions()
+	})
+	return c.Conn.Close()
+}
+
+// drain makes the connection stop reading requests, Serve returns once the requests
+// in progress have been answered
+func (c *Connection) drain() {
+	atomic.StoreInt32(&c.draining, 1)
+
+	// Interrupt a pending read
+	c.Conn.SetReadDeadline(time.Now())
+}
+
+// writeMessage queues a message for the writer goroutine, messages are sent in the order they were queued
+func (c *Connection) writeMessage(msg []byte) error {
+	select {
+	case c.writes <- msg:
+		return nil
+	case <-c.done:
+		return net.ErrClosed
+	}
+}
+
+// supportsMultiCredit reports whether requests may be charged more than one credit
+func (c *Connection) supportsMultiCredit() bool {
+	return c.dialect != DialectUnknown && c.dialect != DialectSMB202
+}
+
+// grantCredits returns the number of credits to grant in the response to a request
+// and adds them to the credit window
+func (c *Connection) grantCredits(request *Header) uint16 {
+	policy := c.creditPolicy
+
+	// Grant what the client asks for, but at least the configured minimum
+	n := request.CreditRequestResponse
+	if n < policy.MinCredits {
+		n = policy.MinCredits
+	}
+
+	// Slow down the growth of the window while the connection is loaded
+	if policy.LoadThreshold > 0 && int(atomic.LoadInt32(&c.inFlight)) > policy.LoadThreshold && n > policy.LoadGrant {
+		n = policy.LoadGrant
+	}
+
+	return c.credits.grant(n, policy.MaxCredits)
+}
+
+// sessionPreauth returns the preauth integrity hash of a session in session setup.
+// The first call for a session forks the connection value, it returns nil unless SMB 3.1.1 was negotiated.
+func (c *Connection) sessionPreauth(sessionID uint64) *PreauthIntegrity {
+	if c.preauth == nil {
+		return nil
+	}
+
+	c.preauthMu.Lock()
+	defer c.preauthMu.Unlock()
+
+	p, ok := c.preauthSessions[sessionID]
+	if !ok {
+		p = c.preauth.Fork()
+		c.preauthSessions[sessionID] = p
+	}
+	return p
+}
+
+// endSessionPreauth stops tracking the preauth integrity hash of a session once
+// session setup has completed or failed, and returns its final value
+func (c *Connection) endSessionPreauth(sessionID uint64) *PreauthIntegrity {
+	c.preauthMu.Lock()
+	defer c.preauthMu.Unlock()
+
+	p := c.preauthSessions[sessionID]
+	delete(c.preauthSessions, sessionID)
+	return p
+}
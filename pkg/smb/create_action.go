@@ -0,0 +1,34 @@
+package smb
+
+import "github.com/yuriyvolkov/simba/pkg/vfs"
+
+// CreateAction represents what an SMB2 create request did to the file, reported in the response
+type CreateAction uint32
+
+const (
+	// CreateActionSuperseded indicates that an existing file was replaced
+	CreateActionSuperseded CreateAction = 0x00000000
+
+	// CreateActionOpened indicates that an existing file was opened
+	CreateActionOpened CreateAction = 0x00000001
+
+	// CreateActionCreated indicates that a new file was created
+	CreateActionCreated CreateAction = 0x00000002
+
+	// CreateActionOverwritten indicates that an existing file was truncated
+	CreateActionOverwritten CreateAction = 0x00000003
+)
+
+// createActionOf returns the create action reporting what the storage did
+func createActionOf(action vfs.Action) CreateAction {
+	switch action {
+	case vfs.ActionSuperseded:
+		return CreateActionSuperseded
+	case vfs.ActionCreated:
+		return CreateActionCreated
+	case vfs.ActionOverwritten:
+		return CreateActionOverwritten
+	default:
+		return CreateActionOpened
+	}
+}
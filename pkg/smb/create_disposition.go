@@ -0,0 +1,41 @@
+package smb
+
+import "github.com/yuriyvolkov/simba/pkg/vfs"
+
+// CreateDisposition represents what an SMB2 create request does when the file exists and when it does not
+type CreateDisposition uint32
+
+const (
+	// CreateDispositionSupersede replaces an existing file and creates a missing one
+	CreateDispositionSupersede CreateDisposition = 0x00000000
+
+	// CreateDispositionOpen opens an existing file and fails if it is missing
+	CreateDispositionOpen CreateDisposition = 0x00000001
+
+	// CreateDispositionCreate creates a missing file and fails if it exists
+	CreateDispositionCreate CreateDisposition = 0x00000002
+
+	// CreateDispositionOpenIf opens an existing file and creates a missing one
+	CreateDispositionOpenIf CreateDisposition = 0x00000003
+
+	// CreateDispositionOverwrite truncates an existing file and fails if it is missing
+	CreateDispositionOverwrite CreateDisposition = 0x00000004
+
+	// CreateDispositionOverwriteIf truncates an existing file and creates a missing one
+	CreateDispositionOverwriteIf CreateDisposition = 0x00000005
+)
+
+// valid reports whether the disposition is one of the six defined values
+func (d CreateDisposition) valid() bool {
+	return d <= CreateDispositionOverwriteIf
+}
+
+// modifies reports whether the disposition may create or truncate a file
+func (d CreateDisposition) modifies() bool {
+	return d != CreateDispositionOpen && d != CreateDispositionOpenIf
+}
+
+// vfs returns the storage disposition, the values are in the same order
+func (d CreateDisposition) vfs() vfs.Disposition {
+	return vfs.Disposition(d)
+}
@@ -0,0 +1,69 @@
+package smb
+
+// CreateOptions represents the options of an SMB2 create request
+type CreateOptions uint32
+
+const (
+	// CreateOptionDirectoryFile requires the file to be a directory, and creates a directory
+	CreateOptionDirectoryFile CreateOptions = 0x00000001
+
+	// CreateOptionWriteThrough commits writes to stable storage before they complete
+	CreateOptionWriteThrough CreateOptions = 0x00000002
+
+	// CreateOptionSequentialOnly indicates that the file is only accessed sequentially
+	CreateOptionSequentialOnly CreateOptions = 0x00000004
+
+	// CreateOptionNoIntermediateBuffering forbids caching the data of the file
+	CreateOptionNoIntermediateBuffering CreateOptions = 0x00000008
+
+	// CreateOptionSynchronousIOAlert is ignored by SMB2 servers
+	CreateOptionSynchronousIOAlert CreateOptions = 0x00000010
+
+	// CreateOptionSynchronousIONonalert is ignored by SMB2 servers
+	CreateOptionSynchronousIONonalert CreateOptions = 0x00000020
+
+	// CreateOptionNonDirectoryFile refuses to open a directory
+	CreateOptionNonDirectoryFile CreateOptions = 0x00000040
+
+	// CreateOptionCompleteIfOplocked is ignored by SMB2 servers
+	CreateOptionCompleteIfOplocked CreateOptions = 0x00000100
+
+	// CreateOptionNoEAKnowledge refuses files with extended attributes the client does not understand
+	CreateOptionNoEAKnowledge CreateOptions = 0x00000200
+
+	// CreateOptionOpenRemoteInstance is ignored by SMB2 servers
+	CreateOptionOpenRemoteInstance CreateOptions = 0x00000400
+
+	// CreateOptionRandomAccess indicates that the file is accessed randomly
+	CreateOptionRandomAccess CreateOptions = 0x00000800
+
+	// CreateOptionDeleteOnClose deletes the file once the open is closed
+	CreateOptionDeleteOnClose CreateOptions = 0x00001000
+
+	// CreateOptionOpenByFileID opens a file by its file ID instead of its name
+	CreateOptionOpenByFileID CreateOptions = 0x00002000
+
+	// CreateOptionOpenForBackupIntent opens the file for a backup application
+	CreateOptionOpenForBackupIntent CreateOptions = 0x00004000
+
+	// CreateOptionNoCompression creates the file uncompressed
+	CreateOptionNoCompression CreateOptions = 0x00008000
+
+	// CreateOptionOpenRequiringOplock is ignored by SMB2 servers
+	CreateOptionOpenRequiringOplock CreateOptions = 0x00010000
+
+	// CreateOptionDisallowExclusive is ignored by SMB2 servers
+	CreateOptionDisallowExclusive CreateOptions = 0x00020000
+
+	// CreateOptionReserveOpfilter asks for a filter oplock, which SMB2 does not support
+	CreateOptionReserveOpfilter CreateOptions = 0x00100000
+
+	// CreateOptionOpenReparsePoint opens a reparse point instead of its target
+	CreateOptionOpenReparsePoint CreateOptions = 0x00200000
+
+	// CreateOptionOpenNoRecall keeps the data of the file in remote storage
+	CreateOptionOpenNoRecall CreateOptions = 0x00400000
+
+	// CreateOptionOpenForFreeSpaceQuery opens the file to query the free space of its volume
+	CreateOptionOpenForFreeSpaceQuery CreateOptions = 0x00800000
+)
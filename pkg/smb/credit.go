@@ -0,0 +1,166 @@
+package smb
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+// creditSize is the number of payload bytes covered by a single credit
+const creditSize = 64 * 1024
+
+// ErrInvalidMessageID is returned when a request uses a message ID outside the
+// credit window of the connection, or one that was already used
+var ErrInvalidMessageID = errors.New("smb: message id outside of the credit window")
+
+// CreditPolicy controls how many credits the server grants to clients
+type CreditPolicy struct {
+	// MinCredits is the smallest number of credits granted in a response, even if the client asks for fewer
+	MinCredits uint16
+
+	// MaxCredits is the largest number of credits a client may hold at any time
+	MaxCredits uint16
+
+	// LoadThreshold is the number of requests in progress on a connection above
+	// which the connection is considered loaded, zero disables throttling
+	LoadThreshold int
+
+	// LoadGrant is the largest number of credits granted in a response while the connection is loaded
+	LoadGrant uint16
+}
+
+// DefaultCreditPolicy is the credit policy used by new connections
+var DefaultCreditPolicy = CreditPolicy{
+	MinCredits:    1,
+	MaxCredits:    512,
+	LoadThreshold: 64,
+	LoadGrant:     1,
+}
+
+// creditWindow tracks the message IDs a client may use, the CommandSequenceWindow of MS-SMB2.
+// Every ID below low has been used, every ID from high on has not been granted yet.
+// IDs in between that were used out of order are kept in used.
+type creditWindow struct {
+	mu   sync.Mutex
+	low  uint64
+	high uint64
+	used map[uint64]struct{}
+}
+
+// newCreditWindow creates a window holding message ID zero, the one credit every client starts with
+func newCreditWindow() *creditWindow {
+	return &creditWindow{
+		high: 1,
+		used: make(map[uint64]struct{}),
+	}
+}
+
+// consume removes charge consecutive message IDs starting with messageID from the window
+func (w *creditWindow) consume(messageID uint64, charge uint16) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Check that every ID is in the window and unused before touching any of them
+	end := messageID + uint64(charge)
+	if messageID < w.low || end > w.high || end < messageID {
+		return ErrInvalidMessageID
+	}
+	for id := messageID; id < end; id++ {
+		if _, ok := w.used[id]; ok {
+			return ErrInvalidMessageID
+		}
+	}
+
+	// Mark the IDs as used and move the low end over the used IDs
+	for id := messageID; id < end; id++ {
+		w.used[id] = struct{}{}
+	}
+	for {
+		if _, ok := w.used[w.low]; !ok {
+			break
+		}
+		delete(w.used, w.low)
+		w.low++
+	}
+
+	return nil
+}
+
+// grant extends the window by up to n message IDs without letting it grow beyond max,
+// and returns the number of credits actually granted
+func (w *creditWindow) grant(n uint16, max uint16) uint16 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Limit the window span, so a client leaving holes cannot grow it without bounds
+	span := w.high - w.low
+	if span >= uint64(max) {
+		n = 0
+	} else if uint64(n) > uint64(max)-span {
+		n = uint16(uint64(max) - span)
+	}
+
+	// Never leave the client without a credit, it could not send another request
+	if n == 0 && w.available() == 0 {
+		n = 1
+	}
+
+	w.high += uint64(n)
+	return n
+}
+
+// available returns the number of credits the client holds, the caller must hold the lock
+func (w *creditWindow) available() uint64 {
+	return w.high - w.low - uint64(len(w.used))
+}
+
+// creditCharge returns the number of credits a request consumes.
+// A charge of zero counts as one, SMB 2.0.2 always charges one credit.
+func creditCharge(dialect Dialect, header *Header) uint16 {
+	if dialect == DialectSMB202 || header.CreditCharge == 0 {
+		return 1
+	}
+	return header.CreditCharge
+}
+
+// requestPayloadSize returns the larger of the payload sent with a request and the payload
+// expected in its response, for the commands where the credit charge depends on it
+func requestPayloadSize(command Command, body []byte) (uint32, bool) {
+	// u32 reads a little-endian field at a fixed offset of the request body
+	u32 := func(off int) uint32 {
+		if len(body) < off+4 {
+			return 0
+		}
+		return binary.LittleEndian.Uint32(body[off:])
+	}
+
+	switch command {
+	case CommandRead, CommandWrite:
+		// The Length field of READ and WRITE
+		return u32(4), true
+	case CommandIoctl:
+		// InputCount + OutputCount against MaxInputResponse + MaxOutputResponse
+		send, expected := u32(28)+u32(40), u32(32)+u32(44)
+		if send > expected {
+			return send, true
+		}
+		return expected, true
+	case CommandQueryDirectory:
+		// The OutputBufferLength field of QUERY_DIRECTORY
+		return u32(28), true
+	case CommandChangeNotify:
+		// The OutputBufferLength field of CHANGE_NOTIFY
+		return u32(4), true
+	default:
+		return 0, false
+	}
+}
+
+// validCreditCharge reports whether the credit charge of a request covers its payload
+func validCreditCharge(charge uint16, command Command, body []byte) bool {
+	size, ok := requestPayloadSize(command, body)
+	if !ok || size == 0 {
+		return true
+	}
+	return uint32(charge) >= (size-1)/creditSize+1
+}
@@ -26,6 +26,10 @@ const (
 
 	// DialectSMB311 indicates the SMB 3.1.1 dialect
 	DialectSMB311 Dialect = 0x0311
+
+	// DialectSMB2Wildcard is returned to SMB1 negotiate requests to make the
+	// client send an SMB2 negotiate request listing the dialects it supports
+	DialectSMB2Wildcard Dialect = 0x02FF
 )
 
 // Dialects represents a list of SMB dialects
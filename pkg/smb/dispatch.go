@@ -0,0 +1,175 @@
+package smb
+
+import (
+	"sync/atomic"
+)
+
+// handleMessage handles a complete SMB message, which may hold several compounded
+// requests, and sends the responses back compounded in the same order. An error
+// means that the client violated the protocol or the response could not be sent,
+// and the connection must be closed.
+func (c *Connection) handleMessage(data []byte) error {
+	// Decrypt an encrypted message with the keys of its session
+	var encrypted *session
+	if isTransform(data) {
+		msg, s, err := c.decryptMessage(data)
+		if err != nil {
+			return err
+		}
+		data, encrypted = msg, s
+	}
+
+	// Decompress a compressed message, encryption wraps compression
+	if isCompressed(data) {
+		msg, err := c.decompressMessage(data)
+		if err != nil {
+			return err
+		}
+		data = msg
+	}
+
+	// Split the message into its requests
+	packets, err := compoundParse(data)
+	if err != nil {
+		return err
+	}
+
+	// The requests of an encrypted message must belong to the session that encrypted it
+	if encrypted != nil {
+		for _, packet := range packets {
+			if !packet.isRelated() && packet.Header.SessionID != encrypted.id {
+				return ErrInvalidTransformHeader
+			}
+			packet.encrypted = encrypted
+		}
+	}
+
+	// Handle the requests in order, related requests depend on the previous ones
+	for i, packet := range packets {
+		if err := c.handlePacket(packet, i == 0); err != nil {
+			return err
+		}
+	}
+
+	// Send the responses, some requests like CANCEL have none
+	msg := compoundResponses(packets)
+	if len(msg) == 0 {
+		return nil
+	}
+	for _, packet := range packets {
+		if packet.compress {
+			if msg, err = c.compressMessage(msg); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if encrypted != nil {
+		if msg, err = c.encryptMessage(encrypted, msg); err != nil {
+			return err
+		}
+	}
+	if err := c.writeMessage(msg); err != nil {
+		return err
+	}
+
+	// Let the async operations of the message send their final responses
+	for _, packet := range packets {
+		if packet.async != nil {
+			close(packet.async.interimSent)
+		}
+	}
+	return nil
+}
+
+// handlePacket checks a request against the credit window of the connection and
+// dispatches it to the handler of its command
+func (c *Connection) handlePacket(packet *Packet, first bool) error {
+	atomic.AddInt32(&c.inFlight, 1)
+	defer atomic.AddInt32(&c.inFlight, -1)
+
+	// Consume the message IDs covered by the credit charge, CANCEL does not use a credit
+	charge := creditCharge(c.dialect, &packet.Header)
+	if packet.Header.Command != CommandCancel {
+		if err := c.credits.consume(packet.Header.MessageID, charge); err != nil {
+			return err
+		}
+	}
+
+	// Large reads and writes must be paid for with enough credits
+	if c.supportsMultiCredit() && len(packet.raw) > HeaderSize &&
+		!validCreditCharge(charge, packet.Header.Command, packet.raw[HeaderSize:]) {
+		return sendErrorResponse(c, packet, StatusInvalidParameter)
+	}
+
+	// Related requests inherit the session and tree of the previous request and fail with it
+	if packet.isRelated() && packet.compound != nil {
+		if first {
+			return sendErrorResponse(c, packet, StatusInvalidParameter)
+		}
+		if packet.compound.status != StatusSuccess {
+			return sendErrorResponse(c, packet, packet.compound.status)
+		}
+		packet.Header.SessionID = packet.compound.sessionID
+		packet.Header.TreeID = packet.compound.treeID
+	}
+	if packet.compound != nil {
+		packet.compound.sessionID = packet.Header.SessionID
+		packet.compound.treeID = packet.Header.TreeID
+	}
+
+	// Requests must belong to an established session, expired sessions must be reauthenticated
+	if status := c.checkSession(packet); status != StatusSuccess {
+		return sendErrorResponse(c, packet, status)
+	}
+
+	// Sessions that must encrypt refuse plain requests
+	if status := c.checkEncryption(packet); status != StatusSuccess {
+		if packet.Header.Command == CommandCancel {
+			c.server.logger.Printf("%s: dropping CANCEL message %d: status %#08x", c.RemoteAddr(), packet.Header.MessageID, uint32(status))
+			return nil
+		}
+		return sendErrorResponse(c, packet, status)
+	}
+
+	// Requests on signed sessions must carry a valid signature, a CANCEL failing the check is dropped
+	if status := c.checkSignature(packet); status != StatusSuccess {
+		if packet.Header.Command == CommandCancel {
+			c.server.logger.Printf("%s: dropping CANCEL message %d: status %#08x", c.RemoteAddr(), packet.Header.MessageID, uint32(status))
+			return nil
+		}
+		return sendErrorResponse(c, packet, status)
+	}
+
+	// Requests on a share must use a tree connect of their session
+	if status := c.checkTree(packet); status != StatusSuccess {
+		return sendErrorResponse(c, packet, status)
+	}
+
+	// Handle the packet according to its command
+	switch packet.Header.Command {
+	case CommandNegotiate:
+		return handleNegotiateCommand(c, packet)
+	case CommandSessionSetup:
+		return handleSessionSetupCommand(c, packet)
+	case CommandLogoff:
+		return handleLogoffCommand(c, packet)
+	case CommandTreeConnect:
+		return handleTreeConnectCommand(c, packet)
+	case CommandTreeDisconnect:
+		return handleTreeDisconnectCommand(c, packet)
+	case CommandCreate:
+		return handleCreateCommand(c, packet)
+	case CommandClose:
+		return handleCloseCommand(c, packet)
+	case CommandRead:
+		return handleReadCommand(c, packet)
+	case CommandWrite:
+		return handleWriteCommand(c, packet)
+	case CommandCancel:
+		return handleCancelCommand(c, packet)
+	default:
+		// Send error response for unknown command
+		return sendErrorResponse(c, packet, StatusNotImplemented)
+	}
+}
@@ -0,0 +1,202 @@
+package smb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+)
+
+// Labels and contexts of the encryption key derivation (MS-SMB2, section 3.1.4.2), the null terminators are part of them
+const (
+	encryptionLabelSMB30       = "SMB2AESCCM\x00"
+	encryptionContextServerIn  = "ServerIn \x00"
+	encryptionContextServerOut = "ServerOut\x00"
+	encryptionLabelSMB311In    = "SMBC2SCipherKey\x00"
+	encryptionLabelSMB311Out   = "SMBS2CCipherKey\x00"
+)
+
+var (
+	// ErrDecryptionFailed is returned when an encrypted message cannot be authenticated or has no session to decrypt it
+	ErrDecryptionFailed = errors.New("smb: message decryption failed")
+
+	// ErrUnsupportedCipher is returned when keys are derived for an unknown cipher
+	ErrUnsupportedCipher = errors.New("smb: unsupported cipher")
+
+	// ErrNoncesExhausted is returned when a session has used up its nonces, a new session must be set up
+	ErrNoncesExhausted = errors.New("smb: encryption nonces exhausted")
+)
+
+// sessionCipher encrypts the responses and decrypts the requests of a session
+type sessionCipher struct {
+	encrypt cipher.AEAD
+	decrypt cipher.AEAD
+
+	// nonce is the last nonce used to encrypt a message, every message takes the next one
+	// so that no nonce is ever used twice with the same key
+	nonceMu sync.Mutex
+	nonce   uint64
+}
+
+// newSessionCipher derives the encryption and decryption keys of a session and creates its cipher.
+// The AES-256 ciphers derive 256-bit keys from the full session key, the others 128-bit keys.
+func newSessionCipher(id Cipher, dialect Dialect, sessionKey []byte, preauthValue []byte) (*sessionCipher, error) {
+	bits := 128
+	if id == CipherAES256CCM || id == CipherAES256GCM {
+		bits = 256
+	}
+
+	// Derive the keys, SMB 3.1.1 binds them to the preauth integrity hash of the session
+	var in, out []byte
+	if dialect >= DialectSMB311 {
+		in = kdf(sessionKey, encryptionLabelSMB311In, preauthValue, bits)
+		out = kdf(sessionKey, encryptionLabelSMB311Out, preauthValue, bits)
+	} else {
+		in = kdf(sessionKey, encryptionLabelSMB30, []byte(encryptionContextServerIn), bits)
+		out = kdf(sessionKey, encryptionLabelSMB30, []byte(encryptionContextServerOut), bits)
+	}
+
+	// Create the ciphers
+	decrypt, err := newAEAD(id, in)
+	if err != nil {
+		return nil, err
+	}
+	encrypt, err := newAEAD(id, out)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionCipher{encrypt: encrypt, decrypt: decrypt}, nil
+}
+
+// newAEAD creates the AES mode of a cipher, CCM uses 11-byte nonces and GCM 12-byte nonces
+func newAEAD(id Cipher, key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	switch id {
+	case CipherAES128CCM, CipherAES256CCM:
+		return newCCM(block, 11, aes.BlockSize), nil
+	case CipherAES128GCM, CipherAES256GCM:
+		return cipher.NewGCM(block)
+	default:
+		return nil, ErrUnsupportedCipher
+	}
+}
+
+// nextNonce returns a nonce that was never used by the session
+func (sc *sessionCipher) nextNonce() (uint64, error) {
+	sc.nonceMu.Lock()
+	defer sc.nonceMu.Unlock()
+
+	if sc.nonce == math.MaxUint64 {
+		return 0, ErrNoncesExhausted
+	}
+	sc.nonce++
+	return sc.nonce, nil
+}
+
+// seal encrypts a message and prefixes it with its transform header
+func (sc *sessionCipher) seal(sessionID uint64, msg []byte) ([]byte, error) {
+	// Take a fresh nonce
+	n, err := sc.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	header := &TransformHeader{
+		OriginalMessageSize: uint32(len(msg)),
+		Flags:               TransformFlagEncrypted,
+		SessionID:           sessionID,
+	}
+	binary.LittleEndian.PutUint64(header.Nonce[:], n)
+
+	// Marshal the header, the part following the signature is authenticated with the message
+	buf, err := header.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	// Encrypt the message, the tag goes into the signature of the header
+	sealed := sc.encrypt.Seal(nil, header.Nonce[:sc.encrypt.NonceSize()], msg, buf[transformHeaderAADOffset:])
+	copy(buf[4:4+signatureSize], sealed[len(msg):])
+	return append(buf, sealed[:len(msg)]...), nil
+}
+
+// open authenticates and decrypts a message with its transform header
+func (sc *sessionCipher) open(header *TransformHeader, data []byte) ([]byte, error) {
+	ciphertext := data[TransformHeaderSize:]
+	if int(header.OriginalMessageSize) != len(ciphertext) {
+		return nil, ErrDecryptionFailed
+	}
+
+	// The tag follows the ciphertext
+	sealed := make([]byte, 0, len(ciphertext)+signatureSize)
+	sealed = append(sealed, ciphertext...)
+	sealed = append(sealed, header.Signature[:]...)
+	msg, err := sc.decrypt.Open(nil, header.Nonce[:sc.decrypt.NonceSize()], sealed, data[transformHeaderAADOffset:TransformHeaderSize])
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return msg, nil
+}
+
+// decryptMessage decrypts a message received with a transform header and returns the session it belongs to
+func (c *Connection) decryptMessage(data []byte) ([]byte, *session, error) {
+	// Parse the transform header, encryption is only available from SMB 3.0 on
+	header, err := TransformHeaderParse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.dialect < DialectSMB300 || header.Flags != TransformFlagEncrypted {
+		return nil, nil, ErrInvalidTransformHeader
+	}
+
+	// Find the session, it must have set up its keys
+	s := c.lookupSession(header.SessionID)
+	if s == nil {
+		return nil, nil, ErrDecryptionFailed
+	}
+	sc, _ := s.encryption()
+	if sc == nil {
+		return nil, nil, ErrDecryptionFailed
+	}
+
+	// Decrypt the message
+	msg, err := sc.open(header, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return msg, s, nil
+}
+
+// encryptMessage encrypts a message with the keys of a session that decrypted a request
+func (c *Connection) encryptMessage(s *session, msg []byte) ([]byte, error) {
+	sc, _ := s.encryption()
+	return sc.seal(s.id, msg)
+}
+
+// checkEncryption refuses unencrypted requests on a session that must encrypt its messages
+// and on the tree connects of shares that require encryption.
+// Negotiate and session setup are exchanged before the keys exist.
+func (c *Connection) checkEncryption(packet *Packet) Status {
+	if packet.encrypted != nil || packet.Header.SessionID == 0 {
+		return StatusSuccess
+	}
+	switch packet.Header.Command {
+	case CommandNegotiate, CommandSessionSetup:
+		return StatusSuccess
+	}
+	s := c.lookupSession(packet.Header.SessionID)
+	if s == nil {
+		return StatusSuccess
+	}
+	if _, required := s.encryption(); required {
+		return StatusAccessDenied
+	}
+	if tree := s.lookupTree(packet.Header.TreeID); tree != nil && tree.share.EncryptData {
+		return StatusAccessDenied
+	}
+	return StatusSuccess
+}
@@ -1,30 +1,51 @@
 package smb
 
-// ErrorClass represents an SMB error class
-type ErrorClass uint8
+import (
+	"bytes"
+	"encoding/binary"
+)
 
-const (
-	// ErrorClassSuccess indicates a successful operation
-	ErrorClassSuccess ErrorClass = 0
+// errorResponseStructureSize is the structure size of an SMB2 error response
+const errorResponseStructureSize = 9
 
-	// ErrorClassDOS indicates a DOS error
-	ErrorClassDOS ErrorClass = 0x01
+// ErrorResponse represents an SMB2 error response.
+// The status itself is carried in the header of the packet.
+type ErrorResponse struct {
+	ErrorContextCount uint8
+	ErrorData         []byte
+}
 
-	// ErrorClassServer indicates a server error
-	ErrorClassServer ErrorClass = 0x02
+// Marshal serializes an SMB2 error response into a byte slice
+func (r *ErrorResponse) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
 
-	// ErrorClassHardware indicates a hardware error
-	ErrorClassHardware ErrorClass = 0x03
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(errorResponseStructureSize)); err != nil {
+		return nil, err
+	}
 
-	// ErrorClassProto indicates a protocol error
-	ErrorClassProto ErrorClass = 0x04
-)
+	// Write the error context count
+	if err := binary.Write(buf, binary.LittleEndian, r.ErrorContextCount); err != nil {
+		return nil, err
+	}
 
-// ErrorResponse represents an SMB error response
-type ErrorResponse struct {
-	ErrorClass    ErrorClass
-	Reserved      uint8
-	ErrorCode     uint32
-	ErrorReserved uint32
-	ErrorString   string
+	// Write the reserved field
+	if err := binary.Write(buf, binary.LittleEndian, uint8(0)); err != nil {
+		return nil, err
+	}
+
+	// Write the byte count
+	if err := binary.Write(buf, binary.LittleEndian, uint32(len(r.ErrorData))); err != nil {
+		return nil, err
+	}
+
+	// Write the error data, which must be at least one byte long
+	if len(r.ErrorData) == 0 {
+		buf.WriteByte(0)
+	} else {
+		buf.Write(r.ErrorData)
+	}
+
+	return buf.Bytes(), nil
 }
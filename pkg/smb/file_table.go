@@ -0,0 +1,294 @@
+package smb
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/yuriyvolkov/simba/pkg/vfs"
+)
+
+const (
+	// shareModeRead is the access that conflicts with opens not sharing read
+	shareModeRead = FileReadData | FileExecute
+
+	// shareModeWrite is the access that conflicts with opens not sharing write
+	shareModeWrite = FileWriteData | FileAppendData
+
+	// shareModeDelete is the access that conflicts with opens not sharing delete
+	shareModeDelete = Delete
+)
+
+// fileKey identifies a file across the opens of the server. Files of storage reachable through several
+// FS values are told apart by their real path alone, the others by their FS and their file ID, or by
+// their name if the storage has none or the file does not exist yet.
+type fileKey struct {
+	fs   vfs.FS
+	id   uint64
+	name string
+}
+
+// sharedFile represents a file opened by one or more opens on any of its streams, from any session and connection
+type sharedFile struct {
+	key   fileKey
+	opens []*open
+
+	// deletePending holds the streams whose delete is pending, the empty name standing for the file itself.
+	// A stream is deleted with its last open and the file with the last open of any of its streams,
+	// neither can be opened again until the delete is done.
+	deletePending map[string]bool
+
+	// appendMu serializes the appends to the file, each one writes at the end left by the previous one
+	appendMu sync.Mutex
+}
+
+// fileTable holds the files opened on the server, it enforces the share modes of their opens.
+// The table is only locked to check and register opens, files are opened, closed and deleted outside the lock.
+type fileTable struct {
+	mu    sync.Mutex
+	files map[fileKey]*sharedFile
+}
+
+// newFileTable creates an empty file table
+func newFileTable() *fileTable {
+	return &fileTable{files: make(map[fileKey]*sharedFile)}
+}
+
+// keyOf returns the key of a file, info is nil if the file does not exist
+func keyOf(fsys vfs.FS, name string, info *vfs.FileInfo) (fileKey, error) {
+	if rfs, ok := fsys.(vfs.RealPathFS); ok {
+		p, err := rfs.RealPath(name)
+		if err != nil {
+			return fileKey{}, err
+		}
+		return fileKey{name: p}, nil
+	}
+	if info != nil && info.FileID != 0 {
+		return fileKey{fs: fsys, id: info.FileID}, nil
+	}
+	return fileKey{fs: fsys, name: name}, nil
+}
+
+// checkShareAccess checks an open of a stream asking for access and sharing shareAccess against the opens
+// of the same stream. Opens asking for neither read, write nor delete access are not subject to share modes.
+func (f *sharedFile) checkShareAccess(stream string, access AccessMask, shareAccess ShareAccess) Status {
+	if f.deletePending[""] || f.deletePending[stream] {
+		return StatusDeletePending
+	}
+	if access&(shareModeRead|shareModeWrite|shareModeDelete) == 0 {
+		return StatusSuccess
+	}
+	for _, o := range f.opens {
+		if o.stream != stream || o.access&(shareModeRead|shareModeWrite|shareModeDelete) == 0 {
+			continue
+		}
+
+		// The new open must be shared by the existing one, and must share the access of the existing one
+		if access&shareModeRead != 0 && o.shareAccess&ShareAccessRead == 0 ||
+			access&shareModeWrite != 0 && o.shareAccess&ShareAccessWrite == 0 ||
+			access&shareModeDelete != 0 && o.shareAccess&ShareAccessDelete == 0 ||
+			o.access&shareModeRead != 0 && shareAccess&ShareAccessRead == 0 ||
+			o.access&shareModeWrite != 0 && shareAccess&ShareAccessWrite == 0 ||
+			o.access&shareModeDelete != 0 && shareAccess&ShareAccessDelete == 0 {
+			return StatusSharingViolation
+		}
+	}
+	return StatusSuccess
+}
+
+// hasOpens reports whether a stream of the file has opens
+func (f *sharedFile) hasOpens(stream string) bool {
+	for _, o := range f.opens {
+		if o.stream == stream {
+			return true
+		}
+	}
+	return false
+}
+
+// register checks an open against the share modes of the other opens of the file and adds it to them
+func (t *fileTable) register(o *open, key fileKey, access AccessMask) Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f := t.files[key]
+	if f == nil {
+		f = &sharedFile{key: key, deletePending: make(map[string]bool)}
+		t.files[key] = f
+	} else if status := f.checkShareAccess(o.stream, access, o.shareAccess); status != StatusSuccess {
+		return status
+	}
+	o.shared = f
+	o.files = t
+	f.opens = append(f.opens, o)
+	return StatusSuccess
+}
+
+// unregister removes an open from its file. It reports whether the open was the last one a pending
+// delete waited for, and the stream to delete, empty for the file itself.
+func (t *fileTable) unregister(o *open) (bool, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f := o.shared
+	for i, other := range f.opens {
+		if other == o {
+			f.opens = append(f.opens[:i], f.opens[i+1:]...)
+			break
+		}
+	}
+	if o.deleteOnClose {
+		f.deletePending[o.stream] = true
+	}
+
+	// The file goes with the last open of any stream, a stream with its own last open
+	switch {
+	case f.deletePending[""] && len(f.opens) == 0:
+		return true, ""
+	case o.stream != "" && f.deletePending[o.stream] && !f.hasOpens(o.stream):
+		return true, o.stream
+	}
+	t.release(f)
+	return false, ""
+}
+
+// deleted clears the pending delete of a file or stream once it was carried out or failed
+func (t *fileTable) deleted(f *sharedFile, stream string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if stream == "" {
+		f.deletePending = make(map[string]bool)
+	} else {
+		delete(f.deletePending, stream)
+	}
+	t.release(f)
+}
+
+// release drops a file without opens nor pending deletes from the table, the table must be locked
+func (t *fileTable) release(f *sharedFile) {
+	if len(f.opens) == 0 && len(f.deletePending) == 0 && t.files[f.key] == f {
+		delete(t.files, f.key)
+	}
+}
+
+// open opens the file of an open under the share modes of the other opens of the same file and registers it.
+// The open is registered before the file is opened, so that a file is never truncated under an open that
+// does not share write and no conflicting open slips in between the check and the open.
+func (t *fileTable) open(o *open, fsys vfs.FS, opts vfs.OpenOptions) (vfs.Action, *vfs.FileInfo, Status) {
+	o.fs = fsys
+
+	// Find the file, superseding needs to delete it and overwriting to write it
+	info, err := fsys.Stat(o.name)
+	if errors.Is(err, vfs.ErrNotExist) {
+		info, err = nil, nil
+	}
+	if err != nil {
+		return 0, nil, createStatus(fsys, o.name, err)
+	}
+	key, err := keyOf(fsys, o.name, info)
+	if err != nil {
+		return 0, nil, createStatus(fsys, o.name, err)
+	}
+	access := o.access
+	switch opts.Disposition {
+	case vfs.DispositionSupersede:
+		access |= Delete
+	case vfs.DispositionOverwrite, vfs.DispositionOverwriteIf:
+		access |= FileWriteData
+	}
+
+	// Register the open in place of the file it is about to open
+	if status := t.register(o, key, access); status != StatusSuccess {
+		return 0, nil, status
+	}
+
+	// Open the file or stream
+	var file vfs.File
+	var action vfs.Action
+	if o.stream != "" {
+		if sfs, ok := fsys.(vfs.StreamFS); ok {
+			file, action, err = sfs.OpenStream(o.name, o.stream, opts)
+		} else {
+			err = vfs.ErrInvalidName
+		}
+	} else {
+		file, action, err = fsys.Open(o.name, opts)
+	}
+	if err == nil {
+		if info, err = file.Stat(); err != nil {
+			file.Close()
+		}
+	}
+	if err != nil {
+		t.abort(o)
+		return 0, nil, createStatus(fsys, o.name, err)
+	}
+	o.file = file
+
+	// A file created or replaced by the open has a file ID of its own, the open moves to it.
+	// A file the open created is removed again if another open got to it first.
+	if _, ok := fsys.(vfs.RealPathFS); !ok {
+		if newKey, _ := keyOf(fsys, o.name, info); newKey != key {
+			t.abort(o)
+			if status := t.register(o, newKey, o.access); status != StatusSuccess {
+				file.Close()
+				o.file = nil
+				if action == vfs.ActionCreated {
+					o.remove("")
+				}
+				return 0, nil, status
+			}
+		}
+	}
+	return action, info, StatusSuccess
+}
+
+// abort unregisters an open whose file could not be opened, a delete it was the last open for is carried out
+func (t *fileTable) abort(o *open) {
+	deleteOnClose := o.deleteOnClose
+	o.deleteOnClose = false
+	if last, stream := t.unregister(o); last {
+		o.remove(stream)
+		t.deleted(o.shared, stream)
+	}
+	o.deleteOnClose = deleteOnClose
+}
+
+// close closes the file of an open. Closing an open with delete on close makes the delete pending, the stream
+// is deleted once its last open is closed and the file once the last open of any of its streams is closed.
+func (t *fileTable) close(o *open) error {
+	last, stream := t.unregister(o)
+	err := o.file.Close()
+	if !last {
+		return err
+	}
+
+	// Delete the file or stream, new opens are refused until it is gone
+	err = o.remove(stream)
+	t.deleted(o.shared, stream)
+	return err
+}
+
+// remove deletes the file of an open, or one of its streams
+func (o *open) remove(stream string) error {
+	if stream == "" {
+		return o.fs.Remove(o.name)
+	}
+	sfs, ok := o.fs.(vfs.StreamFS)
+	if !ok {
+		return vfs.ErrNotSupported
+	}
+	return sfs.RemoveStream(o.name, stream)
+}
+
+// appendData writes data at the end of the file of an open
+func (o *open) appendData(data []byte) (int, error) {
+	o.shared.appendMu.Lock()
+	defer o.shared.appendMu.Unlock()
+
+	info, err := o.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return o.file.WriteAt(data, info.Size)
+}
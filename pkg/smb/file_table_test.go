@@ -0,0 +1,172 @@
+package smb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yuriyvolkov/simba/pkg/vfs"
+)
+
+// shareAll shares read, write and delete access
+const shareAll = ShareAccessRead | ShareAccessWrite | ShareAccessDelete
+
+func TestShareModes(t *testing.T) {
+	tests := []struct {
+		name        string
+		access      AccessMask
+		shareAccess ShareAccess
+		access2     AccessMask
+		share2      ShareAccess
+		disposition CreateDisposition
+		want        Status
+	}{
+		{
+			name:   "second writer not shared",
+			access: FileReadData | FileWriteData, shareAccess: ShareAccessRead,
+			access2: FileReadData | FileWriteData, share2: shareAll,
+			disposition: CreateDispositionOpen,
+			want:        StatusSharingViolation,
+		},
+		{
+			name:   "reader sharing write",
+			access: FileReadData | FileWriteData, shareAccess: ShareAccessRead,
+			access2: FileReadData, share2: ShareAccessRead | ShareAccessWrite,
+			disposition: CreateDispositionOpen,
+			want:        StatusSuccess,
+		},
+		{
+			name:   "reader not sharing the write of the first open",
+			access: FileReadData | FileWriteData, shareAccess: ShareAccessRead,
+			access2: FileReadData, share2: ShareAccessRead,
+			disposition: CreateDispositionOpen,
+			want:        StatusSharingViolation,
+		},
+		{
+			name:   "attributes only",
+			access: FileReadData | FileWriteData, shareAccess: 0,
+			access2: FileReadAttributes, share2: 0,
+			disposition: CreateDispositionOpen,
+			want:        StatusSuccess,
+		},
+		{
+			name:   "overwrite needs write sharing",
+			access: FileReadData, shareAccess: ShareAccessRead | ShareAccessDelete,
+			access2: FileReadData, share2: shareAll, disposition: CreateDispositionOverwrite,
+			want: StatusSharingViolation,
+		},
+		{
+			name:   "supersede needs delete sharing",
+			access: FileReadData, shareAccess: ShareAccessRead | ShareAccessWrite,
+			access2: FileReadData, share2: shareAll, disposition: CreateDispositionSupersede,
+			want: StatusSharingViolation,
+		},
+		{
+			name:   "delete not shared",
+			access: FileReadData, shareAccess: ShareAccessRead | ShareAccessWrite,
+			access2: Delete, share2: shareAll,
+			disposition: CreateDispositionOpen,
+			want:        StatusSharingViolation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newTestTree(t, vfs.NewMemFS(0))
+			id := tree.mustCreate("book.xlsx", tt.access, tt.shareAccess, CreateDispositionCreate, 0)
+			status, id2, _ := tree.create("book.xlsx", tt.access2, tt.share2, tt.disposition, 0)
+			if status != tt.want {
+				t.Errorf("second open status = %#x, want %#x", uint32(status), uint32(tt.want))
+			}
+			if status == StatusSuccess {
+				tree.close(id2)
+			}
+			tree.close(id)
+			if n := len(tree.conn.server.files.files); n != 0 {
+				t.Errorf("file table holds %d files once closed", n)
+			}
+		})
+	}
+}
+
+func TestShareModesAcrossShares(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "f.txt"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same directory shared twice, and a subdirectory of it shared on its own
+	tree := newTestTree(t, vfs.NewOSFS(dir))
+	again := tree.connect("again", vfs.NewOSFS(dir))
+	nested := tree.connect("nested", vfs.NewOSFS(filepath.Join(dir, "sub")))
+
+	id := tree.mustCreate(`sub\f.txt`, FileReadData|FileWriteData, ShareAccessRead, CreateDispositionOpen, 0)
+	if status, _, _ := again.create(`sub\f.txt`, FileWriteData, shareAll, CreateDispositionOpen, 0); status != StatusSharingViolation {
+		t.Errorf("open through the same directory status = %#x, want %#x", uint32(status), uint32(StatusSharingViolation))
+	}
+	if status, _, _ := nested.create(`f.txt`, FileWriteData, shareAll, CreateDispositionOpen, 0); status != StatusSharingViolation {
+		t.Errorf("open through the subdirectory status = %#x, want %#x", uint32(status), uint32(StatusSharingViolation))
+	}
+	if status, _, _ := nested.create(`f.txt`, FileReadData, ShareAccessRead|ShareAccessWrite, CreateDispositionOpen, 0); status != StatusSuccess {
+		t.Errorf("reader through the subdirectory status = %#x", uint32(status))
+	}
+	tree.close(id)
+}
+
+func TestDeleteOnCloseWaitsForStreams(t *testing.T) {
+	fsys := vfs.NewMemFS(0)
+	tree := newTestTree(t, fsys)
+
+	// Open the main stream with delete on close and a named stream of the same file
+	main := tree.mustCreate("f.txt", FileReadData|FileWriteData|Delete, shareAll, CreateDispositionCreate, CreateOptionDeleteOnClose)
+	stream := tree.mustCreate("f.txt:extra", FileReadData|FileWriteData, shareAll, CreateDispositionCreate, 0)
+
+	// Closing the main stream leaves the file to the open of the named stream
+	if status := tree.close(main); status != StatusSuccess {
+		t.Fatalf("close status = %#x", uint32(status))
+	}
+	if _, err := fsys.Stat("f.txt"); err != nil {
+		t.Fatalf("file deleted while a stream is open: %v", err)
+	}
+	for _, name := range []string{"f.txt", "f.txt:extra"} {
+		if status, _, _ := tree.create(name, FileReadData, shareAll, CreateDispositionOpen, 0); status != StatusDeletePending {
+			t.Errorf("open of %s status = %#x, want %#x", name, uint32(status), uint32(StatusDeletePending))
+		}
+	}
+
+	// The last open of any stream deletes the file
+	if status := tree.close(stream); status != StatusSuccess {
+		t.Fatalf("close status = %#x", uint32(status))
+	}
+	if _, err := fsys.Stat("f.txt"); err == nil {
+		t.Error("file kept once its last open was closed")
+	}
+	if n := len(tree.conn.server.files.files); n != 0 {
+		t.Errorf("file table holds %d files once closed", n)
+	}
+}
+
+func TestDeleteOnCloseStream(t *testing.T) {
+	fsys := vfs.NewMemFS(0)
+	tree := newTestTree(t, fsys)
+
+	// Deleting a named stream leaves the main stream alone
+	main := tree.mustCreate("f.txt", FileReadData, shareAll, CreateDispositionCreate, 0)
+	stream := tree.mustCreate("f.txt:extra", FileReadData|Delete, shareAll, CreateDispositionCreate, CreateOptionDeleteOnClose)
+	tree.close(stream)
+	streams, err := fsys.Streams("f.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range streams {
+		if st.Name == "extra" {
+			t.Error("stream kept once its last open was closed")
+		}
+	}
+	if status, _, _ := tree.create("f.txt", FileReadData, shareAll, CreateDispositionOpen, 0); status != StatusSuccess {
+		t.Errorf("open of the main stream status = %#x", uint32(status))
+	}
+	tree.close(main)
+}
@@ -2,3 +2,27 @@ package smb
 
 // FlagUnicode indicates that the data in the SMB packet is encoded in Unicode.
 const FlagUnicode uint16 = 0x8000
+
+// SMB2 header flags
+const (
+	// FlagServerToRedir indicates that the packet is a response
+	FlagServerToRedir uint32 = 0x00000001
+
+	// FlagAsyncCommand indicates that the header is an async header
+	FlagAsyncCommand uint32 = 0x00000002
+
+	// FlagRelatedOperations indicates that the command is related to the previous one in a compound
+	FlagRelatedOperations uint32 = 0x00000004
+
+	// FlagSigned indicates that the packet is signed
+	FlagSigned uint32 = 0x00000008
+
+	// FlagPriorityMask holds the I/O priority of the request in SMB 3.1.1
+	FlagPriorityMask uint32 = 0x00000070
+
+	// FlagDFSOperations indicates that the command is a DFS operation
+	FlagDFSOperations uint32 = 0x10000000
+
+	// FlagReplayOperation indicates that the command is a replay operation
+	FlagReplayOperation uint32 = 0x20000000
+)
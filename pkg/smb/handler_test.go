@@ -0,0 +1,196 @@
+package smb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/yuriyvolkov/simba/pkg/vfs"
+)
+
+// testHandlers maps the commands sent by the tests to their handlers
+var testHandlers = map[Command]func(*Connection, *Packet) error{
+	CommandSessionSetup:   handleSessionSetupCommand,
+	CommandTreeConnect:    handleTreeConnectCommand,
+	CommandTreeDisconnect: handleTreeDisconnectCommand,
+	CommandCreate:         handleCreateCommand,
+	CommandClose:          handleCloseCommand,
+	CommandRead:           handleReadCommand,
+	CommandWrite:          handleWriteCommand,
+}
+
+// newTestConn creates a server with the options and a connection to it that negotiated SMB 3.1.1.
+// Requests are handed to the handlers directly, the network connection is never read.
+func newTestConn(t *testing.T, opts ...Option) *Connection {
+	t.Helper()
+
+	conn, _ := newTestPipe(t, opts...)
+	return conn
+}
+
+// newTestPipe is newTestConn that returns the client end of the network connection as well,
+// the responses written by the connection are read from it
+func newTestPipe(t *testing.T, opts ...Option) (*Connection, net.Conn) {
+	t.Helper()
+
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	conn := newConnection(NewServer(opts...), server)
+	conn.dialect = DialectSMB311
+	return conn, client
+}
+
+// testRequest marshals a request, parses it back as the server would and passes it to the handler of
+// the command. It returns the status of the response and its body.
+func testRequest(t *testing.T, conn *Connection, sessionID uint64, treeID uint32, command Command, request Marshaller) (Status, []byte) {
+	t.Helper()
+
+	status, body, err := handleTestRequest(conn, sessionID, treeID, command, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status, body
+}
+
+// handleTestRequest is testRequest returning its failures, for goroutines other than the one of the test
+func handleTestRequest(conn *Connection, sessionID uint64, treeID uint32, command Command, request Marshaller) (Status, []byte, error) {
+	// Marshal and parse the request
+	raw, err := request.Marshal()
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := ParseData(command, raw)
+	if err != nil {
+		return 0, nil, fmt.Errorf("parsing command %#x: %w", command, err)
+	}
+	packet := &Packet{
+		Header: Header{Command: command, SessionID: sessionID, TreeID: treeID},
+		Data:   data,
+	}
+
+	// Handle the request
+	if err := testHandlers[command](conn, packet); err != nil {
+		return 0, nil, fmt.Errorf("handling command %#x: %w", command, err)
+	}
+	if len(packet.response) < HeaderSize {
+		return 0, nil, fmt.Errorf("command %#x has no response", command)
+	}
+	return Status(binary.LittleEndian.Uint32(packet.response[8:12])), packet.response[HeaderSize:], nil
+}
+
+// testTree is a tree connect of an established session on a share named "share",
+// client is the client end of the network connection
+type testTree struct {
+	t       *testing.T
+	conn    *Connection
+	client  net.Conn
+	session *session
+	tree    *treeConnect
+}
+
+// newTestTree serves fsys as the share "share" and connects a user to it
+func newTestTree(t *testing.T, fsys vfs.FS, opts ...ShareOption) *testTree {
+	t.Helper()
+
+	conn, client := newTestPipe(t, WithShareFS("share", fsys, opts...))
+	s := conn.newSession()
+	s.setIdentity("DOMAIN", "user", nil, 0)
+	s.establish(time.Time{})
+	return &testTree{
+		t:       t,
+		conn:    conn,
+		client:  client,
+		session: s,
+		tree:    s.addTree(conn.server.shares.lookup("share")),
+	}
+}
+
+// connect adds a share to the server of the tree connect and connects the same session to it
+func (tt *testTree) connect(name string, fsys vfs.FS, opts ...ShareOption) *testTree {
+	tt.t.Helper()
+
+	WithShareFS(name, fsys, opts...)(tt.conn.server)
+	return &testTree{
+		t:       tt.t,
+		conn:    tt.conn,
+		client:  tt.client,
+		session: tt.session,
+		tree:    tt.session.addTree(tt.conn.server.shares.lookup(name)),
+	}
+}
+
+// request sends a request on the tree connect and returns the status and the body of the response
+func (tt *testTree) request(command Command, request Marshaller) (Status, []byte) {
+	tt.t.Helper()
+
+	return testRequest(tt.t, tt.conn, tt.session.id, tt.tree.id, command, request)
+}
+
+// create opens a file and returns the status, the file ID and the create action of the response
+func (tt *testTree) create(name string, access AccessMask, shareAccess ShareAccess, disposition CreateDisposition, options CreateOptions) (Status, FileID, CreateAction) {
+	tt.t.Helper()
+
+	status, body := tt.request(CommandCreate, &CreateRequest{
+		ImpersonationLevel: ImpersonationLevelImpersonation,
+		DesiredAccess:      access,
+		ShareAccess:        shareAccess,
+		CreateDisposition:  disposition,
+		CreateOptions:      options,
+		Name:               name,
+	})
+	if status != StatusSuccess {
+		return status, FileID{}, 0
+	}
+	id := FileID{
+		Persistent: binary.LittleEndian.Uint64(body[64:72]),
+		Volatile:   binary.LittleEndian.Uint64(body[72:80]),
+	}
+	return status, id, CreateAction(binary.LittleEndian.Uint32(body[4:8]))
+}
+
+// mustCreate opens a file and fails the test if it cannot be opened
+func (tt *testTree) mustCreate(name string, access AccessMask, shareAccess ShareAccess, disposition CreateDisposition, options CreateOptions) FileID {
+	tt.t.Helper()
+
+	status, id, _ := tt.create(name, access, shareAccess, disposition, options)
+	if status != StatusSuccess {
+		tt.t.Fatalf("create %s: status %#x", name, uint32(status))
+	}
+	return id
+}
+
+// close closes a file and returns the status of the response
+func (tt *testTree) close(id FileID) Status {
+	tt.t.Helper()
+
+	status, _ := tt.request(CommandClose, &CloseRequest{FileID: id})
+	return status
+}
+
+// read reads from a file and returns the status and the data of the response
+func (tt *testTree) read(id FileID, offset uint64, length uint32) (Status, []byte) {
+	tt.t.Helper()
+
+	status, body := tt.request(CommandRead, &ReadRequest{FileID: id, Offset: offset, Length: length})
+	if status != StatusSuccess {
+		return status, nil
+	}
+	n := binary.LittleEndian.Uint32(body[4:8])
+	return status, body[16 : 16+n]
+}
+
+// write writes to a file and returns the status and the count of the response
+func (tt *testTree) write(id FileID, offset uint64, data []byte) (Status, uint32) {
+	tt.t.Helper()
+
+	status, body := tt.request(CommandWrite, &WriteRequest{FileID: id, Offset: offset, Data: data})
+	if status != StatusSuccess {
+		return status, 0
+	}
+	return status, binary.LittleEndian.Uint32(body[4:8])
+}
@@ -3,40 +3,99 @@ package smb
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 )
 
-// Header represents an SMB header
+// HeaderSize is the size of an SMB2 packet header in bytes
+const HeaderSize = 64
+
+// ProtocolIDSMB2 is the protocol identifier of SMB2 and SMB3 packets
+var ProtocolIDSMB2 = [4]byte{0xFE, 'S', 'M', 'B'}
+
+var (
+	// ErrInvalidProtocolID is returned when a packet does not start with the SMB2 protocol identifier
+	ErrInvalidProtocolID = errors.New("smb: invalid protocol id")
+
+	// ErrInvalidHeader is returned when a packet header is truncated or has a wrong structure size
+	ErrInvalidHeader = errors.New("smb: invalid header")
+)
+
+// Header represents an SMB2 packet header.
+// The sync and the async header are both 64 bytes long and differ only in the
+// fields selected by the Flags:
+//
+//	Status is present in responses (FlagServerToRedir), ChannelSequence in requests.
+//	AsyncID is present in async messages (FlagAsyncCommand), Reserved and TreeID otherwise.
+//	CreditRequestResponse is the CreditRequest of a request and the CreditResponse of a response.
 type Header struct {
-	ProtocolID  [4]byte
-	Command     Command
-	Status      Status
-	Flags       uint32
-	Flags2      uint32
-	Reserved    uint32
-	TreeID      uint32
-	ProcessID   uint16
-	UserID      uint16
-	MultiplexID uint16
-	Data        []byte
+	ProtocolID            [4]byte
+	StructureSize         uint16
+	CreditCharge          uint16
+	Status                Status
+	ChannelSequence       uint16
+	Command               Command
+	CreditRequestResponse uint16
+	Flags                 uint32
+	NextCommand           uint32
+	MessageID             uint64
+	AsyncID               uint64
+	Reserved              uint32
+	TreeID                uint32
+	SessionID             uint64
+	Signature             [16]byte
+}
+
+// IsResponse reports whether the header belongs to a server response
+func (h *Header) IsResponse() bool {
+	return h.Flags&FlagServerToRedir != 0
 }
 
-// Marshal serializes an SMB header into a byte slice
+// IsAsync reports whether the header is an async header carrying an AsyncID
+func (h *Header) IsAsync() bool {
+	return h.Flags&FlagAsyncCommand != 0
+}
+
+// Marshal serializes an SMB2 header into a byte slice
 func (h *Header) Marshal() ([]byte, error) {
 	// Create a new bytes buffer
-	buf := new(bytes.Buffer)
+	buf := bytes.NewBuffer(make([]byte, 0, HeaderSize))
 
 	// Write the protocol ID
 	if err := binary.Write(buf, binary.LittleEndian, h.ProtocolID); err != nil {
 		return nil, err
 	}
 
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, h.StructureSize); err != nil {
+		return nil, err
+	}
+
+	// Write the credit charge
+	if err := binary.Write(buf, binary.LittleEndian, h.CreditCharge); err != nil {
+		return nil, err
+	}
+
+	// Write the status of a response, or the channel sequence and reserved field of a request
+	if h.IsResponse() {
+		if err := binary.Write(buf, binary.LittleEndian, h.Status); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := binary.Write(buf, binary.LittleEndian, h.ChannelSequence); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(buf, binary.LittleEndian, uint16(0)); err != nil {
+			return nil, err
+		}
+	}
+
 	// Write the command
 	if err := binary.Write(buf, binary.LittleEndian, h.Command); err != nil {
 		return nil, err
 	}
 
-	// Write the status
-	if err := binary.Write(buf, binary.LittleEndian, h.Status); err != nil {
+	// Write the credit request or response
+	if err := binary.Write(buf, binary.LittleEndian, h.CreditRequestResponse); err != nil {
 		return nil, err
 	}
 
@@ -45,32 +104,82 @@ func (h *Header) Marshal() ([]byte, error) {
 		return nil, err
 	}
 
-	// Write the flags 2
-	if err := binary.Write(buf, binary.LittleEndian, h.Flags2); err != nil {
+	// Write the offset of the next command in a compounded message
+	if err := binary.Write(buf, binary.LittleEndian, h.NextCommand); err != nil {
+		return nil, err
+	}
+
+	// Write the message ID
+	if err := binary.Write(buf, binary.LittleEndian, h.MessageID); err != nil {
 		return nil, err
 	}
 
-	// Write the reserved field
-	if err := binary.Write(buf, binary.LittleEndian, h.Reserved); err != nil {
+	// Write the async ID, or the reserved field and the tree ID
+	if h.IsAsync() {
+		if err := binary.Write(buf, binary.LittleEndian, h.AsyncID); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := binary.Write(buf, binary.LittleEndian, h.Reserved); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(buf, binary.LittleEndian, h.TreeID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Write the session ID
+	if err := binary.Write(buf, binary.LittleEndian, h.SessionID); err != nil {
 		return nil, err
 	}
 
-	// Write the tree ID
-	// TODO
+	// Write the signature
+	if err := binary.Write(buf, binary.LittleEndian, h.Signature); err != nil {
+		return nil, err
+	}
 
 	return buf.Bytes(), nil
 }
 
-// HeaderParse parses an SMB packet header from a byte slice
+// HeaderParse parses an SMB2 packet header from a byte slice
 func HeaderParse(data []byte) (*Header, error) {
+	// Make sure the whole header is present
+	if len(data) < HeaderSize {
+		return nil, ErrInvalidHeader
+	}
+
 	// Create a new bytes reader
-	r := bytes.NewReader(data)
+	r := bytes.NewReader(data[:HeaderSize])
 
 	// Read the protocol ID
 	var protocolID [4]byte
 	if err := binary.Read(r, binary.LittleEndian, &protocolID); err != nil {
 		return nil, err
 	}
+	if protocolID != ProtocolIDSMB2 {
+		return nil, ErrInvalidProtocolID
+	}
+
+	// Read the structure size
+	var structureSize uint16
+	if err := binary.Read(r, binary.LittleEndian, &structureSize); err != nil {
+		return nil, err
+	}
+	if structureSize != HeaderSize {
+		return nil, ErrInvalidHeader
+	}
+
+	// Read the credit charge
+	var creditCharge uint16
+	if err := binary.Read(r, binary.LittleEndian, &creditCharge); err != nil {
+		return nil, err
+	}
+
+	// Read the status, its meaning depends on the flags read below
+	var status uint32
+	if err := binary.Read(r, binary.LittleEndian, &status); err != nil {
+		return nil, err
+	}
 
 	// Read the command
 	var command Command
@@ -78,9 +187,9 @@ func HeaderParse(data []byte) (*Header, error) {
 		return nil, err
 	}
 
-	// Read the status
-	var status Status
-	if err := binary.Read(r, binary.LittleEndian, &status); err != nil {
+	// Read the credit request or response
+	var creditRequestResponse uint16
+	if err := binary.Read(r, binary.LittleEndian, &creditRequestResponse); err != nil {
 		return nil, err
 	}
 
@@ -90,55 +199,82 @@ func HeaderParse(data []byte) (*Header, error) {
 		return nil, err
 	}
 
-	// Read the flags 2
-	var flags2 uint32
-	if err := binary.Read(r, binary.LittleEndian, &flags2); err != nil {
-		return nil, err
-	}
-
-	// Read the reserved field
-	var reserved uint32
-	if err := binary.Read(r, binary.LittleEndian, &reserved); err != nil {
+	// Read the offset of the next command
+	var nextCommand uint32
+	if err := binary.Read(r, binary.LittleEndian, &nextCommand); err != nil {
 		return nil, err
 	}
 
-	// Read the tree ID
-	var treeID uint32
-	if err := binary.Read(r, binary.LittleEndian, &treeID); err != nil {
+	// Read the message ID
+	var messageID uint64
+	if err := binary.Read(r, binary.LittleEndian, &messageID); err != nil {
 		return nil, err
 	}
 
-	// Read the process ID
-	var processID uint16
-	if err := binary.Read(r, binary.LittleEndian, &processID); err != nil {
+	// Read the async ID, its meaning depends on the flags
+	var asyncID uint64
+	if err := binary.Read(r, binary.LittleEndian, &asyncID); err != nil {
 		return nil, err
 	}
 
-	// Read the user ID
-	var userID uint16
-	if err := binary.Read(r, binary.LittleEndian, &userID); err != nil {
+	// Read the session ID
+	var sessionID uint64
+	if err := binary.Read(r, binary.LittleEndian, &sessionID); err != nil {
 		return nil, err
 	}
 
-	// Read the multiplex ID
-	var multiplexID uint16
-	if err := binary.Read(r, binary.LittleEndian, &multiplexID); err != nil {
+	// Read the signature
+	var signature [16]byte
+	if err := binary.Read(r, binary.LittleEndian, &signature); err != nil {
 		return nil, err
 	}
 
 	// Create the header
 	header := &Header{
-		ProtocolID:  protocolID,
-		Command:     command,
-		Status:      status,
-		Flags:       flags,
-		Flags2:      flags2,
-		Reserved:    reserved,
-		TreeID:      treeID,
-		ProcessID:   processID,
-		UserID:      userID,
-		MultiplexID: multiplexID,
+		ProtocolID:            protocolID,
+		StructureSize:         structureSize,
+		CreditCharge:          creditCharge,
+		Command:               command,
+		CreditRequestResponse: creditRequestResponse,
+		Flags:                 flags,
+		NextCommand:           nextCommand,
+		MessageID:             messageID,
+		SessionID:             sessionID,
+		Signature:             signature,
+	}
+
+	// Split the fields shared between requests and responses
+	if header.IsResponse() {
+		header.Status = Status(status)
+	} else {
+		header.ChannelSequence = uint16(status)
+	}
+
+	// Split the fields shared between sync and async headers
+	if header.IsAsync() {
+		header.AsyncID = asyncID
+	} else {
+		header.Reserved = uint32(asyncID)
+		header.TreeID = uint32(asyncID >> 32)
 	}
 
 	return header, nil
 }
+
+// responseHeader creates the header of a response to the request with the given header
+func responseHeader(request *Header, status Status, credits uint16) Header {
+	return Header{
+		ProtocolID:            ProtocolIDSMB2,
+		StructureSize:         HeaderSize,
+		CreditCharge:          request.CreditCharge,
+		Status:                status,
+		Command:               request.Command,
+		CreditRequestResponse: credits,
+		Flags:                 request.Flags&(FlagAsyncCommand|FlagRelatedOperations|FlagPriorityMask) | FlagServerToRedir,
+		MessageID:             request.MessageID,
+		AsyncID:               request.AsyncID,
+		Reserved:              request.Reserved,
+		TreeID:                request.TreeID,
+		SessionID:             request.SessionID,
+	}
+}
@@ -0,0 +1,18 @@
+package smb
+
+// ImpersonationLevel represents how far the server may impersonate the client when opening a file
+type ImpersonationLevel uint32
+
+const (
+	// ImpersonationLevelAnonymous does not let the server identify the client
+	ImpersonationLevelAnonymous ImpersonationLevel = 0x00000000
+
+	// ImpersonationLevelIdentification lets the server identify the client
+	ImpersonationLevelIdentification ImpersonationLevel = 0x00000001
+
+	// ImpersonationLevelImpersonation lets the server act as the client locally
+	ImpersonationLevelImpersonation ImpersonationLevel = 0x00000002
+
+	// ImpersonationLevelDelegate lets the server act as the client on other servers
+	ImpersonationLevelDelegate ImpersonationLevel = 0x00000003
+)
@@ -0,0 +1,56 @@
+package smb
+
+import "time"
+
+// ConnectionLimits bounds the resources a single client connection may use
+type ConnectionLimits struct {
+	// MaxMessageSize is the largest SMB message accepted from the client
+	MaxMessageSize int
+
+	// IdleTimeout closes the connection when the client sends no message for this long, zero disables it
+	IdleTimeout time.Duration
+
+	// Workers is the number of messages of the connection processed concurrently
+	Workers int
+
+	// MaxTransactSize, MaxReadSize and MaxWriteSize are the largest transact, read and write
+	// announced to the client, SMB 2.0.2 clients are limited to 64 KiB
+	MaxTransactSize int
+	MaxReadSize     int
+	MaxWriteSize    int
+}
+
+// DefaultMaxIOSize is the default size limit of a single transact, read or write, as large as
+// the default message size leaves room for
+const DefaultMaxIOSize = 8 * 1024 * 1024
+
+// ioMessageOverhead is the room left in a message for the headers around the data of a read or write
+const ioMessageOverhead = 64 * 1024
+
+// ioSizes returns the largest transact, read and write announced on a connection of the dialect.
+// SMB 2.0.2 clients cannot go beyond 64 KiB, and a read or write must fit into a message.
+func (l *ConnectionLimits) ioSizes(dialect Dialect) (int, int, int) {
+	maxTransact, maxRead, maxWrite := l.MaxTransactSize, l.MaxReadSize, l.MaxWriteSize
+	if dialect == DialectSMB202 {
+		maxTransact = minInt(maxTransact, smb202MaxBufferSize)
+		maxRead = minInt(maxRead, smb202MaxBufferSize)
+		maxWrite = minInt(maxWrite, smb202MaxBufferSize)
+	}
+	if room := l.MaxMessageSize - ioMessageOverhead; room > 0 {
+		maxTransact = minInt(maxTransact, room)
+		maxRead = minInt(maxRead, room)
+		maxWrite = minInt(maxWrite, room)
+	}
+	return maxTransact, maxRead, maxWrite
+}
+
+// DefaultConnectionLimits are the limits used by new connections
+var DefaultConnectionLimits = ConnectionLimits{
+	MaxMessageSize: DefaultMaxMessageSize,
+	IdleTimeout:    15 * time.Minute,
+	Workers:        16,
+
+	MaxTransactSize: DefaultMaxIOSize,
+	MaxReadSize:     DefaultMaxIOSize,
+	MaxWriteSize:    DefaultMaxIOSize,
+}
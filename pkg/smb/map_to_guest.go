@@ -0,0 +1,15 @@
+package smb
+
+// MapToGuest represents which failed logons are turned into guest logons, as the Samba option of that name
+type MapToGuest int
+
+const (
+	// MapToGuestNever refuses every failed logon
+	MapToGuestNever MapToGuest = iota
+
+	// MapToGuestBadUser logs users unknown to the server in as guest
+	MapToGuestBadUser
+
+	// MapToGuestBadPassword logs unknown users and users giving a wrong password in as guest
+	MapToGuestBadPassword
+)
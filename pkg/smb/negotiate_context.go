@@ -0,0 +1,392 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// NegotiateContextType identifies an SMB 3.1.1 negotiate context
+type NegotiateContextType uint16
+
+const (
+	// NegotiateContextPreauthIntegrity identifies SMB2_PREAUTH_INTEGRITY_CAPABILITIES
+	NegotiateContextPreauthIntegrity NegotiateContextType = 0x0001
+
+	// NegotiateContextEncryption identifies SMB2_ENCRYPTION_CAPABILITIES
+	NegotiateContextEncryption NegotiateContextType = 0x0002
+
+	// NegotiateContextCompression identifies SMB2_COMPRESSION_CAPABILITIES
+	NegotiateContextCompression NegotiateContextType = 0x0003
+
+	// NegotiateContextNetname identifies SMB2_NETNAME_NEGOTIATE_CONTEXT_ID
+	NegotiateContextNetname NegotiateContextType = 0x0005
+
+	// NegotiateContextTransport identifies SMB2_TRANSPORT_CAPABILITIES
+	NegotiateContextTransport NegotiateContextType = 0x0006
+
+	// NegotiateContextRDMATransform identifies SMB2_RDMA_TRANSFORM_CAPABILITIES
+	NegotiateContextRDMATransform NegotiateContextType = 0x0007
+
+	// NegotiateContextSigning identifies SMB2_SIGNING_CAPABILITIES
+	NegotiateContextSigning NegotiateContextType = 0x0008
+)
+
+// negotiateContextHeaderSize is the size of the header preceding each negotiate context
+const negotiateContextHeaderSize = 8
+
+// HashAlgorithm identifies a preauth integrity hash algorithm
+type HashAlgorithm uint16
+
+// HashAlgorithmSHA512 indicates SHA-512, the only preauth integrity hash algorithm
+const HashAlgorithmSHA512 HashAlgorithm = 0x0001
+
+// CompressionCapabilitiesFlagChained indicates support for chained compression
+const CompressionCapabilitiesFlagChained uint32 = 0x00000001
+
+// TransportCapabilitiesFlagAcceptTransportLevelSecurity indicates that transport
+// level security (QUIC) may be used instead of SMB encryption
+const TransportCapabilitiesFlagAcceptTransportLevelSecurity uint32 = 0x00000001
+
+// RDMATransform identifies a transform applied to RDMA operations
+type RDMATransform uint16
+
+const (
+	// RDMATransformNone indicates no transform
+	RDMATransformNone RDMATransform = 0x0000
+
+	// RDMATransformEncryption indicates RDMA encryption
+	RDMATransformEncryption RDMATransform = 0x0001
+
+	// RDMATransformSigning indicates RDMA signing
+	RDMATransformSigning RDMATransform = 0x0002
+)
+
+// ErrInvalidNegotiateContext is returned when a negotiate context is malformed or duplicated
+var ErrInvalidNegotiateContext = errors.New("smb: invalid negotiate context")
+
+// PreauthIntegrityCapabilities represents SMB2_PREAUTH_INTEGRITY_CAPABILITIES
+type PreauthIntegrityCapabilities struct {
+	HashAlgorithms []HashAlgorithm
+	Salt           []byte
+}
+
+// EncryptionCapabilities represents SMB2_ENCRYPTION_CAPABILITIES
+type EncryptionCapabilities struct {
+	Ciphers []Cipher
+}
+
+// CompressionCapabilities represents SMB2_COMPRESSION_CAPABILITIES
+type CompressionCapabilities struct {
+	Flags                 uint32
+	CompressionAlgorithms []CompressionAlgorithm
+}
+
+// TransportCapabilities represents SMB2_TRANSPORT_CAPABILITIES
+type TransportCapabilities struct {
+	Flags uint32
+}
+
+// RDMATransformCapabilities represents SMB2_RDMA_TRANSFORM_CAPABILITIES
+type RDMATransformCapabilities struct {
+	TransformIDs []RDMATransform
+}
+
+// SigningCapabilities represents SMB2_SIGNING_CAPABILITIES
+type SigningCapabilities struct {
+	SigningAlgorithms []SigningAlgorithm
+}
+
+// NegotiateContexts holds the negotiate contexts of an SMB 3.1.1 negotiate request or response.
+// A nil field (or an empty NetName) means that the context is absent.
+type NegotiateContexts struct {
+	PreauthIntegrity *PreauthIntegrityCapabilities
+	Encryption       *EncryptionCapabilities
+	Compression      *CompressionCapabilities
+	NetName          string
+	Transport        *TransportCapabilities
+	RDMATransform    *RDMATransformCapabilities
+	Signing          *SigningCapabilities
+}
+
+// count returns the number of contexts present
+func (c *NegotiateContexts) count() int {
+	n := 0
+	if c.PreauthIntegrity != nil {
+		n++
+	}
+	if c.Encryption != nil {
+		n++
+	}
+	if c.Compression != nil {
+		n++
+	}
+	if c.NetName != "" {
+		n++
+	}
+	if c.Transport != nil {
+		n++
+	}
+	if c.RDMATransform != nil {
+		n++
+	}
+	if c.Signing != nil {
+		n++
+	}
+	return n
+}
+
+// Marshal serializes the negotiate context list into a byte slice.
+// The list must be placed at an 8-byte aligned offset from the start of the SMB2 header.
+func (c *NegotiateContexts) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
+
+	// Write the preauth integrity capabilities
+	if c.PreauthIntegrity != nil {
+		data := new(bytes.Buffer)
+		if err := binary.Write(data, binary.LittleEndian, uint16(len(c.PreauthIntegrity.HashAlgorithms))); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(data, binary.LittleEndian, uint16(len(c.PreauthIntegrity.Salt))); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(data, binary.LittleEndian, c.PreauthIntegrity.HashAlgorithms); err != nil {
+			return nil, err
+		}
+		data.Write(c.PreauthIntegrity.Salt)
+		writeNegotiateContext(buf, NegotiateContextPreauthIntegrity, data.Bytes())
+	}
+
+	// Write the encryption capabilities
+	if c.Encryption != nil {
+		data := new(bytes.Buffer)
+		if err := binary.Write(data, binary.LittleEndian, uint16(len(c.Encryption.Ciphers))); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(data, binary.LittleEndian, c.Encryption.Ciphers); err != nil {
+			return nil, err
+		}
+		writeNegotiateContext(buf, NegotiateContextEncryption, data.Bytes())
+	}
+
+	// Write the compression capabilities
+	if c.Compression != nil {
+		data := new(bytes.Buffer)
+		if err := binary.Write(data, binary.LittleEndian, uint16(len(c.Compression.CompressionAlgorithms))); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(data, binary.LittleEndian, uint16(0)); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(data, binary.LittleEndian, c.Compression.Flags); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(data, binary.LittleEndian, c.Compression.CompressionAlgorithms); err != nil {
+			return nil, err
+		}
+		writeNegotiateContext(buf, NegotiateContextCompression, data.Bytes())
+	}
+
+	// Write the server name the client connected to
+	if c.NetName != "" {
+		writeNegotiateContext(buf, NegotiateContextNetname, encodeUTF16LE(c.NetName))
+	}
+
+	// Write the transport capabilities
+	if c.Transport != nil {
+		data := new(bytes.Buffer)
+		if err := binary.Write(data, binary.LittleEndian, c.Transport.Flags); err != nil {
+			return nil, err
+		}
+		writeNegotiateContext(buf, NegotiateContextTransport, data.Bytes())
+	}
+
+	// Write the RDMA transform capabilities
+	if c.RDMATransform != nil {
+		data := new(bytes.Buffer)
+		if err := binary.Write(data, binary.LittleEndian, uint16(len(c.RDMATransform.TransformIDs))); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(data, binary.LittleEndian, uint16(0)); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(data, binary.LittleEndian, uint32(0)); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(data, binary.LittleEndian, c.RDMATransform.TransformIDs); err != nil {
+			return nil, err
+		}
+		writeNegotiateContext(buf, NegotiateContextRDMATransform, data.Bytes())
+	}
+
+	// Write the signing capabilities
+	if c.Signing != nil {
+		data := new(bytes.Buffer)
+		if err := binary.Write(data, binary.LittleEndian, uint16(len(c.Signing.SigningAlgorithms))); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(data, binary.LittleEndian, c.Signing.SigningAlgorithms); err != nil {
+			return nil, err
+		}
+		writeNegotiateContext(buf, NegotiateContextSigning, data.Bytes())
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeNegotiateContext writes a single negotiate context, aligned to an 8-byte boundary
+// relative to the start of the list
+func writeNegotiateContext(buf *bytes.Buffer, contextType NegotiateContextType, data []byte) {
+	buf.Write(make([]byte, padding8(buf.Len())))
+	binary.Write(buf, binary.LittleEndian, contextType)
+	binary.Write(buf, binary.LittleEndian, uint16(len(data)))
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	buf.Write(data)
+}
+
+// NegotiateContextsParse parses count negotiate contexts from a byte slice starting at the first context.
+// Contexts of unknown type are ignored.
+func NegotiateContextsParse(data []byte, count int) (*NegotiateContexts, error) {
+	contexts := &NegotiateContexts{}
+
+	off := 0
+	for i := 0; i < count; i++ {
+		// Contexts start at 8-byte boundaries relative to the first one
+		off += padding8(off)
+
+		// Read the context header
+		if off+negotiateContextHeaderSize > len(data) {
+			return nil, ErrInvalidNegotiateContext
+		}
+		contextType := NegotiateContextType(binary.LittleEndian.Uint16(data[off:]))
+		dataLength := int(binary.LittleEndian.Uint16(data[off+2:]))
+		off += negotiateContextHeaderSize
+
+		// Read the context data
+		if off+dataLength > len(data) {
+			return nil, ErrInvalidNegotiateContext
+		}
+		r := bytes.NewReader(data[off : off+dataLength])
+		off += dataLength
+
+		switch contextType {
+		case NegotiateContextPreauthIntegrity:
+			if contexts.PreauthIntegrity != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+
+			// Read the hash algorithm count and the salt length
+			var hashAlgorithmCount, saltLength uint16
+			if err := binary.Read(r, binary.LittleEndian, &hashAlgorithmCount); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+			if err := binary.Read(r, binary.LittleEndian, &saltLength); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+
+			// Read the hash algorithms and the salt
+			preauth := &PreauthIntegrityCapabilities{
+				HashAlgorithms: make([]HashAlgorithm, hashAlgorithmCount),
+				Salt:           make([]byte, saltLength),
+			}
+			if err := binary.Read(r, binary.LittleEndian, preauth.HashAlgorithms); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+			if err := binary.Read(r, binary.LittleEndian, preauth.Salt); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+			contexts.PreauthIntegrity = preauth
+		case NegotiateContextEncryption:
+			if contexts.Encryption != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+
+			// Read the ciphers
+			var cipherCount uint16
+			if err := binary.Read(r, binary.LittleEndian, &cipherCount); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+			encryption := &EncryptionCapabilities{Ciphers: make([]Cipher, cipherCount)}
+			if err := binary.Read(r, binary.LittleEndian, encryption.Ciphers); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+			contexts.Encryption = encryption
+		case NegotiateContextCompression:
+			if contexts.Compression != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+
+			// Read the algorithm count, the padding and the flags
+			var algorithmCount, padding uint16
+			compression := &CompressionCapabilities{}
+			if err := binary.Read(r, binary.LittleEndian, &algorithmCount); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+			if err := binary.Read(r, binary.LittleEndian, &padding); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+			if err := binary.Read(r, binary.LittleEndian, &compression.Flags); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+
+			// Read the compression algorithms
+			compression.CompressionAlgorithms = make([]CompressionAlgorithm, algorithmCount)
+			if err := binary.Read(r, binary.LittleEndian, compression.CompressionAlgorithms); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+			contexts.Compression = compression
+		case NegotiateContextNetname:
+			contexts.NetName = decodeUTF16LE(data[off-dataLength : off])
+		case NegotiateContextTransport:
+			transport := &TransportCapabilities{}
+			if err := binary.Read(r, binary.LittleEndian, &transport.Flags); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+			contexts.Transport = transport
+		case NegotiateContextRDMATransform:
+			if contexts.RDMATransform != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+
+			// Read the transform count and skip the reserved fields
+			var transformCount uint16
+			if err := binary.Read(r, binary.LittleEndian, &transformCount); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+			var reserved [6]byte
+			if err := binary.Read(r, binary.LittleEndian, &reserved); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+
+			// Read the transform IDs
+			rdma := &RDMATransformCapabilities{TransformIDs: make([]RDMATransform, transformCount)}
+			if err := binary.Read(r, binary.LittleEndian, rdma.TransformIDs); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+			contexts.RDMATransform = rdma
+		case NegotiateContextSigning:
+			if contexts.Signing != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+
+			// Read the signing algorithms
+			var algorithmCount uint16
+			if err := binary.Read(r, binary.LittleEndian, &algorithmCount); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+			signing := &SigningCapabilities{SigningAlgorithms: make([]SigningAlgorithm, algorithmCount)}
+			if err := binary.Read(r, binary.LittleEndian, signing.SigningAlgorithms); err != nil {
+				return nil, ErrInvalidNegotiateContext
+			}
+			contexts.Signing = signing
+		}
+	}
+
+	return contexts, nil
+}
+
+// padding8 returns the number of bytes needed to align n to an 8-byte boundary
+func padding8(n int) int {
+	return (8 - n%8) % 8
+}
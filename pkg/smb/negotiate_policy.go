@@ -0,0 +1,88 @@
+package smb
+
+// NegotiatePolicy holds the server preferences used to select algorithms from the
+// SMB 3.1.1 negotiate contexts of a client. Every list is ordered from the most
+// to the least preferred algorithm; algorithms missing from a list are never selected.
+type NegotiatePolicy struct {
+	// Ciphers lists the encryption algorithms
+	Ciphers []Cipher
+
+	// SigningAlgorithms lists the signing algorithms
+	SigningAlgorithms []SigningAlgorithm
+
+	// CompressionAlgorithms lists the compression algorithms, an empty list disables compression
+	CompressionAlgorithms []CompressionAlgorithm
+
+	// ChainedCompression allows chained compression if the client supports it
+	ChainedCompression bool
+
+	// CompressionThreshold is the size below which responses are sent uncompressed
+	CompressionThreshold int
+}
+
+// DefaultNegotiatePolicy is the policy used to answer negotiate requests
+var DefaultNegotiatePolicy = NegotiatePolicy{
+	Ciphers:           []Cipher{CipherAES128GCM, CipherAES128CCM, CipherAES256GCM, CipherAES256CCM},
+	SigningAlgorithms: []SigningAlgorithm{SigningAlgorithmAESGMAC, SigningAlgorithmAESCMAC, SigningAlgorithmHMACSHA256},
+
+	CompressionThreshold: DefaultCompressionThreshold,
+}
+
+// selectCipher returns the most preferred cipher offered by the client, or CipherNone
+func (p *NegotiatePolicy) selectCipher(offered []Cipher) Cipher {
+	for _, preferred := range p.Ciphers {
+		for _, c := range offered {
+			if c == preferred {
+				return c
+			}
+		}
+	}
+	return CipherNone
+}
+
+// selectSigningAlgorithm returns the most preferred signing algorithm offered by the client.
+// AES-CMAC is used if there is no common algorithm.
+func (p *NegotiatePolicy) selectSigningAlgorithm(offered []SigningAlgorithm) SigningAlgorithm {
+	for _, preferred := range p.SigningAlgorithms {
+		for _, a := range offered {
+			if a == preferred {
+				return a
+			}
+		}
+	}
+	return SigningAlgorithmAESCMAC
+}
+
+// selectCompression returns the compression capabilities to answer the client with.
+// Without chaining a single algorithm is selected, with chaining all common algorithms
+// are returned in order of preference. Pattern_V1 is only usable in chained mode, algorithms
+// the server does not implement are skipped.
+func (p *NegotiatePolicy) selectCompression(offered *CompressionCapabilities) *CompressionCapabilities {
+	chained := p.ChainedCompression && offered.Flags&CompressionCapabilitiesFlagChained != 0
+
+	selected := &CompressionCapabilities{}
+	if chained {
+		selected.Flags = CompressionCapabilitiesFlagChained
+	}
+	for _, preferred := range p.CompressionAlgorithms {
+		if !isCompressionSupported(preferred) || preferred == CompressionAlgorithmPatternV1 && !chained {
+			continue
+		}
+		for _, a := range offered.CompressionAlgorithms {
+			if a == preferred {
+				selected.CompressionAlgorithms = append(selected.CompressionAlgorithms, a)
+			}
+		}
+		if !chained && len(selected.CompressionAlgorithms) > 0 {
+			break
+		}
+	}
+
+	// Answer with NONE if there is no common algorithm
+	if len(selected.CompressionAlgorithms) == 0 {
+		selected.Flags = 0
+		selected.CompressionAlgorithms = []CompressionAlgorithm{CompressionAlgorithmNone}
+	}
+
+	return selected
+}
@@ -0,0 +1,222 @@
+package smb
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/yuriyvolkov/simba/pkg/vfs"
+)
+
+// allocationUnit is the cluster size allocation sizes are rounded up to
+const allocationUnit = 4096
+
+// open represents a file opened by an SMB2 create request on a tree connect
+type open struct {
+	id   FileID
+	tree *treeConnect
+
+	// fs is the storage of the share the file was opened on
+	fs   vfs.FS
+	file vfs.File
+
+	// shared is the file as seen by all opens of the server, files the table holding it
+	shared *sharedFile
+	files  *fileTable
+
+	// name is the path of the file in the storage of the share, stream the name of the opened
+	// data stream, empty for the main stream
+	name   string
+	stream string
+	isDir  bool
+
+	// access is the access granted to the open, shareAccess what it lets other opens do
+	access      AccessMask
+	shareAccess ShareAccess
+	options     CreateOptions
+
+	// deleteOnClose makes the delete of the file or stream pending once the open is closed
+	deleteOnClose bool
+}
+
+// addOpen registers an open on the tree connect and allocates its file ID. The persistent part
+// is unique across the server, the volatile part within the tree connect.
+func (t *treeConnect) addOpen(o *open, persistentIDs *uint64) {
+	t.opensMu.Lock()
+	defer t.opensMu.Unlock()
+
+	// Zero and all bits set are reserved, the latter for related requests
+	for {
+		t.nextVolatileID++
+		if t.nextVolatileID != 0 && t.nextVolatileID != ^uint64(0) {
+			break
+		}
+	}
+	for o.id.Persistent == 0 || o.id.Persistent == ^uint64(0) {
+		o.id.Persistent = atomic.AddUint64(persistentIDs, 1)
+	}
+	o.id.Volatile = t.nextVolatileID
+	o.tree = t
+	t.opens[o.id] = o
+}
+
+// lookupOpen returns the open with the given file ID, or nil if there is none
+func (t *treeConnect) lookupOpen(id FileID) *open {
+	t.opensMu.Lock()
+	defer t.opensMu.Unlock()
+
+	return t.opens[id]
+}
+
+// removeOpen unregisters an open and returns it, or nil if there is none with the given file ID
+func (t *treeConnect) removeOpen(id FileID) *open {
+	t.opensMu.Lock()
+	defer t.opensMu.Unlock()
+
+	o := t.opens[id]
+	delete(t.opens, id)
+	return o
+}
+
+// lookupOpen returns the open a request on a file refers to, with the file ID it was resolved to.
+// A related request uses the file of the previous request of the compound.
+func (c *Connection) lookupOpen(packet *Packet, id FileID) (*open, FileID, Status) {
+	s := c.lookupSession(packet.Header.SessionID)
+	if s == nil {
+		return nil, id, StatusUserSessionDeleted
+	}
+	tree := s.lookupTree(packet.Header.TreeID)
+	if tree == nil {
+		return nil, id, StatusNetworkNameDeleted
+	}
+	id = packet.resolveFileID(id)
+	o := tree.lookupOpen(id)
+	if o == nil {
+		return nil, id, StatusFileClosed
+	}
+	return o, id, StatusSuccess
+}
+
+// closeOpens closes the opens of a tree connect that was disconnected
+func (t *treeConnect) closeOpens() {
+	t.opensMu.Lock()
+	opens := t.opens
+	t.opens = make(map[FileID]*open)
+	t.opensMu.Unlock()
+
+	for _, o := range opens {
+		o.close()
+	}
+}
+
+// close closes the file of an open, the file table deletes it if the open asked for it
+func (o *open) close() error {
+	return o.files.close(o)
+}
+
+// mapGenericAccess replaces the generic rights of an access mask by the file rights they stand for
+func mapGenericAccess(access AccessMask) AccessMask {
+	if access&GenericRead != 0 {
+		access |= FileGenericRead
+	}
+	if access&GenericWrite != 0 {
+		access |= FileGenericWrite
+	}
+	if access&GenericExecute != 0 {
+		access |= FileGenericExecute
+	}
+	if access&GenericAll != 0 {
+		access |= FileAllAccess
+	}
+	return access &^ (GenericRead | GenericWrite | GenericExecute | GenericAll)
+}
+
+// sharePath converts the name of a create request into a storage path and a stream name.
+// Names use backslashes and are relative to the share, a stream is named file:stream or file:stream:$DATA.
+func sharePath(name string) (string, string, Status) {
+	if strings.HasPrefix(name, `\`) {
+		return "", "", StatusInvalidParameter
+	}
+	if strings.ContainsAny(name, "*?\"<>|/") {
+		return "", "", StatusObjectNameInvalid
+	}
+
+	// Split off the stream, only the last element may name one
+	name, stream, hasStream := strings.Cut(name, ":")
+	if hasStream {
+		var streamType string
+		var typed bool
+		stream, streamType, typed = strings.Cut(stream, ":")
+		switch {
+		case strings.Contains(stream, `\`):
+			return "", "", StatusObjectNameInvalid
+		case typed && !strings.EqualFold(streamType, "$DATA"):
+			return "", "", StatusObjectNameInvalid
+		case !typed && stream == "":
+			return "", "", StatusObjectNameInvalid
+		case stream != "" && !vfs.ValidStreamName(stream):
+			return "", "", StatusObjectNameInvalid
+		}
+	}
+
+	// The root of the share has an empty name
+	p := strings.ReplaceAll(name, `\`, "/")
+	if p == "" {
+		p = "."
+	}
+	if !vfs.ValidName(p) {
+		return "", "", StatusObjectNameInvalid
+	}
+	return p, stream, StatusSuccess
+}
+
+// createStatus returns the status of a create request that failed. A missing file is reported as such
+// if its directory exists, and as a missing path otherwise.
+func createStatus(fsys vfs.FS, name string, err error) Status {
+	if errors.Is(err, vfs.ErrNotExist) || errors.Is(err, vfs.ErrNotDir) {
+		if dir := path.Dir(name); dir != "." {
+			if info, serr := fsys.Stat(dir); serr != nil || !info.IsDir() {
+				return StatusPathNotFound
+			}
+		}
+	}
+	return vfsStatus(err)
+}
+
+// vfsStatus returns the status reporting a storage error
+func vfsStatus(err error) Status {
+	switch {
+	case err == nil:
+		return StatusSuccess
+	case errors.Is(err, vfs.ErrNotExist):
+		return StatusObjectNameNotFound
+	case errors.Is(err, vfs.ErrExist):
+		return StatusObjectNameCollision
+	case errors.Is(err, vfs.ErrPermission):
+		return StatusAccessDenied
+	case errors.Is(err, vfs.ErrIsDir):
+		return StatusFileIsADirectory
+	case errors.Is(err, vfs.ErrNotDir):
+		return StatusNotADirectory
+	case errors.Is(err, vfs.ErrNotEmpty):
+		return StatusDirectoryNotEmpty
+	case errors.Is(err, vfs.ErrInvalidName):
+		return StatusObjectNameInvalid
+	case errors.Is(err, vfs.ErrNoSpace):
+		return StatusDiskFull
+	case errors.Is(err, vfs.ErrLockConflict):
+		return StatusFileLockConflict
+	case errors.Is(err, vfs.ErrInvalidOffset):
+		return StatusInvalidParameter
+	case errors.Is(err, vfs.ErrNotSupported):
+		return StatusNotSupported
+	default:
+		return StatusUnsuccessful
+	}
+}
+
+// allocationSize returns the space a file of the given size takes, in whole clusters
+func allocationSize(size int64) uint64 {
+	return uint64((size + allocationUnit - 1) / allocationUnit * allocationUnit)
+}
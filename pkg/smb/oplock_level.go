@@ -0,0 +1,21 @@
+package smb
+
+// OplockLevel represents the opportunistic lock requested on or granted to an open
+type OplockLevel uint8
+
+const (
+	// OplockLevelNone indicates that no oplock is granted
+	OplockLevelNone OplockLevel = 0x00
+
+	// OplockLevelII indicates a shared oplock, the client may cache reads
+	OplockLevelII OplockLevel = 0x01
+
+	// OplockLevelExclusive indicates an exclusive oplock, the client may cache reads and writes
+	OplockLevelExclusive OplockLevel = 0x08
+
+	// OplockLevelBatch indicates a batch oplock, the client may also cache the handle
+	OplockLevelBatch OplockLevel = 0x09
+
+	// OplockLevelLease indicates that a lease is requested in a create context
+	OplockLevelLease OplockLevel = 0xFF
+)
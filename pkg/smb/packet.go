@@ -2,7 +2,6 @@ package smb
 
 import (
 	"errors"
-	"unsafe"
 )
 
 type Marshaller interface {
@@ -13,6 +12,38 @@ type Marshaller interface {
 type Packet struct {
 	Header Header
 	Data   Marshaller
+
+	// raw holds the message as received, header included
+	raw []byte
+
+	// compound holds the state shared with the other requests of a compounded message
+	compound *compoundState
+
+	// response holds the marshaled response once the request has been handled,
+	// it is signed with signer when the message is sent
+	response []byte
+	signer   *signer
+
+	// encrypted is the session whose keys decrypted the request, nil for a plain request.
+	// The responses to an encrypted message are encrypted with the same keys.
+	encrypted *session
+
+	// compress asks for the response to be compressed if compression was negotiated,
+	// READ sets it for the data it returns
+	compress bool
+
+	// async is set when the request went async, response then holds the interim response
+	async *asyncOperation
+}
+
+// respond records the marshaled response to the request, it is sent once all
+// requests of the message have been handled.
+// An interim response does not fail the related requests following it.
+func (p *Packet) respond(status Status, response []byte) {
+	p.response = response
+	if p.compound != nil && status != StatusPending {
+		p.compound.status = status
+	}
 }
 
 // Marshal serializes an SMB packet into a byte slice
@@ -33,17 +64,30 @@ func (p *Packet) Marshal() ([]byte, error) {
 	return append(header, data...), nil
 }
 
-// PacketParse parses an SMB packet from a byte slice
+// PacketParse parses an SMB packet from a byte slice.
+// Only the first request of a compounded message is parsed.
 func PacketParse(data []byte) (*Packet, error) {
+	// Upgrade SMB1 negotiate requests, any other SMB1 command is refused
+	if isSMB1(data) {
+		return smb1PacketParse(data)
+	}
+
 	// Parse the header
 	header, err := HeaderParse(data)
 	if err != nil {
 		return nil, err
 	}
 
+	// Cut off the following requests of a compounded message
+	if header.NextCommand != 0 {
+		if header.NextCommand < HeaderSize || int(header.NextCommand) > len(data) {
+			return nil, ErrInvalidCompound
+		}
+		data = data[:header.NextCommand]
+	}
+
 	// Get the data section of the packet
-	headerSize := unsafe.Sizeof(Header{})
-	packetData := data[headerSize:]
+	packetData := data[HeaderSize:]
 
 	// Parse the packet data
 	parsedData, err := ParseData(header.Command, packetData)
@@ -55,6 +99,7 @@ func PacketParse(data []byte) (*Packet, error) {
 	packet := &Packet{
 		Header: *header,
 		Data:   parsedData,
+		raw:    data,
 	}
 
 	return packet, nil
@@ -67,6 +112,8 @@ func ParseData(command Command, data []byte) (Marshaller, error) {
 		return NegotiateRequestParse(data)
 	case CommandSessionSetup:
 		return SessionSetupRequestParse(data)
+	case CommandLogoff:
+		return LogoffRequestParse(data)
 	case CommandTreeConnect:
 		return TreeConnectRequestParse(data)
 	case CommandTreeDisconnect:
@@ -81,14 +128,12 @@ func ParseData(command Command, data []byte) (Marshaller, error) {
 		return ReadRequestParse(data)
 	case CommandWrite:
 		return WriteRequestParse(data)
-	case CommandDelete:
-		return DeleteRequestParse(data)
-	case CommandRename:
-		return RenameRequestParse(data)
 	case CommandQueryInfo:
 		return QueryInfoRequestParse(data)
 	case CommandSetInfo:
 		return SetInfoRequestParse(data)
+	case CommandCancel:
+		return CancelRequestParse(data)
 	default:
 		return nil, errors.New("invalid command")
 	}
@@ -0,0 +1,37 @@
+package smb
+
+import (
+	"crypto/sha512"
+)
+
+// PreauthIntegrity tracks an SMB 3.1.1 preauth integrity hash: a running SHA-512 over the
+// negotiate and session setup messages exchanged so far. The final value of a session is an
+// input to its key derivation, so a tampered negotiation results in unusable keys.
+type PreauthIntegrity struct {
+	value [sha512.Size]byte
+}
+
+// NewPreauthIntegrity creates a preauth integrity hash with the initial all-zero value
+func NewPreauthIntegrity() *PreauthIntegrity {
+	return &PreauthIntegrity{}
+}
+
+// Update chains a complete SMB2 message, header included, into the hash
+func (p *PreauthIntegrity) Update(message []byte) {
+	h := sha512.New()
+	h.Write(p.value[:])
+	h.Write(message)
+	copy(p.value[:], h.Sum(nil))
+}
+
+// Fork returns an independent copy of the hash, used to start a session from the connection value
+func (p *PreauthIntegrity) Fork() *PreauthIntegrity {
+	fork := *p
+	return &fork
+}
+
+// Value returns the current hash value
+func (p *PreauthIntegrity) Value() []byte {
+	value := p.value
+	return value[:]
+}
@@ -0,0 +1,51 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// cancelRequestStructureSize is the structure size of an SMB2 cancel request
+const cancelRequestStructureSize = 4
+
+// ErrInvalidCancelRequest is returned when a cancel request is truncated or malformed
+var ErrInvalidCancelRequest = errors.New("smb: invalid cancel request")
+
+// CancelRequest represents an SMB2 cancel request, the request to cancel is given by the header
+type CancelRequest struct{}
+
+// Marshal serializes an SMB2 cancel request into a byte slice
+func (r *CancelRequest) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(cancelRequestStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the reserved field
+	if err := binary.Write(buf, binary.LittleEndian, uint16(0)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// CancelRequestParse parses an SMB2 cancel request
+func CancelRequestParse(data []byte) (*CancelRequest, error) {
+	// Create a new bytes reader
+	r := bytes.NewReader(data)
+
+	// Read the structure size
+	var structureSize uint16
+	if err := binary.Read(r, binary.LittleEndian, &structureSize); err != nil {
+		return nil, err
+	}
+	if structureSize != cancelRequestStructureSize {
+		return nil, ErrInvalidCancelRequest
+	}
+
+	return &CancelRequest{}, nil
+}
@@ -3,51 +3,214 @@ package smb
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+
+	"github.com/yuriyvolkov/simba/pkg/vfs"
 )
 
+// createRequestStructureSize is the structure size of an SMB2 create request
+const createRequestStructureSize = 57
+
+// ErrInvalidCreateRequest is returned when a create request is truncated or malformed
+var ErrInvalidCreateRequest = errors.New("smb: invalid create request")
+
+// CreateRequest represents an SMB2 create request. Name is the path of the file relative to the share,
+// with backslashes as separators, empty for the root of the share. CreateContexts holds the raw
+// create contexts.
 type CreateRequest struct {
-	WordCount          uint8
-	NameLength         uint8
-	Flags              uint32
-	RootDirectoryFID   uint32
-	DesiredAccess      uint32
-	AllocationSize     uint64
-	ExtFileAttributes  uint32
-	ShareAccess        uint32
-	CreateDisposition  uint32
-	CreateOptions      uint32
-	ImpersonationLevel uint32
-	SecurityFlags      uint8
-	ByteCount          uint16
-	FileName           string
-	CreateContextData  []byte
+	SecurityFlags        uint8
+	RequestedOplockLevel OplockLevel
+	ImpersonationLevel   ImpersonationLevel
+	SmbCreateFlags       uint64
+	DesiredAccess        AccessMask
+	FileAttributes       vfs.Attributes
+	ShareAccess          ShareAccess
+	CreateDisposition    CreateDisposition
+	CreateOptions        CreateOptions
+	Name                 string
+	CreateContexts       []byte
 }
 
+// Marshal serializes an SMB2 create request into a byte slice
+func (r *CreateRequest) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
+	name := encodeUTF16LE(r.Name)
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(createRequestStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the security flags and the requested oplock level
+	if err := binary.Write(buf, binary.LittleEndian, r.SecurityFlags); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.RequestedOplockLevel); err != nil {
+		return nil, err
+	}
+
+	// Write the impersonation level
+	if err := binary.Write(buf, binary.LittleEndian, r.ImpersonationLevel); err != nil {
+		return nil, err
+	}
+
+	// Write the create flags and the reserved field
+	if err := binary.Write(buf, binary.LittleEndian, r.SmbCreateFlags); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint64(0)); err != nil {
+		return nil, err
+	}
+
+	// Write the desired access, the file attributes and the share access
+	if err := binary.Write(buf, binary.LittleEndian, r.DesiredAccess); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.FileAttributes); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.ShareAccess); err != nil {
+		return nil, err
+	}
+
+	// Write the create disposition and options
+	if err := binary.Write(buf, binary.LittleEndian, r.CreateDisposition); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.CreateOptions); err != nil {
+		return nil, err
+	}
+
+	// Write the name offset and length, the name follows the fixed part of the request
+	if err := binary.Write(buf, binary.LittleEndian, uint16(HeaderSize+createRequestStructureSize-1)); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint16(len(name))); err != nil {
+		return nil, err
+	}
+
+	// Write the create contexts offset and length, the contexts follow the name at an 8-byte boundary
+	var contextsOffset int
+	if len(r.CreateContexts) > 0 {
+		contextsOffset = HeaderSize + createRequestStructureSize - 1 + len(name)
+		contextsOffset += padding8(contextsOffset)
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint32(contextsOffset)); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint32(len(r.CreateContexts))); err != nil {
+		return nil, err
+	}
+
+	// Write the name, the buffer holds at least one byte
+	buf.Write(name)
+	if len(name) == 0 && len(r.CreateContexts) == 0 {
+		buf.WriteByte(0)
+	}
+
+	// Write the create contexts
+	if len(r.CreateContexts) > 0 {
+		buf.Write(make([]byte, contextsOffset-HeaderSize-buf.Len()))
+		buf.Write(r.CreateContexts)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// CreateRequestParse parses an SMB2 create request
 func CreateRequestParse(data []byte) (*CreateRequest, error) {
-	// Parse the request structure from the byte slice
-	var request CreateRequest
-	err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &request)
-	if err != nil {
+	// Create a new bytes reader
+	r := bytes.NewReader(data)
+	request := &CreateRequest{}
+
+	// Read the structure size
+	var structureSize uint16
+	if err := binary.Read(r, binary.LittleEndian, &structureSize); err != nil {
 		return nil, err
 	}
+	if structureSize != createRequestStructureSize {
+		return nil, ErrInvalidCreateRequest
+	}
 
-	// Read the variable-length fields from the request
-	buf := bytes.NewReader(data[24:])
+	// Read the security flags and the requested oplock level
+	if err := binary.Read(r, binary.LittleEndian, &request.SecurityFlags); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &request.RequestedOplockLevel); err != nil {
+		return nil, err
+	}
+
+	// Read the impersonation level
+	if err := binary.Read(r, binary.LittleEndian, &request.ImpersonationLevel); err != nil {
+		return nil, err
+	}
 
-	// Read the file name
-	fileName, err := readVarString(buf, int(request.NameLength), request.Flags&uint32(FlagUnicode) != 0)
-	if err != nil {
+	// Read the create flags and skip the reserved field
+	if err := binary.Read(r, binary.LittleEndian, &request.SmbCreateFlags); err != nil {
+		return nil, err
+	}
+	var reserved uint64
+	if err := binary.Read(r, binary.LittleEndian, &reserved); err != nil {
 		return nil, err
 	}
-	request.FileName = fileName
 
-	// Read the create context data
-	createContextData, err := readVarBytes(buf)
-	if err != nil {
+	// Read the desired access, the file attributes and the share access
+	if err := binary.Read(r, binary.LittleEndian, &request.DesiredAccess); err != nil {
 		return nil, err
 	}
-	request.CreateContextData = createContextData
+	if err := binary.Read(r, binary.LittleEndian, &request.FileAttributes); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &request.ShareAccess); err != nil {
+		return nil, err
+	}
+
+	// Read the create disposition and options
+	if err := binary.Read(r, binary.LittleEndian, &request.CreateDisposition); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &request.CreateOptions); err != nil {
+		return nil, err
+	}
+
+	// Read the name offset and length
+	var nameOffset, nameLength uint16
+	if err := binary.Read(r, binary.LittleEndian, &nameOffset); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &nameLength); err != nil {
+		return nil, err
+	}
+
+	// Read the create contexts offset and length
+	var contextsOffset, contextsLength uint32
+	if err := binary.Read(r, binary.LittleEndian, &contextsOffset); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &contextsLength); err != nil {
+		return nil, err
+	}
+
+	// Read the name, the offset is counted from the start of the header
+	if nameLength > 0 {
+		start := int(nameOffset) - HeaderSize
+		end := start + int(nameLength)
+		if nameLength%2 != 0 || start < createRequestStructureSize-1 || end > len(data) {
+			return nil, ErrInvalidCreateRequest
+		}
+		request.Name = decodeUTF16LE(data[start:end])
+	}
+
+	// Read the create contexts, they start at an 8-byte boundary
+	if contextsLength > 0 {
+		start := int64(contextsOffset) - HeaderSize
+		end := start + int64(contextsLength)
+		if contextsOffset%8 != 0 || start < createRequestStructureSize-1 || end > int64(len(data)) {
+			return nil, ErrInvalidCreateRequest
+		}
+		request.CreateContexts = data[start:end]
+	}
 
-	// Return the parsed request
-	return &request, nil
+	return request, nil
 }
@@ -24,6 +24,25 @@ type FlushRequest struct {
 	CreateContextData []byte
 }
 
+func (f *FlushRequest) Marshal() ([]byte, error) {
+	// Create a byte buffer for the request
+	buf := bytes.NewBuffer([]byte{})
+
+	// Write the fixed-length fields to the buffer
+	binary.Write(buf, binary.LittleEndian, f.WordCount)
+	binary.Write(buf, binary.LittleEndian, f.FID)
+	binary.Write(buf, binary.LittleEndian, f.Reserved)
+	binary.Write(buf, binary.LittleEndian, f.Flags)
+	binary.Write(buf, binary.LittleEndian, uint8(len(f.FileName)))
+
+	// Write the variable-length fields to the buffer
+	writeVarString(buf, f.FileName)
+	writeVarBytes(buf, f.CreateContextData)
+
+	// Return the serialized request
+	return buf.Bytes(), nil
+}
+
 func FlushRequestParse(data []byte) (*FlushRequest, error) {
 	// Parse the request structure from the byte slice
 	var request FlushRequest
@@ -0,0 +1,51 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// logoffStructureSize is the structure size of an SMB2 logoff request and response
+const logoffStructureSize = 4
+
+// ErrInvalidLogoffRequest is returned when a logoff request is truncated or malformed
+var ErrInvalidLogoffRequest = errors.New("smb: invalid logoff request")
+
+// LogoffRequest represents an SMB2 logoff request, the session is given by the header
+type LogoffRequest struct{}
+
+// Marshal serializes an SMB2 logoff request into a byte slice
+func (r *LogoffRequest) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(logoffStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the reserved field
+	if err := binary.Write(buf, binary.LittleEndian, uint16(0)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// LogoffRequestParse parses an SMB2 logoff request
+func LogoffRequestParse(data []byte) (*LogoffRequest, error) {
+	// Create a new bytes reader
+	r := bytes.NewReader(data)
+
+	// Read the structure size
+	var structureSize uint16
+	if err := binary.Read(r, binary.LittleEndian, &structureSize); err != nil {
+		return nil, err
+	}
+	if structureSize != logoffStructureSize {
+		return nil, ErrInvalidLogoffRequest
+	}
+
+	return &LogoffRequest{}, nil
+}
@@ -3,19 +3,95 @@ package smb
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 )
 
-// NegotiateRequest represents an SMB negotiate request
+// negotiateRequestStructureSize is the structure size of an SMB2 negotiate request
+const negotiateRequestStructureSize = 36
+
+// ErrInvalidNegotiateRequest is returned when a negotiate request is malformed
+var ErrInvalidNegotiateRequest = errors.New("smb: invalid negotiate request")
+
+// NegotiateRequest represents an SMB2 negotiate request.
+// NegotiateContexts is only present if the client offers the SMB 3.1.1 dialect.
 type NegotiateRequest struct {
-	Dialects Dialects
+	SecurityMode      SecurityMode
+	Capabilities      Capability
+	ClientGUID        [16]byte
+	Dialects          Dialects
+	NegotiateContexts *NegotiateContexts
+}
+
+// hasDialect reports whether the client offers the dialect
+func (r *NegotiateRequest) hasDialect(dialect Dialect) bool {
+	for _, d := range r.Dialects {
+		if d == dialect {
+			return true
+		}
+	}
+	return false
 }
 
 func (r *NegotiateRequest) Marshal() ([]byte, error) {
 	// Create a new bytes buffer
 	var b bytes.Buffer
 
-	// Write the word count
-	if err := binary.Write(&b, binary.LittleEndian, uint8(len(r.Dialects))); err != nil {
+	// Serialize the negotiate context list
+	var contexts []byte
+	var contextCount uint16
+	if r.NegotiateContexts != nil {
+		var err error
+		if contexts, err = r.NegotiateContexts.Marshal(); err != nil {
+			return nil, err
+		}
+		contextCount = uint16(r.NegotiateContexts.count())
+	}
+
+	// The context list follows the dialects at an 8-byte boundary
+	dialectsEnd := HeaderSize + negotiateRequestStructureSize + 2*len(r.Dialects)
+	var contextOffset uint32
+	if contextCount > 0 {
+		contextOffset = uint32(dialectsEnd + padding8(dialectsEnd))
+	}
+
+	// Write the structure size
+	if err := binary.Write(&b, binary.LittleEndian, uint16(negotiateRequestStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the dialect count
+	if err := binary.Write(&b, binary.LittleEndian, uint16(len(r.Dialects))); err != nil {
+		return nil, err
+	}
+
+	// Write the security mode
+	if err := binary.Write(&b, binary.LittleEndian, r.SecurityMode); err != nil {
+		return nil, err
+	}
+
+	// Write the reserved field
+	if err := binary.Write(&b, binary.LittleEndian, uint16(0)); err != nil {
+		return nil, err
+	}
+
+	// Write the capabilities
+	if err := binary.Write(&b, binary.LittleEndian, r.Capabilities); err != nil {
+		return nil, err
+	}
+
+	// Write the client GUID
+	if err := binary.Write(&b, binary.LittleEndian, r.ClientGUID); err != nil {
+		return nil, err
+	}
+
+	// Write the negotiate context offset, count and the reserved field
+	if err := binary.Write(&b, binary.LittleEndian, contextOffset); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&b, binary.LittleEndian, contextCount); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&b, binary.LittleEndian, uint16(0)); err != nil {
 		return nil, err
 	}
 
@@ -24,30 +100,91 @@ func (r *NegotiateRequest) Marshal() ([]byte, error) {
 		return nil, err
 	}
 
+	// Write the padding and the negotiate context list
+	if contextCount > 0 {
+		b.Write(make([]byte, padding8(dialectsEnd)))
+		b.Write(contexts)
+	}
+
 	// Return the marshaled data
 	return b.Bytes(), nil
 }
 
-// NegotiateRequestParse parses an SMB negotiate request
+// NegotiateRequestParse parses an SMB2 negotiate request
 func NegotiateRequestParse(data []byte) (*NegotiateRequest, error) {
 	// Create a new bytes reader
 	r := bytes.NewReader(data)
 
-	// Read the word count
-	var wordCount uint8
-	if err := binary.Read(r, binary.LittleEndian, &wordCount); err != nil {
+	// Read the structure size
+	var structureSize uint16
+	if err := binary.Read(r, binary.LittleEndian, &structureSize); err != nil {
+		return nil, err
+	}
+	if structureSize != negotiateRequestStructureSize {
+		return nil, ErrInvalidNegotiateRequest
+	}
+
+	// Read the dialect count
+	var dialectCount uint16
+	if err := binary.Read(r, binary.LittleEndian, &dialectCount); err != nil {
+		return nil, err
+	}
+	if dialectCount == 0 {
+		return nil, ErrInvalidNegotiateRequest
+	}
+
+	// Read the security mode
+	request := &NegotiateRequest{}
+	if err := binary.Read(r, binary.LittleEndian, &request.SecurityMode); err != nil {
+		return nil, err
+	}
+
+	// Skip the reserved field
+	var reserved uint16
+	if err := binary.Read(r, binary.LittleEndian, &reserved); err != nil {
+		return nil, err
+	}
+
+	// Read the capabilities
+	if err := binary.Read(r, binary.LittleEndian, &request.Capabilities); err != nil {
+		return nil, err
+	}
+
+	// Read the client GUID
+	if err := binary.Read(r, binary.LittleEndian, &request.ClientGUID); err != nil {
+		return nil, err
+	}
+
+	// Read the negotiate context offset and count, for older dialects this is the client start time
+	var contextOffset uint32
+	if err := binary.Read(r, binary.LittleEndian, &contextOffset); err != nil {
+		return nil, err
+	}
+	var contextCount uint16
+	if err := binary.Read(r, binary.LittleEndian, &contextCount); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &reserved); err != nil {
 		return nil, err
 	}
 
 	// Read the dialects
-	dialects := make([]Dialect, wordCount)
-	if err := binary.Read(r, binary.LittleEndian, &dialects); err != nil {
+	request.Dialects = make(Dialects, dialectCount)
+	if err := binary.Read(r, binary.LittleEndian, request.Dialects); err != nil {
 		return nil, err
 	}
 
-	// Create the request
-	request := &NegotiateRequest{
-		Dialects: dialects,
+	// Read the negotiate context list, offsets are relative to the start of the SMB2 header
+	if request.hasDialect(DialectSMB311) && contextCount > 0 {
+		start := int(contextOffset) - HeaderSize
+		if start < negotiateRequestStructureSize || start > len(data) {
+			return nil, ErrInvalidNegotiateRequest
+		}
+		contexts, err := NegotiateContextsParse(data[start:], int(contextCount))
+		if err != nil {
+			return nil, err
+		}
+		request.NegotiateContexts = contexts
 	}
 
 	return request, nil
@@ -25,6 +25,25 @@ type QueryInfoRequest struct {
 	QueryContextData []byte
 }
 
+func (q *QueryInfoRequest) Marshal() ([]byte, error) {
+	// Create a byte buffer for the request
+	buf := bytes.NewBuffer([]byte{})
+
+	// Write the fixed-length fields to the buffer
+	binary.Write(buf, binary.LittleEndian, q.WordCount)
+	binary.Write(buf, binary.LittleEndian, q.InformationLevel)
+	binary.Write(buf, binary.LittleEndian, q.Reserved)
+	binary.Write(buf, binary.LittleEndian, uint8(len(q.FileName)))
+	binary.Write(buf, binary.LittleEndian, q.Flags)
+
+	// Write the variable-length fields to the buffer
+	writeVarString(buf, q.FileName)
+	writeVarBytes(buf, q.QueryContextData)
+
+	// Return the serialized request
+	return buf.Bytes(), nil
+}
+
 func QueryInfoRequestParse(data []byte) (*QueryInfoRequest, error) {
 	// Parse the request structure from the byte slice
 	var request QueryInfoRequest
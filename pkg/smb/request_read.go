@@ -3,63 +3,172 @@ package smb
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 )
 
-// ReadRequest structure represents a request to read data from a file in the Server Message Block (SMB) protocol.
-// It has the following fields:
-
-//     WordCount: an 8-bit integer indicating the number of 16-bit words in the request.
-//     FID: a 16-bit integer identifying the file to read from.
-//     Offset: a 64-bit integer specifying the offset in the file to read from.
-//     MaxCount: a 16-bit integer indicating the maximum number of bytes to read from the file.
-//     MinCount: a 16-bit integer indicating the minimum number of bytes to read from the file.
-//     Remaining: a 32-bit integer indicating the number of bytes remaining to be read from the file.
-//     HighOffset: a 32-bit integer specifying the high 32 bits of the file offset.
-//     Reserved: a 32-bit integer reserved for future use.
-//     Flags: a 16-bit integer containing flags that modify the request.
-//     NameLength: an 8-bit integer indicating the length of the FileName field in bytes.
-//     FileName: a variable-length string containing the name of the file to read from.
-//     ReadContextData: a variable-length byte slice containing additional data for the request.
+// readRequestStructureSize is the structure size of an SMB2 read request
+const readRequestStructureSize = 49
+
+const (
+	// ReadFlagReadUnbuffered asks for the data to be read without going through the server cache
+	ReadFlagReadUnbuffered uint8 = 0x01
+
+	// ReadFlagRequestCompressed asks for the response to be compressed, SMB 3.1.1 only
+	ReadFlagRequestCompressed uint8 = 0x02
+)
+
+// ErrInvalidReadRequest is returned when a read request is truncated or malformed
+var ErrInvalidReadRequest = errors.New("smb: invalid read request")
+
+// ReadRequest represents an SMB2 read request. Length bytes are read at Offset, the read fails
+// with STATUS_END_OF_FILE if fewer than MinimumCount bytes are available. Channel and the channel
+// information are only used with RDMA.
 type ReadRequest struct {
-	WordCount       uint8
-	FID             uint16
+	Padding         uint8
+	Flags           uint8
+	Length          uint32
 	Offset          uint64
-	MaxCount        uint16
-	MinCount        uint16
-	Remaining       uint32
-	HighOffset      uint32
-	Reserved        uint32
-	Flags           uint16
-	NameLength      uint8
-	FileName        string
-	ReadContextData []byte
+	FileID          FileID
+	MinimumCount    uint32
+	Channel         uint32
+	RemainingBytes  uint32
+	ReadChannelInfo []byte
 }
 
+// Marshal serializes an SMB2 read request into a byte slice
+func (r *ReadRequest) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := bytes.NewBuffer(make([]byte, 0, readRequestStructureSize+len(r.ReadChannelInfo)))
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(readRequestStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the padding and the flags
+	if err := binary.Write(buf, binary.LittleEndian, r.Padding); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.Flags); err != nil {
+		return nil, err
+	}
+
+	// Write the length and the offset
+	if err := binary.Write(buf, binary.LittleEndian, r.Length); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.Offset); err != nil {
+		return nil, err
+	}
+
+	// Write the file ID
+	if err := binary.Write(buf, binary.LittleEndian, r.FileID.Persistent); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.FileID.Volatile); err != nil {
+		return nil, err
+	}
+
+	// Write the minimum count, the channel and the remaining bytes
+	if err := binary.Write(buf, binary.LittleEndian, r.MinimumCount); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.Channel); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.RemainingBytes); err != nil {
+		return nil, err
+	}
+
+	// Write the channel information offset and length, the information follows the fixed part of the request
+	var infoOffset uint16
+	if len(r.ReadChannelInfo) > 0 {
+		infoOffset = HeaderSize + readRequestStructureSize - 1
+	}
+	if err := binary.Write(buf, binary.LittleEndian, infoOffset); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint16(len(r.ReadChannelInfo))); err != nil {
+		return nil, err
+	}
+
+	// Write the channel information, the buffer holds at least one byte
+	buf.Write(r.ReadChannelInfo)
+	if len(r.ReadChannelInfo) == 0 {
+		buf.WriteByte(0)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ReadRequestParse parses an SMB2 read request
 func ReadRequestParse(data []byte) (*ReadRequest, error) {
-	// Parse the request structure from the byte slice
-	var request ReadRequest
-	err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &request)
-	if err != nil {
+	// Create a new bytes reader
+	r := bytes.NewReader(data)
+	request := &ReadRequest{}
+
+	// Read the structure size
+	var structureSize uint16
+	if err := binary.Read(r, binary.LittleEndian, &structureSize); err != nil {
+		return nil, err
+	}
+	if structureSize != readRequestStructureSize {
+		return nil, ErrInvalidReadRequest
+	}
+
+	// Read the padding and the flags
+	if err := binary.Read(r, binary.LittleEndian, &request.Padding); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &request.Flags); err != nil {
+		return nil, err
+	}
+
+	// Read the length and the offset
+	if err := binary.Read(r, binary.LittleEndian, &request.Length); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &request.Offset); err != nil {
 		return nil, err
 	}
 
-	// Read the variable-length fields from the request
-	buf := bytes.NewReader(data[17:])
+	// Read the file ID
+	if err := binary.Read(r, binary.LittleEndian, &request.FileID.Persistent); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &request.FileID.Volatile); err != nil {
+		return nil, err
+	}
 
-	// Read the file name
-	fileName, err := readVarString(buf, int(request.NameLength), request.Flags&FlagUnicode != 0)
-	if err != nil {
+	// Read the minimum count, the channel and the remaining bytes
+	if err := binary.Read(r, binary.LittleEndian, &request.MinimumCount); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &request.Channel); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &request.RemainingBytes); err != nil {
 		return nil, err
 	}
-	request.FileName = fileName
 
-	// Read the read context data
-	readContextData, err := readVarBytes(buf)
-	if err != nil {
+	// Read the channel information offset and length
+	var infoOffset, infoLength uint16
+	if err := binary.Read(r, binary.LittleEndian, &infoOffset); err != nil {
 		return nil, err
 	}
-	request.ReadContextData = readContextData
+	if err := binary.Read(r, binary.LittleEndian, &infoLength); err != nil {
+		return nil, err
+	}
+
+	// Read the channel information, the offset is counted from the start of the header
+	if infoLength > 0 {
+		start := int(infoOffset) - HeaderSize
+		end := start + int(infoLength)
+		if start < readRequestStructureSize-1 || end > len(data) {
+			return nil, ErrInvalidReadRequest
+		}
+		request.ReadChannelInfo = data[start:end]
+	}
 
-	// Return the parsed request
-	return &request, nil
+	return request, nil
 }
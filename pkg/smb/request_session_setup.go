@@ -3,77 +3,141 @@ package smb
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 )
 
-// SessionSetupRequest represents an SMB session setup request
-// The WordCount field specifies the number of words in the request, where a word is a 16-bit field.
-// The AndXCommand field is used to chain multiple SMB commands together into a single request.
-// The AndXReserved field is reserved for future use and should be set to zero.
-// The AndXOffset field specifies the offset, in bytes, from the start of the SMB header to the next SMB command in the chain.
-// The MaxBufferSize field specifies the maximum size, in bytes, of the buffer that the client can use for the request.
-// The MaxMpxCount field specifies the maximum number of pending multiplexed requests that the client can have.
-// The VCNumber field specifies the virtual circuit (VC) number that the client is using for the request.
-// The SessionKey field is a 32-bit value that is used to identify the session.
-// The SecurityBlobLen field specifies the length, in bytes, of the security blob.
-// The Reserved field is reserved for future use and should be set to zero.
-// The Capabilities field specifies the capabilities of the client, such as support for Unicode strings and large files.
-// The SecurityBlob field contains the security blob, which is used to authenticate the client.
+// sessionSetupRequestStructureSize is the structure size of an SMB2 session setup request
+const sessionSetupRequestStructureSize = 25
+
+// SessionSetupFlagBinding asks to bind an existing session to a new connection
+const SessionSetupFlagBinding uint8 = 0x01
+
+// ErrInvalidSessionSetupRequest is returned when a session setup request is truncated or malformed
+var ErrInvalidSessionSetupRequest = errors.New("smb: invalid session setup request")
+
+// SessionSetupRequest represents an SMB2 session setup request.
+// SecurityBuffer holds the SPNEGO token of the current authentication leg.
 type SessionSetupRequest struct {
-	WordCount       uint8
-	AndXCommand     Command
-	AndXReserved    uint8
-	AndXOffset      uint16
-	MaxBufferSize   uint16
-	MaxMpxCount     uint16
-	VCNumber        uint16
-	SessionKey      uint32
-	SecurityBlobLen uint16
-	Reserved        uint16
-	Capabilities    uint32
-	SecurityBlob    []byte
+	Flags             uint8
+	SecurityMode      uint8
+	Capabilities      Capability
+	Channel           uint32
+	PreviousSessionID uint64
+	SecurityBuffer    []byte
 }
 
-// SessionSetupRequestParse parses an SMB session setup request
+// Marshal serializes an SMB2 session setup request into a byte slice
+func (r *SessionSetupRequest) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(sessionSetupRequestStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the flags and the security mode
+	if err := binary.Write(buf, binary.LittleEndian, r.Flags); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.SecurityMode); err != nil {
+		return nil, err
+	}
+
+	// Write the capabilities and the channel
+	if err := binary.Write(buf, binary.LittleEndian, r.Capabilities); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.Channel); err != nil {
+		return nil, err
+	}
+
+	// Write the security buffer offset and length, the buffer directly follows the fixed part
+	if err := binary.Write(buf, binary.LittleEndian, uint16(HeaderSize+sessionSetupRequestStructureSize-1)); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint16(len(r.SecurityBuffer))); err != nil {
+		return nil, err
+	}
+
+	// Write the previous session ID
+	if err := binary.Write(buf, binary.LittleEndian, r.PreviousSessionID); err != nil {
+		return nil, err
+	}
+
+	// Write the security buffer
+	buf.Write(r.SecurityBuffer)
+
+	return buf.Bytes(), nil
+}
+
+// SessionSetupRequestParse parses an SMB2 session setup request
 func SessionSetupRequestParse(data []byte) (*SessionSetupRequest, error) {
 	// Create a new bytes reader
 	r := bytes.NewReader(data)
 
-	// Read the word count
-	var wordCount uint8
-	if err := binary.Read(r, binary.LittleEndian, &wordCount); err != nil {
+	// Read the structure size
+	var structureSize uint16
+	if err := binary.Read(r, binary.LittleEndian, &structureSize); err != nil {
 		return nil, err
 	}
+	if structureSize != sessionSetupRequestStructureSize {
+		return nil, ErrInvalidSessionSetupRequest
+	}
 
-	// Read the data block size
-	var dataBlockSize uint16
-	if err := binary.Read(r, binary.LittleEndian, &dataBlockSize); err != nil {
+	// Read the flags and the security mode
+	var flags, securityMode uint8
+	if err := binary.Read(r, binary.LittleEndian, &flags); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &securityMode); err != nil {
 		return nil, err
 	}
 
-	// Read the data block
-	dataBlock := make([]byte, dataBlockSize)
-	if err := binary.Read(r, binary.LittleEndian, dataBlock); err != nil {
+	// Read the capabilities and the channel
+	var capabilities Capability
+	if err := binary.Read(r, binary.LittleEndian, &capabilities); err != nil {
+		return nil, err
+	}
+	var channel uint32
+	if err := binary.Read(r, binary.LittleEndian, &channel); err != nil {
 		return nil, err
 	}
 
-	// Read the byte count
-	var byteCount uint16
-	if err := binary.Read(r, binary.LittleEndian, &byteCount); err != nil {
+	// Read the security buffer offset and length
+	var securityBufferOffset, securityBufferLength uint16
+	if err := binary.Read(r, binary.LittleEndian, &securityBufferOffset); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &securityBufferLength); err != nil {
 		return nil, err
 	}
 
-	// Read the padding
-	padding := make([]byte, byteCount)
-	if err := binary.Read(r, binary.LittleEndian, padding); err != nil {
+	// Read the previous session ID
+	var previousSessionID uint64
+	if err := binary.Read(r, binary.LittleEndian, &previousSessionID); err != nil {
 		return nil, err
 	}
 
-	// FIXME Create the request
+	// Read the security buffer, its offset is relative to the start of the header
+	var securityBuffer []byte
+	if securityBufferLength > 0 {
+		start := int(securityBufferOffset) - HeaderSize
+		end := start + int(securityBufferLength)
+		if start < sessionSetupRequestStructureSize-1 || end > len(data) {
+			return nil, ErrInvalidSessionSetupRequest
+		}
+		securityBuffer = data[start:end]
+	}
+
+	// Create the request
 	request := &SessionSetupRequest{
-		// DataBlockSize: dataBlockSize,
-		// DataBlock:     dataBlock,
-		// ByteCount:     byteCount,
-		// Padding:       padding,
+		Flags:             flags,
+		SecurityMode:      securityMode,
+		Capabilities:      capabilities,
+		Channel:           channel,
+		PreviousSessionID: previousSessionID,
+		SecurityBuffer:    securityBuffer,
 	}
 
 	return request, nil
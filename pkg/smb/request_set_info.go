@@ -25,6 +25,25 @@ type SetInfoRequest struct {
 	SetContextData   []byte
 }
 
+func (s *SetInfoRequest) Marshal() ([]byte, error) {
+	// Create a byte buffer for the request
+	buf := bytes.NewBuffer([]byte{})
+
+	// Write the fixed-length fields to the buffer
+	binary.Write(buf, binary.LittleEndian, s.WordCount)
+	binary.Write(buf, binary.LittleEndian, s.InformationLevel)
+	binary.Write(buf, binary.LittleEndian, s.Reserved)
+	binary.Write(buf, binary.LittleEndian, uint8(len(s.FileName)))
+	binary.Write(buf, binary.LittleEndian, s.Flags)
+
+	// Write the variable-length fields to the buffer
+	writeVarString(buf, s.FileName)
+	writeVarBytes(buf, s.SetContextData)
+
+	// Return the serialized request
+	return buf.Bytes(), nil
+}
+
 func SetInfoRequestParse(data []byte) (*SetInfoRequest, error) {
 	// Parse the request structure from the byte slice
 	var request SetInfoRequest
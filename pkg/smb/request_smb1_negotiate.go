@@ -0,0 +1,161 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ProtocolIDSMB1 is the protocol identifier of SMB1 packets
+var ProtocolIDSMB1 = [4]byte{0xFF, 'S', 'M', 'B'}
+
+// smb1HeaderSize is the size of an SMB1 packet header in bytes
+const smb1HeaderSize = 32
+
+// smb1CommandNegotiate is the SMB_COM_NEGOTIATE command code
+const smb1CommandNegotiate = 0x72
+
+// smb1DialectBufferFormat precedes each dialect string in an SMB1 negotiate request
+const smb1DialectBufferFormat = 0x02
+
+// Dialect strings that SMB2 capable clients add to their SMB1 negotiate request
+const (
+	// smb1DialectSMB202 announces support for the SMB 2.0.2 dialect only
+	smb1DialectSMB202 = "SMB 2.002"
+
+	// smb1DialectSMB2Wildcard announces support for SMB 2.1 and later dialects
+	smb1DialectSMB2Wildcard = "SMB 2.???"
+)
+
+// ErrSMB1NotSupported is returned for SMB1 packets other than a negotiate request that can be upgraded to SMB2
+var ErrSMB1NotSupported = errors.New("smb: SMB1 is not supported")
+
+// SMB1NegotiateRequest represents an SMB1 negotiate request.
+// It is only accepted to upgrade the connection to SMB2.
+type SMB1NegotiateRequest struct {
+	Dialects []string
+}
+
+// Marshal serializes an SMB1 negotiate request into a byte slice
+func (r *SMB1NegotiateRequest) Marshal() ([]byte, error) {
+	// Serialize the dialect strings
+	var dialects bytes.Buffer
+	for _, d := range r.Dialects {
+		dialects.WriteByte(smb1DialectBufferFormat)
+		dialects.WriteString(d)
+		dialects.WriteByte(0)
+	}
+
+	// Create a new bytes buffer
+	var b bytes.Buffer
+
+	// Write the word count
+	if err := binary.Write(&b, binary.LittleEndian, uint8(0)); err != nil {
+		return nil, err
+	}
+
+	// Write the byte count
+	if err := binary.Write(&b, binary.LittleEndian, uint16(dialects.Len())); err != nil {
+		return nil, err
+	}
+
+	// Write the dialects
+	b.Write(dialects.Bytes())
+
+	return b.Bytes(), nil
+}
+
+// upgradeDialect returns the SMB2 dialect to answer the request with,
+// or DialectUnknown if the client does not support SMB2
+func (r *SMB1NegotiateRequest) upgradeDialect() Dialect {
+	dialect := DialectUnknown
+	for _, d := range r.Dialects {
+		switch d {
+		case smb1DialectSMB2Wildcard:
+			return DialectSMB2Wildcard
+		case smb1DialectSMB202:
+			dialect = DialectSMB202
+		}
+	}
+	return dialect
+}
+
+// SMB1NegotiateRequestParse parses the parameters and data of an SMB1 negotiate request
+func SMB1NegotiateRequestParse(data []byte) (*SMB1NegotiateRequest, error) {
+	// Create a new bytes reader
+	r := bytes.NewReader(data)
+
+	// Read the word count, a negotiate request has no parameter words
+	var wordCount uint8
+	if err := binary.Read(r, binary.LittleEndian, &wordCount); err != nil {
+		return nil, err
+	}
+	if wordCount != 0 {
+		return nil, ErrSMB1NotSupported
+	}
+
+	// Read the byte count
+	var byteCount uint16
+	if err := binary.Read(r, binary.LittleEndian, &byteCount); err != nil {
+		return nil, err
+	}
+
+	// Read the dialect buffer
+	buf := make([]byte, byteCount)
+	if err := binary.Read(r, binary.LittleEndian, buf); err != nil {
+		return nil, err
+	}
+
+	// Split the buffer into null-terminated dialect strings
+	request := &SMB1NegotiateRequest{}
+	for len(buf) > 0 {
+		if buf[0] != smb1DialectBufferFormat {
+			return nil, ErrSMB1NotSupported
+		}
+		end := bytes.IndexByte(buf, 0)
+		if end < 0 {
+			return nil, ErrSMB1NotSupported
+		}
+		request.Dialects = append(request.Dialects, string(buf[1:end]))
+		buf = buf[end+1:]
+	}
+
+	return request, nil
+}
+
+// isSMB1 reports whether the message starts with the SMB1 protocol identifier
+func isSMB1(data []byte) bool {
+	return len(data) >= len(ProtocolIDSMB1) && bytes.Equal(data[:len(ProtocolIDSMB1)], ProtocolIDSMB1[:])
+}
+
+// smb1PacketParse parses an SMB1 negotiate request into a packet with an SMB2
+// negotiate header, so it can be answered by the SMB2 negotiate handler
+func smb1PacketParse(data []byte) (*Packet, error) {
+	// Make sure the whole header is present
+	if len(data) < smb1HeaderSize {
+		return nil, ErrInvalidHeader
+	}
+
+	// Refuse everything but the negotiate request
+	if data[4] != smb1CommandNegotiate {
+		return nil, ErrSMB1NotSupported
+	}
+
+	// Parse the dialect strings
+	request, err := SMB1NegotiateRequestParse(data[smb1HeaderSize:])
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the packet, the response is sent with message ID zero
+	packet := &Packet{
+		Header: Header{
+			ProtocolID:    ProtocolIDSMB2,
+			StructureSize: HeaderSize,
+			Command:       CommandNegotiate,
+		},
+		Data: request,
+	}
+
+	return packet, nil
+}
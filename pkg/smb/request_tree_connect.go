@@ -3,30 +3,76 @@ package smb
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 )
 
-// TreeConnectRequest represents an SMB tree connect request
-// The TreeConnectRequest struct has three fields:
+// treeConnectRequestStructureSize is the structure size of an SMB2 tree connect request
+const treeConnectRequestStructureSize = 9
 
-//     Path: The path of the share to connect to.
-//     Password: The password for the share, if any.
-//     Service: The service associated with the share.
+const (
+	// TreeConnectFlagClusterReconnect indicates that the client reconnects to a cluster after a failover
+	TreeConnectFlagClusterReconnect uint16 = 0x0001
+
+	// TreeConnectFlagRedirectToOwner indicates that the client supports redirection to the owner of the share
+	TreeConnectFlagRedirectToOwner uint16 = 0x0002
+
+	// TreeConnectFlagExtensionPresent indicates that a tree connect request extension precedes the path
+	TreeConnectFlagExtensionPresent uint16 = 0x0004
+)
+
+// ErrInvalidTreeConnectRequest is returned when a tree connect request is truncated or malformed
+var ErrInvalidTreeConnectRequest = errors.New("smb: invalid tree connect request")
+
+// TreeConnectRequest represents an SMB2 tree connect request. Path is the UNC path of
+// the share, \\server\share.
 type TreeConnectRequest struct {
-	Path     string
-	Password string
-	Service  string
+	Flags uint16
+	Path  string
 }
 
-// TreeConnectRequestParse parses an SMB tree connect request
+// Marshal serializes an SMB2 tree connect request into a byte slice
+func (r *TreeConnectRequest) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
+	path := encodeUTF16LE(r.Path)
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(treeConnectRequestStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the flags
+	if err := binary.Write(buf, binary.LittleEndian, r.Flags); err != nil {
+		return nil, err
+	}
+
+	// Write the path offset and length, the path follows the fixed part of the request
+	if err := binary.Write(buf, binary.LittleEndian, uint16(HeaderSize+treeConnectRequestStructureSize-1)); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint16(len(path))); err != nil {
+		return nil, err
+	}
+
+	// Write the path
+	buf.Write(path)
+
+	return buf.Bytes(), nil
+}
+
+// TreeConnectRequestParse parses an SMB2 tree connect request
 func TreeConnectRequestParse(data []byte) (*TreeConnectRequest, error) {
 	// Create a new bytes reader
 	r := bytes.NewReader(data)
 
-	// Read the word count
-	var wordCount uint8
-	if err := binary.Read(r, binary.LittleEndian, &wordCount); err != nil {
+	// Read the structure size
+	var structureSize uint16
+	if err := binary.Read(r, binary.LittleEndian, &structureSize); err != nil {
 		return nil, err
 	}
+	if structureSize != treeConnectRequestStructureSize {
+		return nil, ErrInvalidTreeConnectRequest
+	}
 
 	// Read the flags
 	var flags uint16
@@ -34,29 +80,27 @@ func TreeConnectRequestParse(data []byte) (*TreeConnectRequest, error) {
 		return nil, err
 	}
 
-	// Read the path
-	path, err := readSMBString(r, flags&FlagUnicode != 0)
-	if err != nil {
+	// Read the path offset and length
+	var pathOffset, pathLength uint16
+	if err := binary.Read(r, binary.LittleEndian, &pathOffset); err != nil {
 		return nil, err
 	}
-
-	// Read the password
-	password, err := readSMBString(r, flags&FlagUnicode != 0)
-	if err != nil {
+	if err := binary.Read(r, binary.LittleEndian, &pathLength); err != nil {
 		return nil, err
 	}
 
-	// Read the service
-	service, err := readSMBString(r, flags&FlagUnicode != 0)
-	if err != nil {
-		return nil, err
+	// Read the path, the offset is counted from the start of the header. With an extension
+	// the path is inside the extension, the offset still points at it.
+	start := int(pathOffset) - HeaderSize
+	end := start + int(pathLength)
+	if pathLength == 0 || pathLength%2 != 0 || start < treeConnectRequestStructureSize-1 || end > len(data) {
+		return nil, ErrInvalidTreeConnectRequest
 	}
 
 	// Create the request
 	request := &TreeConnectRequest{
-		Path:     path,
-		Password: password,
-		Service:  service,
+		Flags: flags,
+		Path:  decodeUTF16LE(data[start:end]),
 	}
 
 	return request, nil
@@ -3,21 +3,49 @@ package smb
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 )
 
-type TreeDisconnectRequest struct {
-	WordCount uint8
-	ByteCount uint16
+// treeDisconnectStructureSize is the structure size of an SMB2 tree disconnect request and response
+const treeDisconnectStructureSize = 4
+
+// ErrInvalidTreeDisconnectRequest is returned when a tree disconnect request is truncated or malformed
+var ErrInvalidTreeDisconnectRequest = errors.New("smb: invalid tree disconnect request")
+
+// TreeDisconnectRequest represents an SMB2 tree disconnect request, the tree is given by the header
+type TreeDisconnectRequest struct{}
+
+// Marshal serializes an SMB2 tree disconnect request into a byte slice
+func (r *TreeDisconnectRequest) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(treeDisconnectStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the reserved field
+	if err := binary.Write(buf, binary.LittleEndian, uint16(0)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
 }
 
+// TreeDisconnectRequestParse parses an SMB2 tree disconnect request
 func TreeDisconnectRequestParse(data []byte) (*TreeDisconnectRequest, error) {
-	// Parse the request structure from the byte slice
-	var request TreeDisconnectRequest
-	err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &request)
-	if err != nil {
+	// Create a new bytes reader
+	r := bytes.NewReader(data)
+
+	// Read the structure size
+	var structureSize uint16
+	if err := binary.Read(r, binary.LittleEndian, &structureSize); err != nil {
 		return nil, err
 	}
+	if structureSize != treeDisconnectStructureSize {
+		return nil, ErrInvalidTreeDisconnectRequest
+	}
 
-	// Return the parsed request
-	return &request, nil
+	return &TreeDisconnectRequest{}, nil
 }
@@ -3,71 +3,180 @@ package smb
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 )
 
-// This structure represents a request to write data to a file in the Server Message Block (SMB) protocol.
-// It has the following fields:
-// 	WordCount: an 8-bit integer indicating the number of 16-bit words in the request.
-// 	FID: a 16-bit integer identifying the file to write to.
-// 	Offset: a 64-bit integer specifying the offset in the file to write to.
-// 	Remaining: a 32-bit integer indicating the number of bytes remaining to be written to the file.
-// 	DataLength: a 16-bit integer indicating the length of the DataToWrite field in bytes.
-// 	DataOffset: a 16-bit integer specifying the offset in the packet where the DataToWrite field begins.
-// 	HighOffset: a 32-bit integer specifying the high 32 bits of the file offset.
-// 	Reserved: a 32-bit integer reserved for future use.
-// 	Flags: a 16-bit integer containing flags that modify the request.
-// 	NameLength: an 8-bit integer indicating the length of the FileName field in bytes.
-// 	FileName: a variable-length string containing the name of the file to write to.
-// 	WriteContextData: a variable-length byte slice containing additional data for the request.
-// 	DataToWrite: a variable-length byte slice containing the data to write to the file.
+// writeRequestStructureSize is the structure size of an SMB2 write request
+const writeRequestStructureSize = 49
+
+const (
+	// WriteFlagWriteThrough asks for the data to reach stable storage before the write completes
+	WriteFlagWriteThrough uint32 = 0x00000001
+
+	// WriteFlagWriteUnbuffered asks for the data to be written without going through the server cache
+	WriteFlagWriteUnbuffered uint32 = 0x00000002
+)
+
+// ErrInvalidWriteRequest is returned when a write request is truncated or malformed
+var ErrInvalidWriteRequest = errors.New("smb: invalid write request")
+
+// WriteRequest represents an SMB2 write request. Data is written at Offset, an offset with all bits
+// set appends to the file. Channel and the channel information are only used with RDMA.
 type WriteRequest struct {
-	WordCount        uint8
-	FID              uint16
 	Offset           uint64
-	Remaining        uint32
-	DataLength       uint16
-	DataOffset       uint16
-	HighOffset       uint32
-	Reserved         uint32
-	Flags            uint16
-	NameLength       uint8
-	FileName         string
-	WriteContextData []byte
-	DataToWrite      []byte
+	FileID           FileID
+	Channel          uint32
+	RemainingBytes   uint32
+	WriteChannelInfo []byte
+	Flags            uint32
+	Data             []byte
+}
+
+// Marshal serializes an SMB2 write request into a byte slice
+func (r *WriteRequest) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := bytes.NewBuffer(make([]byte, 0, writeRequestStructureSize+len(r.Data)+len(r.WriteChannelInfo)))
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(writeRequestStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the data offset and length, the data follows the fixed part of the request
+	if err := binary.Write(buf, binary.LittleEndian, uint16(HeaderSize+writeRequestStructureSize-1)); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint32(len(r.Data))); err != nil {
+		return nil, err
+	}
+
+	// Write the offset
+	if err := binary.Write(buf, binary.LittleEndian, r.Offset); err != nil {
+		return nil, err
+	}
+
+	// Write the file ID
+	if err := binary.Write(buf, binary.LittleEndian, r.FileID.Persistent); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.FileID.Volatile); err != nil {
+		return nil, err
+	}
+
+	// Write the channel and the remaining bytes
+	if err := binary.Write(buf, binary.LittleEndian, r.Channel); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.RemainingBytes); err != nil {
+		return nil, err
+	}
+
+	// Write the channel information offset and length, the information follows the data
+	var infoOffset uint16
+	if len(r.WriteChannelInfo) > 0 {
+		infoOffset = uint16(HeaderSize + writeRequestStructureSize - 1 + len(r.Data))
+	}
+	if err := binary.Write(buf, binary.LittleEndian, infoOffset); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint16(len(r.WriteChannelInfo))); err != nil {
+		return nil, err
+	}
+
+	// Write the flags
+	if err := binary.Write(buf, binary.LittleEndian, r.Flags); err != nil {
+		return nil, err
+	}
+
+	// Write the data and the channel information, the buffer holds at least one byte
+	buf.Write(r.Data)
+	buf.Write(r.WriteChannelInfo)
+	if len(r.Data) == 0 && len(r.WriteChannelInfo) == 0 {
+		buf.WriteByte(0)
+	}
+
+	return buf.Bytes(), nil
 }
 
+// WriteRequestParse parses an SMB2 write request
 func WriteRequestParse(data []byte) (*WriteRequest, error) {
-	// Parse the request structure from the byte slice
-	var request WriteRequest
-	err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &request)
-	if err != nil {
+	// Create a new bytes reader
+	r := bytes.NewReader(data)
+	request := &WriteRequest{}
+
+	// Read the structure size
+	var structureSize uint16
+	if err := binary.Read(r, binary.LittleEndian, &structureSize); err != nil {
 		return nil, err
 	}
+	if structureSize != writeRequestStructureSize {
+		return nil, ErrInvalidWriteRequest
+	}
 
-	// Read the variable-length fields from the request
-	buf := bytes.NewReader(data[18:])
+	// Read the data offset and length
+	var dataOffset uint16
+	var dataLength uint32
+	if err := binary.Read(r, binary.LittleEndian, &dataOffset); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &dataLength); err != nil {
+		return nil, err
+	}
 
-	// Read the file name
-	fileName, err := readVarString(buf, int(request.NameLength), request.Flags&FlagUnicode != 0)
-	if err != nil {
+	// Read the offset
+	if err := binary.Read(r, binary.LittleEndian, &request.Offset); err != nil {
 		return nil, err
 	}
-	request.FileName = fileName
 
-	// Read the write context data
-	writeContextData, err := readVarBytes(buf)
-	if err != nil {
+	// Read the file ID
+	if err := binary.Read(r, binary.LittleEndian, &request.FileID.Persistent); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &request.FileID.Volatile); err != nil {
+		return nil, err
+	}
+
+	// Read the channel and the remaining bytes
+	if err := binary.Read(r, binary.LittleEndian, &request.Channel); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &request.RemainingBytes); err != nil {
 		return nil, err
 	}
-	request.WriteContextData = writeContextData
 
-	// Read the data to write
-	dataToWrite, err := readVarBytes(buf)
-	if err != nil {
+	// Read the channel information offset and length
+	var infoOffset, infoLength uint16
+	if err := binary.Read(r, binary.LittleEndian, &infoOffset); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &infoLength); err != nil {
 		return nil, err
 	}
-	request.DataToWrite = dataToWrite
 
-	// Return the parsed request
-	return &request, nil
+	// Read the flags
+	if err := binary.Read(r, binary.LittleEndian, &request.Flags); err != nil {
+		return nil, err
+	}
+
+	// Read the data, the offset is counted from the start of the header
+	if dataLength > 0 {
+		start := int64(dataOffset) - HeaderSize
+		end := start + int64(dataLength)
+		if start < writeRequestStructureSize-1 || end > int64(len(data)) {
+			return nil, ErrInvalidWriteRequest
+		}
+		request.Data = data[start:end]
+	}
+
+	// Read the channel information
+	if infoLength > 0 {
+		start := int(infoOffset) - HeaderSize
+		end := start + int(infoLength)
+		if start < writeRequestStructureSize-1 || end > len(data) {
+			return nil, ErrInvalidWriteRequest
+		}
+		request.WriteChannelInfo = data[start:end]
+	}
+
+	return request, nil
 }
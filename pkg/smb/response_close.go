@@ -0,0 +1,66 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"github.com/yuriyvolkov/simba/pkg/vfs"
+)
+
+// closeResponseStructureSize is the structure size of an SMB2 close response
+const closeResponseStructureSize = 60
+
+// CloseResponse represents an SMB2 close response. The attributes are only set when the request
+// carried CloseFlagPostQueryAttrib, Flags echoes it then.
+type CloseResponse struct {
+	Flags          uint16
+	CreationTime   time.Time
+	LastAccessTime time.Time
+	LastWriteTime  time.Time
+	ChangeTime     time.Time
+	AllocationSize uint64
+	EndOfFile      uint64
+	FileAttributes vfs.Attributes
+}
+
+// Marshal serializes an SMB2 close response into a byte slice
+func (r *CloseResponse) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := bytes.NewBuffer(make([]byte, 0, closeResponseStructureSize))
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(closeResponseStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the flags and the reserved field
+	if err := binary.Write(buf, binary.LittleEndian, r.Flags); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint32(0)); err != nil {
+		return nil, err
+	}
+
+	// Write the timestamps
+	for _, t := range []time.Time{r.CreationTime, r.LastAccessTime, r.LastWriteTime, r.ChangeTime} {
+		if err := binary.Write(buf, binary.LittleEndian, timeToFiletime(t)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Write the allocation size and the end of file
+	if err := binary.Write(buf, binary.LittleEndian, r.AllocationSize); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.EndOfFile); err != nil {
+		return nil, err
+	}
+
+	// Write the file attributes
+	if err := binary.Write(buf, binary.LittleEndian, r.FileAttributes); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,107 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"github.com/yuriyvolkov/simba/pkg/vfs"
+)
+
+// createResponseStructureSize is the structure size of an SMB2 create response
+const createResponseStructureSize = 89
+
+// CreateResponseFlagReparsePoint indicates that the opened file is a reparse point
+const CreateResponseFlagReparsePoint uint8 = 0x01
+
+// CreateResponse represents an SMB2 create response. CreateContexts holds the raw create contexts
+// returned to the client.
+type CreateResponse struct {
+	OplockLevel    OplockLevel
+	Flags          uint8
+	CreateAction   CreateAction
+	CreationTime   time.Time
+	LastAccessTime time.Time
+	LastWriteTime  time.Time
+	ChangeTime     time.Time
+	AllocationSize uint64
+	EndOfFile      uint64
+	FileAttributes vfs.Attributes
+	FileID         FileID
+	CreateContexts []byte
+}
+
+// Marshal serializes an SMB2 create response into a byte slice
+func (r *CreateResponse) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := bytes.NewBuffer(make([]byte, 0, createResponseStructureSize+len(r.CreateContexts)))
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(createResponseStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the oplock level and the flags
+	if err := binary.Write(buf, binary.LittleEndian, r.OplockLevel); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.Flags); err != nil {
+		return nil, err
+	}
+
+	// Write the create action
+	if err := binary.Write(buf, binary.LittleEndian, r.CreateAction); err != nil {
+		return nil, err
+	}
+
+	// Write the timestamps
+	for _, t := range []time.Time{r.CreationTime, r.LastAccessTime, r.LastWriteTime, r.ChangeTime} {
+		if err := binary.Write(buf, binary.LittleEndian, timeToFiletime(t)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Write the allocation size and the end of file
+	if err := binary.Write(buf, binary.LittleEndian, r.AllocationSize); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.EndOfFile); err != nil {
+		return nil, err
+	}
+
+	// Write the file attributes and the reserved field
+	if err := binary.Write(buf, binary.LittleEndian, r.FileAttributes); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint32(0)); err != nil {
+		return nil, err
+	}
+
+	// Write the file ID
+	if err := binary.Write(buf, binary.LittleEndian, r.FileID.Persistent); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.FileID.Volatile); err != nil {
+		return nil, err
+	}
+
+	// Write the create contexts offset and length, the contexts follow the fixed part of the response
+	var contextsOffset uint32
+	if len(r.CreateContexts) > 0 {
+		contextsOffset = HeaderSize + createResponseStructureSize - 1
+	}
+	if err := binary.Write(buf, binary.LittleEndian, contextsOffset); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint32(len(r.CreateContexts))); err != nil {
+		return nil, err
+	}
+
+	// Write the create contexts, the buffer holds at least one byte
+	buf.Write(r.CreateContexts)
+	if len(r.CreateContexts) == 0 {
+		buf.WriteByte(0)
+	}
+
+	return buf.Bytes(), nil
+}
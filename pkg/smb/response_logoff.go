@@ -0,0 +1,27 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// LogoffResponse represents an SMB2 logoff response
+type LogoffResponse struct{}
+
+// Marshal serializes an SMB2 logoff response into a byte slice
+func (r *LogoffResponse) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(logoffStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the reserved field
+	if err := binary.Write(buf, binary.LittleEndian, uint16(0)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
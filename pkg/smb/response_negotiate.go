@@ -6,33 +6,50 @@ import (
 	"time"
 )
 
-// NegotiateResponse represents an SMB negotiate response
+// negotiateResponseStructureSize is the structure size of an SMB2 negotiate response
+const negotiateResponseStructureSize = 65
+
+// NegotiateResponse represents an SMB2 negotiate response.
+// NegotiateContexts is only sent for the SMB 3.1.1 dialect.
 type NegotiateResponse struct {
-	Dialect             Dialect
-	SecurityMode        SecurityMode
-	MaxBufferSize       uint32
-	MaxMpxCount         uint16
-	Capabilities        Capability
-	SystemTime          time.Time
-	ServerTimeZone      int16
-	Challenge           [8]byte
-	DomainName          string
-	ServerName          string
-	EncryptionKeyLength uint16
+	SecurityMode      SecurityMode
+	Dialect           Dialect
+	ServerGUID        [16]byte
+	Capabilities      Capability
+	MaxTransactSize   uint32
+	MaxReadSize       uint32
+	MaxWriteSize      uint32
+	SystemTime        time.Time
+	ServerStartTime   time.Time
+	SecurityBuffer    []byte
+	NegotiateContexts *NegotiateContexts
 }
 
-// Marshal serializes an SMB negotiate response into a byte slice
+// Marshal serializes an SMB2 negotiate response into a byte slice
 func (r *NegotiateResponse) Marshal() ([]byte, error) {
 	// Create a new bytes buffer
 	buf := new(bytes.Buffer)
 
-	// Write the word count
-	if err := binary.Write(buf, binary.LittleEndian, uint8(17)); err != nil {
-		return nil, err
+	// Serialize the negotiate context list
+	var contexts []byte
+	var contextCount uint16
+	if r.NegotiateContexts != nil {
+		var err error
+		if contexts, err = r.NegotiateContexts.Marshal(); err != nil {
+			return nil, err
+		}
+		contextCount = uint16(r.NegotiateContexts.count())
 	}
 
-	// Write the dialect
-	if err := binary.Write(buf, binary.LittleEndian, r.Dialect); err != nil {
+	// The context list follows the security buffer at an 8-byte boundary
+	securityBufferEnd := HeaderSize + negotiateResponseStructureSize - 1 + len(r.SecurityBuffer)
+	var contextOffset uint32
+	if contextCount > 0 {
+		contextOffset = uint32(securityBufferEnd + padding8(securityBufferEnd))
+	}
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(negotiateResponseStructureSize)); err != nil {
 		return nil, err
 	}
 
@@ -41,13 +58,18 @@ func (r *NegotiateResponse) Marshal() ([]byte, error) {
 		return nil, err
 	}
 
-	// Write the maximum buffer size
-	if err := binary.Write(buf, binary.LittleEndian, r.MaxBufferSize); err != nil {
+	// Write the dialect
+	if err := binary.Write(buf, binary.LittleEndian, r.Dialect); err != nil {
 		return nil, err
 	}
 
-	// Write the maximum multiplex count
-	if err := binary.Write(buf, binary.LittleEndian, r.MaxMpxCount); err != nil {
+	// Write the negotiate context count
+	if err := binary.Write(buf, binary.LittleEndian, contextCount); err != nil {
+		return nil, err
+	}
+
+	// Write the server GUID
+	if err := binary.Write(buf, binary.LittleEndian, r.ServerGUID); err != nil {
 		return nil, err
 	}
 
@@ -56,26 +78,52 @@ func (r *NegotiateResponse) Marshal() ([]byte, error) {
 		return nil, err
 	}
 
+	// Write the maximum transact, read and write sizes
+	if err := binary.Write(buf, binary.LittleEndian, r.MaxTransactSize); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.MaxReadSize); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.MaxWriteSize); err != nil {
+		return nil, err
+	}
+
 	// Write the system time
-	if err := binary.Write(buf, binary.LittleEndian, uint64(time.Date(
-		r.SystemTime.Year(),
-		r.SystemTime.Month(),
-		r.SystemTime.Day(),
-		r.SystemTime.Hour(),
-		r.SystemTime.Minute(),
-		r.SystemTime.Second(),
-		0,
-		time.UTC,
-	).Unix())); err != nil {
+	if err := binary.Write(buf, binary.LittleEndian, timeToFiletime(r.SystemTime)); err != nil {
+		return nil, err
+	}
+
+	// Write the server start time
+	if err := binary.Write(buf, binary.LittleEndian, timeToFiletime(r.ServerStartTime)); err != nil {
+		return nil, err
+	}
+
+	// Write the security buffer offset and length, the buffer directly follows the fixed part
+	var securityBufferOffset uint16
+	if len(r.SecurityBuffer) > 0 {
+		securityBufferOffset = HeaderSize + negotiateResponseStructureSize - 1
+	}
+	if err := binary.Write(buf, binary.LittleEndian, securityBufferOffset); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint16(len(r.SecurityBuffer))); err != nil {
 		return nil, err
 	}
 
-	// Write the server time zone
-	if err := binary.Write(buf, binary.LittleEndian, r.ServerTimeZone); err != nil {
+	// Write the negotiate context offset
+	if err := binary.Write(buf, binary.LittleEndian, contextOffset); err != nil {
 		return nil, err
 	}
 
-	// FIXME add missing Writes
+	// Write the security buffer
+	buf.Write(r.SecurityBuffer)
+
+	// Write the padding and the negotiate context list
+	if contextCount > 0 {
+		buf.Write(make([]byte, padding8(securityBufferEnd)))
+		buf.Write(contexts)
+	}
 
 	return buf.Bytes(), nil
 }
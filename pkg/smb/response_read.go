@@ -0,0 +1,55 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// readResponseStructureSize is the structure size of an SMB2 read response
+const readResponseStructureSize = 17
+
+// ReadResponse represents an SMB2 read response, Data holds the bytes read
+type ReadResponse struct {
+	DataRemaining uint32
+	Data          []byte
+}
+
+// Marshal serializes an SMB2 read response into a byte slice
+func (r *ReadResponse) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := bytes.NewBuffer(make([]byte, 0, readResponseStructureSize+len(r.Data)))
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(readResponseStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the data offset and the reserved field, the data follows the fixed part of the response
+	if err := binary.Write(buf, binary.LittleEndian, uint8(HeaderSize+readResponseStructureSize-1)); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint8(0)); err != nil {
+		return nil, err
+	}
+
+	// Write the data length and the data remaining
+	if err := binary.Write(buf, binary.LittleEndian, uint32(len(r.Data))); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.DataRemaining); err != nil {
+		return nil, err
+	}
+
+	// Write the flags, reserved for SMB2
+	if err := binary.Write(buf, binary.LittleEndian, uint32(0)); err != nil {
+		return nil, err
+	}
+
+	// Write the data, the buffer holds at least one byte
+	buf.Write(r.Data)
+	if len(r.Data) == 0 {
+		buf.WriteByte(0)
+	}
+
+	return buf.Bytes(), nil
+}
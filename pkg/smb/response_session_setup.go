@@ -0,0 +1,49 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// sessionSetupResponseStructureSize is the structure size of an SMB2 session setup response
+const sessionSetupResponseStructureSize = 9
+
+// SessionSetupResponse represents an SMB2 session setup response.
+// SecurityBuffer holds the SPNEGO token answering the current authentication leg.
+type SessionSetupResponse struct {
+	SessionFlags   SessionFlag
+	SecurityBuffer []byte
+}
+
+// Marshal serializes an SMB2 session setup response into a byte slice
+func (r *SessionSetupResponse) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(sessionSetupResponseStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the session flags
+	if err := binary.Write(buf, binary.LittleEndian, r.SessionFlags); err != nil {
+		return nil, err
+	}
+
+	// Write the security buffer offset and length, the buffer directly follows the fixed part
+	var securityBufferOffset uint16
+	if len(r.SecurityBuffer) > 0 {
+		securityBufferOffset = HeaderSize + sessionSetupResponseStructureSize - 1
+	}
+	if err := binary.Write(buf, binary.LittleEndian, securityBufferOffset); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint16(len(r.SecurityBuffer))); err != nil {
+		return nil, err
+	}
+
+	// Write the security buffer
+	buf.Write(r.SecurityBuffer)
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,55 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// treeConnectResponseStructureSize is the structure size of an SMB2 tree connect response
+const treeConnectResponseStructureSize = 16
+
+// TreeConnectResponse represents an SMB2 tree connect response, the tree ID is returned in the header
+type TreeConnectResponse struct {
+	ShareType     ShareType
+	ShareFlags    ShareFlag
+	Capabilities  ShareCapability
+	MaximalAccess AccessMask
+}
+
+// Marshal serializes an SMB2 tree connect response into a byte slice
+func (r *TreeConnectResponse) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := bytes.NewBuffer(make([]byte, 0, treeConnectResponseStructureSize))
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(treeConnectResponseStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the share type
+	if err := binary.Write(buf, binary.LittleEndian, r.ShareType); err != nil {
+		return nil, err
+	}
+
+	// Write the reserved field
+	if err := binary.Write(buf, binary.LittleEndian, uint8(0)); err != nil {
+		return nil, err
+	}
+
+	// Write the share flags
+	if err := binary.Write(buf, binary.LittleEndian, r.ShareFlags); err != nil {
+		return nil, err
+	}
+
+	// Write the capabilities
+	if err := binary.Write(buf, binary.LittleEndian, r.Capabilities); err != nil {
+		return nil, err
+	}
+
+	// Write the maximal access
+	if err := binary.Write(buf, binary.LittleEndian, r.MaximalAccess); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,27 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// TreeDisconnectResponse represents an SMB2 tree disconnect response
+type TreeDisconnectResponse struct{}
+
+// Marshal serializes an SMB2 tree disconnect response into a byte slice
+func (r *TreeDisconnectResponse) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := new(bytes.Buffer)
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(treeDisconnectStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the reserved field
+	if err := binary.Write(buf, binary.LittleEndian, uint16(0)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,52 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// writeResponseStructureSize is the structure size of an SMB2 write response
+const writeResponseStructureSize = 17
+
+// WriteResponse represents an SMB2 write response, Count is the number of bytes written
+type WriteResponse struct {
+	Count     uint32
+	Remaining uint32
+}
+
+// Marshal serializes an SMB2 write response into a byte slice
+func (r *WriteResponse) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := bytes.NewBuffer(make([]byte, 0, writeResponseStructureSize))
+
+	// Write the structure size
+	if err := binary.Write(buf, binary.LittleEndian, uint16(writeResponseStructureSize)); err != nil {
+		return nil, err
+	}
+
+	// Write the reserved field
+	if err := binary.Write(buf, binary.LittleEndian, uint16(0)); err != nil {
+		return nil, err
+	}
+
+	// Write the count and the remaining bytes
+	if err := binary.Write(buf, binary.LittleEndian, r.Count); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, r.Remaining); err != nil {
+		return nil, err
+	}
+
+	// Write the channel information offset and length, unused
+	if err := binary.Write(buf, binary.LittleEndian, uint16(0)); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint16(0)); err != nil {
+		return nil, err
+	}
+
+	// Write the buffer, it holds at least one byte
+	buf.WriteByte(0)
+
+	return buf.Bytes(), nil
+}
@@ -1,18 +1,12 @@
 package smb
 
-// SecurityMode represents the security mode of an SMB packet
-type SecurityMode uint8
+// SecurityMode represents the security mode of an SMB2 negotiate exchange
+type SecurityMode uint16
 
 const (
-	// SecurityModeUserLevel indicates user-level security
-	SecurityModeUserLevel SecurityMode = 0x01
-
-	// SecurityModeEncryptPasswords indicates encrypted password support
-	SecurityModeEncryptPasswords SecurityMode = 0x02
-
 	// SecurityModeSignaturesEnabled indicates signature support
-	SecurityModeSignaturesEnabled SecurityMode = 0x04
+	SecurityModeSignaturesEnabled SecurityMode = 0x0001
 
-	// SecurityModeSignaturesRequired indicates signature support
-	SecurityModeSignaturesRequired SecurityMode = 0x08
+	// SecurityModeSignaturesRequired indicates that signatures are required
+	SecurityModeSignaturesRequired SecurityMode = 0x0002
 )
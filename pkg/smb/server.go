@@ -0,0 +1,518 @@
+package smb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuriyvolkov/simba/pkg/krb5"
+	"github.com/yuriyvolkov/simba/pkg/vfs"
+)
+
+// defaultAddr is the address ListenAndServe listens on when none is given
+const defaultAddr = ":445"
+
+// defaultDomain is the NetBIOS domain announced to clients when none is given
+const defaultDomain = "WORKGROUP"
+
+// ErrServerClosed is returned by Serve and ListenAndServe once Shutdown has been called
+var ErrServerClosed = errors.New("smb: server closed")
+
+// Share represents a directory exported to clients under a share name
+type Share struct {
+	Name string
+	Path string
+
+	// FS is the storage of the share, every file of the share is reached through it. Pipe shares have none.
+	FS vfs.FS
+
+	// Type is the type of the share, disk for exported directories and pipe for IPC$
+	Type ShareType
+
+	// GuestOK lets guest and anonymous sessions connect to the share
+	GuestOK bool
+
+	// GuestReadOnly restricts guest and anonymous sessions to reading
+	GuestReadOnly bool
+
+	// EncryptData refuses unencrypted access to the share
+	EncryptData bool
+
+	// ReadOnly restricts every session to reading
+	ReadOnly bool
+
+	// ValidUsers lists the users allowed to connect, groups are given as @group. An empty list allows everybody.
+	ValidUsers []string
+}
+
+// ShareOption configures a Share
+type ShareOption func(*Share)
+
+// GuestAccess lets guest and anonymous sessions connect to the share, read-only if readOnly is set
+func GuestAccess(readOnly bool) ShareOption {
+	return func(sh *Share) {
+		sh.GuestOK = true
+		sh.GuestReadOnly = readOnly
+	}
+}
+
+// RequireEncryption refuses unencrypted access to the share
+func RequireEncryption() ShareOption {
+	return func(sh *Share) {
+		sh.EncryptData = true
+	}
+}
+
+// ReadOnly restricts every session to reading the share
+func ReadOnly() ShareOption {
+	return func(sh *Share) {
+		sh.ReadOnly = true
+	}
+}
+
+// ValidUsers only lets the given users connect to the share, a name starting with @ names a group
+func ValidUsers(names ...string) ShareOption {
+	return func(sh *Share) {
+		sh.ValidUsers = append(sh.ValidUsers, names...)
+	}
+}
+
+// admits reports whether a session may connect to the share
+func (sh *Share) admits(s *session) bool {
+	if !sh.GuestOK && s.isGuest() {
+		return false
+	}
+	if len(sh.ValidUsers) == 0 {
+		return true
+	}
+	_, user, groups, _ := s.identity()
+	for _, name := range sh.ValidUsers {
+		if group := strings.TrimPrefix(name, "@"); group != name {
+			for _, g := range groups {
+				if strings.EqualFold(g, group) {
+					return true
+				}
+			}
+		} else if strings.EqualFold(name, user) {
+			return true
+		}
+	}
+	return false
+}
+
+// readOnlyFor reports whether a session may only read the share
+func (sh *Share) readOnlyFor(s *session) bool {
+	return sh.ReadOnly || sh.GuestReadOnly && s.isGuest()
+}
+
+// maximalAccess returns the most access a session may be granted on the share
+func (sh *Share) maximalAccess(s *session) AccessMask {
+	if sh.readOnlyFor(s) {
+		return FileGenericRead | FileGenericExecute
+	}
+	return FileAllAccess
+}
+
+// flags returns the share flags announced to a client connecting to the share
+func (sh *Share) flags() ShareFlag {
+	flags := ShareFlagManualCaching
+	if sh.EncryptData {
+		flags |= ShareFlagEncryptData
+	}
+	return flags
+}
+
+// capabilities returns the share capabilities announced to a client connecting to the share.
+// The server has no DFS namespace, no continuously available opens and no cluster, so a share has none of them.
+func (sh *Share) capabilities() ShareCapability {
+	return 0
+}
+
+// Server serves SMB clients.
+// A Server is created with NewServer and configured with options, it must not be copied.
+type Server struct {
+	// persistentIDs allocates the persistent parts of file IDs. It is accessed atomically
+	// and comes first to be 64-bit aligned.
+	persistentIDs uint64
+
+	// guid identifies the server to clients, startTime is reported in the negotiate response
+	guid      [16]byte
+	startTime time.Time
+
+	// shares holds the exported shares
+	shares *shareRegistry
+
+	// authenticator looks up the credentials of users, no user can log in without one
+	authenticator Authenticator
+
+	// guestAccount is the account guests are logged in as, guest logons are refused if empty.
+	// mapToGuest selects the failed logons turned into guest logons.
+	guestAccount string
+	mapToGuest   MapToGuest
+
+	// nullSessions allows anonymous logons
+	nullSessions bool
+
+	// signingRequired makes every authenticated session sign its messages
+	signingRequired bool
+
+	// encryptData makes every authenticated session encrypt its messages, sessions that cannot are refused
+	encryptData bool
+
+	// acceptor validates Kerberos tickets, Kerberos is only offered when a keytab is configured
+	acceptor *krb5.Acceptor
+
+	// computerName and domain are the NetBIOS names announced to clients during authentication
+	computerName string
+	domain       string
+
+	// logger receives connection errors
+	logger *log.Logger
+
+	// limits, negotiatePolicy and creditPolicy are applied to every connection
+	limits          ConnectionLimits
+	negotiatePolicy NegotiatePolicy
+	creditPolicy    CreditPolicy
+
+	// sessions holds the sessions of all connections, keyed by session ID
+	sessions *sessionTable
+
+	// files holds the files opened by all sessions, it enforces their share modes
+	files *fileTable
+
+	// listeners and conns track what Shutdown has to stop
+	mu           sync.Mutex
+	listeners    map[net.Listener]struct{}
+	conns        map[*Connection]struct{}
+	shuttingDown bool
+
+	// connWG counts the connections being served
+	connWG sync.WaitGroup
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithShare exports the directory at path under the share name
+func WithShare(name string, path string, opts ...ShareOption) Option {
+	return func(s *Server) {
+		share := &Share{Name: name, Path: path, FS: vfs.NewOSFS(path), Type: ShareTypeDisk}
+		for _, opt := range opts {
+			opt(share)
+		}
+		s.shares.add(share)
+	}
+}
+
+// WithShareFS exports the storage fsys under the share name
+func WithShareFS(name string, fsys vfs.FS, opts ...ShareOption) Option {
+	return func(s *Server) {
+		share := &Share{Name: name, FS: fsys, Type: ShareTypeDisk}
+		for _, opt := range opts {
+			opt(share)
+		}
+		s.shares.add(share)
+	}
+}
+
+// WithAuthenticator sets the authenticator used to log users in
+func WithAuthenticator(a Authenticator) Option {
+	return func(s *Server) {
+		s.authenticator = a
+	}
+}
+
+// WithGuestAccount enables guest logons as the account with the given name.
+// Clients logging in with that name are guests whatever their password.
+func WithGuestAccount(name string) Option {
+	return func(s *Server) {
+		s.guestAccount = name
+	}
+}
+
+// WithMapToGuest selects the failed logons turned into guest logons, none by default.
+// It has no effect unless a guest account is set.
+func WithMapToGuest(m MapToGuest) Option {
+	return func(s *Server) {
+		s.mapToGuest = m
+	}
+}
+
+// WithNullSessions allows anonymous logons, which are refused by default
+func WithNullSessions(allow bool) Option {
+	return func(s *Server) {
+		s.nullSessions = allow
+	}
+}
+
+// WithSigningRequired sets whether sessions must sign their messages, which is the default.
+// Without it, messages are only signed when the client requires it or signs its requests.
+func WithSigningRequired(required bool) Option {
+	return func(s *Server) {
+		s.signingRequired = required
+	}
+}
+
+// WithEncryptionRequired sets whether sessions must encrypt their messages, unencrypted requests are
+// then refused with STATUS_ACCESS_DENIED. Encryption requires SMB 3 and is not required by default.
+func WithEncryptionRequired(required bool) Option {
+	return func(s *Server) {
+		s.encryptData = required
+	}
+}
+
+// WithKeytab enables Kerberos authentication with the service keys of the keytab
+func WithKeytab(kt *krb5.Keytab) Option {
+	return func(s *Server) {
+		s.acceptor = krb5.NewAcceptor(kt)
+	}
+}
+
+// WithComputerName sets the NetBIOS name of the server, the host name by default
+func WithComputerName(name string) Option {
+	return func(s *Server) {
+		s.computerName = strings.ToUpper(name)
+	}
+}
+
+// WithDomain sets the NetBIOS domain or workgroup name of the server, WORKGROUP by default
+func WithDomain(name string) Option {
+	return func(s *Server) {
+		s.domain = strings.ToUpper(name)
+	}
+}
+
+// WithLogger sets the logger receiving connection errors, a nil logger discards them
+func WithLogger(l *log.Logger) Option {
+	return func(s *Server) {
+		if l == nil {
+			l = log.New(io.Discard, "", 0)
+		}
+		s.logger = l
+	}
+}
+
+// WithLimits sets the resource limits of every connection
+func WithLimits(limits ConnectionLimits) Option {
+	return func(s *Server) {
+		s.limits = limits
+	}
+}
+
+// WithNegotiatePolicy sets the algorithms offered to SMB 3.1.1 clients
+func WithNegotiatePolicy(policy NegotiatePolicy) Option {
+	return func(s *Server) {
+		s.negotiatePolicy = policy
+	}
+}
+
+// WithCreditPolicy sets how many credits clients are granted
+func WithCreditPolicy(policy CreditPolicy) Option {
+	return func(s *Server) {
+		s.creditPolicy = policy
+	}
+}
+
+// NewServer creates a server with the given options
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		guid:            newGUID(),
+		startTime:       time.Now(),
+		shares:          newShareRegistry(),
+		computerName:    defaultComputerName(),
+		domain:          defaultDomain,
+		signingRequired: true,
+		logger:          log.Default(),
+		limits:          DefaultConnectionLimits,
+		negotiatePolicy: DefaultNegotiatePolicy,
+		creditPolicy:    DefaultCreditPolicy,
+		listeners:       make(map[net.Listener]struct{}),
+		conns:           make(map[*Connection]struct{}),
+		sessions:        newSessionTable(),
+		files:           newFileTable(),
+	}
+
+	// Apply the options
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// securityMode returns the security mode announced in the negotiate response
+func (s *Server) securityMode() SecurityMode {
+	if s.signingRequired {
+		return SecurityModeSignaturesEnabled | SecurityModeSignaturesRequired
+	}
+	return SecurityModeSignaturesEnabled
+}
+
+// defaultComputerName returns the NetBIOS name derived from the host name
+func defaultComputerName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "SIMBA"
+	}
+	name, _, _ := strings.Cut(hostname, ".")
+	return strings.ToUpper(name)
+}
+
+// ListenAndServe listens on the TCP address addr, ":445" if empty, and serves the accepted connections
+func (s *Server) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = defaultAddr
+	}
+
+	// Listen for incoming connections
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on the listener and serves each of them in a new goroutine.
+// It always returns a non-nil error and closes the listener, ErrServerClosed after Shutdown.
+// Temporary accept errors are retried after a growing delay, any other accept error is returned.
+func (s *Server) Serve(ln net.Listener) error {
+	// Track the listener, so Shutdown can close it
+	if !s.trackListener(ln, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(ln, false)
+	defer ln.Close()
+
+	// delay is the pause after a temporary accept error, it doubles up to a second while the errors go on
+	var delay time.Duration
+	for {
+		// Accept incoming connections
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isShuttingDown() {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if !errors.As(err, &ne) || !ne.Temporary() {
+				return err
+			}
+
+			// Back off on temporary errors such as running out of file descriptors
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay *= 2; delay > time.Second {
+				delay = time.Second
+			}
+			s.logger.Printf("accept error: %v; retrying in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		// Handle the connection in a new goroutine
+		c := newConnection(s, conn)
+		if !s.trackConn(c, true) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(c)
+	}
+}
+
+// Shutdown stops the server gracefully. It closes the listeners, stops reading new requests,
+// waits for the requests in progress to be answered and then closes the connections.
+// If ctx expires first, the remaining connections are closed at once and the context error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shuttingDown = true
+
+	// Stop accepting connections
+	for ln := range s.listeners {
+		ln.Close()
+	}
+
+	// Stop reading requests
+	for c := range s.conns {
+		c.drain()
+	}
+	s.mu.Unlock()
+
+	// Wait for the connections to finish
+	done := make(chan struct{})
+	go func() {
+		s.connWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		// Close the remaining connections
+		s.mu.Lock()
+		for c := range s.conns {
+			c.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// serveConn serves a connection until the client disconnects or the server shuts down
+func (s *Server) serveConn(c *Connection) {
+	defer s.trackConn(c, false)
+
+	if err := c.Serve(); err != nil && !errors.Is(err, io.EOF) &&
+		!errors.Is(err, os.ErrDeadlineExceeded) && !errors.Is(err, net.ErrClosed) {
+		s.logger.Printf("%s: %v", c.RemoteAddr(), err)
+	}
+}
+
+// trackListener adds or removes a listener, adding fails once the server is shutting down
+func (s *Server) trackListener(ln net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !add {
+		delete(s.listeners, ln)
+		return true
+	}
+	if s.shuttingDown {
+		return false
+	}
+	s.listeners[ln] = struct{}{}
+	return true
+}
+
+// trackConn adds or removes a connection, adding fails once the server is shutting down
+func (s *Server) trackConn(c *Connection, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !add {
+		delete(s.conns, c)
+		s.connWG.Done()
+		return true
+	}
+	if s.shuttingDown {
+		return false
+	}
+	s.conns[c] = struct{}{}
+	s.connWG.Add(1)
+	return true
+}
+
+// isShuttingDown reports whether Shutdown has been called
+func (s *Server) isShuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.shuttingDown
+}
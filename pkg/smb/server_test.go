@@ -0,0 +1,75 @@
+package smb
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// temporaryError is an accept error that goes away by itself
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "too many open files" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+// failingListener is a listener whose Accept returns its errors in turn
+type failingListener struct {
+	errs []error
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	err := l.errs[0]
+	if len(l.errs) > 1 {
+		l.errs = l.errs[1:]
+	}
+	return nil, err
+}
+
+func (l *failingListener) Close() error   { return nil }
+func (l *failingListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+func TestServeAcceptErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		errs    []error
+		want    error
+		retries int
+		delay   time.Duration
+	}{
+		{
+			name:    "temporary errors",
+			errs:    []error{temporaryError{}, temporaryError{}, temporaryError{}, net.ErrClosed},
+			want:    net.ErrClosed,
+			retries: 3,
+			delay:   (5 + 10 + 20) * time.Millisecond,
+		},
+		{
+			name: "permanent error",
+			errs: []error{errors.New("listener broken")},
+			want: errors.New("listener broken"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			s := NewServer(WithLogger(log.New(&logs, "", 0)))
+
+			start := time.Now()
+			err := s.Serve(&failingListener{errs: tt.errs})
+			if err == nil || err.Error() != tt.want.Error() {
+				t.Errorf("Serve error = %v, want %v", err, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed < tt.delay {
+				t.Errorf("Serve returned after %v, want at least %v of back off", elapsed, tt.delay)
+			}
+			if retries := strings.Count(logs.String(), "retrying"); retries != tt.retries {
+				t.Errorf("logged %d retries, want %d", retries, tt.retries)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package smb
+
+import (
+	"sync"
+	"time"
+)
+
+// sessionState represents the authentication state of a session
+type sessionState int
+
+const (
+	// sessionInProgress is a session whose session setup has not completed
+	sessionInProgress sessionState = iota
+
+	// sessionValid is an authenticated session
+	sessionValid
+
+	// sessionExpired is a session whose Kerberos ticket has expired, it must be reauthenticated
+	sessionExpired
+)
+
+// session holds the state of an SMB2 session
+type session struct {
+	// mu serializes the session setup legs of the session
+	mu sync.Mutex
+
+	id uint64
+
+	// conn is the connection the session was set up on, dialect the dialect negotiated on it
+	conn    *Connection
+	dialect Dialect
+
+	// auth is the authentication exchange in progress, nil once it has completed
+	auth *authExchange
+
+	// sessionKey is the key established by authentication, the signing and encryption keys derive from it
+	sessionKey []byte
+
+	// keysMu guards the fields read by every request of the session while session setup may change them.
+	// state is the authentication state, expiresAt the time the logon expires, zero if it does not.
+	// signer signs the messages of the session, it is nil for guest and anonymous sessions.
+	// signingRequired rejects unsigned requests. cipher encrypts the messages of the session
+	// if a cipher was negotiated, encryptData rejects unencrypted requests.
+	// domain and user identify the authenticated client, groups lists the groups of its account
+	// and flags marks guest and anonymous sessions, reauthentication may replace them.
+	keysMu          sync.RWMutex
+	state           sessionState
+	expiresAt       time.Time
+	signer          *signer
+	signingRequired bool
+	cipher          *sessionCipher
+	encryptData     bool
+	domain          string
+	user            string
+	groups          []string
+	flags           SessionFlag
+
+	// preauthValue is the SMB 3.1.1 preauth integrity hash at the end of session setup
+	preauthValue []byte
+
+	// trees holds the tree connects of the session, keyed by tree ID
+	treesMu    sync.Mutex
+	trees      map[uint32]*treeConnect
+	nextTreeID uint32
+}
+
+// sessionTable holds the sessions of a server, keyed by session ID. Session IDs are unique
+// across the connections of the server.
+type sessionTable struct {
+	mu       sync.Mutex
+	sessions map[uint64]*session
+	nextID   uint64
+}
+
+// newSessionTable creates an empty session table
+func newSessionTable() *sessionTable {
+	return &sessionTable{sessions: make(map[uint64]*session)}
+}
+
+// add allocates a session ID and registers a session
+func (t *sessionTable) add(s *session) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Zero means no session and all bits set is reserved
+	for {
+		t.nextID++
+		if _, ok := t.sessions[t.nextID]; !ok && t.nextID != 0 && t.nextID != ^uint64(0) {
+			break
+		}
+	}
+	s.id = t.nextID
+	t.sessions[s.id] = s
+}
+
+// lookup returns the session with the given ID, or nil if there is none
+func (t *sessionTable) lookup(id uint64) *session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.sessions[id]
+}
+
+// remove removes a session from the table
+func (t *sessionTable) remove(s *session) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.sessions, s.id)
+}
+
+// removeConnection removes the sessions set up on a connection and returns them
+func (t *sessionTable) removeConnection(c *Connection) []*session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var removed []*session
+	for id, s := range t.sessions {
+		if s.conn == c {
+			delete(t.sessions, id)
+			removed = append(removed, s)
+		}
+	}
+	return removed
+}
+
+// newSession allocates a session ID and registers a session in setup
+func (c *Connection) newSession() *session {
+	s := &session{
+		conn:    c,
+		dialect: c.dialect,
+		state:   sessionInProgress,
+		trees:   make(map[uint32]*treeConnect),
+	}
+	c.server.sessions.add(s)
+	return s
+}
+
+// lookupSession returns the session with the given ID, or nil if there is none on the connection.
+// Sessions cannot be used from another connection, multichannel is not supported.
+func (c *Connection) lookupSession(id uint64) *session {
+	s := c.server.sessions.lookup(id)
+	if s == nil || s.conn != c {
+		return nil
+	}
+	return s
+}
+
+// removeSession removes a session from the server, cancels its pending operations and drops its tree connects and opens
+func (c *Connection) removeSession(s *session) {
+	c.server.sessions.remove(s)
+	c.cancelSessionAsync(s.id)
+	s.close()
+}
+
+// closeSessions tears down the sessions of the connection once it is closed
+func (c *Connection) closeSessions() {
+	for _, s := range c.server.sessions.removeConnection(c) {
+		s.close()
+	}
+}
+
+// checkSession verifies that a request belongs to an established session of the connection.
+// An expired session only accepts LOGOFF and CLOSE until the client reauthenticates.
+func (c *Connection) checkSession(packet *Packet) Status {
+	switch packet.Header.Command {
+	case CommandNegotiate, CommandSessionSetup, CommandCancel, CommandEcho:
+		return StatusSuccess
+	}
+
+	s := c.lookupSession(packet.Header.SessionID)
+	if s == nil {
+		return StatusUserSessionDeleted
+	}
+	switch s.currentState(time.Now()) {
+	case sessionInProgress:
+		return StatusUserSessionDeleted
+	case sessionExpired:
+		if packet.Header.Command != CommandLogoff && packet.Header.Command != CommandClose {
+			return StatusNetworkSessionExpired
+		}
+	}
+	return StatusSuccess
+}
+
+// isGuest reports whether the session is a guest or anonymous session
+func (s *session) isGuest() bool {
+	_, _, _, flags := s.identity()
+	return flags&(SessionFlagIsGuest|SessionFlagIsNull) != 0
+}
+
+// setIdentity sets the authenticated client of the session, the groups of its account and the session flags
+func (s *session) setIdentity(domain, user string, groups []string, flags SessionFlag) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	s.domain = domain
+	s.user = user
+	s.groups = groups
+	s.flags = flags
+}
+
+// identity returns the authenticated client of the session, the groups of its account and the session flags.
+// The groups must not be modified.
+func (s *session) identity() (domain, user string, groups []string, flags SessionFlag) {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+
+	return s.domain, s.user, s.groups, s.flags
+}
+
+// establish marks the session as authenticated until expiresAt, a zero time never expires.
+// Reauthentication calls it again with the expiry time of the new logon.
+func (s *session) establish(expiresAt time.Time) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	s.state = sessionValid
+	s.expiresAt = expiresAt
+}
+
+// currentState returns the state of the session at the given time
+func (s *session) currentState(now time.Time) sessionState {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+
+	if s.state == sessionValid && !s.expiresAt.IsZero() && now.After(s.expiresAt) {
+		return sessionExpired
+	}
+	return s.state
+}
+
+// setSigning sets the signer of the session and whether requests must be signed
+func (s *session) setSigning(sg *signer, required bool) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	s.signer = sg
+	s.signingRequired = required
+}
+
+// signing returns the signer of the session, nil if it cannot sign, and whether requests must be signed
+func (s *session) signing() (*signer, bool) {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+
+	return s.signer, s.signingRequired
+}
+
+// setEncryption sets the cipher of the session and whether requests must be encrypted
+func (s *session) setEncryption(sc *sessionCipher, required bool) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	s.cipher = sc
+	s.encryptData = required
+}
+
+// encryption returns the cipher of the session, nil if it cannot encrypt, and whether requests must be encrypted
+func (s *session) encryption() (*sessionCipher, bool) {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+
+	return s.cipher, s.encryptData
+}
+
+// close drops the tree connects of a session that was removed and closes their opens
+func (s *session) close() {
+	s.treesMu.Lock()
+	trees := s.trees
+	s.trees = make(map[uint32]*treeConnect)
+	s.treesMu.Unlock()
+
+	for _, tree := range trees {
+		tree.closeOpens()
+	}
+}
@@ -0,0 +1,15 @@
+package smb
+
+// SessionFlag represents the session flags of an SMB2 session setup response
+type SessionFlag uint16
+
+const (
+	// SessionFlagIsGuest indicates that the client was logged in as guest
+	SessionFlagIsGuest SessionFlag = 0x0001
+
+	// SessionFlagIsNull indicates that the client was logged in anonymously
+	SessionFlagIsNull SessionFlag = 0x0002
+
+	// SessionFlagEncryptData indicates that the server requires encryption on the session
+	SessionFlagEncryptData SessionFlag = 0x0004
+)
@@ -0,0 +1,15 @@
+package smb
+
+// ShareAccess represents the access an open lets other opens of the same file have
+type ShareAccess uint32
+
+const (
+	// ShareAccessRead lets other opens read the file
+	ShareAccessRead ShareAccess = 0x00000001
+
+	// ShareAccessWrite lets other opens write the file
+	ShareAccessWrite ShareAccess = 0x00000002
+
+	// ShareAccessDelete lets other opens delete or rename the file
+	ShareAccessDelete ShareAccess = 0x00000004
+)
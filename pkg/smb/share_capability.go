@@ -0,0 +1,24 @@
+package smb
+
+// ShareCapability represents the capabilities of a share in an SMB2 tree connect response
+type ShareCapability uint32
+
+const (
+	// ShareCapabilityDFS indicates that the share is part of a DFS namespace
+	ShareCapabilityDFS ShareCapability = 0x00000008
+
+	// ShareCapabilityContinuousAvailability indicates that the opens of the share survive a failover
+	ShareCapabilityContinuousAvailability ShareCapability = 0x00000010
+
+	// ShareCapabilityScaleout indicates that the share is served by several nodes of a cluster
+	ShareCapabilityScaleout ShareCapability = 0x00000020
+
+	// ShareCapabilityCluster indicates that the share is served by a cluster
+	ShareCapabilityCluster ShareCapability = 0x00000040
+
+	// ShareCapabilityAsymmetric indicates that clients may have to move to another node of the cluster
+	ShareCapabilityAsymmetric ShareCapability = 0x00000080
+
+	// ShareCapabilityRedirectToOwner indicates that the share supports redirection to the owner node
+	ShareCapabilityRedirectToOwner ShareCapability = 0x00000100
+)
@@ -0,0 +1,54 @@
+package smb
+
+// ShareFlag represents the share flags of an SMB2 tree connect response
+type ShareFlag uint32
+
+const (
+	// ShareFlagManualCaching lets clients cache files of the share offline if the user asks for it
+	ShareFlagManualCaching ShareFlag = 0x00000000
+
+	// ShareFlagAutoCaching lets clients cache the files of the share offline automatically
+	ShareFlagAutoCaching ShareFlag = 0x00000010
+
+	// ShareFlagVDOCaching lets clients cache the programs of the share offline
+	ShareFlagVDOCaching ShareFlag = 0x00000020
+
+	// ShareFlagNoCaching forbids offline caching of the share
+	ShareFlagNoCaching ShareFlag = 0x00000030
+
+	// ShareFlagDFS indicates that the share is part of a DFS namespace
+	ShareFlagDFS ShareFlag = 0x00000001
+
+	// ShareFlagDFSRoot indicates that the share is the root of a DFS namespace
+	ShareFlagDFSRoot ShareFlag = 0x00000002
+
+	// ShareFlagRestrictExclusiveOpens forbids opens that deny reading to other clients
+	ShareFlagRestrictExclusiveOpens ShareFlag = 0x00000100
+
+	// ShareFlagForceSharedDelete forces FILE_SHARE_DELETE on every open
+	ShareFlagForceSharedDelete ShareFlag = 0x00000200
+
+	// ShareFlagAllowNamespaceCaching lets clients cache directory listings of the share
+	ShareFlagAllowNamespaceCaching ShareFlag = 0x00000400
+
+	// ShareFlagAccessBasedDirectoryEnum hides the entries the user cannot access from directory listings
+	ShareFlagAccessBasedDirectoryEnum ShareFlag = 0x00000800
+
+	// ShareFlagForceLevelIIOplock prevents exclusive oplocks on the share
+	ShareFlagForceLevelIIOplock ShareFlag = 0x00001000
+
+	// ShareFlagEnableHashV1 enables BranchCache hashes of version 1
+	ShareFlagEnableHashV1 ShareFlag = 0x00002000
+
+	// ShareFlagEnableHashV2 enables BranchCache hashes of version 2
+	ShareFlagEnableHashV2 ShareFlag = 0x00004000
+
+	// ShareFlagEncryptData indicates that the messages on the share must be encrypted
+	ShareFlagEncryptData ShareFlag = 0x00008000
+
+	// ShareFlagIdentityRemoting indicates that the share supports identity remoting
+	ShareFlagIdentityRemoting ShareFlag = 0x00040000
+
+	// ShareFlagCompressData asks clients to compress the requests on the share
+	ShareFlagCompressData ShareFlag = 0x00100000
+)
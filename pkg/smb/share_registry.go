@@ -0,0 +1,51 @@
+package smb
+
+import (
+	"strings"
+	"sync"
+)
+
+// ipcShareName is the name of the named pipe share every server exports
+const ipcShareName = "IPC$"
+
+// shareRegistry holds the shares of a server. Share names are matched case-insensitively.
+type shareRegistry struct {
+	mu     sync.RWMutex
+	shares map[string]*Share
+}
+
+// newShareRegistry creates a registry holding the IPC$ share
+func newShareRegistry() *shareRegistry {
+	r := &shareRegistry{shares: make(map[string]*Share)}
+	r.add(&Share{Name: ipcShareName, Type: ShareTypePipe, GuestOK: true})
+	return r
+}
+
+// add registers a share, replacing a share of the same name
+func (r *shareRegistry) add(sh *Share) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.shares[strings.ToUpper(sh.Name)] = sh
+}
+
+// lookup returns the share with the given name, or nil if there is none
+func (r *shareRegistry) lookup(name string) *Share {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.shares[strings.ToUpper(name)]
+}
+
+// shareName returns the share name of a \\server\share UNC path, or false if the path is malformed.
+// The server name is not checked, clients may connect by any name or address of the server.
+func shareName(path string) (string, bool) {
+	if !strings.HasPrefix(path, `\\`) {
+		return "", false
+	}
+	server, share, ok := strings.Cut(path[2:], `\`)
+	if !ok || server == "" || share == "" || strings.Contains(share, `\`) {
+		return "", false
+	}
+	return share, true
+}
@@ -0,0 +1,15 @@
+package smb
+
+// ShareType represents the type of a share in an SMB2 tree connect response
+type ShareType uint8
+
+const (
+	// ShareTypeDisk is a share of files and directories
+	ShareTypeDisk ShareType = 0x01
+
+	// ShareTypePipe is a named pipe share, like IPC$
+	ShareTypePipe ShareType = 0x02
+
+	// ShareTypePrint is a printer share
+	ShareTypePrint ShareType = 0x03
+)
@@ -0,0 +1,243 @@
+package smb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+)
+
+// headerSignatureOffset is the offset of the Signature field in the SMB2 header
+const headerSignatureOffset = 48
+
+// signatureSize is the size of the signature of an SMB2 message
+const signatureSize = 16
+
+// Labels and contexts of the signing key derivation (MS-SMB2, section 3.1.4.2), the null terminators are part of them
+const (
+	signingLabelSMB30   = "SMB2AESCMAC\x00"
+	signingContextSMB30 = "SmbSign\x00"
+	signingLabelSMB311  = "SMBSigningKey\x00"
+)
+
+// gmacNonceFlagResponse and gmacNonceFlagCancel are set in the nonce of AES-GMAC signatures (MS-SMB2, section 3.1.4.1)
+const (
+	gmacNonceFlagResponse = 0x00000001
+	gmacNonceFlagCancel   = 0x00000002
+)
+
+// kdf derives a key of the given length in bits with the SP800-108 KDF in counter mode, using HMAC-SHA256 as PRF
+func kdf(key []byte, label string, context []byte, bits int) []byte {
+	var out []byte
+	for i := uint32(1); len(out)*8 < bits; i++ {
+		h := hmac.New(sha256.New, key)
+		binary.Write(h, binary.BigEndian, i)
+		h.Write([]byte(label))
+		h.Write([]byte{0})
+		h.Write(context)
+		binary.Write(h, binary.BigEndian, uint32(bits))
+		out = h.Sum(out)
+	}
+	return out[:bits/8]
+}
+
+// signingKey derives the signing key of a session. SMB 2.x signs with the session key itself,
+// SMB 3.1.1 binds the key to the preauth integrity hash of the session.
+func signingKey(dialect Dialect, sessionKey []byte, preauthValue []byte) []byte {
+	switch {
+	case dialect >= DialectSMB311:
+		return kdf(sessionKey, signingLabelSMB311, preauthValue, 128)
+	case dialect >= DialectSMB300:
+		return kdf(sessionKey, signingLabelSMB30, []byte(signingContextSMB30), 128)
+	default:
+		return sessionKey
+	}
+}
+
+// signer signs and verifies the messages of a session
+type signer struct {
+	algorithm SigningAlgorithm
+	key       []byte
+
+	// aead is the AES-GCM instance of AES-GMAC, block the AES instance of AES-CMAC
+	block cipher.Block
+	aead  cipher.AEAD
+}
+
+// newSigner creates a signer for the algorithm with the signing key of a session
+func newSigner(algorithm SigningAlgorithm, key []byte) (*signer, error) {
+	s := &signer{algorithm: algorithm, key: key}
+	if algorithm == SigningAlgorithmHMACSHA256 {
+		return s, nil
+	}
+
+	// The AES algorithms use 128-bit keys
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	s.block = block
+	if algorithm == SigningAlgorithmAESGMAC {
+		if s.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// signature computes the signature of a message, header included, as if its Signature field was zero
+func (s *signer) signature(msg []byte) []byte {
+	data := append([]byte{}, msg...)
+	copy(data[headerSignatureOffset:headerSignatureOffset+signatureSize], make([]byte, signatureSize))
+
+	switch s.algorithm {
+	case SigningAlgorithmAESCMAC:
+		return cmac(s.block, data)
+	case SigningAlgorithmAESGMAC:
+		// The nonce is the message ID followed by the direction and whether the message is a CANCEL
+		nonce := make([]byte, s.aead.NonceSize())
+		copy(nonce, data[24:32])
+		var flags uint32
+		if binary.LittleEndian.Uint32(data[16:20])&FlagServerToRedir != 0 {
+			flags |= gmacNonceFlagResponse
+		}
+		if Command(binary.LittleEndian.Uint16(data[12:14])) == CommandCancel {
+			flags |= gmacNonceFlagCancel
+		}
+		binary.LittleEndian.PutUint32(nonce[8:], flags)
+
+		// GMAC is GCM authenticating the message without encrypting anything
+		return s.aead.Seal(nil, nonce, nil, data)
+	default:
+		h := hmac.New(sha256.New, s.key)
+		h.Write(data)
+		return h.Sum(nil)[:signatureSize]
+	}
+}
+
+// sign marks a message as signed and writes its signature into its header
+func (s *signer) sign(msg []byte) {
+	flags := binary.LittleEndian.Uint32(msg[16:20])
+	binary.LittleEndian.PutUint32(msg[16:20], flags|FlagSigned)
+	copy(msg[headerSignatureOffset:], s.signature(msg))
+}
+
+// verify reports whether the signature in the header of a message is valid
+func (s *signer) verify(msg []byte) bool {
+	if len(msg) < HeaderSize {
+		return false
+	}
+	return subtle.ConstantTimeCompare(s.signature(msg), msg[headerSignatureOffset:headerSignatureOffset+signatureSize]) == 1
+}
+
+// checkSignature verifies the signature of a request on a session that signs its messages.
+// Unsigned requests are refused when the session requires signing.
+func (c *Connection) checkSignature(packet *Packet) Status {
+	// Requests outside of a session and sessions in setup are not signed, encryption authenticates encrypted requests
+	if packet.Header.SessionID == 0 || packet.Header.Command == CommandNegotiate || packet.encrypted != nil {
+		return StatusSuccess
+	}
+	s := c.lookupSession(packet.Header.SessionID)
+	if s == nil {
+		return StatusSuccess
+	}
+	sg, required := s.signing()
+	if sg == nil {
+		return StatusSuccess
+	}
+
+	// Verify the signature
+	if packet.Header.Flags&FlagSigned == 0 {
+		if required {
+			return StatusAccessDenied
+		}
+		return StatusSuccess
+	}
+	if !sg.verify(packet.raw) {
+		return StatusAccessDenied
+	}
+	return StatusSuccess
+}
+
+// responseSigner returns the signer the response to a request must be signed with, or nil.
+// Responses are signed when the request was signed or the session requires signing,
+// the responses to encrypted requests are encrypted instead.
+func (c *Connection) responseSigner(packet *Packet, status Status) *signer {
+	if packet.encrypted != nil {
+		return nil
+	}
+	s := c.lookupSession(packet.Header.SessionID)
+	if s == nil {
+		return nil
+	}
+	sg, required := s.signing()
+	if sg == nil {
+		return nil
+	}
+	if packet.Header.Flags&FlagSigned != 0 || required {
+		return sg
+	}
+
+	// SMB 3.1.1 always signs the final session setup response, it proves the preauth integrity hash
+	if packet.Header.Command == CommandSessionSetup && status == StatusSuccess && c.dialect == DialectSMB311 {
+		return sg
+	}
+	return nil
+}
+
+// cmac computes the AES-CMAC of data (RFC 4493)
+func cmac(block cipher.Block, data []byte) []byte {
+	// Derive the subkeys from the encrypted zero block
+	k1 := make([]byte, aes.BlockSize)
+	block.Encrypt(k1, k1)
+	k1 = cmacDouble(k1)
+	k2 := cmacDouble(k1)
+
+	// Split off the last block, it is masked with K1 if complete and padded and masked with K2 otherwise
+	n := (len(data) + aes.BlockSize - 1) / aes.BlockSize
+	if n == 0 {
+		n = 1
+	}
+	last := make([]byte, aes.BlockSize)
+	rest := data[(n-1)*aes.BlockSize:]
+	if len(rest) == aes.BlockSize {
+		xorBytes(last, rest, k1)
+	} else {
+		copy(last, rest)
+		last[len(rest)] = 0x80
+		xorBytes(last, last, k2)
+	}
+
+	// Chain the blocks in CBC mode with a zero IV
+	mac := make([]byte, aes.BlockSize)
+	for i := 0; i < n-1; i++ {
+		xorBytes(mac, mac, data[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(mac, mac)
+	}
+	xorBytes(mac, mac, last)
+	block.Encrypt(mac, mac)
+	return mac
+}
+
+// cmacDouble multiplies a block by x in GF(2^128), deriving the CMAC subkeys
+func cmacDouble(in []byte) []byte {
+	out := make([]byte, len(in))
+	carry := in[0] >> 7
+	for i := 0; i < len(in)-1; i++ {
+		out[i] = in[i]<<1 | in[i+1]>>7
+	}
+	out[len(in)-1] = in[len(in)-1] << 1
+	if carry != 0 {
+		out[len(in)-1] ^= 0x87
+	}
+	return out
+}
+
+// xorBytes sets dst to the exclusive or of a and b, which have the length of dst
+func xorBytes(dst []byte, a []byte, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
@@ -0,0 +1,15 @@
+package smb
+
+// SigningAlgorithm identifies an SMB message signing algorithm
+type SigningAlgorithm uint16
+
+const (
+	// SigningAlgorithmHMACSHA256 indicates HMAC-SHA256
+	SigningAlgorithmHMACSHA256 SigningAlgorithm = 0x0000
+
+	// SigningAlgorithmAESCMAC indicates AES-128-CMAC
+	SigningAlgorithmAESCMAC SigningAlgorithm = 0x0001
+
+	// SigningAlgorithmAESGMAC indicates AES-128-GMAC
+	SigningAlgorithmAESGMAC SigningAlgorithm = 0x0002
+)
@@ -1,48 +1,123 @@
 package smb
 
-// Status represents an SMB status code
+// Status represents an NT status code carried in the SMB2 header
 type Status uint32
 
 const (
 	// StatusSuccess indicates a successful operation
 	StatusSuccess Status = 0x00000000
 
+	// StatusPending indicates an operation that completes asynchronously
+	StatusPending Status = 0x00000103
+
+	// StatusMoreProcessingRequired indicates that authentication needs another session setup leg
+	StatusMoreProcessingRequired Status = 0xC0000016
+
+	// StatusNotImplemented indicates a request that is not implemented
+	StatusNotImplemented Status = 0xC0000002
+
 	// StatusInvalidParameter indicates an invalid parameter
-	StatusInvalidParameter Status = 0x00000057
+	StatusInvalidParameter Status = 0xC000000D
 
 	// StatusAccessDenied indicates access was denied
-	StatusAccessDenied Status = 0x00000005
+	StatusAccessDenied Status = 0xC0000022
 
 	// StatusIncorrectPassword indicates an incorrect password
-	StatusIncorrectPassword Status = 0x00000056
+	StatusIncorrectPassword Status = 0xC000006A
+
+	// StatusLogonFailure indicates that the user name or password is wrong
+	StatusLogonFailure Status = 0xC000006D
+
+	// StatusAccountDisabled indicates that the account of the user is disabled
+	StatusAccountDisabled Status = 0xC0000072
+
+	// StatusAccountExpired indicates that the account of the user has expired
+	StatusAccountExpired Status = 0xC0000193
+
+	// StatusPasswordMustChange indicates that the user must change the password before logging in
+	StatusPasswordMustChange Status = 0xC0000224
+
+	// StatusUserSessionDeleted indicates that the session of a request does not exist
+	StatusUserSessionDeleted Status = 0xC0000203
+
+	// StatusNetworkSessionExpired indicates that the logon of the session has expired and must be renewed
+	StatusNetworkSessionExpired Status = 0xC000035C
+
+	// StatusRequestNotAccepted indicates that the server cannot accept the request
+	StatusRequestNotAccepted Status = 0xC00000D0
 
 	// StatusBadNetworkName indicates a bad network name
-	StatusBadNetworkName Status = 0x000004B3
+	StatusBadNetworkName Status = 0xC00000CC
+
+	// StatusNetworkNameDeleted indicates that the tree connect of the request does not exist
+	StatusNetworkNameDeleted Status = 0xC00000C9
 
 	// StatusPathNotFound indicates a path was not found
-	StatusPathNotFound Status = 0x00000003
+	StatusPathNotFound Status = 0xC000003A
 
 	// StatusInvalidHandle indicates an invalid handle
-	StatusInvalidHandle Status = 0x00000006
+	StatusInvalidHandle Status = 0xC0000008
 
 	// StatusFileExists indicates a file already exists
-	StatusFileExists Status = 0x00000050
+	StatusFileExists Status = StatusObjectNameCollision
 
-	// StatusInvalidDevice indicates an invalid device
-	StatusInvalidDevice Status = 0x00000047
+	// StatusInvalidDevice indicates an invalid device request
+	StatusInvalidDevice Status = 0xC0000010
 
 	// StatusInvalidNetworkResponse indicates an invalid network response
-	StatusInvalidNetworkResponse Status = 0x000004B2
+	StatusInvalidNetworkResponse Status = 0xC00000C3
 
 	// StatusNotSupported indicates a request is not supported
-	StatusNotSupported Status = 0x00000032
+	StatusNotSupported Status = 0xC00000BB
 
 	// StatusObjectNameInvalid indicates an invalid object name
-	StatusObjectNameInvalid Status = 0x00000033
+	StatusObjectNameInvalid Status = 0xC0000033
 
 	// StatusObjectNameNotFound indicates an object name was not found
-	StatusObjectNameNotFound Status = 0x00000034
+	StatusObjectNameNotFound Status = 0xC0000034
 
 	// StatusObjectNameCollision indicates an object name collision
-	StatusObjectNameCollision Status = 0x00000035
+	StatusObjectNameCollision Status = 0xC0000035
+
+	// StatusCancelled indicates an operation that was canceled by the client
+	StatusCancelled Status = 0xC0000120
+
+	// StatusUnsuccessful indicates an operation that failed for an unspecified reason
+	StatusUnsuccessful Status = 0xC0000001
+
+	// StatusFileClosed indicates a request on a file ID that is not open
+	StatusFileClosed Status = 0xC0000128
+
+	// StatusFileIsADirectory indicates that a file was expected but a directory was found
+	StatusFileIsADirectory Status = 0xC00000BA
+
+	// StatusNotADirectory indicates that a directory was expected but a file was found
+	StatusNotADirectory Status = 0xC0000103
+
+	// StatusDirectoryNotEmpty indicates that a directory to delete still has entries
+	StatusDirectoryNotEmpty Status = 0xC0000101
+
+	// StatusCannotDelete indicates that a read-only file was opened for deletion
+	StatusCannotDelete Status = 0xC0000121
+
+	// StatusDiskFull indicates that the storage of the share has no space left
+	StatusDiskFull Status = 0xC000007F
+
+	// StatusBadImpersonationLevel indicates an impersonation level out of range
+	StatusBadImpersonationLevel Status = 0xC00000A5
+
+	// StatusSharingViolation indicates an open conflicting with the share modes of other opens of the file
+	StatusSharingViolation Status = 0xC0000043
+
+	// StatusDeletePending indicates an open of a file that is about to be deleted
+	StatusDeletePending Status = 0xC0000056
+
+	// StatusEndOfFile indicates a read at or beyond the end of a file
+	StatusEndOfFile Status = 0xC0000011
+
+	// StatusFileLockConflict indicates a read or write of a range locked by another open
+	StatusFileLockConflict Status = 0xC0000054
+
+	// StatusSMBNoPreauthIntegrityHashOverlap indicates that client and server have no common preauth integrity hash algorithm
+	StatusSMBNoPreauthIntegrityHashOverlap Status = 0xC05D0000
 )
@@ -0,0 +1,135 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// TransformHeaderSize is the size of an SMB2 TRANSFORM_HEADER in bytes
+const TransformHeaderSize = 52
+
+// transformHeaderAADOffset is the offset of the part of the transform header authenticated with the message
+const transformHeaderAADOffset = 20
+
+// ProtocolIDTransform is the protocol identifier of encrypted SMB3 messages
+var ProtocolIDTransform = [4]byte{0xFD, 'S', 'M', 'B'}
+
+// TransformFlagEncrypted indicates that the message is encrypted with the cipher of the connection
+const TransformFlagEncrypted uint16 = 0x0001
+
+// ErrInvalidTransformHeader is returned for a truncated or malformed transform header
+var ErrInvalidTransformHeader = errors.New("smb: invalid transform header")
+
+// TransformHeader represents an SMB2 TRANSFORM_HEADER, which precedes an encrypted message.
+// Flags is the EncryptionAlgorithm field of SMB 3.0, where its only value has the same meaning.
+type TransformHeader struct {
+	Signature           [16]byte
+	Nonce               [16]byte
+	OriginalMessageSize uint32
+	Flags               uint16
+	SessionID           uint64
+}
+
+// Marshal serializes a transform header into a byte slice
+func (h *TransformHeader) Marshal() ([]byte, error) {
+	// Create a new bytes buffer
+	buf := bytes.NewBuffer(make([]byte, 0, TransformHeaderSize))
+
+	// Write the protocol ID
+	if err := binary.Write(buf, binary.LittleEndian, ProtocolIDTransform); err != nil {
+		return nil, err
+	}
+
+	// Write the signature
+	if err := binary.Write(buf, binary.LittleEndian, h.Signature); err != nil {
+		return nil, err
+	}
+
+	// Write the nonce
+	if err := binary.Write(buf, binary.LittleEndian, h.Nonce); err != nil {
+		return nil, err
+	}
+
+	// Write the size of the message before encryption
+	if err := binary.Write(buf, binary.LittleEndian, h.OriginalMessageSize); err != nil {
+		return nil, err
+	}
+
+	// Write the reserved field
+	if err := binary.Write(buf, binary.LittleEndian, uint16(0)); err != nil {
+		return nil, err
+	}
+
+	// Write the flags
+	if err := binary.Write(buf, binary.LittleEndian, h.Flags); err != nil {
+		return nil, err
+	}
+
+	// Write the session ID
+	if err := binary.Write(buf, binary.LittleEndian, h.SessionID); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// TransformHeaderParse parses a transform header from a byte slice
+func TransformHeaderParse(data []byte) (*TransformHeader, error) {
+	// Make sure the whole header is present
+	if len(data) < TransformHeaderSize {
+		return nil, ErrInvalidTransformHeader
+	}
+
+	// Create a new bytes reader
+	r := bytes.NewReader(data[:TransformHeaderSize])
+
+	// Read the protocol ID
+	var protocolID [4]byte
+	if err := binary.Read(r, binary.LittleEndian, &protocolID); err != nil {
+		return nil, err
+	}
+	if protocolID != ProtocolIDTransform {
+		return nil, ErrInvalidProtocolID
+	}
+
+	header := &TransformHeader{}
+
+	// Read the signature
+	if err := binary.Read(r, binary.LittleEndian, &header.Signature); err != nil {
+		return nil, err
+	}
+
+	// Read the nonce
+	if err := binary.Read(r, binary.LittleEndian, &header.Nonce); err != nil {
+		return nil, err
+	}
+
+	// Read the size of the message before encryption
+	if err := binary.Read(r, binary.LittleEndian, &header.OriginalMessageSize); err != nil {
+		return nil, err
+	}
+
+	// Skip the reserved field
+	var reserved uint16
+	if err := binary.Read(r, binary.LittleEndian, &reserved); err != nil {
+		return nil, err
+	}
+
+	// Read the flags
+	if err := binary.Read(r, binary.LittleEndian, &header.Flags); err != nil {
+		return nil, err
+	}
+
+	// Read the session ID
+	if err := binary.Read(r, binary.LittleEndian, &header.SessionID); err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// isTransform reports whether a message starts with a transform header
+func isTransform(data []byte) bool {
+	return len(data) >= len(ProtocolIDTransform) && bytes.Equal(data[:len(ProtocolIDTransform)], ProtocolIDTransform[:])
+}
@@ -0,0 +1,107 @@
+package smb
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Session service message types (RFC 1002, section 4.3)
+const (
+	// sessionMessage carries an SMB message
+	sessionMessage byte = 0x00
+
+	// sessionRequest is sent by NetBIOS clients on port 139 before any SMB traffic
+	sessionRequest byte = 0x81
+
+	// sessionPositiveResponse accepts a session request
+	sessionPositiveResponse byte = 0x82
+
+	// sessionKeepAlive is sent by clients to keep an idle session open
+	sessionKeepAlive byte = 0x85
+)
+
+// transportHeaderSize is the size of the Direct TCP / NetBIOS session service header
+const transportHeaderSize = 4
+
+// maxTransportMessageSize is the largest length that fits into the 24-bit Direct TCP length field
+const maxTransportMessageSize = 0x00FFFFFF
+
+// DefaultMaxMessageSize is the default limit for a single SMB message received from a client
+const DefaultMaxMessageSize = 8*1024*1024 + 64*1024
+
+var (
+	// ErrMessageTooLarge is returned when a client announces a message larger than the configured maximum
+	ErrMessageTooLarge = errors.New("smb: message too large")
+
+	// ErrInvalidSessionMessage is returned when the session service header has an unknown type
+	ErrInvalidSessionMessage = errors.New("smb: invalid session service message")
+)
+
+// ReadMessage reads a single SMB message framed by a Direct TCP (RFC 1002 compatible) header.
+// Keep-alive messages are skipped and NetBIOS session requests are answered with a positive
+// response, so the returned slice always holds a complete SMB message of at most maxSize bytes.
+func ReadMessage(rw io.ReadWriter, maxSize int) ([]byte, error) {
+	for {
+		// Read the session service header
+		var header [transportHeaderSize]byte
+		if _, err := io.ReadFull(rw, header[:]); err != nil {
+			return nil, err
+		}
+
+		// The Direct TCP transport uses the three low bytes as the length. For NetBIOS
+		// framing the second byte only carries the length extension bit, so both read the same.
+		length := int(header[1])<<16 | int(binary.BigEndian.Uint16(header[2:]))
+
+		switch header[0] {
+		case sessionMessage:
+			// Reject messages larger than the configured maximum before allocating
+			if length > maxSize {
+				return nil, ErrMessageTooLarge
+			}
+
+			// Reassemble the full message
+			msg := make([]byte, length)
+			if _, err := io.ReadFull(rw, msg); err != nil {
+				return nil, err
+			}
+
+			return msg, nil
+		case sessionRequest:
+			// Discard the called and calling names
+			if _, err := io.CopyN(io.Discard, rw, int64(length)); err != nil {
+				return nil, err
+			}
+
+			// Accept the session
+			if _, err := rw.Write([]byte{sessionPositiveResponse, 0, 0, 0}); err != nil {
+				return nil, err
+			}
+		case sessionKeepAlive:
+			// Discard any payload of the keep-alive
+			if _, err := io.CopyN(io.Discard, rw, int64(length)); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, ErrInvalidSessionMessage
+		}
+	}
+}
+
+// WriteMessage writes a single SMB message prefixed with a Direct TCP header
+func WriteMessage(w io.Writer, msg []byte) error {
+	// Make sure the length fits into the header
+	if len(msg) > maxTransportMessageSize {
+		return ErrMessageTooLarge
+	}
+
+	// Write the header and the message in one call so concurrent writers cannot interleave them
+	buf := make([]byte, transportHeaderSize+len(msg))
+	buf[0] = sessionMessage
+	buf[1] = byte(len(msg) >> 16)
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(msg)))
+	copy(buf[transportHeaderSize:], msg)
+
+	_, err := w.Write(buf)
+	return err
+}
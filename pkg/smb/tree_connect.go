@@ -0,0 +1,73 @@
+package smb
+
+import "sync"
+
+// treeConnect represents a connection of a session to a share
+type treeConnect struct {
+	id    uint32
+	share *Share
+
+	// maximalAccess is the most access the session may be granted on the share
+	maximalAccess AccessMask
+
+	// opens holds the files opened on the tree connect, keyed by file ID
+	opensMu        sync.Mutex
+	opens          map[FileID]*open
+	nextVolatileID uint64
+}
+
+// addTree connects the session to a share and allocates the tree ID of the connection
+func (s *session) addTree(share *Share) *treeConnect {
+	s.treesMu.Lock()
+	defer s.treesMu.Unlock()
+
+	// Zero means no tree and all bits set is reserved
+	for {
+		s.nextTreeID++
+		if _, ok := s.trees[s.nextTreeID]; !ok && s.nextTreeID != 0 && s.nextTreeID != ^uint32(0) {
+			break
+		}
+	}
+	tree := &treeConnect{
+		id:            s.nextTreeID,
+		share:         share,
+		maximalAccess: share.maximalAccess(s),
+		opens:         make(map[FileID]*open),
+	}
+	s.trees[tree.id] = tree
+	return tree
+}
+
+// lookupTree returns the tree connect with the given ID, or nil if there is none
+func (s *session) lookupTree(id uint32) *treeConnect {
+	s.treesMu.Lock()
+	defer s.treesMu.Unlock()
+
+	return s.trees[id]
+}
+
+// removeTree disconnects a tree and returns it, or nil if there is none with the given ID
+func (s *session) removeTree(id uint32) *treeConnect {
+	s.treesMu.Lock()
+	defer s.treesMu.Unlock()
+
+	tree := s.trees[id]
+	delete(s.trees, id)
+	return tree
+}
+
+// checkTree verifies that a request on a share belongs to a tree connect of its session
+func (c *Connection) checkTree(packet *Packet) Status {
+	switch packet.Header.Command {
+	case CommandTreeDisconnect, CommandCreate, CommandClose, CommandFlush, CommandRead, CommandWrite,
+		CommandLock, CommandIoctl, CommandQueryDirectory, CommandChangeNotify, CommandQueryInfo, CommandSetInfo:
+	default:
+		return StatusSuccess
+	}
+
+	s := c.lookupSession(packet.Header.SessionID)
+	if s == nil || s.lookupTree(packet.Header.TreeID) == nil {
+		return StatusNetworkNameDeleted
+	}
+	return StatusSuccess
+}
@@ -0,0 +1,296 @@
+package smb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidUserFile is returned for a malformed line of a user file
+var ErrInvalidUserFile = errors.New("smb: invalid user file")
+
+// userFileHeader starts every user file written by FileUserStore
+const userFileHeader = "# simba users, one per line as name:nthash:[flags]:groups\n"
+
+// Letters of the account flags in a user file, U marks a normal account as in smbpasswd
+var accountFlagLetters = []struct {
+	flag   AccountFlag
+	letter byte
+}{
+	{AccountDisabled, 'D'},
+	{AccountExpired, 'E'},
+	{AccountPasswordMustChange, 'C'},
+}
+
+// FileUserStore is a UserStore kept in a text file similar to smbpasswd, every line holds an account as
+//
+//	name:nthash:[flags]:groups
+//
+// where nthash is 32 hex digits, flags holds U for a normal account followed by D (disabled),
+// E (expired) or C (password must change), and groups is a comma separated list.
+// Lines starting with # are comments. The file is read again whenever it changes on disk,
+// so accounts edited by another process are picked up without a restart. Changes are made under
+// an flock on the file name followed by ".lock", so concurrent "simba user" runs do not lose each
+// other's changes; systems without flock have no such lock.
+type FileUserStore struct {
+	path string
+
+	// mu guards users and modTime, the modification time of the file when it was last read
+	mu      sync.Mutex
+	users   *MemoryUserStore
+	modTime time.Time
+}
+
+// OpenFileUserStore opens the user file at path, a missing file is created by the first change
+func OpenFileUserStore(path string) (*FileUserStore, error) {
+	s := &FileUserStore{path: path, users: NewMemoryUserStore()}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LookupUser returns the account of a user
+func (s *FileUserStore) LookupUser(domain string, name string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s.users.LookupUser(domain, name)
+}
+
+// Users returns all accounts sorted by name
+func (s *FileUserStore) Users() ([]User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s.users.Users()
+}
+
+// AddUser adds an account and saves the file
+func (s *FileUserStore) AddUser(user User) error {
+	if err := validateUserLine(user); err != nil {
+		return err
+	}
+	return s.update(func() error {
+		return s.users.AddUser(user)
+	})
+}
+
+// UpdateUser replaces an existing account and saves the file
+func (s *FileUserStore) UpdateUser(user User) error {
+	if err := validateUserLine(user); err != nil {
+		return err
+	}
+	return s.update(func() error {
+		return s.users.UpdateUser(user)
+	})
+}
+
+// DeleteUser removes an account and saves the file
+func (s *FileUserStore) DeleteUser(name string) error {
+	return s.update(func() error {
+		return s.users.DeleteUser(name)
+	})
+}
+
+// update applies a change to the accounts read from the file and saves them.
+// The lock file keeps other processes from changing the file in between.
+func (s *FileUserStore) update(change func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := lockUserFile(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.reload(); err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// reload reads the file again if it changed since it was last read
+func (s *FileUserStore) reload() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.users = NewMemoryUserStore()
+		s.modTime = time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(s.modTime) && !s.modTime.IsZero() {
+		return nil
+	}
+
+	// Parse the file
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	users, err := parseUserFile(f, s.path)
+	if err != nil {
+		return err
+	}
+
+	s.users = NewMemoryUserStore(users...)
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// save writes the accounts to a temporary file and renames it over the file, so readers never see a partial file
+func (s *FileUserStore) save() error {
+	users, err := s.users.Users()
+	if err != nil {
+		return err
+	}
+
+	// Serialize the accounts
+	buf := new(bytes.Buffer)
+	buf.WriteString(userFileHeader)
+	for _, u := range users {
+		writeUserLine(buf, u)
+	}
+
+	// Write the file, it holds password hashes and is only readable by its owner
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	// Remember the new modification time, so the file is not read again
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// parseUserFile parses the accounts of a user file, errors give the name of the file and the line number
+func parseUserFile(r io.Reader, name string) ([]User, error) {
+	var users []User
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		u, err := parseUserLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		users = append(users, u)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// parseUserLine parses an account given as name:nthash:[flags]:groups
+func parseUserLine(text string) (User, error) {
+	fields := strings.Split(text, ":")
+	if len(fields) != 4 || fields[0] == "" {
+		return User{}, ErrInvalidUserFile
+	}
+	u := User{Name: fields[0]}
+
+	// Parse the NT hash
+	hash, err := hex.DecodeString(fields[1])
+	if err != nil || len(hash) != len(u.NTHash) {
+		return User{}, ErrInvalidUserFile
+	}
+	copy(u.NTHash[:], hash)
+
+	// Parse the account flags
+	flags := fields[2]
+	if len(flags) < 2 || flags[0] != '[' || flags[len(flags)-1] != ']' {
+		return User{}, ErrInvalidUserFile
+	}
+	for _, c := range []byte(flags[1 : len(flags)-1]) {
+		switch c {
+		case 'U', ' ':
+			continue
+		}
+		known := false
+		for _, l := range accountFlagLetters {
+			if l.letter == c {
+				u.Flags |= l.flag
+				known = true
+			}
+		}
+		if !known {
+			return User{}, ErrInvalidUserFile
+		}
+	}
+
+	// Parse the groups
+	for _, g := range strings.Split(fields[3], ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			u.Groups = append(u.Groups, g)
+		}
+	}
+
+	return u, nil
+}
+
+// validateUserLine checks that an account can be written as a line, names and groups cannot hold separators
+func validateUserLine(u User) error {
+	if u.Name == "" || strings.ContainsAny(u.Name, ":#\r\n") || strings.TrimSpace(u.Name) != u.Name {
+		return ErrInvalidUserName
+	}
+	for _, g := range u.Groups {
+		if g == "" || strings.ContainsAny(g, ":,\r\n") || strings.TrimSpace(g) != g {
+			return fmt.Errorf("smb: invalid group name %q", g)
+		}
+	}
+	return nil
+}
+
+// writeUserLine writes an account as name:nthash:[flags]:groups
+func writeUserLine(buf *bytes.Buffer, u User) {
+	flags := []byte{'U'}
+	for _, l := range accountFlagLetters {
+		if u.Flags&l.flag != 0 {
+			flags = append(flags, l.letter)
+		}
+	}
+	fmt.Fprintf(buf, "%s:%X:[%s]:%s\n", u.Name, u.NTHash[:], flags, strings.Join(u.Groups, ","))
+}
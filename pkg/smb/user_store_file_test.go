@@ -0,0 +1,200 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUserLineRoundTrip(t *testing.T) {
+	var hash [16]byte
+	hex.Decode(hash[:], []byte("8846f7eaee8fb117ad06bdd830b7586c"))
+	tests := []struct {
+		name string
+		user User
+		line string
+	}{
+		{
+			name: "plain",
+			user: User{Name: "alice", NTHash: hash},
+			line: "alice:8846F7EAEE8FB117AD06BDD830B7586C:[U]:",
+		},
+		{
+			name: "groups",
+			user: User{Name: "bob", NTHash: hash, Groups: []string{"staff", "domain users"}},
+			line: "bob:8846F7EAEE8FB117AD06BDD830B7586C:[U]:staff,domain users",
+		},
+		{
+			name: "all flags",
+			user: User{Name: "carol", NTHash: hash, Flags: AccountDisabled | AccountExpired | AccountPasswordMustChange},
+			line: "carol:8846F7EAEE8FB117AD06BDD830B7586C:[UDEC]:",
+		},
+		{
+			name: "must change",
+			user: User{Name: "dave", NTHash: hash, Flags: AccountPasswordMustChange, Groups: []string{"admins"}},
+			line: "dave:8846F7EAEE8FB117AD06BDD830B7586C:[UC]:admins",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateUserLine(tt.user); err != nil {
+				t.Fatal(err)
+			}
+
+			// Write the account
+			buf := new(bytes.Buffer)
+			writeUserLine(buf, tt.user)
+			if line := buf.String(); line != tt.line+"\n" {
+				t.Errorf("line = %q, want %q", line, tt.line)
+			}
+
+			// Parse it back
+			u, err := parseUserLine(strings.TrimSuffix(buf.String(), "\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(u, tt.user) {
+				t.Errorf("parsed %+v, want %+v", u, tt.user)
+			}
+		})
+	}
+}
+
+func TestParseUserFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		users int
+		err   string
+	}{
+		{
+			name:  "comments and blank lines",
+			file:  userFileHeader + "\n  # disabled account\nalice:00000000000000000000000000000000:[U D]:\n",
+			users: 1,
+		},
+		{name: "missing field", file: "# users\nalice:00000000000000000000000000000000:[U]\n", err: "users:2:"},
+		{name: "empty name", file: ":00000000000000000000000000000000:[U]:\n", err: "users:1:"},
+		{name: "short hash", file: "\n\nalice:0000:[U]:\n", err: "users:3:"},
+		{name: "hash not hex", file: "alice:0000000000000000000000000000000Z:[U]:\n", err: "users:1:"},
+		{name: "flags without brackets", file: "alice:00000000000000000000000000000000:U:\n", err: "users:1:"},
+		{name: "unknown flag", file: "alice:00000000000000000000000000000000:[UX]:\n", err: "users:1:"},
+		{
+			name: "second account",
+			file: "alice:00000000000000000000000000000000:[U]:\nbob:00000000000000000000000000000000:[U]:a:b\n",
+			err:  "users:2:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, err := parseUserFile(strings.NewReader(tt.file), "users")
+			if tt.err != "" {
+				if !errors.Is(err, ErrInvalidUserFile) || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %s%v", err, tt.err, ErrInvalidUserFile)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != tt.users {
+				t.Errorf("parsed %d users, want %d", len(users), tt.users)
+			}
+		})
+	}
+}
+
+func TestValidateUserLine(t *testing.T) {
+	tests := []struct {
+		name string
+		user User
+	}{
+		{name: "empty name", user: User{}},
+		{name: "name with colon", user: User{Name: "a:b"}},
+		{name: "name starting with space", user: User{Name: " alice"}},
+		{name: "comment name", user: User{Name: "#alice"}},
+		{name: "empty group", user: User{Name: "alice", Groups: []string{""}}},
+		{name: "group with comma", user: User{Name: "alice", Groups: []string{"a,b"}}},
+		{name: "group with leading space", user: User{Name: "alice", Groups: []string{" staff"}}},
+		{name: "group with trailing space", user: User{Name: "alice", Groups: []string{"staff "}}},
+		{name: "group with newline", user: User{Name: "alice", Groups: []string{"staff\n"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateUserLine(tt.user); err == nil {
+				t.Error("account accepted")
+			}
+		})
+	}
+}
+
+func TestFileUserStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	store, err := OpenFileUserStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes are saved to the file
+	alice := User{Name: "alice", Groups: []string{"staff"}, Flags: AccountPasswordMustChange}
+	alice.SetPassword("secret")
+	if err := store.AddUser(alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddUser(User{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddUser(User{Name: "ALICE"}); !errors.Is(err, ErrUserExists) {
+		t.Errorf("add existing user error = %v, want %v", err, ErrUserExists)
+	}
+	if err := store.DeleteUser("bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another store reading the file sees them
+	other, err := OpenFileUserStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := other.Users()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || !reflect.DeepEqual(users[0], alice) {
+		t.Errorf("users = %+v, want %+v", users, alice)
+	}
+}
+
+// TestFileUserStoreConcurrent adds users through several stores of the same file at once,
+// as concurrent "simba user" runs would, none of the additions may be lost
+func TestFileUserStoreConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	const stores = 8
+	var wg sync.WaitGroup
+	for i := 0; i < stores; i++ {
+		store, err := OpenFileUserStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := store.AddUser(User{Name: string(rune('a' + i))}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	store, err := OpenFileUserStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users, _ := store.Users(); len(users) != stores {
+		t.Errorf("file holds %d users, want %d", len(users), stores)
+	}
+}
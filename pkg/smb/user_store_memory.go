@@ -0,0 +1,104 @@
+package smb
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryUserStore is a UserStore holding its accounts in memory.
+// The domain given by clients is ignored, all accounts are local to the server.
+type MemoryUserStore struct {
+	mu    sync.RWMutex
+	users map[string]*User
+}
+
+// NewMemoryUserStore creates a store holding the given accounts
+func NewMemoryUserStore(users ...User) *MemoryUserStore {
+	s := &MemoryUserStore{users: make(map[string]*User)}
+	for _, u := range users {
+		s.users[userKey(u.Name)] = copyUser(u)
+	}
+	return s
+}
+
+// LookupUser returns the account of a user
+func (s *MemoryUserStore) LookupUser(domain string, name string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[userKey(name)]
+	if !ok {
+		return nil, ErrNoSuchUser
+	}
+	return u, nil
+}
+
+// Users returns all accounts sorted by name
+func (s *MemoryUserStore) Users() ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, *copyUser(*u))
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return userKey(users[i].Name) < userKey(users[j].Name)
+	})
+	return users, nil
+}
+
+// AddUser adds an account
+func (s *MemoryUserStore) AddUser(user User) error {
+	if user.Name == "" {
+		return ErrInvalidUserName
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := userKey(user.Name)
+	if _, ok := s.users[key]; ok {
+		return ErrUserExists
+	}
+	s.users[key] = copyUser(user)
+	return nil
+}
+
+// UpdateUser replaces an existing account
+func (s *MemoryUserStore) UpdateUser(user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := userKey(user.Name)
+	if _, ok := s.users[key]; !ok {
+		return ErrNoSuchUser
+	}
+	s.users[key] = copyUser(user)
+	return nil
+}
+
+// DeleteUser removes an account
+func (s *MemoryUserStore) DeleteUser(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := userKey(name)
+	if _, ok := s.users[key]; !ok {
+		return ErrNoSuchUser
+	}
+	delete(s.users, key)
+	return nil
+}
+
+// userKey returns the key of a user name, names are case-insensitive
+func userKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// copyUser returns a copy of an account that does not share its groups, users handed out are never modified
+func copyUser(u User) *User {
+	u.Groups = append([]string(nil), u.Groups...)
+	return &u
+}
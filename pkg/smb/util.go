@@ -5,15 +5,43 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"io"
+	"time"
 	"unicode/utf16"
 )
 
+// filetimeEpochOffset is the number of 100-nanosecond intervals between 1601-01-01 and 1970-01-01
+const filetimeEpochOffset = 116444736000000000
+
 func randomBytes(n int) []byte {
 	buf := make([]byte, n)
 	rand.Read(buf)
 	return buf
 }
 
+// newGUID generates a random GUID
+func newGUID() [16]byte {
+	var guid [16]byte
+	copy(guid[:], randomBytes(len(guid)))
+	return guid
+}
+
+// timeToFiletime converts a time to a Windows FILETIME, the number of
+// 100-nanosecond intervals since January 1, 1601 (UTC)
+func timeToFiletime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano()/100 + filetimeEpochOffset)
+}
+
+// minInt returns the smaller of two ints
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 func readSMBString(r io.Reader, isUnicode bool) (string, error) {
 	// Read the string length
 	var length uint8
@@ -29,13 +57,32 @@ func readSMBString(r io.Reader, isUnicode bool) (string, error) {
 
 	if isUnicode {
 		// If the string is in Unicode format, convert it to a Go string
-		return string(utf16.Decode(data)), nil
+		return decodeUTF16LE(data), nil
 	}
 
 	// Otherwise, return the raw string data
 	return string(data), nil
 }
 
+// encodeUTF16LE encodes a string as UTF-16 in little-endian byte order, without a terminating null
+func encodeUTF16LE(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, len(u)*2)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+	return b
+}
+
+// decodeUTF16LE decodes a UTF-16 little-endian byte slice into a string, a trailing odd byte is ignored
+func decodeUTF16LE(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
+
 // readVarString function takes a bytes.Reader object as its first argument,
 // the length of the string in bytes as its second argument, and a boolean indicating
 // whether the string is in Unicode format as its third argument. It reads the string
@@ -55,7 +102,7 @@ func readVarString(buf *bytes.Reader, n int, unicode bool) (string, error) {
 			return "", err
 		}
 		// Convert the byte slice to a Unicode string
-		return string(utf16.Decode(str)), nil
+		return decodeUTF16LE(str), nil
 	} else {
 		// Read 1 byte for each character in the string
 		str = make([]byte, n)
@@ -104,7 +151,7 @@ func writeVarString(buf *bytes.Buffer, s string) {
 
 		// Write the Unicode string
 		for i := 2; i < len(s); i += 2 {
-			binary.Write(buf, binary.LittleEndian, uint16(s[i]<<8|s[i+1]))
+			binary.Write(buf, binary.LittleEndian, uint16(s[i])<<8|uint16(s[i+1]))
 		}
 	} else {
 		// Write the ASCII string
@@ -0,0 +1,144 @@
+package smb
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Serve reads messages from the client and processes them until the connection fails, is drained or closed.
+// Messages are handled concurrently by up to Workers goroutines, while a single writer goroutine
+// sends the responses, so that each message is written as a whole and in the order it was queued.
+// The returned error is the read error or the protocol violation that ended the connection.
+func (c *Connection) Serve() error {
+	var wg sync.WaitGroup
+
+	// Start the writer
+	go c.writeLoop()
+
+	// Read and dispatch the messages
+	err := c.readLoop(&wg)
+
+	// Let the requests in progress finish and their responses be sent before closing
+	wg.Wait()
+	c.stopWriter()
+	c.Close()
+
+	return c.failure(err)
+}
+
+// readLoop reads messages and hands them to the workers until reading fails or the connection is drained
+func (c *Connection) readLoop(wg *sync.WaitGroup) error {
+	// workers holds a slot for every message being handled, at least one
+	n := c.limits.Workers
+	if n < 1 {
+		n = 1
+	}
+	workers := make(chan struct{}, n)
+
+	for {
+		// Drop the connection if the client stays idle for too long
+		if c.limits.IdleTimeout > 0 {
+			if err := c.Conn.SetReadDeadline(time.Now().Add(c.limits.IdleTimeout)); err != nil {
+				return err
+			}
+		}
+
+		// Stop reading once the connection is drained, the check follows the deadline update
+		// so that a deadline set by drain is never overwritten unnoticed
+		if atomic.LoadInt32(&c.draining) != 0 {
+			return nil
+		}
+
+		// Receive the next complete SMB message
+		data, err := ReadMessage(c.Conn, c.limits.MaxMessageSize)
+		if err != nil {
+			if atomic.LoadInt32(&c.draining) != 0 {
+				return nil
+			}
+			return err
+		}
+
+		// The negotiate exchange sets up the connection, handle it before reading on
+		if !c.negotiated() {
+			if err := c.handleMessage(data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Wait for a free worker, this stops reading from a client that sends faster than it is served
+		select {
+		case workers <- struct{}{}:
+		case <-c.done:
+			return net.ErrClosed
+		}
+
+		// Handle the message, a protocol violation closes the connection
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			if err := c.handleMessage(data); err != nil {
+				c.fail(err)
+			}
+		}()
+	}
+}
+
+// writeLoop sends the queued messages to the client until it is stopped or the connection is closed
+func (c *Connection) writeLoop() {
+	defer close(c.writerDone)
+
+	for {
+		select {
+		case msg := <-c.writes:
+			if msg == nil {
+				return
+			}
+			if err := WriteMessage(c.Conn, msg); err != nil {
+				c.fail(err)
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// stopWriter waits for the writer to send the messages queued so far and stops it
+func (c *Connection) stopWriter() {
+	select {
+	case c.writes <- nil:
+	case <-c.done:
+		return
+	}
+
+	select {
+	case <-c.writerDone:
+	case <-c.done:
+	}
+}
+
+// fail closes the connection because of err, only the first error is kept
+func (c *Connection) fail(err error) {
+	c.errOnce.Do(func() {
+		c.err = err
+	})
+	c.Close()
+}
+
+// failure returns the error that ended the connection, which is err unless a worker or the writer failed first
+func (c *Connection) failure(err error) error {
+	c.errOnce.Do(func() {
+		c.err = err
+	})
+	return c.err
+}
+
+// negotiated reports whether the negotiate exchange has completed
+func (c *Connection) negotiated() bool {
+	return c.dialect != DialectUnknown && c.dialect != DialectSMB2Wildcard
+}
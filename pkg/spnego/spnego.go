@@ -0,0 +1,245 @@
+// Package spnego implements the SPNEGO tokens (RFC 4178) that SMB carries in
+// session setup to negotiate the authentication mechanism.
+package spnego
+
+import (
+	"encoding/asn1"
+	"errors"
+)
+
+var (
+	// OIDSPNEGO identifies the SPNEGO mechanism itself
+	OIDSPNEGO = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}
+
+	// OIDNTLMSSP identifies NTLM authentication
+	OIDNTLMSSP = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}
+
+	// OIDKerberos5 identifies Kerberos V5 authentication
+	OIDKerberos5 = asn1.ObjectIdentifier{1, 2, 840, 113554, 1, 2, 2}
+
+	// OIDMSKerberos5 is the Kerberos V5 OID with the truncation bug of older Windows versions
+	OIDMSKerberos5 = asn1.ObjectIdentifier{1, 2, 840, 48018, 1, 2, 2}
+)
+
+// NegState represents the state of the negotiation in a NegTokenResp
+type NegState int
+
+const (
+	// NegStateAcceptCompleted ends a successful negotiation
+	NegStateAcceptCompleted NegState = 0
+
+	// NegStateAcceptIncomplete asks for more tokens
+	NegStateAcceptIncomplete NegState = 1
+
+	// NegStateReject ends a failed negotiation
+	NegStateReject NegState = 2
+
+	// NegStateRequestMIC asks the peer for a mechListMIC
+	NegStateRequestMIC NegState = 3
+)
+
+// ErrInvalidToken is returned for a token that is not a valid SPNEGO token
+var ErrInvalidToken = errors.New("spnego: invalid token")
+
+// ASN.1 tags of the GSS-API and NegotiationToken wrappers
+const (
+	tagInitialContextToken = 0
+	tagNegTokenInit        = 0
+	tagNegTokenResp        = 1
+)
+
+// NegTokenInit represents the token that starts the negotiation, it lists the mechanisms
+// the sender supports in order of preference and may carry the first token of the preferred one
+type NegTokenInit struct {
+	MechTypes   []asn1.ObjectIdentifier
+	MechToken   []byte
+	MechListMIC []byte
+
+	// RawMechTypes is the DER encoding of MechTypes as received, the mechListMIC is computed over it
+	RawMechTypes []byte
+}
+
+// negTokenInit is the ASN.1 structure of NegTokenInit.
+// MechTypes is kept raw, including its explicit tag, so that its encoding can be preserved.
+type negTokenInit struct {
+	MechTypes   asn1.RawValue  `asn1:"explicit,tag:0"`
+	ReqFlags    asn1.BitString `asn1:"explicit,optional,tag:1"`
+	MechToken   []byte         `asn1:"explicit,optional,tag:2"`
+	MechListMIC []byte         `asn1:"explicit,optional,tag:3"`
+}
+
+// Marshal serializes a NegTokenInit inside the GSS-API initial context token
+func (t *NegTokenInit) Marshal() ([]byte, error) {
+	// Encode the mechanism list
+	mechTypes, err := asn1.Marshal(t.MechTypes)
+	if err != nil {
+		return nil, err
+	}
+	mechTypes, err = wrap(asn1.ClassContextSpecific, 0, mechTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encode the token
+	token, err := asn1.Marshal(negTokenInit{
+		MechTypes:   asn1.RawValue{FullBytes: mechTypes},
+		MechToken:   t.MechToken,
+		MechListMIC: t.MechListMIC,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap it as the NegotiationToken choice
+	token, err = wrap(asn1.ClassContextSpecific, tagNegTokenInit, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prefix the SPNEGO OID and wrap it as the GSS-API initial context token
+	oid, err := asn1.Marshal(OIDSPNEGO)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(asn1.ClassApplication, tagInitialContextToken, append(oid, token...))
+}
+
+// NegTokenInitParse parses a NegTokenInit inside the GSS-API initial context token
+func NegTokenInitParse(data []byte) (*NegTokenInit, error) {
+	// Unwrap the GSS-API initial context token
+	content, err := unwrap(data, asn1.ClassApplication, tagInitialContextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the mechanism OID
+	var oid asn1.ObjectIdentifier
+	rest, err := asn1.Unmarshal(content, &oid)
+	if err != nil || !oid.Equal(OIDSPNEGO) {
+		return nil, ErrInvalidToken
+	}
+
+	// Unwrap the NegotiationToken choice
+	content, err = unwrap(rest, asn1.ClassContextSpecific, tagNegTokenInit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode the token
+	var token negTokenInit
+	if _, err := asn1.Unmarshal(content, &token); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// Decode the mechanism list
+	var mechTypes []asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(token.MechTypes.Bytes, &mechTypes); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return &NegTokenInit{
+		MechTypes:    mechTypes,
+		MechToken:    token.MechToken,
+		MechListMIC:  token.MechListMIC,
+		RawMechTypes: token.MechTypes.Bytes,
+	}, nil
+}
+
+// NegTokenResp represents the tokens following the NegTokenInit
+type NegTokenResp struct {
+	NegState      NegState
+	SupportedMech asn1.ObjectIdentifier
+	ResponseToken []byte
+	MechListMIC   []byte
+}
+
+// negTokenResp is the ASN.1 structure of NegTokenResp.
+// NegState is kept raw, including its explicit tag, encoding/asn1 would drop the zero value accept-completed.
+type negTokenResp struct {
+	NegState      asn1.RawValue         `asn1:"explicit,optional,tag:0"`
+	SupportedMech asn1.ObjectIdentifier `asn1:"explicit,optional,tag:1"`
+	ResponseToken []byte                `asn1:"explicit,optional,tag:2"`
+	MechListMIC   []byte                `asn1:"explicit,optional,tag:3"`
+}
+
+// Marshal serializes a NegTokenResp
+func (t *NegTokenResp) Marshal() ([]byte, error) {
+	// Encode the negotiation state
+	negState, err := asn1.Marshal(asn1.Enumerated(t.NegState))
+	if err != nil {
+		return nil, err
+	}
+	negState, err = wrap(asn1.ClassContextSpecific, 0, negState)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encode the token
+	token, err := asn1.Marshal(negTokenResp{
+		NegState:      asn1.RawValue{FullBytes: negState},
+		SupportedMech: t.SupportedMech,
+		ResponseToken: t.ResponseToken,
+		MechListMIC:   t.MechListMIC,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap it as the NegotiationToken choice
+	return wrap(asn1.ClassContextSpecific, tagNegTokenResp, token)
+}
+
+// NegTokenRespParse parses a NegTokenResp.
+// A token without a negotiation state is reported as NegStateAcceptIncomplete.
+func NegTokenRespParse(data []byte) (*NegTokenResp, error) {
+	// Unwrap the NegotiationToken choice
+	content, err := unwrap(data, asn1.ClassContextSpecific, tagNegTokenResp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode the token
+	var token negTokenResp
+	if _, err := asn1.Unmarshal(content, &token); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// Decode the negotiation state
+	negState := NegStateAcceptIncomplete
+	if len(token.NegState.FullBytes) > 0 {
+		var state asn1.Enumerated
+		if _, err := asn1.Unmarshal(token.NegState.Bytes, &state); err != nil {
+			return nil, ErrInvalidToken
+		}
+		negState = NegState(state)
+	}
+
+	return &NegTokenResp{
+		NegState:      negState,
+		SupportedMech: token.SupportedMech,
+		ResponseToken: token.ResponseToken,
+		MechListMIC:   token.MechListMIC,
+	}, nil
+}
+
+// IsNegTokenInit reports whether a token is a GSS-API initial context token, as opposed to a NegTokenResp
+func IsNegTokenInit(data []byte) bool {
+	return len(data) > 0 && data[0] == 0x60
+}
+
+// wrap encodes content as a constructed value with the given class and tag
+func wrap(class int, tag int, content []byte) ([]byte, error) {
+	return asn1.Marshal(asn1.RawValue{Class: class, Tag: tag, IsCompound: true, Bytes: content})
+}
+
+// unwrap returns the content of a constructed value with the given class and tag
+func unwrap(data []byte, class int, tag int) ([]byte, error) {
+	var v asn1.RawValue
+	if _, err := asn1.Unmarshal(data, &v); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if v.Class != class || v.Tag != tag || !v.IsCompound {
+		return nil, ErrInvalidToken
+	}
+	return v.Bytes, nil
+}
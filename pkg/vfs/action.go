@@ -0,0 +1,18 @@
+package vfs
+
+// Action tells what Open did to the file
+type Action int
+
+const (
+	// ActionSuperseded means that an existing file was replaced
+	ActionSuperseded Action = iota
+
+	// ActionOpened means that an existing file was opened
+	ActionOpened
+
+	// ActionCreated means that the file was created
+	ActionCreated
+
+	// ActionOverwritten means that an existing file was truncated
+	ActionOverwritten
+)
@@ -0,0 +1,42 @@
+package vfs
+
+// Attributes represents the attributes of a file, with the values of the Windows file attributes
+type Attributes uint32
+
+const (
+	// AttrReadOnly marks a file that cannot be written or deleted
+	AttrReadOnly Attributes = 0x00000001
+
+	// AttrHidden marks a file left out of ordinary directory listings
+	AttrHidden Attributes = 0x00000002
+
+	// AttrSystem marks a file used by the operating system
+	AttrSystem Attributes = 0x00000004
+
+	// AttrDirectory marks a directory
+	AttrDirectory Attributes = 0x00000010
+
+	// AttrArchive marks a file changed since it was last backed up
+	AttrArchive Attributes = 0x00000020
+
+	// AttrNormal marks a file without any other attribute
+	AttrNormal Attributes = 0x00000080
+
+	// AttrTemporary marks a file that is only used for a short time
+	AttrTemporary Attributes = 0x00000100
+)
+
+// settableAttributes are the attributes clients may change
+const settableAttributes = AttrReadOnly | AttrHidden | AttrSystem | AttrArchive | AttrTemporary
+
+// normalize returns the attributes to report, AttrNormal if no other is set
+func (a Attributes) normalize(dir bool) Attributes {
+	a &^= AttrNormal | AttrDirectory
+	if dir {
+		a |= AttrDirectory
+	}
+	if a == 0 {
+		a = AttrNormal
+	}
+	return a
+}
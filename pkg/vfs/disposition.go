@@ -0,0 +1,29 @@
+package vfs
+
+// Disposition tells Open what to do when the file exists and when it does not
+type Disposition int
+
+const (
+	// DispositionSupersede replaces an existing file and creates a missing one
+	DispositionSupersede Disposition = iota
+
+	// DispositionOpen opens an existing file and fails if it is missing
+	DispositionOpen
+
+	// DispositionCreate creates a missing file and fails if it exists
+	DispositionCreate
+
+	// DispositionOpenIf opens an existing file and creates a missing one
+	DispositionOpenIf
+
+	// DispositionOverwrite truncates an existing file and fails if it is missing
+	DispositionOverwrite
+
+	// DispositionOverwriteIf truncates an existing file and creates a missing one
+	DispositionOverwriteIf
+)
+
+// creates reports whether the disposition creates a missing file
+func (d Disposition) creates() bool {
+	return d != DispositionOpen && d != DispositionOverwrite
+}
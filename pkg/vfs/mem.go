@@ -0,0 +1,716 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is an FS keeping its files in memory, for tests and scratch shares. Files have attributes,
+// alternate data streams and byte-range locks. The data of all streams is limited to the capacity
+// of the FS, extended attributes are not counted. Names are case-sensitive.
+type MemFS struct {
+	mu   sync.Mutex
+	root *memNode
+
+	// capacity bounds the bytes stored, used counts the bytes stored
+	capacity int64
+	used     int64
+
+	// nextID is the file ID of the last file created
+	nextID uint64
+}
+
+// memNode is a file or directory of a MemFS
+type memNode struct {
+	id  uint64
+	dir bool
+
+	// children holds the entries of a directory
+	children map[string]*memNode
+
+	// streams holds the data of a file, the main stream has an empty name
+	streams map[string]*memStream
+
+	attrs  Attributes
+	xattrs map[string][]byte
+
+	created  time.Time
+	modified time.Time
+	accessed time.Time
+	changed  time.Time
+
+	// removed is set once the node is no longer reachable, its data no longer counts
+	removed bool
+}
+
+// memStream is a data stream of a file with the byte-range locks taken on it
+type memStream struct {
+	data  []byte
+	locks []memLock
+}
+
+// memLock is a byte-range lock held by an open
+type memLock struct {
+	owner     *memFile
+	off       int64
+	length    int64
+	exclusive bool
+}
+
+// DefaultMemCapacity is the capacity of a MemFS created without one. A write far past the end
+// of a file fills the gap with zeros, the default keeps a single request from exhausting memory.
+const DefaultMemCapacity = 1 << 30
+
+// NewMemFS creates an empty MemFS holding at most capacity bytes, zero means DefaultMemCapacity
+func NewMemFS(capacity int64) *MemFS {
+	if capacity <= 0 {
+		capacity = DefaultMemCapacity
+	}
+	f := &MemFS{capacity: capacity}
+	f.root = f.newNode(true, time.Now())
+	return f
+}
+
+// newNode creates a file or directory
+func (f *MemFS) newNode(dir bool, now time.Time) *memNode {
+	f.nextID++
+	n := &memNode{
+		id:       f.nextID,
+		dir:      dir,
+		xattrs:   make(map[string][]byte),
+		created:  now,
+		modified: now,
+		accessed: now,
+		changed:  now,
+	}
+	if dir {
+		n.children = make(map[string]*memNode)
+	} else {
+		n.streams = map[string]*memStream{"": {}}
+	}
+	return n
+}
+
+// lookup finds a name, it returns its directory and last element as well so that a missing
+// file can be created. The directory is nil for the root.
+func (f *MemFS) lookup(name string) (*memNode, string, *memNode, error) {
+	if !ValidName(name) {
+		return nil, "", nil, ErrInvalidName
+	}
+	if name == "." {
+		return nil, "", f.root, nil
+	}
+	elems := strings.Split(name, "/")
+	dir := f.root
+	for _, elem := range elems[:len(elems)-1] {
+		next, ok := dir.children[elem]
+		switch {
+		case !ok:
+			return nil, "", nil, ErrNotExist
+		case !next.dir:
+			return nil, "", nil, ErrNotDir
+		}
+		dir = next
+	}
+	base := elems[len(elems)-1]
+	return dir, base, dir.children[base], nil
+}
+
+// resize changes the size of a stream within the capacity of the FS
+func (f *MemFS) resize(n *memNode, st *memStream, size int64) error {
+	delta := size - int64(len(st.data))
+	if !n.removed && delta > 0 && f.used+delta > f.capacity {
+		return ErrNoSpace
+	}
+	if size > int64(len(st.data)) {
+		st.data = append(st.data, make([]byte, size-int64(len(st.data)))...)
+	} else if size == 0 {
+		st.data = nil
+	} else {
+		st.data = st.data[:size]
+	}
+	if !n.removed {
+		f.used += delta
+	}
+	return nil
+}
+
+// release frees the data of a node that was unlinked, open files keep working on it
+func (f *MemFS) release(n *memNode) {
+	n.removed = true
+	for _, st := range n.streams {
+		f.used -= int64(len(st.data))
+	}
+	for _, child := range n.children {
+		f.release(child)
+	}
+}
+
+// Open opens or creates a file or directory according to the options
+func (f *MemFS) Open(name string, opts OpenOptions) (File, Action, error) {
+	return f.open(name, "", opts)
+}
+
+// OpenStream opens or creates a named stream of a file, a missing file is created with the stream
+func (f *MemFS) OpenStream(name, stream string, opts OpenOptions) (File, Action, error) {
+	if !ValidStreamName(stream) {
+		return nil, 0, ErrInvalidName
+	}
+	if opts.Directory {
+		return nil, 0, ErrNotDir
+	}
+	return f.open(name, stream, opts)
+}
+
+// open opens the main or a named stream of a file
+func (f *MemFS) open(name, stream string, opts OpenOptions) (File, Action, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dir, base, n, err := f.lookup(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	now := time.Now()
+
+	// Create a missing file or directory
+	if n == nil {
+		if !opts.Disposition.creates() {
+			return nil, 0, ErrNotExist
+		}
+		n = f.newNode(opts.Directory, now)
+		if stream != "" {
+			n.streams[stream] = &memStream{}
+		}
+		dir.children[base] = n
+		dir.modified, dir.changed = now, now
+		return &memFile{fs: f, node: n, name: name, stream: stream, write: opts.Write}, ActionCreated, nil
+	}
+
+	// Find the stream of an existing file, creating a missing named stream
+	action := ActionCreated
+	st := n.streams[stream]
+	if stream == "" || st != nil {
+		if action, err = opts.check(n.dir && stream == ""); err != nil {
+			return nil, 0, err
+		}
+	} else if !opts.Disposition.creates() {
+		return nil, 0, ErrNotExist
+	}
+	if (opts.Write || action != ActionOpened) && n.attrs&AttrReadOnly != 0 {
+		return nil, 0, ErrPermission
+	}
+	switch {
+	case st == nil && stream != "":
+		n.streams[stream] = &memStream{}
+		n.modified, n.changed = now, now
+	case action == ActionSuperseded || action == ActionOverwritten:
+		if err := f.resize(n, st, 0); err != nil {
+			return nil, 0, err
+		}
+		n.modified, n.changed = now, now
+	}
+	return &memFile{fs: f, node: n, name: name, stream: stream, write: opts.Write}, action, nil
+}
+
+// Stat returns the information of a file or directory
+func (f *MemFS) Stat(name string) (*FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, _, n, err := f.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		return nil, ErrNotExist
+	}
+	return n.info(path.Base(name), ""), nil
+}
+
+// Rename moves a file or directory, an existing target is only replaced if replace is set.
+// A directory cannot replace or be moved into itself.
+func (f *MemFS) Rename(oldname, newname string, replace bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if oldname == "." || newname == "." {
+		return ErrPermission
+	}
+	oldDir, oldBase, n, err := f.lookup(oldname)
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		return ErrNotExist
+	}
+	newDir, newBase, target, err := f.lookup(newname)
+	if err != nil {
+		return err
+	}
+	if n.dir && strings.HasPrefix(newname, oldname+"/") {
+		return ErrInvalidName
+	}
+
+	// Replace the target
+	if target == n {
+		return nil
+	}
+	if target != nil {
+		switch {
+		case !replace:
+			return ErrExist
+		case target.dir:
+			return ErrIsDir
+		}
+		f.release(target)
+	}
+
+	now := time.Now()
+	delete(oldDir.children, oldBase)
+	newDir.children[newBase] = n
+	oldDir.modified, oldDir.changed = now, now
+	newDir.modified, newDir.changed = now, now
+	n.changed = now
+	return nil
+}
+
+// Remove removes a file or an empty directory
+func (f *MemFS) Remove(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if name == "." {
+		return ErrPermission
+	}
+	dir, base, n, err := f.lookup(name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case n == nil:
+		return ErrNotExist
+	case n.dir && len(n.children) > 0:
+		return ErrNotEmpty
+	}
+
+	now := time.Now()
+	delete(dir.children, base)
+	dir.modified, dir.changed = now, now
+	f.release(n)
+	return nil
+}
+
+// Streams lists the streams of a file, the main stream of a regular file first
+func (f *MemFS) Streams(name string) ([]StreamInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, _, n, err := f.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		return nil, ErrNotExist
+	}
+	streams := make([]StreamInfo, 0, len(n.streams))
+	for name, st := range n.streams {
+		streams = append(streams, StreamInfo{Name: name, Size: int64(len(st.data))})
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].Name < streams[j].Name
+	})
+	return streams, nil
+}
+
+// RemoveStream removes a named stream of a file
+func (f *MemFS) RemoveStream(name, stream string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !ValidStreamName(stream) {
+		return ErrInvalidName
+	}
+	_, _, n, err := f.lookup(name)
+	if err != nil {
+		return err
+	}
+	if n == nil || n.streams[stream] == nil {
+		return ErrNotExist
+	}
+	if !n.removed {
+		f.used -= int64(len(n.streams[stream].data))
+	}
+	delete(n.streams, stream)
+	n.changed = time.Now()
+	return nil
+}
+
+// Usage returns the capacity of the FS and the free space
+func (f *MemFS) Usage() (int64, int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.capacity, f.capacity - f.used
+}
+
+// info describes a node, or one of its streams if stream is set
+func (n *memNode) info(name, stream string) *FileInfo {
+	info := &FileInfo{
+		Name:         name,
+		Mode:         0644,
+		Attributes:   n.attrs.normalize(n.dir),
+		ModTime:      n.modified,
+		AccessTime:   n.accessed,
+		ChangeTime:   n.changed,
+		CreationTime: n.created,
+		FileID:       n.id,
+		Links:        1,
+	}
+	if n.attrs&AttrReadOnly != 0 {
+		info.Mode = 0444
+	}
+	if n.dir {
+		info.Mode |= fs.ModeDir | 0111
+	}
+	if st := n.streams[stream]; st != nil {
+		info.Size = int64(len(st.data))
+	}
+	return info
+}
+
+// memFile is a file opened on a MemFS
+type memFile struct {
+	fs     *MemFS
+	node   *memNode
+	name   string
+	stream string
+
+	// write allows changing the data, closed is set by Close
+	write  bool
+	closed bool
+}
+
+// data returns the stream the file was opened on
+func (f *memFile) data() (*memStream, error) {
+	if f.closed {
+		return nil, fs.ErrClosed
+	}
+	if f.node.dir && f.stream == "" {
+		return nil, ErrIsDir
+	}
+	st := f.node.streams[f.stream]
+	if st == nil {
+		return nil, ErrNotExist
+	}
+	return st, nil
+}
+
+// Name returns the name the file was opened with
+func (f *memFile) Name() string {
+	return f.name
+}
+
+// ReadAt reads from the file at an offset
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	st, err := f.data()
+	if err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, ErrInvalidOffset
+	}
+	if st.conflicts(f, off, int64(len(p)), false) {
+		return 0, ErrLockConflict
+	}
+	f.node.accessed = time.Now()
+	if off >= int64(len(st.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, st.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt writes to the file at an offset, extending it if needed
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	st, err := f.data()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case !f.write:
+		return 0, ErrPermission
+	case off < 0:
+		return 0, ErrInvalidOffset
+	case st.conflicts(f, off, int64(len(p)), true):
+		return 0, ErrLockConflict
+	}
+	if end := off + int64(len(p)); end > int64(len(st.data)) {
+		if err := f.fs.resize(f.node, st, end); err != nil {
+			return 0, err
+		}
+	}
+	copy(st.data[off:], p)
+	f.touch()
+	return len(p), nil
+}
+
+// touch records a change of the data
+func (f *memFile) touch() {
+	now := time.Now()
+	f.node.modified, f.node.changed = now, now
+	f.node.attrs |= AttrArchive
+}
+
+// Stat returns the information of the file
+func (f *memFile) Stat() (*FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return nil, fs.ErrClosed
+	}
+	return f.node.info(path.Base(f.name), f.stream), nil
+}
+
+// Truncate changes the size of the file
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	st, err := f.data()
+	if err != nil {
+		return err
+	}
+	switch {
+	case !f.write:
+		return ErrPermission
+	case size < 0:
+		return ErrInvalidOffset
+	}
+	if err := f.fs.resize(f.node, st, size); err != nil {
+		return err
+	}
+	f.touch()
+	return nil
+}
+
+// Readdir returns the entries of the directory sorted by name
+func (f *memFile) Readdir() ([]*FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	switch {
+	case f.closed:
+		return nil, fs.ErrClosed
+	case !f.node.dir || f.stream != "":
+		return nil, ErrNotDir
+	}
+	infos := make([]*FileInfo, 0, len(f.node.children))
+	for name, child := range f.node.children {
+		infos = append(infos, child.info(name, ""))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	f.node.accessed = time.Now()
+	return infos, nil
+}
+
+// SetTimes changes the access and modification times, a zero time is left unchanged
+func (f *memFile) SetTimes(atime, mtime time.Time) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return fs.ErrClosed
+	}
+	if !atime.IsZero() {
+		f.node.accessed = atime
+	}
+	if !mtime.IsZero() {
+		f.node.modified = mtime
+	}
+	f.node.changed = time.Now()
+	return nil
+}
+
+// SetAttributes replaces the attributes that can be set
+func (f *memFile) SetAttributes(attrs Attributes) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.node.attrs = attrs & settableAttributes
+	f.node.changed = time.Now()
+	return nil
+}
+
+// Sync does nothing, memory is as stable as it gets
+func (f *memFile) Sync() error {
+	return nil
+}
+
+// GetXattr returns the value of an extended attribute
+func (f *memFile) GetXattr(name string) ([]byte, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	value, ok := f.node.xattrs[name]
+	if !ok {
+		return nil, ErrNotExist
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// SetXattr sets the value of an extended attribute
+func (f *memFile) SetXattr(name string, value []byte) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	f.node.xattrs[name] = append([]byte(nil), value...)
+	f.node.changed = time.Now()
+	return nil
+}
+
+// RemoveXattr removes an extended attribute
+func (f *memFile) RemoveXattr(name string) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if _, ok := f.node.xattrs[name]; !ok {
+		return ErrNotExist
+	}
+	delete(f.node.xattrs, name)
+	f.node.changed = time.Now()
+	return nil
+}
+
+// ListXattrs returns the names of the extended attributes
+func (f *memFile) ListXattrs() ([]string, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	names := make([]string, 0, len(f.node.xattrs))
+	for name := range f.node.xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Lock locks a range of the file, the lock is released by Unlock or Close
+func (f *memFile) Lock(off, length int64, exclusive bool) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	st, err := f.data()
+	if err != nil {
+		return err
+	}
+	if off < 0 || length < 0 {
+		return ErrInvalidOffset
+	}
+
+	// A shared lock may overlap the locks of the same open, other overlaps need both locks to be shared
+	for _, l := range st.locks {
+		if !overlaps(l.off, l.length, off, length) || !l.exclusive && !exclusive {
+			continue
+		}
+		if l.owner == f && !exclusive {
+			continue
+		}
+		return ErrLockConflict
+	}
+	st.locks = append(st.locks, memLock{owner: f, off: off, length: length, exclusive: exclusive})
+	return nil
+}
+
+// Unlock releases the lock taken on exactly the range
+func (f *memFile) Unlock(off, length int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	st, err := f.data()
+	if err != nil {
+		return err
+	}
+	for i, l := range st.locks {
+		if l.owner == f && l.off == off && l.length == length {
+			st.locks = append(st.locks[:i], st.locks[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotLocked
+}
+
+// CheckLock tells whether the open may read or write a range
+func (f *memFile) CheckLock(off, length int64, write bool) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	st, err := f.data()
+	if err != nil {
+		return err
+	}
+	if st.conflicts(f, off, length, write) {
+		return ErrLockConflict
+	}
+	return nil
+}
+
+// conflicts reports whether an open may not access a range. Exclusive locks keep other opens out,
+// shared locks refuse writes to everybody.
+func (st *memStream) conflicts(f *memFile, off, length int64, write bool) bool {
+	for _, l := range st.locks {
+		if !overlaps(l.off, l.length, off, length) {
+			continue
+		}
+		if l.exclusive && l.owner != f || !l.exclusive && write {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps reports whether two byte ranges share a byte, empty ranges overlap nothing
+func overlaps(off1, len1, off2, len2 int64) bool {
+	return len1 > 0 && len2 > 0 && off1 < off2+len2 && off2 < off1+len1
+}
+
+// Close releases the locks of the open and closes it
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	for _, st := range f.node.streams {
+		locks := st.locks[:0]
+		for _, l := range st.locks {
+			if l.owner != f {
+				locks = append(locks, l)
+			}
+		}
+		st.locks = locks
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package vfs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemFSDispositions(t *testing.T) {
+	testDispositions(t, func(t *testing.T) FS {
+		return NewMemFS(0)
+	})
+}
+
+func TestMemFSCapacity(t *testing.T) {
+	fsys := NewMemFS(10)
+	f, _, err := fsys.Open("file.txt", OpenOptions{Disposition: DispositionCreate, Write: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Writes within the capacity succeed, the ones going beyond fail and change nothing
+	if _, err := f.WriteAt([]byte("hello"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("world!"), 5); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("write beyond the capacity error = %v, want %v", err, ErrNoSpace)
+	}
+	if err := f.Truncate(11); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("truncate beyond the capacity error = %v, want %v", err, ErrNoSpace)
+	}
+	if total, free := fsys.Usage(); total != 10 || free != 5 {
+		t.Errorf("usage = %d total %d free, want 10 total 5 free", total, free)
+	}
+
+	// Streams count against the same capacity
+	s, _, err := fsys.OpenStream("file.txt", "extra", OpenOptions{Disposition: DispositionCreate, Write: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.WriteAt([]byte("123456"), 0); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("stream write beyond the capacity error = %v, want %v", err, ErrNoSpace)
+	}
+	if _, err := s.WriteAt([]byte("12345"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing the file frees its space
+	if err := fsys.Remove("file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, free := fsys.Usage(); free != 10 {
+		t.Errorf("free space once removed = %d, want 10", free)
+	}
+}
+
+func TestMemFSDefaultCapacity(t *testing.T) {
+	fsys := NewMemFS(0)
+	f, _, err := fsys.Open("sparse.bin", OpenOptions{Disposition: DispositionCreate, Write: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// A write far past the end would fill the gap with zeros, it fails without allocating
+	if _, err := f.WriteAt([]byte("x"), 1<<40); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("write far past the end error = %v, want %v", err, ErrNoSpace)
+	}
+	if err := f.Truncate(1 << 40); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("truncate far past the end error = %v, want %v", err, ErrNoSpace)
+	}
+	if info, err := f.Stat(); err != nil || info.Size != 0 {
+		t.Errorf("size after the failed writes = %v, %v, want 0", info, err)
+	}
+	if total, free := fsys.Usage(); total != DefaultMemCapacity || free != DefaultMemCapacity {
+		t.Errorf("usage = %d total %d free, want %d for both", total, free, DefaultMemCapacity)
+	}
+}
+
+func TestMemFSLocks(t *testing.T) {
+	tests := []struct {
+		name      string
+		exclusive bool
+		off       int64
+		length    int64
+		write     bool
+		want      error
+	}{
+		{name: "read in exclusive range", exclusive: true, off: 2, length: 4, want: ErrLockConflict},
+		{name: "write in exclusive range", exclusive: true, off: 0, length: 1, write: true, want: ErrLockConflict},
+		{name: "read past exclusive range", exclusive: true, off: 4, length: 4},
+		{name: "read in shared range", off: 0, length: 4},
+		{name: "write in shared range", off: 3, length: 2, write: true, want: ErrLockConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := NewMemFS(0)
+			f, _, err := fsys.Open("file.txt", OpenOptions{Disposition: DispositionCreate, Write: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.WriteAt([]byte("01234567"), 0); err != nil {
+				t.Fatal(err)
+			}
+			g, _, err := fsys.Open("file.txt", OpenOptions{Disposition: DispositionOpen, Write: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer g.Close()
+
+			// Lock the first half of the file through the first open
+			if err := f.(LockFile).Lock(0, 4, tt.exclusive); err != nil {
+				t.Fatal(err)
+			}
+
+			// Access the range through the second open
+			buf := make([]byte, tt.length)
+			if tt.write {
+				_, err = g.WriteAt(buf, tt.off)
+			} else {
+				_, err = g.ReadAt(buf, tt.off)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("access error = %v, want %v", err, tt.want)
+			}
+			if err := g.(LockFile).Lock(0, 4, true); !errors.Is(err, ErrLockConflict) {
+				t.Errorf("conflicting lock error = %v, want %v", err, ErrLockConflict)
+			}
+
+			// Closing the first open releases its locks
+			f.Close()
+			if err := g.(LockFile).CheckLock(0, 4, true); err != nil {
+				t.Errorf("check once unlocked error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package vfs
+
+// OpenOptions controls how Open opens a file
+type OpenOptions struct {
+	// Disposition selects what happens to existing and missing files
+	Disposition Disposition
+
+	// Directory requires a directory and creates one, NonDirectory refuses directories
+	Directory    bool
+	NonDirectory bool
+
+	// Write opens the file for writing as well as reading
+	Write bool
+
+	// WriteThrough commits every write to stable storage before it returns
+	WriteThrough bool
+}
+
+// check applies the options to an existing file or directory and returns what Open must do with it
+func (o *OpenOptions) check(isDir bool) (Action, error) {
+	switch {
+	case o.Disposition == DispositionCreate:
+		return 0, ErrExist
+	case o.Directory && !isDir:
+		return 0, ErrNotDir
+	case o.NonDirectory && isDir:
+		return 0, ErrIsDir
+	}
+	switch o.Disposition {
+	case DispositionSupersede:
+		if isDir {
+			return 0, ErrIsDir
+		}
+		return ActionSuperseded, nil
+	case DispositionOverwrite, DispositionOverwriteIf:
+		if isDir {
+			return 0, ErrIsDir
+		}
+		return ActionOverwritten, nil
+	default:
+		return ActionOpened, nil
+	}
+}
@@ -0,0 +1,322 @@
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// OSFS is an FS backed by a directory of the local filesystem. Symbolic links are followed
+// as long as they stay inside the directory.
+type OSFS struct {
+	root string
+}
+
+// NewOSFS creates an FS rooted at the directory root
+func NewOSFS(root string) *OSFS {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		root = real
+	}
+	return &OSFS{root: filepath.Clean(root)}
+}
+
+// path returns the local path of a name with its symbolic links resolved, a link leading
+// out of the root is refused
+func (f *OSFS) path(name string) (string, error) {
+	if !ValidName(name) {
+		return "", ErrInvalidName
+	}
+	p := filepath.Join(f.root, filepath.FromSlash(name))
+
+	// Resolve the links of the path, a missing file is resolved through its directory
+	real, err := filepath.EvalSymlinks(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		dir, err := filepath.EvalSymlinks(filepath.Dir(p))
+		if err != nil {
+			return "", osError(err)
+		}
+		real = filepath.Join(dir, filepath.Base(p))
+	} else if err != nil {
+		return "", osError(err)
+	}
+	if real != f.root && !strings.HasPrefix(real, f.root+string(filepath.Separator)) {
+		return "", ErrPermission
+	}
+	return real, nil
+}
+
+// RealPath returns the local path of a file with its links resolved
+func (f *OSFS) RealPath(name string) (string, error) {
+	return f.path(name)
+}
+
+// Open opens or creates a file or directory according to the options
+func (f *OSFS) Open(name string, opts OpenOptions) (File, Action, error) {
+	p, err := f.path(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Check an existing file against the options
+	fi, err := os.Stat(p)
+	switch {
+	case err == nil:
+		action, err := opts.check(fi.IsDir())
+		if err != nil {
+			return nil, 0, err
+		}
+		flags := os.O_RDONLY
+		switch {
+		case fi.IsDir():
+		case action != ActionOpened:
+			flags = os.O_RDWR | os.O_TRUNC
+		case opts.Write:
+			flags = os.O_RDWR
+		}
+		file, err := f.openFile(name, p, flags, opts)
+		return file, action, err
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, 0, osError(err)
+	case !opts.Disposition.creates():
+		return nil, 0, ErrNotExist
+	}
+
+	// Create the missing file or directory
+	flags := os.O_RDONLY
+	if opts.Directory {
+		if err := os.Mkdir(p, 0755); err != nil {
+			return nil, 0, osError(err)
+		}
+	} else {
+		flags = os.O_RDWR | os.O_CREATE | os.O_EXCL
+	}
+	file, err := f.openFile(name, p, flags, opts)
+	return file, ActionCreated, err
+}
+
+// openFile opens the local file of a name
+func (f *OSFS) openFile(name, p string, flags int, opts OpenOptions) (File, error) {
+	if opts.WriteThrough && flags != os.O_RDONLY {
+		flags |= os.O_SYNC
+	}
+	file, err := os.OpenFile(p, flags, 0644)
+	if err != nil {
+		return nil, osError(err)
+	}
+	return &osFile{fs: f, name: name, path: p, file: file}, nil
+}
+
+// Stat returns the information of a file or directory
+func (f *OSFS) Stat(name string) (*FileInfo, error) {
+	p, err := f.path(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, osError(err)
+	}
+	return fileInfo(path.Base(name), fi), nil
+}
+
+// Rename moves a file or directory, an existing target is only replaced if replace is set
+func (f *OSFS) Rename(oldname, newname string, replace bool) error {
+	if oldname == "." || newname == "." {
+		return ErrPermission
+	}
+	oldpath, err := f.path(oldname)
+	if err != nil {
+		return err
+	}
+	newpath, err := f.path(newname)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(newpath); err == nil && !replace {
+		return ErrExist
+	}
+	return osError(os.Rename(oldpath, newpath))
+}
+
+// Remove removes a file or an empty directory
+func (f *OSFS) Remove(name string) error {
+	if name == "." {
+		return ErrPermission
+	}
+	p, err := f.path(name)
+	if err != nil {
+		return err
+	}
+	return osError(os.Remove(p))
+}
+
+// osFile is a file opened by an OSFS
+type osFile struct {
+	fs   *OSFS
+	name string
+	path string
+	file *os.File
+}
+
+// Name returns the name the file was opened with
+func (f *osFile) Name() string {
+	return f.name
+}
+
+// ReadAt reads from the file at an offset
+func (f *osFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.file.ReadAt(p, off)
+	return n, osError(err)
+}
+
+// WriteAt writes to the file at an offset
+func (f *osFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.file.WriteAt(p, off)
+	return n, osError(err)
+}
+
+// Stat returns the information of the file
+func (f *osFile) Stat() (*FileInfo, error) {
+	fi, err := f.file.Stat()
+	if err != nil {
+		return nil, osError(err)
+	}
+	return fileInfo(path.Base(f.name), fi), nil
+}
+
+// Truncate changes the size of the file
+func (f *osFile) Truncate(size int64) error {
+	return osError(f.file.Truncate(size))
+}
+
+// Readdir returns the entries of the directory sorted by name. Entries that cannot be
+// read, like dangling links and links leading out of the root, are left out.
+func (f *osFile) Readdir() ([]*FileInfo, error) {
+	entries, err := os.ReadDir(f.path)
+	if err != nil {
+		return nil, osError(err)
+	}
+	infos := make([]*FileInfo, 0, len(entries))
+	for _, e := range entries {
+		fi, err := f.fs.Stat(path.Join(f.name, e.Name()))
+		if err != nil {
+			continue
+		}
+		infos = append(infos, fi)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos, nil
+}
+
+// SetTimes changes the access and modification times, a zero time is left unchanged
+func (f *osFile) SetTimes(atime, mtime time.Time) error {
+	if atime.IsZero() || mtime.IsZero() {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if atime.IsZero() {
+			atime = fi.AccessTime
+		}
+		if mtime.IsZero() {
+			mtime = fi.ModTime
+		}
+	}
+	return osError(os.Chtimes(f.path, atime, mtime))
+}
+
+// Sync commits the data of the file to stable storage
+func (f *osFile) Sync() error {
+	return osError(f.file.Sync())
+}
+
+// GetXattr returns the value of an extended attribute
+func (f *osFile) GetXattr(name string) ([]byte, error) {
+	return getXattr(f.path, name)
+}
+
+// SetXattr sets the value of an extended attribute
+func (f *osFile) SetXattr(name string, value []byte) error {
+	return setXattr(f.path, name, value)
+}
+
+// RemoveXattr removes an extended attribute
+func (f *osFile) RemoveXattr(name string) error {
+	return removeXattr(f.path, name)
+}
+
+// ListXattrs returns the names of the extended attributes
+func (f *osFile) ListXattrs() ([]string, error) {
+	return listXattrs(f.path)
+}
+
+// Close closes the file
+func (f *osFile) Close() error {
+	return osError(f.file.Close())
+}
+
+// fileInfo converts the information of a local file
+func fileInfo(name string, fi os.FileInfo) *FileInfo {
+	info := &FileInfo{
+		Name:         name,
+		Size:         fi.Size(),
+		Mode:         fi.Mode(),
+		ModTime:      fi.ModTime(),
+		AccessTime:   fi.ModTime(),
+		ChangeTime:   fi.ModTime(),
+		CreationTime: fi.ModTime(),
+		Links:        1,
+	}
+	if fi.IsDir() {
+		info.Size = 0
+	}
+
+	// Files without write permission are read-only, dot files are hidden like Samba does by default
+	var attrs Attributes
+	if fi.Mode().Perm()&0222 == 0 {
+		attrs |= AttrReadOnly
+	}
+	if strings.HasPrefix(name, ".") && name != "." && name != ".." {
+		attrs |= AttrHidden
+	}
+	info.Attributes = attrs.normalize(fi.IsDir())
+
+	statSys(info, fi)
+	return info
+}
+
+// osError maps the errors of the local filesystem to the errors of the package,
+// errors without an equivalent are returned unchanged
+func osError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrNotExist
+	case errors.Is(err, syscall.ENOTEMPTY):
+		// Checked first, it also matches fs.ErrExist
+		return ErrNotEmpty
+	case errors.Is(err, fs.ErrExist):
+		return ErrExist
+	case errors.Is(err, fs.ErrPermission), errors.Is(err, syscall.EBADF):
+		// Writing to a file opened read-only fails with EBADF
+		return ErrPermission
+	case errors.Is(err, syscall.EISDIR):
+		return ErrIsDir
+	case errors.Is(err, syscall.ENOTDIR):
+		return ErrNotDir
+	default:
+		return err
+	}
+}
@@ -0,0 +1,102 @@
+package vfs
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// xattrPrefix is the namespace holding the extended attributes of files, the only one users can write
+const xattrPrefix = "user."
+
+// statSys fills in the times, file ID and link count of a local file. Linux does not report the
+// creation time through stat, the earliest of the change and modification times stands in for it.
+func statSys(info *FileInfo, fi os.FileInfo) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	info.AccessTime = time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec))
+	info.ChangeTime = time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec))
+	info.CreationTime = info.ModTime
+	if info.ChangeTime.Before(info.CreationTime) {
+		info.CreationTime = info.ChangeTime
+	}
+	info.FileID = uint64(st.Ino)
+	info.Links = uint32(st.Nlink)
+}
+
+// getXattr returns the value of an extended attribute of a local file
+func getXattr(path, name string) ([]byte, error) {
+	for {
+		size, err := syscall.Getxattr(path, xattrPrefix+name, nil)
+		if err != nil {
+			return nil, xattrError(err)
+		}
+		value := make([]byte, size)
+		n, err := syscall.Getxattr(path, xattrPrefix+name, value)
+		if err == syscall.ERANGE {
+			// The attribute grew in between
+			continue
+		}
+		if err != nil {
+			return nil, xattrError(err)
+		}
+		return value[:n], nil
+	}
+}
+
+// setXattr sets an extended attribute of a local file
+func setXattr(path, name string, value []byte) error {
+	return xattrError(syscall.Setxattr(path, xattrPrefix+name, value, 0))
+}
+
+// removeXattr removes an extended attribute of a local file
+func removeXattr(path, name string) error {
+	return xattrError(syscall.Removexattr(path, xattrPrefix+name))
+}
+
+// listXattrs returns the names of the extended attributes of a local file
+func listXattrs(path string) ([]string, error) {
+	var buf []byte
+	for {
+		size, err := syscall.Listxattr(path, nil)
+		if err != nil {
+			return nil, xattrError(err)
+		}
+		buf = make([]byte, size)
+		n, err := syscall.Listxattr(path, buf)
+		if err == syscall.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, xattrError(err)
+		}
+		buf = buf[:n]
+		break
+	}
+
+	// The names are null-terminated, only the user namespace is visible
+	var names []string
+	for _, name := range strings.Split(string(buf), "\x00") {
+		if strings.HasPrefix(name, xattrPrefix) {
+			names = append(names, strings.TrimPrefix(name, xattrPrefix))
+		}
+	}
+	return names, nil
+}
+
+// xattrError maps the errors of the extended attribute calls
+func xattrError(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case syscall.ENODATA:
+		return ErrNotExist
+	case syscall.ENOTSUP:
+		return ErrNotSupported
+	default:
+		return osError(err)
+	}
+}
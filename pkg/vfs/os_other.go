@@ -0,0 +1,29 @@
+//go:build !linux
+// +build !linux
+
+package vfs
+
+import "os"
+
+// statSys leaves the times of a local file at its modification time, they are not portable
+func statSys(info *FileInfo, fi os.FileInfo) {}
+
+// getXattr fails, extended attributes are only supported on Linux
+func getXattr(path, name string) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// setXattr fails, extended attributes are only supported on Linux
+func setXattr(path, name string, value []byte) error {
+	return ErrNotSupported
+}
+
+// removeXattr fails, extended attributes are only supported on Linux
+func removeXattr(path, name string) error {
+	return ErrNotSupported
+}
+
+// listXattrs fails, extended attributes are only supported on Linux
+func listXattrs(path string) ([]string, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,118 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dispositionTests lists what each disposition does to an existing file holding data and to a missing file
+var dispositionTests = []struct {
+	name        string
+	disposition Disposition
+	exists      bool
+	action      Action
+	size        int64
+	err         error
+}{
+	{name: "supersede existing", disposition: DispositionSupersede, exists: true, action: ActionSuperseded},
+	{name: "supersede missing", disposition: DispositionSupersede, action: ActionCreated},
+	{name: "open existing", disposition: DispositionOpen, exists: true, action: ActionOpened, size: 4},
+	{name: "open missing", disposition: DispositionOpen, err: ErrNotExist},
+	{name: "create existing", disposition: DispositionCreate, exists: true, err: ErrExist},
+	{name: "create missing", disposition: DispositionCreate, action: ActionCreated},
+	{name: "open if existing", disposition: DispositionOpenIf, exists: true, action: ActionOpened, size: 4},
+	{name: "open if missing", disposition: DispositionOpenIf, action: ActionCreated},
+	{name: "overwrite existing", disposition: DispositionOverwrite, exists: true, action: ActionOverwritten},
+	{name: "overwrite missing", disposition: DispositionOverwrite, err: ErrNotExist},
+	{name: "overwrite if existing", disposition: DispositionOverwriteIf, exists: true, action: ActionOverwritten},
+	{name: "overwrite if missing", disposition: DispositionOverwriteIf, action: ActionCreated},
+}
+
+// testDispositions opens a file with each disposition on the storage created by newFS
+func testDispositions(t *testing.T, newFS func(t *testing.T) FS) {
+	for _, tt := range dispositionTests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := newFS(t)
+
+			// Create the existing file
+			if tt.exists {
+				f, _, err := fsys.Open("file.txt", OpenOptions{Disposition: DispositionCreate, Write: true})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.WriteAt([]byte("data"), 0); err != nil {
+					t.Fatal(err)
+				}
+				f.Close()
+			}
+
+			// Open the file with the disposition
+			f, action, err := fsys.Open("file.txt", OpenOptions{Disposition: tt.disposition, Write: true})
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("open error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if action != tt.action {
+				t.Errorf("action = %d, want %d", action, tt.action)
+			}
+			info, err := f.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size != tt.size {
+				t.Errorf("size = %d, want %d", info.Size, tt.size)
+			}
+		})
+	}
+}
+
+func TestOSFSDispositions(t *testing.T) {
+	testDispositions(t, func(t *testing.T) FS {
+		return NewOSFS(t.TempDir())
+	})
+}
+
+func TestOSFSDirectory(t *testing.T) {
+	fsys := NewOSFS(t.TempDir())
+
+	// Directories are created and opened as such only
+	d, action, err := fsys.Open("dir", OpenOptions{Disposition: DispositionCreate, Directory: true})
+	if err != nil || action != ActionCreated {
+		t.Fatalf("create directory: action %d, error %v", action, err)
+	}
+	d.Close()
+	if _, _, err := fsys.Open("dir", OpenOptions{Disposition: DispositionOpen, NonDirectory: true}); !errors.Is(err, ErrIsDir) {
+		t.Errorf("open directory as a file error = %v, want %v", err, ErrIsDir)
+	}
+	if _, _, err := fsys.Open("dir", OpenOptions{Disposition: DispositionOverwriteIf}); !errors.Is(err, ErrIsDir) {
+		t.Errorf("overwrite directory error = %v, want %v", err, ErrIsDir)
+	}
+}
+
+func TestOSFSLinkOutsideRoot(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skip(err)
+	}
+
+	// Links leading out of the root are refused
+	fsys := NewOSFS(root)
+	if _, err := fsys.Stat("link/secret"); !errors.Is(err, ErrPermission) {
+		t.Errorf("stat through the link error = %v, want %v", err, ErrPermission)
+	}
+	if _, _, err := fsys.Open("link/new", OpenOptions{Disposition: DispositionCreate}); !errors.Is(err, ErrPermission) {
+		t.Errorf("create through the link error = %v, want %v", err, ErrPermission)
+	}
+}
@@ -0,0 +1,204 @@
+// Package vfs defines the storage shares are served from. The SMB handlers only reach files through
+// an FS, so a share can be backed by the local filesystem, by memory or by any other storage.
+// Names are slash-separated paths relative to the root of the FS, as accepted by io/fs.ValidPath,
+// "." being the root itself.
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotExist is returned when a file or one of its parent directories does not exist
+	ErrNotExist = fs.ErrNotExist
+
+	// ErrExist is returned when a file that must be created already exists
+	ErrExist = fs.ErrExist
+
+	// ErrPermission is returned when the storage refuses an operation
+	ErrPermission = fs.ErrPermission
+
+	// ErrIsDir is returned when a directory is opened or used as a file
+	ErrIsDir = errors.New("vfs: is a directory")
+
+	// ErrNotDir is returned when a file is opened or used as a directory
+	ErrNotDir = errors.New("vfs: not a directory")
+
+	// ErrNotEmpty is returned when a directory that is not empty is removed or replaced
+	ErrNotEmpty = errors.New("vfs: directory not empty")
+
+	// ErrInvalidName is returned for a name that is not a valid path
+	ErrInvalidName = errors.New("vfs: invalid name")
+
+	// ErrNotSupported is returned for an operation the storage does not implement
+	ErrNotSupported = errors.New("vfs: operation not supported")
+
+	// ErrInvalidOffset is returned for a negative offset or size
+	ErrInvalidOffset = errors.New("vfs: invalid offset")
+
+	// ErrNoSpace is returned when a write would exceed the capacity of the storage
+	ErrNoSpace = errors.New("vfs: no space left")
+
+	// ErrLockConflict is returned when a byte range is locked by another open
+	ErrLockConflict = errors.New("vfs: byte range locked")
+
+	// ErrNotLocked is returned when unlocking a range that was not locked
+	ErrNotLocked = errors.New("vfs: byte range not locked")
+)
+
+// FS is the storage of a share. Implementations must be safe for concurrent use.
+type FS interface {
+	// Open opens or creates a file or directory according to the options
+	Open(name string, opts OpenOptions) (File, Action, error)
+
+	// Stat returns the information of a file or directory
+	Stat(name string) (*FileInfo, error)
+
+	// Rename moves a file or directory, an existing target is only replaced if replace is set
+	Rename(oldname, newname string, replace bool) error
+
+	// Remove removes a file or an empty directory
+	Remove(name string) error
+}
+
+// File is an open file or directory. Implementations must be safe for concurrent use.
+type File interface {
+	// Name returns the name the file was opened with
+	Name() string
+
+	// ReadAt reads from the file at an offset, it returns io.EOF at the end of the file
+	ReadAt(p []byte, off int64) (int, error)
+
+	// WriteAt writes to the file at an offset, extending it if needed
+	WriteAt(p []byte, off int64) (int, error)
+
+	// Stat returns the information of the file
+	Stat() (*FileInfo, error)
+
+	// Truncate changes the size of the file
+	Truncate(size int64) error
+
+	// Readdir returns the entries of a directory sorted by name
+	Readdir() ([]*FileInfo, error)
+
+	// SetTimes changes the access and modification times, a zero time is left unchanged
+	SetTimes(atime, mtime time.Time) error
+
+	// Sync commits the data of the file to stable storage
+	Sync() error
+
+	// GetXattr returns the value of an extended attribute, ErrNotExist if it is not set
+	GetXattr(name string) ([]byte, error)
+
+	// SetXattr sets the value of an extended attribute
+	SetXattr(name string, value []byte) error
+
+	// RemoveXattr removes an extended attribute
+	RemoveXattr(name string) error
+
+	// ListXattrs returns the names of the extended attributes
+	ListXattrs() ([]string, error)
+
+	// Close closes the file
+	Close() error
+}
+
+// FileInfo describes a file or directory
+type FileInfo struct {
+	// Name is the last element of the path, "." for the root
+	Name string
+	Size int64
+	Mode fs.FileMode
+
+	// Attributes holds the Windows attributes of the file, AttrNormal if it has none
+	Attributes Attributes
+
+	ModTime      time.Time
+	AccessTime   time.Time
+	ChangeTime   time.Time
+	CreationTime time.Time
+
+	// FileID identifies the file within the FS, Links counts its hard links
+	FileID uint64
+	Links  uint32
+}
+
+// IsDir reports whether the information describes a directory
+func (fi *FileInfo) IsDir() bool {
+	return fi.Mode.IsDir()
+}
+
+// AttributeFile is implemented by files whose attributes can be changed
+type AttributeFile interface {
+	File
+
+	// SetAttributes replaces the attributes that can be set, AttrDirectory and AttrNormal are ignored
+	SetAttributes(attrs Attributes) error
+}
+
+// LockFile is implemented by files keeping byte-range locks. A lock belongs to the File it was
+// taken on and is released when that File is closed. Reads and writes through other opens of
+// the file fail with ErrLockConflict on the ranges they cannot access.
+type LockFile interface {
+	File
+
+	// Lock locks a range, other opens can still read a range locked shared
+	Lock(off, length int64, exclusive bool) error
+
+	// Unlock releases the lock taken on exactly the range
+	Unlock(off, length int64) error
+
+	// CheckLock tells whether the open may read or write a range
+	CheckLock(off, length int64, write bool) error
+}
+
+// StreamInfo describes a data stream of a file, the unnamed main stream has an empty name
+type StreamInfo struct {
+	Name string
+	Size int64
+}
+
+// StreamFS is implemented by storage supporting alternate data streams
+type StreamFS interface {
+	FS
+
+	// OpenStream opens or creates a named stream of a file, a missing file is created with the stream
+	OpenStream(name, stream string, opts OpenOptions) (File, Action, error)
+
+	// Streams lists the streams of a file, the main stream of a regular file first
+	Streams(name string) ([]StreamInfo, error)
+
+	// RemoveStream removes a named stream of a file
+	RemoveStream(name, stream string) error
+}
+
+// RealPathFS is implemented by storage whose files can be reached through several FS values,
+// such as local directories shared more than once or nested in each other
+type RealPathFS interface {
+	FS
+
+	// RealPath returns the path of a file with its links resolved, a file has the same real path
+	// whichever FS it is reached through
+	RealPath(name string) (string, error)
+}
+
+// UsageFS is implemented by storage of limited size
+type UsageFS interface {
+	FS
+
+	// Usage returns the capacity of the storage and the free space, both zero if it is unlimited
+	Usage() (total, free int64)
+}
+
+// ValidName reports whether a name can be passed to an FS
+func ValidName(name string) bool {
+	return fs.ValidPath(name)
+}
+
+// ValidStreamName reports whether a stream name can be passed to a StreamFS
+func ValidStreamName(stream string) bool {
+	return stream != "" && !strings.ContainsAny(stream, "/\\:\x00")
+}
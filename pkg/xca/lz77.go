@@ -0,0 +1,199 @@
+package xca
+
+import "encoding/binary"
+
+// lz77MaxOffset is the farthest back a Plain LZ77 match can reach
+const lz77MaxOffset = 8192
+
+// CompressLZ77 compresses data with Plain LZ77 (MS-XCA, section 2.3). Every 32 literals or matches
+// are preceded by a 32-bit word of flags, matches hold their offset and the low bits of their length,
+// longer lengths continue in shared nibbles and following bytes.
+func CompressLZ77(src []byte) []byte {
+	out := make([]byte, 4, len(src)/2+8)
+	var flags uint32
+	flagCount := 0
+	flagPos := 0
+	lastHalfByte := 0
+	m := newMatcher(src)
+
+	for pos := 0; pos < len(src); {
+		offset, length := m.find(pos, lz77MaxOffset, len(src)-pos)
+		if length == 0 {
+			// Copy a literal
+			out = append(out, src[pos])
+			flags <<= 1
+			m.insert(pos)
+			pos++
+		} else {
+			// Encode the match
+			for i := 0; i < length; i++ {
+				m.insert(pos + i)
+			}
+			pos += length
+			matchLength := length - minMatch
+			token := uint16(offset-1) << 3
+			if matchLength < 7 {
+				out = appendUint16(out, token|uint16(matchLength))
+			} else {
+				out = appendUint16(out, token|7)
+				matchLength -= 7
+
+				// Two long matches share a byte for the next four bits of their lengths
+				nibble := matchLength
+				if nibble > 15 {
+					nibble = 15
+				}
+				if lastHalfByte == 0 {
+					lastHalfByte = len(out)
+					out = append(out, byte(nibble))
+				} else {
+					out[lastHalfByte] |= byte(nibble << 4)
+					lastHalfByte = 0
+				}
+
+				// Longer lengths follow in a byte, a 16-bit or a 32-bit word
+				if matchLength >= 15 {
+					matchLength -= 15
+					if matchLength < 255 {
+						out = append(out, byte(matchLength))
+					} else {
+						out = append(out, 255)
+						matchLength += 15 + 7
+						if matchLength < 1<<16 {
+							out = appendUint16(out, uint16(matchLength))
+						} else {
+							out = appendUint16(out, 0)
+							out = appendUint32(out, uint32(matchLength))
+						}
+					}
+				}
+			}
+			flags = flags<<1 | 1
+		}
+
+		// Start a new flag word once 32 flags were collected
+		flagCount++
+		if flagCount == 32 {
+			binary.LittleEndian.PutUint32(out[flagPos:], flags)
+			flagCount = 0
+			flagPos = len(out)
+			out = append(out, 0, 0, 0, 0)
+		}
+	}
+
+	// The unused flags are set, the decoder stops at a match past the end of the data
+	flags = flags<<uint(32-flagCount) | uint32(uint64(1)<<uint(32-flagCount)-1)
+	binary.LittleEndian.PutUint32(out[flagPos:], flags)
+	return out
+}
+
+// DecompressLZ77 decompresses Plain LZ77 data that decompresses to size bytes
+func DecompressLZ77(src []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	var flags uint32
+	flagCount := 0
+	lastHalfByte := 0
+	pos := 0
+
+	for {
+		// Read the next flag word
+		if flagCount == 0 {
+			if pos+4 > len(src) {
+				return nil, ErrCorrupt
+			}
+			flags = binary.LittleEndian.Uint32(src[pos:])
+			pos += 4
+			flagCount = 32
+		}
+		flagCount--
+
+		// Copy a literal
+		if flags&(1<<uint(flagCount)) == 0 {
+			if pos >= len(src) {
+				return nil, ErrCorrupt
+			}
+			out = append(out, src[pos])
+			pos++
+			if len(out) > size {
+				return nil, ErrCorrupt
+			}
+			continue
+		}
+
+		// A match past the end of the data ends it
+		if pos == len(src) {
+			break
+		}
+		if pos+2 > len(src) {
+			return nil, ErrCorrupt
+		}
+		token := binary.LittleEndian.Uint16(src[pos:])
+		pos += 2
+		length := int(token % 8)
+		offset := int(token/8) + 1
+
+		// Decode a long length
+		if length == 7 {
+			if lastHalfByte == 0 {
+				if pos >= len(src) {
+					return nil, ErrCorrupt
+				}
+				length = int(src[pos] % 16)
+				lastHalfByte = pos
+				pos++
+			} else {
+				length = int(src[lastHalfByte] / 16)
+				lastHalfByte = 0
+			}
+			if length == 15 {
+				if pos >= len(src) {
+					return nil, ErrCorrupt
+				}
+				length = int(src[pos])
+				pos++
+				if length == 255 {
+					if pos+2 > len(src) {
+						return nil, ErrCorrupt
+					}
+					length = int(binary.LittleEndian.Uint16(src[pos:]))
+					pos += 2
+					if length == 0 {
+						if pos+4 > len(src) {
+							return nil, ErrCorrupt
+						}
+						length = int(binary.LittleEndian.Uint32(src[pos:]))
+						pos += 4
+					}
+					if length < 15+7 {
+						return nil, ErrCorrupt
+					}
+					length -= 15 + 7
+				}
+				length += 15
+			}
+			length += 7
+		}
+		length += minMatch
+
+		// Copy the match
+		if offset > len(out) || length > size-len(out) {
+			return nil, ErrCorrupt
+		}
+		out = copyMatch(out, offset, length)
+	}
+
+	if len(out) != size {
+		return nil, ErrCorrupt
+	}
+	return out, nil
+}
+
+// appendUint16 appends a little-endian 16-bit word
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+// appendUint32 appends a little-endian 32-bit word
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
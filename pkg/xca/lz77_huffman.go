@@ -0,0 +1,408 @@
+package xca
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// huffmanBlockSize is the amount of data coded with the same Huffman table
+	huffmanBlockSize = 65536
+
+	// huffmanSymbols counts the 256 literals and the 256 match symbols
+	huffmanSymbols = 512
+
+	// huffmanTableSize is the size of the table of 4-bit code lengths preceding every block
+	huffmanTableSize = huffmanSymbols / 2
+
+	// huffmanMaxBits is the longest code
+	huffmanMaxBits = 15
+
+	// huffmanMaxOffset is the farthest back a match can reach
+	huffmanMaxOffset = 65535
+
+	// huffmanEOF is the symbol ending the data, a match of 3 bytes at offset 1 when followed by more data
+	huffmanEOF = 256
+)
+
+// lzToken is a literal or, if length is set, a match found in the data
+type lzToken struct {
+	literal byte
+	length  int
+	offset  int
+}
+
+// symbol returns the Huffman symbol of a token, matches combine the bit length of
+// their offset and the low bits of their length
+func (t lzToken) symbol() int {
+	if t.length == 0 {
+		return int(t.literal)
+	}
+	length := t.length - minMatch
+	if length > 15 {
+		length = 15
+	}
+	return huffmanEOF + (bits.Len(uint(t.offset))-1)<<4 + length
+}
+
+// CompressLZ77Huffman compresses data with LZ77+Huffman (MS-XCA, section 2.1). Every 64 KiB of data
+// are coded with their own canonical Huffman code, whose code lengths precede the block.
+func CompressLZ77Huffman(src []byte) []byte {
+	m := newMatcher(src)
+	var out []byte
+	for start := 0; start == 0 || start < len(src); start += huffmanBlockSize {
+		end := start + huffmanBlockSize
+		if end > len(src) {
+			end = len(src)
+		}
+		last := end == len(src)
+
+		// Find the matches of the block, they do not cross its end
+		var tokens []lzToken
+		for pos := start; pos < end; {
+			offset, length := m.find(pos, huffmanMaxOffset, end-pos)
+			if length == 0 {
+				tokens = append(tokens, lzToken{literal: src[pos]})
+				m.insert(pos)
+				pos++
+				continue
+			}
+			tokens = append(tokens, lzToken{length: length, offset: offset})
+			for i := 0; i < length; i++ {
+				m.insert(pos + i)
+			}
+			pos += length
+		}
+
+		// Build the code, the end of data symbol always has a code so that there are at least two
+		var freqs [huffmanSymbols]int
+		for _, t := range tokens {
+			freqs[t.symbol()]++
+		}
+		freqs[huffmanEOF]++
+		lengths := huffmanLengths(freqs)
+		codes := huffmanCodes(&lengths)
+
+		// Write the table of code lengths, two per byte with the lower symbol in the low nibble
+		for i := 0; i < huffmanSymbols; i += 2 {
+			out = append(out, lengths[i]|lengths[i+1]<<4)
+		}
+
+		// Write the tokens
+		w := &bitWriter{out: out}
+		w.start()
+		for _, t := range tokens {
+			sym := t.symbol()
+			w.write(codes[sym], uint(lengths[sym]))
+			if t.length == 0 {
+				continue
+			}
+
+			// Lengths that do not fit the symbol follow in a byte or a 16-bit word
+			length := t.length - minMatch
+			if length >= 15 {
+				if length-15 < 255 {
+					w.out = append(w.out, byte(length-15))
+				} else {
+					w.out = append(w.out, 255)
+					w.out = appendUint16(w.out, uint16(length))
+				}
+			}
+
+			// The offset follows without its top bit
+			offsetBits := uint(bits.Len(uint(t.offset)) - 1)
+			w.write(uint32(t.offset)&(1<<offsetBits-1), offsetBits)
+		}
+		if last {
+			w.write(codes[huffmanEOF], uint(lengths[huffmanEOF]))
+		}
+		out = w.out
+	}
+	return out
+}
+
+// bitWriter writes the bit stream of a block into 16-bit little-endian words. The words are placed
+// in the output where the decoder reads them, so bytes written between them stay in order.
+type bitWriter struct {
+	out []byte
+
+	// words holds the positions of the words of the bit stream in out, bits counts the bits written
+	words []int
+	bits  int
+}
+
+// start begins the bit stream of a block, the decoder reads two words ahead
+func (w *bitWriter) start() {
+	w.words = nil
+	w.bits = 0
+	w.reserve()
+	w.reserve()
+}
+
+// reserve places the next word of the bit stream at the end of the output
+func (w *bitWriter) reserve() {
+	w.words = append(w.words, len(w.out))
+	w.out = append(w.out, 0, 0)
+}
+
+// write writes the n low bits of value, most significant bit first
+func (w *bitWriter) write(value uint32, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		if value>>uint(i)&1 != 0 {
+			p := w.words[w.bits/16]
+			word := binary.LittleEndian.Uint16(w.out[p:]) | 1<<uint(15-w.bits%16)
+			binary.LittleEndian.PutUint16(w.out[p:], word)
+		}
+		w.bits++
+	}
+
+	// The decoder reads the next word once fewer than 16 bits are left
+	for w.bits > 16*(len(w.words)-1) {
+		w.reserve()
+	}
+}
+
+// huffmanLengths computes the code lengths of a Huffman code limited to huffmanMaxBits,
+// frequencies are halved until the longest code fits
+func huffmanLengths(freqs [huffmanSymbols]int) [huffmanSymbols]uint8 {
+	for {
+		lengths, longest := huffmanTree(&freqs)
+		if longest <= huffmanMaxBits {
+			return lengths
+		}
+		for i := range freqs {
+			if freqs[i] > 0 {
+				freqs[i] = (freqs[i] + 1) / 2
+			}
+		}
+	}
+}
+
+// huffmanTree builds a Huffman tree over the symbols that occur and returns the depth of every symbol
+func huffmanTree(freqs *[huffmanSymbols]int) ([huffmanSymbols]uint8, int) {
+	var lengths [huffmanSymbols]uint8
+
+	// Sort the leaves by frequency
+	var symbols []int
+	for sym, f := range freqs {
+		if f > 0 {
+			symbols = append(symbols, sym)
+		}
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return freqs[symbols[i]] < freqs[symbols[j]]
+	})
+	if len(symbols) == 1 {
+		lengths[symbols[0]] = 1
+		return lengths, 1
+	}
+
+	// Merge the two lightest nodes until one is left, internal nodes are created in order of weight
+	// so the leaves and the internal nodes form two sorted queues
+	n := len(symbols)
+	weight := make([]int, n, 2*n-1)
+	parent := make([]int, 2*n-1)
+	for i, sym := range symbols {
+		weight[i] = freqs[sym]
+	}
+	leaf, internal := 0, n
+	lightest := func() int {
+		if leaf < n && (internal >= len(weight) || weight[leaf] <= weight[internal]) {
+			leaf++
+			return leaf - 1
+		}
+		internal++
+		return internal - 1
+	}
+	for len(weight) < 2*n-1 {
+		a, b := lightest(), lightest()
+		parent[a] = len(weight)
+		parent[b] = len(weight)
+		weight = append(weight, weight[a]+weight[b])
+	}
+
+	// The depth of a node is one more than the depth of its parent, the root is the last node
+	depth := make([]int, 2*n-1)
+	longest := 0
+	for i := 2*n - 3; i >= 0; i-- {
+		depth[i] = depth[parent[i]] + 1
+	}
+	for i, sym := range symbols {
+		lengths[sym] = uint8(depth[i])
+		if depth[i] > longest {
+			longest = depth[i]
+		}
+	}
+	return lengths, longest
+}
+
+// huffmanCodes assigns the canonical codes of the code lengths, shorter codes first and
+// codes of the same length in symbol order
+func huffmanCodes(lengths *[huffmanSymbols]uint8) [huffmanSymbols]uint32 {
+	var codes [huffmanSymbols]uint32
+	code := uint32(0)
+	for l := uint8(1); l <= huffmanMaxBits; l++ {
+		for sym := range lengths {
+			if lengths[sym] == l {
+				codes[sym] = code >> (huffmanMaxBits - l)
+				code += 1 << (huffmanMaxBits - l)
+			}
+		}
+	}
+	return codes
+}
+
+// huffmanDecodeTable maps every 15-bit prefix of the bit stream to the symbol whose code it starts with,
+// prefixes starting no code map to huffmanSymbols
+func huffmanDecodeTable(lengths *[huffmanSymbols]uint8) ([]uint16, error) {
+	table := make([]uint16, 1<<huffmanMaxBits)
+	for i := range table {
+		table[i] = huffmanSymbols
+	}
+	code := 0
+	for l := uint8(1); l <= huffmanMaxBits; l++ {
+		for sym := range lengths {
+			if lengths[sym] != l {
+				continue
+			}
+			n := 1 << (huffmanMaxBits - l)
+			if code+n > len(table) {
+				return nil, ErrCorrupt
+			}
+			for i := code; i < code+n; i++ {
+				table[i] = uint16(sym)
+			}
+			code += n
+		}
+	}
+	return table, nil
+}
+
+// bitReader reads the bit stream of a block, mirroring bitWriter
+type bitReader struct {
+	src []byte
+	pos int
+
+	// next holds the bits read ahead, extra counts those beyond the first 16
+	next  uint32
+	extra int
+}
+
+// start begins the bit stream of a block
+func (r *bitReader) start() {
+	r.next = uint32(r.word())<<16 | uint32(r.word())
+	r.extra = 16
+}
+
+// word reads the next 16-bit word, missing input reads as zeros
+func (r *bitReader) word() uint16 {
+	if r.pos+2 > len(r.src) {
+		r.pos += 2
+		return 0
+	}
+	v := binary.LittleEndian.Uint16(r.src[r.pos:])
+	r.pos += 2
+	return v
+}
+
+// peek returns the next n bits without consuming them
+func (r *bitReader) peek(n uint) uint32 {
+	if n == 0 {
+		return 0
+	}
+	return r.next >> (32 - n)
+}
+
+// consume drops n bits and reads another word once fewer than 16 are left
+func (r *bitReader) consume(n uint) {
+	r.next <<= n
+	r.extra -= int(n)
+	if r.extra < 0 {
+		r.next |= uint32(r.word()) << uint(-r.extra)
+		r.extra += 16
+	}
+}
+
+// DecompressLZ77Huffman decompresses LZ77+Huffman data that decompresses to size bytes
+func DecompressLZ77Huffman(src []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	r := &bitReader{src: src}
+	for len(out) < size {
+		// Read the code lengths of the block
+		if r.pos+huffmanTableSize > len(src) {
+			return nil, ErrCorrupt
+		}
+		var lengths [huffmanSymbols]uint8
+		for i, b := range src[r.pos : r.pos+huffmanTableSize] {
+			lengths[2*i] = b & 0x0F
+			lengths[2*i+1] = b >> 4
+		}
+		r.pos += huffmanTableSize
+		table, err := huffmanDecodeTable(&lengths)
+		if err != nil {
+			return nil, err
+		}
+
+		// Decode the block
+		r.start()
+		blockEnd := len(out) + huffmanBlockSize
+		for len(out) < blockEnd && len(out) < size {
+			if r.pos > len(src)+4 {
+				return nil, ErrCorrupt
+			}
+			sym := table[r.peek(huffmanMaxBits)]
+			if sym == huffmanSymbols {
+				return nil, ErrCorrupt
+			}
+			r.consume(uint(lengths[sym]))
+
+			// Copy a literal
+			if sym < huffmanEOF {
+				out = append(out, byte(sym))
+				continue
+			}
+
+			// Decode the length of a match
+			sym -= huffmanEOF
+			length := int(sym % 16)
+			offsetBits := uint(sym / 16)
+			if length == 15 {
+				if r.pos >= len(src) {
+					return nil, ErrCorrupt
+				}
+				length = int(src[r.pos])
+				r.pos++
+				if length == 255 {
+					if r.pos+2 > len(src) {
+						return nil, ErrCorrupt
+					}
+					length = int(binary.LittleEndian.Uint16(src[r.pos:]))
+					r.pos += 2
+					if length == 0 {
+						if r.pos+4 > len(src) {
+							return nil, ErrCorrupt
+						}
+						length = int(binary.LittleEndian.Uint32(src[r.pos:]))
+						r.pos += 4
+					}
+					if length < 15 {
+						return nil, ErrCorrupt
+					}
+					length -= 15
+				}
+				length += 15
+			}
+			length += minMatch
+
+			// Decode the offset and copy the match
+			offset := int(r.peek(offsetBits)) + 1<<offsetBits
+			r.consume(offsetBits)
+			if offset > len(out) || length > size-len(out) {
+				return nil, ErrCorrupt
+			}
+			out = copyMatch(out, offset, length)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,158 @@
+package xca
+
+import "encoding/binary"
+
+const (
+	// lznt1ChunkSize is the size of the chunks LZNT1 compresses independently
+	lznt1ChunkSize = 4096
+
+	// lznt1Signature is set in bits 12 to 14 of every chunk header
+	lznt1Signature = 0x3000
+
+	// lznt1Compressed marks a compressed chunk in its header
+	lznt1Compressed = 0x8000
+)
+
+// CompressLZNT1 compresses data with LZNT1 (MS-XCA, section 2.5).
+// Chunks that do not shrink are stored uncompressed.
+func CompressLZNT1(src []byte) []byte {
+	var out []byte
+	for start := 0; start < len(src); start += lznt1ChunkSize {
+		end := start + lznt1ChunkSize
+		if end > len(src) {
+			end = len(src)
+		}
+		chunk := src[start:end]
+
+		// The header holds the size of the chunk with its header minus 3
+		data := lznt1CompressChunk(chunk)
+		header := uint16(lznt1Signature | lznt1Compressed)
+		if len(data) >= len(chunk) {
+			data = chunk
+			header = lznt1Signature
+		}
+		header |= uint16(len(data) + 2 - 3)
+		out = append(out, byte(header), byte(header>>8))
+		out = append(out, data...)
+	}
+	return out
+}
+
+// lznt1CompressChunk compresses a chunk into groups of eight literals or copy tokens, each preceded by a flag byte
+func lznt1CompressChunk(chunk []byte) []byte {
+	m := newMatcher(chunk)
+	var out []byte
+	for pos := 0; pos < len(chunk); {
+		flagPos := len(out)
+		out = append(out, 0)
+		for bit := uint(0); bit < 8 && pos < len(chunk); bit++ {
+			// The split of a copy token between offset and length depends on the position in the chunk
+			var offset, length int
+			if pos > 0 {
+				shift := lznt1Shift(pos)
+				offset, length = m.find(pos, 1<<(16-shift), 1<<shift-1+minMatch)
+			}
+			if length == 0 {
+				out = append(out, chunk[pos])
+				m.insert(pos)
+				pos++
+				continue
+			}
+
+			token := uint16(offset-1)<<lznt1Shift(pos) | uint16(length-minMatch)
+			out = append(out, byte(token), byte(token>>8))
+			out[flagPos] |= 1 << bit
+			for i := 0; i < length; i++ {
+				m.insert(pos + i)
+			}
+			pos += length
+		}
+	}
+	return out
+}
+
+// DecompressLZNT1 decompresses LZNT1 data that decompresses to size bytes
+func DecompressLZNT1(src []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for len(src) >= 2 {
+		// A zero header ends the data
+		header := binary.LittleEndian.Uint16(src)
+		if header == 0 {
+			break
+		}
+		n := int(header&0x0FFF) + 3
+		if header&0x7000 != lznt1Signature || n > len(src) {
+			return nil, ErrCorrupt
+		}
+		data := src[2:n]
+		src = src[n:]
+
+		// A chunk that decompressed to less than a full chunk is padded with zeros
+		if pad := len(out) % lznt1ChunkSize; pad != 0 {
+			out = append(out, make([]byte, lznt1ChunkSize-pad)...)
+		}
+
+		// Decompress the chunk
+		if header&lznt1Compressed == 0 {
+			out = append(out, data...)
+		} else {
+			var err error
+			if out, err = lznt1DecompressChunk(out, data); err != nil {
+				return nil, err
+			}
+		}
+		if len(out) > size {
+			return nil, ErrCorrupt
+		}
+	}
+	if len(out) != size {
+		return nil, ErrCorrupt
+	}
+	return out, nil
+}
+
+// lznt1DecompressChunk appends a decompressed chunk to out
+func lznt1DecompressChunk(out []byte, data []byte) ([]byte, error) {
+	start := len(out)
+	for i := 0; i < len(data); {
+		flags := data[i]
+		i++
+		for bit := uint(0); bit < 8 && i < len(data); bit++ {
+			// Copy a literal
+			if flags&(1<<bit) == 0 {
+				out = append(out, data[i])
+				i++
+				continue
+			}
+
+			// Copy a match, it cannot reach before the chunk or past its end
+			if i+2 > len(data) {
+				return nil, ErrCorrupt
+			}
+			token := binary.LittleEndian.Uint16(data[i:])
+			i += 2
+			pos := len(out) - start
+			if pos == 0 {
+				return nil, ErrCorrupt
+			}
+			shift := lznt1Shift(pos)
+			offset := int(token>>shift) + 1
+			length := int(token&(1<<shift-1)) + minMatch
+			if offset > pos || pos+length > lznt1ChunkSize {
+				return nil, ErrCorrupt
+			}
+			out = copyMatch(out, offset, length)
+		}
+	}
+	return out, nil
+}
+
+// lznt1Shift returns the number of length bits of a copy token at a position in a chunk,
+// offsets get more bits as the position grows
+func lznt1Shift(pos int) uint {
+	shift := uint(12)
+	for i := pos - 1; i >= 0x10; i >>= 1 {
+		shift--
+	}
+	return shift
+}
@@ -0,0 +1,98 @@
+// Package xca implements the compression algorithms of MS-XCA used by SMB 3.1.1 compression:
+// LZNT1, Plain LZ77 and LZ77+Huffman. The decompressors are given the size of the original data,
+// which SMB always transmits, and fail on input that does not decompress to exactly that size.
+package xca
+
+import "errors"
+
+// ErrCorrupt is returned for compressed data that cannot be decompressed
+var ErrCorrupt = errors.New("xca: corrupt compressed data")
+
+const (
+	// minMatch is the shortest match the algorithms can encode
+	minMatch = 3
+
+	// hashBits is the size of the hash table of the match finder
+	hashBits = 15
+
+	// maxChain bounds the candidates the match finder tries at a position, trading ratio for speed
+	maxChain = 32
+)
+
+// matcher finds earlier occurrences of the bytes at a position, with hash chains over 3-byte prefixes.
+// Positions must be inserted in order, after the match at the position has been looked up.
+type matcher struct {
+	data []byte
+	head []int32
+	prev []int32
+}
+
+// newMatcher creates a match finder over data
+func newMatcher(data []byte) *matcher {
+	m := &matcher{
+		data: data,
+		head: make([]int32, 1<<hashBits),
+		prev: make([]int32, len(data)),
+	}
+	for i := range m.head {
+		m.head[i] = -1
+	}
+	return m
+}
+
+// hash returns the hash chain of the 3-byte prefix at pos
+func (m *matcher) hash(pos int) int {
+	v := uint32(m.data[pos]) | uint32(m.data[pos+1])<<8 | uint32(m.data[pos+2])<<16
+	return int((v * 2654435761) >> (32 - hashBits))
+}
+
+// insert adds a position to the hash chains
+func (m *matcher) insert(pos int) {
+	if pos+minMatch > len(m.data) {
+		return
+	}
+	h := m.hash(pos)
+	m.prev[pos] = m.head[h]
+	m.head[h] = int32(pos)
+}
+
+// find returns the longest earlier match of the bytes at pos, at most window bytes back and maxLen long.
+// The length is 0 if there is no match of at least minMatch bytes.
+func (m *matcher) find(pos int, window int, maxLen int) (offset int, length int) {
+	if maxLen > len(m.data)-pos {
+		maxLen = len(m.data) - pos
+	}
+	if maxLen < minMatch {
+		return 0, 0
+	}
+
+	// Walk the chain from the closest candidate
+	for cand, n := m.head[m.hash(pos)], 0; cand >= 0 && n < maxChain; cand, n = m.prev[cand], n+1 {
+		off := pos - int(cand)
+		if off > window {
+			break
+		}
+		l := 0
+		for l < maxLen && m.data[int(cand)+l] == m.data[pos+l] {
+			l++
+		}
+		if l > length {
+			offset, length = off, l
+			if l == maxLen {
+				break
+			}
+		}
+	}
+	if length < minMatch {
+		return 0, 0
+	}
+	return offset, length
+}
+
+// copyMatch appends length bytes copied from offset bytes back, the source may overlap the copy
+func copyMatch(out []byte, offset int, length int) []byte {
+	for i := 0; i < length; i++ {
+		out = append(out, out[len(out)-offset])
+	}
+	return out
+}